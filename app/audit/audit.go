@@ -0,0 +1,233 @@
+// Package audit keeps an append-only, hash-chained log of privileged actions.
+// Each entry records the SHA-256 hash of the previous one, so changing,
+// inserting or removing entries breaks the chain and is found by Verify.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GenesisHash is the previous hash of the first entry
+var GenesisHash = strings.Repeat("0", 64)
+
+// Outcomes of an action
+const (
+	OutcomeSuccess   = "success"
+	OutcomeFailure   = "failure"
+	OutcomeDenied    = "denied" // the actor lacked the role or CSRF token
+	OutcomeCancelled = "cancelled"
+)
+
+// maxLineSize bounds an entry when reading the log
+const maxLineSize = 4 * 1024 * 1024
+
+// Entry is one recorded action
+type Entry struct {
+	Seq        uint64                 `json:"seq"`
+	Time       time.Time              `json:"time"`
+	Actor      string                 `json:"actor"`                // user name, or "system"
+	AuthMethod string                 `json:"authMethod,omitempty"` // session or token
+	TokenID    string                 `json:"tokenId,omitempty"`
+	SourceIP   string                 `json:"sourceIp,omitempty"`
+	Action     string                 `json:"action"` // e.g. "POST /api/plugins/manage/install"
+	Target     string                 `json:"target,omitempty"`
+	Params     map[string]interface{} `json:"params,omitempty"` // with secrets redacted
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Outcome    string                 `json:"outcome"`
+	Status     int                    `json:"status,omitempty"` // HTTP status
+	Error      string                 `json:"error,omitempty"`
+	PrevHash   string                 `json:"prevHash"`
+	Hash       string                 `json:"hash"`
+}
+
+// computeHash returns the SHA-256 of the entry's JSON without its own hash.
+// The previous hash is part of that JSON, which chains the entries.
+func (e Entry) computeHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log appends entries to a JSON lines file that is only ever opened for appending
+type Log struct {
+	path string
+	file *os.File
+	seq  uint64
+	head string
+	mu   sync.Mutex
+}
+
+// Open opens the log at path, creating it if needed, and continues the chain
+// from its last entry
+func Open(path string) (*Log, error) {
+	l := &Log{path: path, head: GenesisHash}
+	err := readEntries(path, func(_ int, entry Entry, err error) bool {
+		if err == nil {
+			l.seq, l.head = entry.Seq, entry.Hash
+		}
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	l.file = file
+	return l, nil
+}
+
+// Append redacts the entry's target and parameters, chains it to the previous entry and
+// writes it to disk before returning
+func (l *Log) Append(entry Entry) (Entry, error) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+	entry.Target = redactString(entry.Target)
+	entry.Params = normalize(Redact(entry.Params))
+	entry.Details = normalize(Redact(entry.Details))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.Seq = l.seq + 1
+	entry.PrevHash = l.head
+	entry.Hash = entry.computeHash()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to marshal audit entry: %v", err)
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return Entry{}, fmt.Errorf("failed to write audit entry: %v", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return Entry{}, fmt.Errorf("failed to sync audit log: %v", err)
+	}
+	l.seq, l.head = entry.Seq, entry.Hash
+	return entry, nil
+}
+
+// Head returns the sequence number and hash of the last entry. Recording
+// them elsewhere lets Verify's result be checked for removed trailing entries.
+func (l *Log) Head() (uint64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.head
+}
+
+// Path returns the file the log is written to
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Filter selects entries in Query. Empty fields match everything.
+type Filter struct {
+	Actor   string    // exact user name
+	Action  string    // substring of the action, case-insensitive
+	Target  string    // substring of the target, case-insensitive
+	Outcome string    // exact outcome
+	Since   time.Time // inclusive
+	Until   time.Time // exclusive
+	Limit   int       // most recent entries returned; 0 means 100
+}
+
+// matches reports whether an entry passes the filter
+func (f Filter) matches(e Entry) bool {
+	return (f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Action == "" || strings.Contains(strings.ToLower(e.Action), strings.ToLower(f.Action))) &&
+		(f.Target == "" || strings.Contains(strings.ToLower(e.Target), strings.ToLower(f.Target))) &&
+		(f.Outcome == "" || e.Outcome == f.Outcome) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// Query returns the most recent entries matching filter, newest first
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	var matched []Entry
+	err := readEntries(l.path, func(_ int, entry Entry, err error) bool {
+		if err == nil && filter.matches(entry) {
+			matched = append(matched, entry)
+			if len(matched) > filter.Limit {
+				matched = matched[1:]
+			}
+		}
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched, nil
+}
+
+// readEntries calls fn with each line number (from 1) and its parsed entry
+// or parse error until fn returns false
+func readEntries(path string, fn func(line int, entry Entry, err error) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var entry Entry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if !fn(line, entry, err) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %v", err)
+	}
+	return nil
+}
+
+// normalize gives values the types they have after a JSON round trip, so the
+// hash of an entry read back from the file matches the one written
+func normalize(values map[string]interface{}) map[string]interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return map[string]interface{}{"unencodable": err.Error()}
+	}
+	var normalized map[string]interface{}
+	json.Unmarshal(data, &normalized)
+	return normalized
+}
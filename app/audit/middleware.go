@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/NetScout-Go/NetTool/app/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// detailsKey is the Gin context key of details handlers add with Note
+const detailsKey = "audit.details"
+
+// Limits on what is read from requests and responses
+const (
+	maxRecordedBody   = 1024 * 1024
+	maxCapturedOutput = 64 * 1024
+)
+
+// targetKeys name the path and body parameters that identify an action's
+// target, in order of preference
+var targetKeys = []string{"id", "pluginId", "name", "username", "repository", "path"}
+
+// Middleware records every request it handles once the handler is done: the
+// actor and source IP, the method and route as action, the target, the path,
+// query and JSON body parameters with secrets redacted, uploaded file names
+// and sizes, and the outcome from the response status. Place it before role
+// checks so denied attempts are recorded too.
+func (l *Log) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params := requestParams(c)
+		capture := &responseCapture{ResponseWriter: c.Writer}
+		c.Writer = capture
+
+		c.Next()
+
+		if form := c.Request.MultipartForm; form != nil {
+			var files []interface{}
+			for field, headers := range form.File {
+				for _, header := range headers {
+					files = append(files, map[string]interface{}{"field": field, "filename": header.Filename, "size": header.Size})
+				}
+			}
+			for field, values := range form.Value {
+				params[field] = strings.Join(values, ",")
+			}
+			if len(files) > 0 {
+				params["files"] = files
+			}
+		}
+
+		entry := Entry{
+			Actor:    "anonymous",
+			SourceIP: c.RemoteIP(),
+			Action:   c.Request.Method + " " + c.FullPath(),
+			Target:   target(c, params),
+			Params:   params,
+			Status:   capture.Status(),
+		}
+		if forwarded := c.GetHeader("X-Forwarded-For"); forwarded != "" {
+			entry.Details = map[string]interface{}{"forwardedFor": forwarded}
+		}
+		if p := auth.CurrentPrincipal(c); p != nil {
+			entry.Actor, entry.AuthMethod, entry.TokenID = p.Username, p.Method, p.TokenID
+		}
+		if details, ok := c.Get(detailsKey); ok {
+			if entry.Details == nil {
+				entry.Details = make(map[string]interface{})
+			}
+			for key, value := range details.(map[string]interface{}) {
+				entry.Details[key] = value
+			}
+		}
+
+		switch status := capture.Status(); {
+		case status < http.StatusBadRequest:
+			entry.Outcome = OutcomeSuccess
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			entry.Outcome = OutcomeDenied
+			entry.Error = capture.errorMessage()
+		default:
+			entry.Outcome = OutcomeFailure
+			entry.Error = capture.errorMessage()
+		}
+
+		if _, err := l.Append(entry); err != nil {
+			log.Printf("Failed to record audit entry for %s: %v", entry.Action, err)
+		}
+	}
+}
+
+// Note adds a detail to the audit entry of the current request, such as the
+// ID of a job it started
+func Note(c *gin.Context, key string, value interface{}) {
+	details, ok := c.Get(detailsKey)
+	if !ok {
+		details = make(map[string]interface{})
+		c.Set(detailsKey, details)
+	}
+	details.(map[string]interface{})[key] = value
+}
+
+// requestParams collects the path and query parameters and the JSON body of
+// a request, leaving the body for the handler to read
+func requestParams(c *gin.Context) map[string]interface{} {
+	params := make(map[string]interface{})
+	for _, param := range c.Params {
+		params[param.Key] = param.Value
+	}
+	for key, values := range c.Request.URL.Query() {
+		params[key] = strings.Join(values, ",")
+	}
+
+	// Handlers bind JSON whatever the content type says, so any body but a
+	// multipart upload is read as JSON
+	if c.Request.Body == nil || c.Request.Body == http.NoBody || strings.HasPrefix(c.ContentType(), "multipart/") {
+		return params
+	}
+	body := c.Request.Body
+	data, err := io.ReadAll(io.LimitReader(body, maxRecordedBody+1))
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), body), body}
+	if err != nil || len(data) == 0 {
+		return params
+	}
+	if len(data) > maxRecordedBody {
+		params["body"] = "(too large to record)"
+		return params
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return params
+	}
+	if object, ok := decoded.(map[string]interface{}); ok {
+		for key, value := range object {
+			if _, exists := params[key]; !exists {
+				params[key] = value
+			}
+		}
+	} else {
+		params["body"] = decoded
+	}
+	return params
+}
+
+// target picks the parameter that names what an action concerns
+func target(c *gin.Context, params map[string]interface{}) string {
+	for _, key := range targetKeys {
+		if value := c.Param(key); value != "" {
+			return value
+		}
+	}
+	for _, key := range targetKeys {
+		if value, ok := params[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// responseCapture keeps the start of a response so a failure's error
+// message can be recorded
+type responseCapture struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *responseCapture) Write(b []byte) (int, error) {
+	if room := maxCapturedOutput - w.buf.Len(); room > 0 {
+		w.buf.Write(b[:min(len(b), room)])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseCapture) WriteString(s string) (int, error) {
+	if room := maxCapturedOutput - w.buf.Len(); room > 0 {
+		w.buf.WriteString(s[:min(len(s), room)])
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// errorMessage returns the error of a JSON error response, or the start of
+// any other response
+func (w *responseCapture) errorMessage() string {
+	var response struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(w.buf.Bytes(), &response) == nil && response.Error != "" {
+		return response.Error
+	}
+	text := strings.TrimSpace(w.buf.String())
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return text
+}
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces secret values in recorded parameters
+const Redacted = "[REDACTED]"
+
+// secretKeys are parts of parameter names whose values are never recorded
+var secretKeys = []string{
+	"password", "passwd", "passphrase", "secret", "token", "credential",
+	"apikey", "api_key", "authorization", "cookie", "privatekey", "private_key",
+	"psk", "community",
+}
+
+// secretPrefixes start values that are secrets whatever their parameter is called
+var secretPrefixes = []string{"ghp_", "gho_", "ghs_", "github_pat_", "nt_", "Bearer ", "Basic "}
+
+// Redact returns a copy of values with secrets replaced by Redacted: values
+// of parameters named like passwords, tokens or keys, values that look like
+// tokens, and passwords in URLs
+func Redact(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if secretKey(key) {
+			redacted[key] = Redacted
+			continue
+		}
+		redacted[key] = redactValue(value)
+	}
+	return redacted
+}
+
+// redactValue redacts secrets inside a parameter value
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return Redact(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	case []string:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	case string:
+		return redactString(v)
+	}
+	return value
+}
+
+// redactString hides token-like strings and URL passwords
+func redactString(s string) string {
+	for _, prefix := range secretPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return Redacted
+		}
+	}
+	if strings.Contains(s, "://") && strings.Contains(s, "@") {
+		if u, err := url.Parse(s); err == nil && u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				u.User = url.UserPassword(u.User.Username(), "REDACTED")
+				return u.String()
+			}
+		}
+	}
+	return s
+}
+
+// secretKey reports whether a parameter name suggests a secret value
+func secretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range secretKeys {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+)
+
+// Problem is a place where the chain is broken
+type Problem struct {
+	Line   int    `json:"line"`
+	Seq    uint64 `json:"seq,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// VerifyResult is the outcome of checking a log's chain
+type VerifyResult struct {
+	Entries  int       `json:"entries"`
+	LastSeq  uint64    `json:"lastSeq"`
+	Head     string    `json:"head"` // hash of the last entry
+	Valid    bool      `json:"valid"`
+	Problems []Problem `json:"problems,omitempty"`
+}
+
+// Verify checks that every entry's hash matches its content, that it names
+// the previous entry's hash and that sequence numbers have no gaps. After a
+// broken link it continues from the entry's recorded hash, so each tampered
+// place is reported once. Entries removed from the end cannot be detected
+// this way; compare LastSeq and Head with values recorded elsewhere.
+func Verify(path string) (VerifyResult, error) {
+	result := VerifyResult{Head: GenesisHash}
+	var lastSeq uint64
+	err := readEntries(path, func(line int, entry Entry, err error) bool {
+		if err != nil {
+			result.Problems = append(result.Problems, Problem{Line: line, Reason: fmt.Sprintf("unreadable entry: %v", err)})
+			return true
+		}
+		result.Entries++
+		if entry.Seq != lastSeq+1 {
+			result.Problems = append(result.Problems, Problem{Line: line, Seq: entry.Seq, Reason: fmt.Sprintf("sequence jumps from %d to %d", lastSeq, entry.Seq)})
+		}
+		if entry.PrevHash != result.Head {
+			result.Problems = append(result.Problems, Problem{Line: line, Seq: entry.Seq, Reason: "previous hash does not match the entry before it"})
+		}
+		if entry.computeHash() != entry.Hash {
+			result.Problems = append(result.Problems, Problem{Line: line, Seq: entry.Seq, Reason: "content does not match its hash"})
+		}
+		lastSeq, result.Head = entry.Seq, entry.Hash
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	result.LastSeq = lastSeq
+	result.Valid = len(result.Problems) == 0
+	return result, nil
+}
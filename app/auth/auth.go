@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookie and header names
+const (
+	SessionCookie = "nettool_session" // HttpOnly session ID
+	CSRFCookie    = "nettool_csrf"    // readable by the UI's scripts, which echo it in CSRFHeader
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// principalKey is the Gin context key of the authenticated principal
+const principalKey = "auth.principal"
+
+// Ways a principal authenticated
+const (
+	MethodSession     = "session"
+	MethodToken       = "token"
+	MethodCertificate = "certificate" // TLS client certificate naming the user
+)
+
+// Principal is the user behind a request
+type Principal struct {
+	Username  string `json:"username"`
+	Role      Role   `json:"role"`
+	Method    string `json:"method"`
+	TokenID   string `json:"tokenId,omitempty"`   // token requests
+	CSRFToken string `json:"csrfToken,omitempty"` // session requests
+	sessionID string
+}
+
+// Manager authenticates requests with session cookies or API tokens and
+// enforces roles on routes. While no users exist every protected route
+// points to the first-run setup, which needs the setup code from the log.
+type Manager struct {
+	Store      *Store
+	SessionTTL time.Duration
+
+	sessions  sessionStore
+	setupCode string
+	mu        sync.Mutex
+}
+
+// NewManager creates a manager for the users in store
+func NewManager(store *Store) (*Manager, error) {
+	m := &Manager{Store: store, SessionTTL: DefaultSessionTTL}
+	if !store.HasUsers() {
+		code, err := randomHex(8)
+		if err != nil {
+			return nil, err
+		}
+		m.setupCode = code
+	}
+	return m, nil
+}
+
+// SetupCode returns the code needed to create the first admin, or "" once
+// users exist
+func (m *Manager) SetupCode() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setupCode
+}
+
+// SetupRequired reports whether the first admin still has to be created
+func (m *Manager) SetupRequired() bool {
+	return !m.Store.HasUsers()
+}
+
+// Setup creates the first admin if code matches the setup code, and logs them in
+func (m *Manager) Setup(c *gin.Context, code string, username string, password string) (*Principal, error) {
+	m.mu.Lock()
+	expected := m.setupCode
+	m.mu.Unlock()
+	if expected == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(code)), []byte(expected)) != 1 {
+		return nil, fmt.Errorf("invalid setup code")
+	}
+	if err := m.Store.CreateFirstAdmin(username, password); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.setupCode = ""
+	m.mu.Unlock()
+	return m.Login(c, username, password)
+}
+
+// Login checks a user's password and starts a session, setting the session
+// and CSRF cookies
+func (m *Manager) Login(c *gin.Context, username string, password string) (*Principal, error) {
+	user, ok := m.Store.CheckPassword(username, password)
+	if !ok {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+	session, err := m.sessions.create(user.Username, m.SessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	setCookie(c, SessionCookie, session.ID, true)
+	setCookie(c, CSRFCookie, session.CSRFToken, false)
+	return &Principal{Username: user.Username, Role: user.Role, Method: MethodSession, CSRFToken: session.CSRFToken, sessionID: session.ID}, nil
+}
+
+// Logout ends the request's session and clears its cookies
+func (m *Manager) Logout(c *gin.Context) {
+	if id, err := c.Cookie(SessionCookie); err == nil {
+		m.sessions.delete(id)
+	}
+	clearCookie(c, SessionCookie, true)
+	clearCookie(c, CSRFCookie, false)
+}
+
+// EndSessions logs a user out everywhere except in the request's own session
+func (m *Manager) EndSessions(c *gin.Context, username string) {
+	keep := ""
+	if p := CurrentPrincipal(c); p != nil && p.Username == username {
+		keep = p.sessionID
+	}
+	m.sessions.deleteUser(username, keep)
+}
+
+// Authenticate identifies the principal of each request from its bearer
+// token, session cookie or verified TLS client certificate, whose common
+// name is the user name. It rejects invalid tokens and certificates of
+// unknown users but lets anonymous requests through; Require decides what
+// they may reach.
+func (m *Manager) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if header := c.GetHeader("Authorization"); header != "" {
+			scheme, bearer, _ := strings.Cut(header, " ")
+			token, user, ok := m.Store.CheckToken(strings.TrimSpace(bearer))
+			if !strings.EqualFold(scheme, "Bearer") || !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired API token"})
+				return
+			}
+			c.Set(principalKey, &Principal{Username: user.Username, Role: token.Role, Method: MethodToken, TokenID: token.ID})
+			c.Next()
+			return
+		}
+
+		if id, err := c.Cookie(SessionCookie); err == nil {
+			if session, ok := m.sessions.get(id, m.SessionTTL); ok {
+				if user, ok := m.Store.User(session.Username); ok {
+					c.Set(principalKey, &Principal{Username: user.Username, Role: user.Role, Method: MethodSession, CSRFToken: session.CSRFToken, sessionID: session.ID})
+				} else {
+					m.sessions.delete(id) // The user was deleted
+				}
+			}
+		}
+
+		// The TLS server only fills in verified chains for certificates from a
+		// trusted client CA
+		if _, ok := c.Get(principalKey); !ok && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			name := c.Request.TLS.VerifiedChains[0][0].Subject.CommonName
+			user, ok := m.Store.User(name)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("client certificate names unknown user %q", name)})
+				return
+			}
+			c.Set(principalKey, &Principal{Username: user.Username, Role: user.Role, Method: MethodCertificate})
+		}
+		c.Next()
+	}
+}
+
+// Require lets API requests through only for principals with at least role.
+// Requests authenticated by session cookie must also carry the session's
+// CSRF token in the X-CSRF-Token header unless they are GET, HEAD or OPTIONS.
+// Browsers present client certificates to any site that asks, so requests
+// authenticated by certificate that change state must not come from another
+// site's page.
+func (m *Manager) Require(role Role) gin.HandlerFunc {
+	return m.require(role, false)
+}
+
+// RequirePage is Require for HTML pages: anonymous visitors are sent to the
+// login page, or to setup while no users exist
+func (m *Manager) RequirePage(role Role) gin.HandlerFunc {
+	return m.require(role, true)
+}
+
+// require builds the role check for API routes or pages
+func (m *Manager) require(role Role, page bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.SetupRequired() {
+			if page {
+				c.Redirect(http.StatusFound, "/setup")
+			} else {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "no users exist yet; create the first admin at /setup", "setupRequired": true})
+			}
+			c.Abort()
+			return
+		}
+
+		p := CurrentPrincipal(c)
+		if p == nil {
+			if page {
+				c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+			} else {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			}
+			c.Abort()
+			return
+		}
+		if !p.Role.Allows(role) {
+			message := fmt.Sprintf("this requires the %s role; %s is %s", role, p.Username, p.Role)
+			if page {
+				c.HTML(http.StatusForbidden, "error.html", gin.H{"title": "Forbidden", "error": message})
+			} else {
+				c.JSON(http.StatusForbidden, gin.H{"error": message})
+			}
+			c.Abort()
+			return
+		}
+		if p.Method == MethodSession && !safeMethod(c.Request.Method) {
+			sent := c.GetHeader(CSRFHeader)
+			if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(p.CSRFToken)) != 1 {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing or invalid CSRF token"})
+				return
+			}
+		}
+		if p.Method == MethodCertificate && !safeMethod(c.Request.Method) && crossSite(c.Request) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "cross-site request with a client certificate"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentPrincipal returns the authenticated principal of a request, or nil
+func CurrentPrincipal(c *gin.Context) *Principal {
+	if value, ok := c.Get(principalKey); ok {
+		return value.(*Principal)
+	}
+	return nil
+}
+
+// safeMethod reports whether an HTTP method does not change state
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// crossSite reports whether a browser sent the request from another site's
+// page. Scripts and command line clients send neither header.
+func crossSite(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return true
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return err != nil || !strings.EqualFold(u.Host, r.Host)
+	}
+	return false
+}
+
+// setCookie sets a strict same-site cookie for the whole site, marked secure
+// when the request came over TLS
+func setCookie(c *gin.Context, name string, value string, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: httpOnly,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// clearCookie removes a cookie set by setCookie
+func clearCookie(c *gin.Context, name string, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: httpOnly,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -0,0 +1,395 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testPassword is the password of every test user
+const testPassword = "correct horse battery"
+
+// testServer is a manager in front of routes for each role, like main.go's API
+type testServer struct {
+	manager *Manager
+	router  *gin.Engine
+}
+
+// newTestServer creates an empty store and a router with a route per role,
+// plus the login and setup routes
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store, err := NewStore(filepath.Join(t.TempDir(), "auth.json"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	manager, err := NewManager(store)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, CurrentPrincipal(c)) }
+	r := gin.New()
+	r.Use(manager.Authenticate())
+	r.GET("/api/network-info", manager.Require(RoleViewer), ok)
+	r.POST("/api/plugins/run", manager.Require(RoleOperator), ok)
+	r.POST("/api/plugins/install", manager.Require(RoleAdmin), ok)
+	r.GET("/api/config", manager.Require(RoleAdmin), ok)
+	r.POST("/api/auth/login", func(c *gin.Context) {
+		var request struct{ Username, Password string }
+		c.BindJSON(&request)
+		principal, err := manager.Login(c, request.Username, request.Password)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, principal)
+	})
+	r.POST("/api/auth/setup", func(c *gin.Context) {
+		var request struct{ SetupCode, Username, Password string }
+		c.BindJSON(&request)
+		principal, err := manager.Setup(c, request.SetupCode, request.Username, request.Password)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, principal)
+	})
+	return &testServer{manager: manager, router: r}
+}
+
+// addUsers creates the first admin and a viewer and an operator
+func (s *testServer) addUsers(t *testing.T) {
+	t.Helper()
+	if err := s.manager.Store.CreateFirstAdmin("admin", testPassword); err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	for _, role := range []Role{RoleViewer, RoleOperator} {
+		if err := s.manager.Store.CreateUser(string(role), testPassword, role); err != nil {
+			t.Fatalf("create %s: %v", role, err)
+		}
+	}
+}
+
+// token issues an API token for owner with the given role
+func (s *testServer) token(t *testing.T, owner string, role Role, ttl time.Duration) (APIToken, string) {
+	t.Helper()
+	record, secret, err := s.manager.Store.CreateToken(owner, "test", role, ttl)
+	if err != nil {
+		t.Fatalf("create token for %s: %v", owner, err)
+	}
+	return record, secret
+}
+
+// do sends a request through the router; setup may add headers, cookies or TLS state
+func (s *testServer) do(method, path, body string, setup func(r *http.Request)) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if setup != nil {
+		setup(r)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+// login logs a user in and returns the session cookies and the CSRF token
+func (s *testServer) login(t *testing.T, username string) ([]*http.Cookie, string) {
+	t.Helper()
+	w := s.do(http.MethodPost, "/api/auth/login", `{"username": "`+username+`", "password": "`+testPassword+`"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login %s: %d %s", username, w.Code, w.Body)
+	}
+	var principal Principal
+	if err := json.Unmarshal(w.Body.Bytes(), &principal); err != nil {
+		t.Fatalf("login response: %v", err)
+	}
+	return w.Result().Cookies(), principal.CSRFToken
+}
+
+// bearer sets an Authorization header
+func bearer(secret string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+secret) }
+}
+
+// session adds the session cookies and, if given, the CSRF header
+func session(cookies []*http.Cookie, csrf string) func(r *http.Request) {
+	return func(r *http.Request) {
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		if csrf != "" {
+			r.Header.Set(CSRFHeader, csrf)
+		}
+	}
+}
+
+// clientCert makes the request look like it came with a verified client
+// certificate naming the given user
+func clientCert(commonName string) func(r *http.Request) {
+	return func(r *http.Request) {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+}
+
+func TestRoleMatrix(t *testing.T) {
+	s := newTestServer(t)
+	s.addUsers(t)
+
+	routes := []struct {
+		method, path string
+		role         Role
+	}{
+		{http.MethodGet, "/api/network-info", RoleViewer},
+		{http.MethodPost, "/api/plugins/run", RoleOperator},
+		{http.MethodPost, "/api/plugins/install", RoleAdmin},
+		{http.MethodGet, "/api/config", RoleAdmin},
+	}
+	for _, user := range []Role{RoleViewer, RoleOperator, RoleAdmin} {
+		cookies, csrf := s.login(t, string(user))
+		_, secret := s.token(t, string(user), user, 0)
+		for _, route := range routes {
+			want := http.StatusForbidden
+			if user.Allows(route.role) {
+				want = http.StatusOK
+			}
+			if w := s.do(route.method, route.path, "", session(cookies, csrf)); w.Code != want {
+				t.Errorf("%s session %s %s = %d, want %d", user, route.method, route.path, w.Code, want)
+			}
+			if w := s.do(route.method, route.path, "", bearer(secret)); w.Code != want {
+				t.Errorf("%s token %s %s = %d, want %d", user, route.method, route.path, w.Code, want)
+			}
+		}
+	}
+
+	if w := s.do(http.MethodGet, "/api/network-info", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous request = %d, want 401", w.Code)
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	s := newTestServer(t)
+	s.addUsers(t)
+	cookies, csrf := s.login(t, "operator")
+
+	tests := []struct {
+		name  string
+		setup func(r *http.Request)
+		want  int
+	}{
+		{"session without token", session(cookies, ""), http.StatusForbidden},
+		{"session with another token", session(cookies, csrf+"x"), http.StatusForbidden},
+		{"session with the session's token", session(cookies, csrf), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := s.do(http.MethodPost, "/api/plugins/run", "", tt.setup); w.Code != tt.want {
+			t.Errorf("%s: POST = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	// Another session's token does not fit this one
+	_, otherCSRF := s.login(t, "operator")
+	if w := s.do(http.MethodPost, "/api/plugins/run", "", session(cookies, otherCSRF)); w.Code != http.StatusForbidden {
+		t.Errorf("token of another session: POST = %d, want 403", w.Code)
+	}
+
+	// Reads need no token
+	if w := s.do(http.MethodGet, "/api/network-info", "", session(cookies, "")); w.Code != http.StatusOK {
+		t.Errorf("GET without token = %d, want 200", w.Code)
+	}
+
+	// Bearer tokens cannot be sent by another site's page, so they need no CSRF token
+	_, secret := s.token(t, "operator", RoleOperator, 0)
+	if w := s.do(http.MethodPost, "/api/plugins/run", "", bearer(secret)); w.Code != http.StatusOK {
+		t.Errorf("bearer POST without CSRF token = %d, want 200", w.Code)
+	}
+}
+
+func TestRejectsExpiredAndRevokedCredentials(t *testing.T) {
+	s := newTestServer(t)
+	s.addUsers(t)
+
+	_, expired := s.token(t, "viewer", RoleViewer, time.Millisecond)
+	revoked, revokedSecret := s.token(t, "viewer", RoleViewer, 0)
+	if w := s.do(http.MethodGet, "/api/network-info", "", bearer(revokedSecret)); w.Code != http.StatusOK {
+		t.Fatalf("token before revoking = %d, want 200", w.Code)
+	}
+	if err := s.manager.Store.DeleteToken(revoked.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	for name, secret := range map[string]string{
+		"expired token":   expired,
+		"revoked token":   revokedSecret,
+		"malformed token": "nt_not-a-token",
+		"wrong secret":    revokedSecret[:len(revokedSecret)-2] + "xx",
+	} {
+		if w := s.do(http.MethodGet, "/api/network-info", "", bearer(secret)); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s = %d, want 401", name, w.Code)
+		}
+	}
+
+	// Sessions expire when idle for longer than the TTL
+	s.manager.SessionTTL = 20 * time.Millisecond
+	cookies, _ := s.login(t, "viewer")
+	if w := s.do(http.MethodGet, "/api/network-info", "", session(cookies, "")); w.Code != http.StatusOK {
+		t.Fatalf("fresh session = %d, want 200", w.Code)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if w := s.do(http.MethodGet, "/api/network-info", "", session(cookies, "")); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired session = %d, want 401", w.Code)
+	}
+
+	// A deleted user's sessions end with it
+	cookies, _ = s.login(t, "operator")
+	if err := s.manager.Store.DeleteUser("operator"); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if w := s.do(http.MethodGet, "/api/network-info", "", session(cookies, "")); w.Code != http.StatusUnauthorized {
+		t.Errorf("session of a deleted user = %d, want 401", w.Code)
+	}
+}
+
+func TestTokenRoleLimitedToOwner(t *testing.T) {
+	s := newTestServer(t)
+	s.addUsers(t)
+
+	for _, tt := range []struct {
+		owner string
+		role  Role
+	}{
+		{"viewer", RoleOperator},
+		{"viewer", RoleAdmin},
+		{"operator", RoleAdmin},
+	} {
+		if _, _, err := s.manager.Store.CreateToken(tt.owner, "escalate", tt.role, 0); err == nil {
+			t.Errorf("%s created a %s token", tt.owner, tt.role)
+		}
+	}
+
+	// A token may have fewer rights than its owner
+	_, viewerSecret := s.token(t, "admin", RoleViewer, 0)
+	if w := s.do(http.MethodPost, "/api/plugins/run", "", bearer(viewerSecret)); w.Code != http.StatusForbidden {
+		t.Errorf("admin's viewer token running a plugin = %d, want 403", w.Code)
+	}
+
+	// Demoting the owner also limits tokens issued before
+	_, secret := s.token(t, "operator", RoleOperator, 0)
+	if err := s.manager.Store.SetRole("operator", RoleViewer); err != nil {
+		t.Fatalf("demote: %v", err)
+	}
+	if w := s.do(http.MethodPost, "/api/plugins/run", "", bearer(secret)); w.Code != http.StatusForbidden {
+		t.Errorf("token of a demoted owner = %d, want 403", w.Code)
+	}
+	token, _, ok := s.manager.Store.CheckToken(secret)
+	if !ok || token.Role != RoleViewer {
+		t.Errorf("token role = %q (valid %v), want viewer", token.Role, ok)
+	}
+}
+
+func TestSetupClosesOnceAdminExists(t *testing.T) {
+	s := newTestServer(t)
+	code := s.manager.SetupCode()
+	if code == "" || !s.manager.SetupRequired() {
+		t.Fatal("an empty store needs setup and a setup code")
+	}
+
+	// Until then every protected route points to setup
+	w := s.do(http.MethodGet, "/api/network-info", "", nil)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"setupRequired":true`) {
+		t.Errorf("protected route before setup = %d %s, want 401 with setupRequired", w.Code, w.Body)
+	}
+
+	body := func(code, username string) string {
+		return `{"setupCode": "` + code + `", "username": "` + username + `", "password": "` + testPassword + `"}`
+	}
+	if w := s.do(http.MethodPost, "/api/auth/setup", body("wrong", "admin"), nil); w.Code != http.StatusBadRequest {
+		t.Errorf("setup with a wrong code = %d, want 400", w.Code)
+	}
+	w = s.do(http.MethodPost, "/api/auth/setup", body(code, "admin"), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup = %d %s", w.Code, w.Body)
+	}
+	if user, ok := s.manager.Store.User("admin"); !ok || user.Role != RoleAdmin {
+		t.Fatalf("setup created %+v, want an admin", user)
+	}
+	// Setup logs the admin in
+	if w := s.do(http.MethodGet, "/api/config", "", session(w.Result().Cookies(), "")); w.Code != http.StatusOK {
+		t.Errorf("admin session after setup = %d, want 200", w.Code)
+	}
+
+	// The code is used up, and the store refuses a second first admin
+	if s.manager.SetupCode() != "" || s.manager.SetupRequired() {
+		t.Error("setup still open after the first admin was created")
+	}
+	if w := s.do(http.MethodPost, "/api/auth/setup", body(code, "intruder"), nil); w.Code != http.StatusBadRequest {
+		t.Errorf("second setup = %d, want 400", w.Code)
+	}
+	if err := s.manager.Store.CreateFirstAdmin("intruder", testPassword); err == nil {
+		t.Error("store created a second first admin")
+	}
+	if _, ok := s.manager.Store.User("intruder"); ok {
+		t.Error("intruder exists")
+	}
+
+	// A manager started on a store with users never offers setup
+	manager, err := NewManager(s.manager.Store)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	if manager.SetupCode() != "" {
+		t.Error("manager for an existing store has a setup code")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	s := newTestServer(t)
+	s.addUsers(t)
+
+	w := s.do(http.MethodGet, "/api/network-info", "", clientCert("viewer"))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"method":"certificate"`) {
+		t.Errorf("certificate of a user = %d %s, want 200 as that user", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodPost, "/api/plugins/run", "", clientCert("viewer")); w.Code != http.StatusForbidden {
+		t.Errorf("viewer certificate running a plugin = %d, want 403", w.Code)
+	}
+
+	// Only existing users map; the name is not created or guessed
+	for _, name := range []string{"mallory", "Admin", ""} {
+		if w := s.do(http.MethodGet, "/api/network-info", "", clientCert(name)); w.Code != http.StatusUnauthorized {
+			t.Errorf("certificate for %q = %d, want 401", name, w.Code)
+		}
+	}
+
+	// A certificate without a verified chain is not trusted
+	unverified := func(r *http.Request) { r.TLS = &tls.ConnectionState{} }
+	if w := s.do(http.MethodGet, "/api/network-info", "", unverified); w.Code != http.StatusUnauthorized {
+		t.Errorf("unverified certificate = %d, want 401", w.Code)
+	}
+
+	// Browsers send certificates to any site, so other sites' pages cannot change state
+	crossSite := func(r *http.Request) {
+		clientCert("operator")(r)
+		r.Header.Set("Origin", "https://evil.example")
+	}
+	if w := s.do(http.MethodPost, "/api/plugins/run", "", crossSite); w.Code != http.StatusForbidden {
+		t.Errorf("cross-site POST with a certificate = %d, want 403", w.Code)
+	}
+	if w := s.do(http.MethodPost, "/api/plugins/run", "", clientCert("operator")); w.Code != http.StatusOK {
+		t.Errorf("same-site POST with a certificate = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+// Package auth provides local users, API tokens, login sessions with CSRF
+// protection and role-based access control for the web UI and API
+package auth
+
+import "fmt"
+
+// Role is what a user or token may do. Each role includes the ones below it.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // dashboards, history and plugin details
+	RoleOperator Role = "operator" // also run plugins and jobs
+	RoleAdmin    Role = "admin"    // also install plugins, change configuration and manage users and tokens
+)
+
+// level orders roles so they can be compared
+func (r Role) level() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Allows reports whether a principal with role r may do what required needs
+func (r Role) Allows(required Role) bool {
+	return r.level() > 0 && r.level() >= required.level()
+}
+
+// ParseRole validates a role name
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if role.level() == 0 {
+		return "", fmt.Errorf("unknown role %q (want viewer, operator or admin)", name)
+	}
+	return role, nil
+}
+
+// lower returns the less privileged of two roles
+func lower(a, b Role) Role {
+	if a.level() < b.level() {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSessionTTL is how long a login session lasts without requests
+const DefaultSessionTTL = 12 * time.Hour
+
+// Session is a logged in browser. Sessions live in memory, so a restart logs
+// everyone out.
+type Session struct {
+	ID        string
+	Username  string
+	CSRFToken string // must accompany every state-changing request
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// sessionStore keeps sessions and expires idle ones
+type sessionStore struct {
+	sessions map[string]*Session
+	mu       sync.Mutex
+}
+
+// create starts a session for a user
+func (s *sessionStore) create(username string, ttl time.Duration) (*Session, error) {
+	id, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &Session{ID: id, Username: username, CSRFToken: csrf, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]*Session)
+	}
+	for id, old := range s.sessions {
+		if now.After(old.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[session.ID] = session
+	return session, nil
+}
+
+// get returns an unexpired session and extends it by ttl
+func (s *sessionStore) get(id string, ttl time.Duration) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		delete(s.sessions, id)
+		return Session{}, false
+	}
+	session.ExpiresAt = now.Add(ttl)
+	return *session, true
+}
+
+// delete ends a session
+func (s *sessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// deleteUser ends every session of a user except keep
+func (s *sessionStore) deleteUser(username string, keep string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if session.Username == username && id != keep {
+			delete(s.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted for a user
+const MinPasswordLength = 8
+
+// tokenPrefix starts every API token so they are easy to recognize in
+// configuration files and secret scanners
+const tokenPrefix = "nt_"
+
+// User is a local account
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash,omitempty"` // bcrypt; left out of API responses
+	Role         Role      `json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// APIToken is a bearer token for scripts and scrapers. Only a hash of the
+// secret is kept; the token itself is shown once when it is created.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"hash,omitempty"` // SHA-256 of the secret, hex; left out of API responses
+	Role       Role       `json:"role"`           // limited to the owner's role when used
+	Owner      string     `json:"owner"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// storeFile is the layout of the users file
+type storeFile struct {
+	Users  []*User     `json:"users"`
+	Tokens []*APIToken `json:"tokens"`
+}
+
+// Store keeps users and API tokens in a JSON file readable only by the owner
+type Store struct {
+	path   string
+	users  map[string]*User
+	tokens map[string]*APIToken
+	mu     sync.Mutex
+}
+
+// dummyHash is compared against when a login names an unknown user, so the
+// response time does not reveal which users exist
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("nettool-dummy-password"), bcrypt.DefaultCost)
+
+// NewStore loads users and tokens from path; a missing file is an empty store
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:   path,
+		users:  make(map[string]*User),
+		tokens: make(map[string]*APIToken),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %v", err)
+	}
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse users: %v", err)
+	}
+	for _, user := range file.Users {
+		s.users[user.Username] = user
+	}
+	for _, token := range file.Tokens {
+		s.tokens[token.ID] = token
+	}
+	return s, nil
+}
+
+// HasUsers reports whether any user exists yet
+func (s *Store) HasUsers() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users) > 0
+}
+
+// Users returns all users sorted by name, without password hashes
+func (s *Store) Users() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		copied := *user
+		copied.PasswordHash = ""
+		users = append(users, copied)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+// User returns a user without its password hash
+func (s *Store) User(username string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[username]
+	if !ok {
+		return User{}, false
+	}
+	copied := *user
+	copied.PasswordHash = ""
+	return copied, true
+}
+
+// CreateUser adds a user with a hashed password
+func (s *Store) CreateUser(username string, password string, role Role) error {
+	return s.createUser(username, password, role, false)
+}
+
+// CreateFirstAdmin adds an admin, but only while no users exist
+func (s *Store) CreateFirstAdmin(username string, password string) error {
+	return s.createUser(username, password, RoleAdmin, true)
+}
+
+// createUser validates and adds a user, optionally only into an empty store
+func (s *Store) createUser(username string, password string, role Role, onlyFirst bool) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if onlyFirst && len(s.users) > 0 {
+		return fmt.Errorf("setup has already been completed")
+	}
+	if _, exists := s.users[username]; exists {
+		return fmt.Errorf("user %s already exists", username)
+	}
+	s.users[username] = &User{Username: username, PasswordHash: hash, Role: role, CreatedAt: time.Now()}
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, username)
+		return err
+	}
+	return nil
+}
+
+// SetRole changes a user's role. The last admin cannot be demoted.
+func (s *Store) SetRole(username string, role Role) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[username]
+	if !ok {
+		return fmt.Errorf("user not found: %s", username)
+	}
+	if user.Role == RoleAdmin && role != RoleAdmin && s.adminCountLocked() == 1 {
+		return fmt.Errorf("cannot demote the last admin")
+	}
+	old := user.Role
+	user.Role = role
+	if err := s.saveLocked(); err != nil {
+		user.Role = old
+		return err
+	}
+	return nil
+}
+
+// SetPassword replaces a user's password
+func (s *Store) SetPassword(username string, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[username]
+	if !ok {
+		return fmt.Errorf("user not found: %s", username)
+	}
+	old := user.PasswordHash
+	user.PasswordHash = hash
+	if err := s.saveLocked(); err != nil {
+		user.PasswordHash = old
+		return err
+	}
+	return nil
+}
+
+// DeleteUser removes a user and its tokens. The last admin cannot be deleted.
+func (s *Store) DeleteUser(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[username]
+	if !ok {
+		return fmt.Errorf("user not found: %s", username)
+	}
+	if user.Role == RoleAdmin && s.adminCountLocked() == 1 {
+		return fmt.Errorf("cannot delete the last admin")
+	}
+	delete(s.users, username)
+	for id, token := range s.tokens {
+		if token.Owner == username {
+			delete(s.tokens, id)
+		}
+	}
+	return s.saveLocked()
+}
+
+// CheckPassword returns the user if the password matches
+func (s *Store) CheckPassword(username string, password string) (User, bool) {
+	s.mu.Lock()
+	user, ok := s.users[username]
+	hash := dummyHash
+	if ok {
+		hash = []byte(user.PasswordHash)
+	}
+	s.mu.Unlock()
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok {
+		return User{}, false
+	}
+	return s.User(username)
+}
+
+// CreateToken issues a token for owner with at most the owner's role. It
+// returns the token record and the secret token, which is not kept.
+func (s *Store) CreateToken(owner string, name string, role Role, ttl time.Duration) (APIToken, string, error) {
+	if _, err := ParseRole(string(role)); err != nil {
+		return APIToken{}, "", err
+	}
+	if strings.TrimSpace(name) == "" {
+		return APIToken{}, "", fmt.Errorf("token name is required")
+	}
+	id, err := randomHex(6)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[owner]
+	if !ok {
+		return APIToken{}, "", fmt.Errorf("user not found: %s", owner)
+	}
+	if !user.Role.Allows(role) {
+		return APIToken{}, "", fmt.Errorf("a token cannot have more rights than its owner (%s)", user.Role)
+	}
+	token := &APIToken{
+		ID:        id,
+		Name:      strings.TrimSpace(name),
+		Hash:      hashSecret(secret),
+		Role:      role,
+		Owner:     owner,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expires := token.CreatedAt.Add(ttl)
+		token.ExpiresAt = &expires
+	}
+	s.tokens[token.ID] = token
+	if err := s.saveLocked(); err != nil {
+		delete(s.tokens, token.ID)
+		return APIToken{}, "", err
+	}
+	copied := *token
+	copied.Hash = ""
+	return copied, tokenPrefix + token.ID + "_" + secret, nil
+}
+
+// Tokens returns all tokens, newest first
+func (s *Store) Tokens() []APIToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := make([]APIToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		copied := *token
+		copied.Hash = ""
+		tokens = append(tokens, copied)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// DeleteToken revokes a token
+func (s *Store) DeleteToken(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[id]; !ok {
+		return fmt.Errorf("token not found: %s", id)
+	}
+	delete(s.tokens, id)
+	return s.saveLocked()
+}
+
+// CheckToken returns the token and its owner if the bearer token is valid
+// and unexpired. Its role is limited to the owner's current role.
+func (s *Store) CheckToken(bearer string) (APIToken, User, bool) {
+	rest, ok := strings.CutPrefix(bearer, tokenPrefix)
+	if !ok {
+		return APIToken{}, User{}, false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return APIToken{}, User{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashSecret(secret))) != 1 {
+		return APIToken{}, User{}, false
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return APIToken{}, User{}, false
+	}
+	owner, ok := s.users[token.Owner]
+	if !ok {
+		return APIToken{}, User{}, false
+	}
+	// Kept in memory and written with the next change to the store
+	token.LastUsedAt = &now
+
+	copied := *token
+	copied.Hash = ""
+	copied.Role = lower(token.Role, owner.Role)
+	user := *owner
+	user.PasswordHash = ""
+	return copied, user, true
+}
+
+// adminCountLocked counts admins; s.mu must be held
+func (s *Store) adminCountLocked() int {
+	n := 0
+	for _, user := range s.users {
+		if user.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// saveLocked writes the store to disk atomically; s.mu must be held
+func (s *Store) saveLocked() error {
+	file := storeFile{Users: make([]*User, 0, len(s.users)), Tokens: make([]*APIToken, 0, len(s.tokens))}
+	for _, user := range s.users {
+		file.Users = append(file.Users, user)
+	}
+	for _, token := range s.tokens {
+		file.Tokens = append(file.Tokens, token)
+	}
+	sort.Slice(file.Users, func(i, j int) bool { return file.Users[i].Username < file.Users[j].Username })
+	sort.Slice(file.Tokens, func(i, j int) bool { return file.Tokens[i].ID < file.Tokens[j].ID })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal users: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write users: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write users: %v", err)
+	}
+	return nil
+}
+
+// validateUsername accepts short names of letters, digits, dots, dashes and
+// underscores
+func validateUsername(username string) error {
+	if username == "" || len(username) > 64 {
+		return fmt.Errorf("username must be 1 to 64 characters")
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return fmt.Errorf("username may only contain letters, digits, '.', '-' and '_'")
+		}
+	}
+	return nil
+}
+
+// hashPassword checks the password length and hashes it with bcrypt
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > 72 {
+		return "", fmt.Errorf("password must be at most 72 bytes")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+// hashSecret returns the SHA-256 of a token secret; tokens are long and
+// random, so a slow hash is not needed
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes encoded for use in URLs and cookies
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,305 @@
+// Package certs provides the certificates NetTool serves HTTPS with: a
+// self-signed CA generated on first run that issues the server and client
+// certificates, and a reloader that swaps in renewed certificate files
+// without a restart.
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Files an Authority keeps in its directory
+const (
+	CAFile        = "ca.pem"
+	CAKeyFile     = "ca-key.pem"
+	ServerFile    = "server.pem"
+	ServerKeyFile = "server-key.pem"
+)
+
+// Lifetimes of generated certificates. Server certificates stay under the
+// 398 days browsers accept and are renewed a month before they expire.
+const (
+	caLifetime     = 10 * 365 * 24 * time.Hour
+	leafLifetime   = 397 * 24 * time.Hour
+	renewBefore    = 30 * 24 * time.Hour
+	clockSkewSlack = time.Hour
+)
+
+// Authority is a self-signed CA whose certificate and key live in a directory
+type Authority struct {
+	Cert *x509.Certificate
+	dir  string
+	key  crypto.Signer
+}
+
+// LoadOrCreateAuthority loads the CA in dir, generating it if dir has none.
+// created reports whether a new CA was generated, whose certificate clients
+// then have to be given again.
+func LoadOrCreateAuthority(dir string) (a *Authority, created bool, err error) {
+	a = &Authority{dir: dir}
+	certPath, keyPath := filepath.Join(dir, CAFile), filepath.Join(dir, CAKeyFile)
+
+	cert, key, err := loadPair(certPath, keyPath)
+	if err == nil {
+		if !cert.IsCA {
+			return nil, false, fmt.Errorf("%s is not a CA certificate", certPath)
+		}
+		a.Cert, a.key = cert, key
+		return a, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, false, err
+	}
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate CA key: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		Subject:               pkix.Name{Organization: []string{"NetTool"}, CommonName: "NetTool CA " + hostname},
+		NotBefore:             time.Now().Add(-clockSkewSlack),
+		NotAfter:              time.Now().Add(caLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	cert, err = createCertificate(template, nil, key, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := writePair(certPath, keyPath, cert, key); err != nil {
+		return nil, false, err
+	}
+	a.Cert, a.key = cert, key
+	return a, true, nil
+}
+
+// EnsureServerCert makes sure the directory holds a server certificate from
+// this CA that covers hosts and is not about to expire, issuing a new one
+// otherwise. It returns the certificate and key files and whether a new
+// certificate was issued.
+func (a *Authority) EnsureServerCert(hosts []string) (certFile string, keyFile string, issued bool, err error) {
+	if len(hosts) == 0 {
+		return "", "", false, fmt.Errorf("no host names for the server certificate")
+	}
+	certFile, keyFile = filepath.Join(a.dir, ServerFile), filepath.Join(a.dir, ServerKeyFile)
+	if cert, _, err := loadPair(certFile, keyFile); err == nil && a.current(cert, hosts) {
+		return certFile, keyFile, false, nil
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"NetTool"}, CommonName: hosts[0]},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if err := a.issue(template, certFile, keyFile); err != nil {
+		return "", "", false, err
+	}
+	return certFile, keyFile, true, nil
+}
+
+// IssueClientCert issues a certificate that authenticates as username to a
+// server trusting this CA for client certificates, and writes it next to
+// the CA as <username>-client.pem and <username>-client-key.pem
+func (a *Authority) IssueClientCert(username string) (certFile string, keyFile string, err error) {
+	if username == "" || strings.ContainsAny(username, `/\`) {
+		return "", "", fmt.Errorf("invalid user name %q", username)
+	}
+	certFile = filepath.Join(a.dir, username+"-client.pem")
+	keyFile = filepath.Join(a.dir, username+"-client-key.pem")
+	template := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"NetTool"}, CommonName: username},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if err := a.issue(template, certFile, keyFile); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// issue signs a leaf certificate for template with a new key and writes both
+func (a *Authority) issue(template *x509.Certificate, certFile string, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %v", err)
+	}
+	template.NotBefore = time.Now().Add(-clockSkewSlack)
+	template.NotAfter = time.Now().Add(leafLifetime)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	cert, err := createCertificate(template, a.Cert, key, a.key)
+	if err != nil {
+		return err
+	}
+	return writePair(certFile, keyFile, cert, key)
+}
+
+// current reports whether cert was issued by this CA, covers every host and
+// is valid for longer than renewBefore
+func (a *Authority) current(cert *x509.Certificate, hosts []string) bool {
+	if cert.CheckSignatureFrom(a.Cert) != nil || time.Until(cert.NotAfter) < renewBefore {
+		return false
+	}
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultHosts returns the names and addresses a generated server
+// certificate covers: the host name, localhost and the addresses of every
+// interface that is up, followed by extra
+func DefaultHosts(extra []string) []string {
+	hosts := []string{}
+	seen := make(map[string]bool)
+	add := func(host string) {
+		host = strings.TrimSpace(host)
+		if host != "" && !seen[strings.ToLower(host)] {
+			seen[strings.ToLower(host)] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		add(hostname)
+	}
+	add("localhost")
+	add("127.0.0.1")
+	add("::1")
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagUp == 0 {
+				continue
+			}
+			addrs, err := iface.Addrs()
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() {
+					add(ipnet.IP.String())
+				}
+			}
+		}
+	}
+	for _, host := range extra {
+		add(host)
+	}
+	return hosts
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate in the
+// colon-separated form browsers show
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	var b strings.Builder
+	for i, octet := range sum {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+		fmt.Fprintf(&b, "%02X", octet)
+	}
+	return b.String()
+}
+
+// createCertificate signs template with a random serial number
+func createCertificate(template *x509.Certificate, parent *x509.Certificate, key crypto.Signer, signer crypto.Signer) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	template.SerialNumber = serial
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// loadPair reads a PEM certificate and its PKCS #8 key
+func loadPair(certFile string, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, nil, fmt.Errorf("%s holds no PEM certificate", certFile)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %v", certFile, err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("%s holds no PEM key", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %v", keyFile, err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s holds an unsupported key", keyFile)
+	}
+	return cert, key, nil
+}
+
+// writePair writes a certificate and its key, the key readable only by the
+// owner. Each file is replaced atomically so a reloader never sees half of one.
+func writePair(certFile string, keyFile string, cert *x509.Certificate, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %v", err)
+	}
+	if err := writeAtomic(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return err
+	}
+	return writeAtomic(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644)
+}
+
+// writeAtomic writes data to a temporary file and renames it over path
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
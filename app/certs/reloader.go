@@ -0,0 +1,157 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often Watch checks the files for changes
+const DefaultWatchInterval = 10 * time.Second
+
+// Reloader serves the certificate in a pair of PEM files, and optionally
+// trusts the client CAs in a third, swapping in new versions when they
+// change so renewed certificates take effect without a restart
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	mu        sync.RWMutex
+}
+
+// NewReloader loads the certificate and key, and the client CAs unless
+// clientCAFile is ""
+func NewReloader(certFile string, keyFile string, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. If any cannot be loaded the ones in use are
+// kept and the error is returned.
+func (r *Reloader) Reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, path := range r.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		modTimes[path] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %v", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		data, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CAs: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%s holds no PEM certificates", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.clientCAs, r.modTimes = &cert, clientCAs, modTimes
+	return nil
+}
+
+// Leaf returns the certificate being served
+func (r *Reloader) Leaf() *x509.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert.Leaf
+}
+
+// Watch reloads the files whenever one of them changes, checking every
+// interval until stop is closed. A failed reload is retried on the next
+// check, so certificate and key may be replaced one after the other.
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !r.changed() {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			log.Printf("Certificate files changed but could not be reloaded, still serving the old ones: %v", err)
+			continue
+		}
+		log.Printf("Reloaded TLS certificate %s (SHA-256 %s)", r.certFile, Fingerprint(r.Leaf()))
+	}
+}
+
+// TLSConfig returns a server configuration that always uses the latest
+// certificate and client CAs. With client CAs, clientAuth decides whether a
+// client certificate is requested or required.
+func (r *Reloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: r.getCertificate,
+	}
+	if r.clientCAFile == "" {
+		return config
+	}
+	config.ClientAuth = clientAuth
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			handshake := config.Clone()
+			r.mu.RLock()
+			handshake.ClientCAs = r.clientCAs
+			r.mu.RUnlock()
+			return handshake, nil
+		},
+	}
+}
+
+// getCertificate hands the current certificate to each handshake
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// changed reports whether any file's modification time differs from when it
+// was last loaded
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, path := range r.files() {
+		info, err := os.Stat(path)
+		if err == nil && !info.ModTime().Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// files lists the files the reloader reads
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
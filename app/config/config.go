@@ -0,0 +1,249 @@
+// Package config holds NetTool's server configuration. It is read from a
+// YAML, TOML or JSON file, then overridden by NETTOOL_* environment variables
+// and finally by command line flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NetScout-Go/NetTool/app/auth"
+	"github.com/NetScout-Go/NetTool/app/core"
+	"github.com/NetScout-Go/NetTool/app/plugins"
+	"github.com/NetScout-Go/NetTool/app/realtime"
+	"github.com/NetScout-Go/NetTool/app/timeseries"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Log levels
+const (
+	LogDebug = "debug" // Gin's debug output and every request
+	LogInfo  = "info"  // every request
+	LogWarn  = "warn"  // no request log, only NetTool's own messages
+)
+
+// Config is the server configuration
+type Config struct {
+	Listen          List     `json:"listen"`          // addresses of the HTTP or HTTPS listeners, e.g. ":8080"
+	RedirectListen  string   `json:"redirectListen"`  // plain HTTP listener redirecting to HTTPS
+	DataDir         string   `json:"dataDir"`         // users, audit log, metrics, latency targets and TLS files
+	PluginDir       string   `json:"pluginDir"`       // installed plugins
+	PluginConfig    string   `json:"pluginConfig"`    // plugin sources and GitHub tokens
+	TemplateDir     string   `json:"templateDir"`     // templates replacing the built-in ones; "" uses only those
+	StaticDir       string   `json:"staticDir"`       // files replacing or adding to the built-in ones under /static
+	LogLevel        string   `json:"logLevel"`        // debug, info or warn
+	ShutdownTimeout Duration `json:"shutdownTimeout"` // how long running jobs may take to finish on shutdown
+
+	Probes       Probes       `json:"probes"`
+	Connectivity Connectivity `json:"connectivity"`
+	Realtime     Realtime     `json:"realtime"`
+	Auth         Auth         `json:"auth"`
+	Audit        Audit        `json:"audit"`
+	TLS          TLS          `json:"tls"`
+	Metrics      Metrics      `json:"metrics"`
+}
+
+// Probes sets how often network information is collected
+type Probes struct {
+	Intervals       map[string]Duration `json:"intervals"`       // by snapshot section, e.g. "traffic"; unset sections keep their default
+	MetricsInterval Duration            `json:"metricsInterval"` // how often metrics are sampled
+	PollInterval    Duration            `json:"pollInterval"`    // how often updates are pushed when kernel events are unavailable
+}
+
+// Connectivity sets the connectivity check's probes
+type Connectivity struct {
+	ProbeURLs List   `json:"probeURLs"` // HTTP URLs that answer 204
+	DNSName   string `json:"dnsName"`   // resolved by the DNS stage; default is the first probe's host
+}
+
+// Realtime sets up WebSocket and event stream clients
+type Realtime struct {
+	AllowedOrigins List     `json:"allowedOrigins"` // besides the server's own; "*" allows any
+	PingInterval   Duration `json:"pingInterval"`
+	QueueSize      int      `json:"queueSize"`
+	ReplaySize     int      `json:"replaySize"`
+}
+
+// Auth sets up users and sessions
+type Auth struct {
+	File       string   `json:"file"` // default <dataDir>/auth.json
+	SessionTTL Duration `json:"sessionTTL"`
+}
+
+// Audit sets up the audit log
+type Audit struct {
+	File string `json:"file"` // default <dataDir>/audit.log
+}
+
+// TLS sets up HTTPS
+type TLS struct {
+	Cert              string `json:"cert"`
+	Key               string `json:"key"`
+	SelfSigned        bool   `json:"selfSigned"`
+	Dir               string `json:"dir"`   // self-signed CA; default <dataDir>/tls
+	Hosts             List   `json:"hosts"` // extra names for the self-signed certificate
+	ClientCA          string `json:"clientCA"`
+	RequireClientCert bool   `json:"requireClientCert"`
+}
+
+// Metrics sets how long recorded metrics are kept
+type Metrics struct {
+	RawRetention    Duration `json:"rawRetention"`
+	MinuteRetention Duration `json:"minuteRetention"`
+	HourRetention   Duration `json:"hourRetention"`
+}
+
+// pathKeys are the settings holding paths. Relative paths in a config file
+// are relative to the file's directory.
+var pathKeys = []string{
+	"dataDir", "pluginDir", "pluginConfig", "templateDir", "staticDir",
+	"auth.file", "audit.file", "tls.cert", "tls.key", "tls.dir", "tls.clientCA",
+}
+
+// Default returns the built-in configuration, with paths relative to the
+// working directory as in a source checkout
+func Default() *Config {
+	retention := timeseries.DefaultRetention()
+	return &Config{
+		Listen:          List{":8080"},
+		DataDir:         "app/data",
+		PluginDir:       plugins.DefaultPluginsDir,
+		PluginConfig:    "app/plugins/config.json",
+		LogLevel:        LogInfo,
+		ShutdownTimeout: Duration(30 * time.Second),
+		Probes: Probes{
+			Intervals:       map[string]Duration{},
+			MetricsInterval: Duration(5 * time.Second),
+			PollInterval:    Duration(3 * time.Second),
+		},
+		Connectivity: Connectivity{ProbeURLs: List(core.DefaultConnectivityConfig().ProbeURLs)},
+		Realtime: Realtime{
+			PingInterval: Duration(realtime.DefaultPingInterval),
+			QueueSize:    realtime.DefaultQueueSize,
+			ReplaySize:   realtime.DefaultReplaySize,
+		},
+		Auth: Auth{SessionTTL: Duration(auth.DefaultSessionTTL)},
+		Metrics: Metrics{
+			RawRetention:    Duration(retention.Raw),
+			MinuteRetention: Duration(retention.Minute),
+			HourRetention:   Duration(retention.Hour),
+		},
+	}
+}
+
+// Load reads the file at path over c. The format follows the extension:
+// .yaml or .yml, .toml, or .json. Unknown settings are an error so typos do
+// not go unnoticed.
+func (c *Config) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+
+	var values map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("unknown config format %q; use .yaml, .toml or .json", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to resolve config directory: %v", err)
+	}
+	for _, key := range pathKeys {
+		resolvePath(values, strings.Split(key, "."), dir)
+	}
+
+	// Every format is decoded through JSON so one set of field names and
+	// the Duration parser apply to all of them
+	normalized, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(normalized))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return nil
+}
+
+// resolvePath makes the path setting at key absolute against dir
+func resolvePath(values map[string]interface{}, key []string, dir string) {
+	if len(key) > 1 {
+		if nested, ok := values[key[0]].(map[string]interface{}); ok {
+			resolvePath(nested, key[1:], dir)
+		}
+		return
+	}
+	if path, ok := values[key[0]].(string); ok && path != "" && !filepath.IsAbs(path) {
+		values[key[0]] = filepath.Join(dir, path)
+	}
+}
+
+// Finish fills in the paths that default to the data directory and checks
+// the configuration
+func (c *Config) Finish() error {
+	if c.Auth.File == "" {
+		c.Auth.File = c.DataFile("auth.json")
+	}
+	if c.Audit.File == "" {
+		c.Audit.File = c.DataFile("audit.log")
+	}
+	if c.TLS.Dir == "" {
+		c.TLS.Dir = c.DataFile("tls")
+	}
+
+	if len(c.Listen) == 0 {
+		return fmt.Errorf("no listen address")
+	}
+	switch c.LogLevel {
+	case LogDebug, LogInfo, LogWarn:
+	default:
+		return fmt.Errorf("unknown log level %q; use debug, info or warn", c.LogLevel)
+	}
+	for name, interval := range c.Probes.Intervals {
+		if interval <= 0 {
+			return fmt.Errorf("probe interval of %s must be positive", name)
+		}
+	}
+	if c.Probes.MetricsInterval <= 0 || c.Probes.PollInterval <= 0 {
+		return fmt.Errorf("probe intervals must be positive")
+	}
+	if c.Realtime.PingInterval <= 0 {
+		return fmt.Errorf("realtime ping interval must be positive")
+	}
+	if c.Realtime.QueueSize <= 0 {
+		return fmt.Errorf("realtime queue size must be positive")
+	}
+	if c.Realtime.ReplaySize < 0 {
+		return fmt.Errorf("realtime replay size must not be negative")
+	}
+	if c.Auth.SessionTTL <= 0 {
+		return fmt.Errorf("session TTL must be positive")
+	}
+	if c.Metrics.RawRetention <= 0 || c.Metrics.MinuteRetention <= 0 || c.Metrics.HourRetention <= 0 {
+		return fmt.Errorf("metrics retention must be positive")
+	}
+	return nil
+}
+
+// DataFile returns the path of a file in the data directory
+func (c *Config) DataFile(name string) string {
+	return filepath.Join(c.DataDir, name)
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with the given name into a new directory
+// and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	files := map[string]string{
+		"nettool.yaml": `
+listen: [":9090", ":9443"]
+dataDir: data
+logLevel: warn
+probes:
+  intervals:
+    traffic: 2s
+  metricsInterval: 10
+realtime:
+  queueSize: 128
+tls:
+  hosts: nettool.lan, 192.0.2.10
+`,
+		"nettool.toml": `
+listen = [":9090", ":9443"]
+dataDir = "data"
+logLevel = "warn"
+
+[probes]
+metricsInterval = 10
+intervals = { traffic = "2s" }
+
+[realtime]
+queueSize = 128
+
+[tls]
+hosts = ["nettool.lan", "192.0.2.10"]
+`,
+		"nettool.json": `{
+	"listen": ":9090,:9443",
+	"dataDir": "data",
+	"logLevel": "warn",
+	"probes": {"intervals": {"traffic": "2s"}, "metricsInterval": "10s"},
+	"realtime": {"queueSize": 128},
+	"tls": {"hosts": ["nettool.lan", "192.0.2.10"]}
+}`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, name, content)
+			cfg := Default()
+			if err := cfg.Load(path); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			if !reflect.DeepEqual(cfg.Listen, List{":9090", ":9443"}) {
+				t.Errorf("listen = %v", cfg.Listen)
+			}
+			// Relative paths are relative to the config file
+			if want := filepath.Join(filepath.Dir(path), "data"); cfg.DataDir != want {
+				t.Errorf("data dir = %q, want %q", cfg.DataDir, want)
+			}
+			if cfg.LogLevel != LogWarn || cfg.Realtime.QueueSize != 128 {
+				t.Errorf("log level %q queue size %d, want warn and 128", cfg.LogLevel, cfg.Realtime.QueueSize)
+			}
+			if cfg.Probes.Intervals["traffic"] != Duration(2*time.Second) || cfg.Probes.MetricsInterval != Duration(10*time.Second) {
+				t.Errorf("probes = %+v", cfg.Probes)
+			}
+			if !reflect.DeepEqual(cfg.TLS.Hosts, List{"nettool.lan", "192.0.2.10"}) {
+				t.Errorf("tls hosts = %v", cfg.TLS.Hosts)
+			}
+			// Settings the file leaves out keep their defaults
+			if cfg.Realtime.PingInterval != Default().Realtime.PingInterval {
+				t.Errorf("ping interval = %v, want the default", cfg.Realtime.PingInterval)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		errText string
+	}{
+		{"unknown setting", "nettool.yaml", "listen: [':8080']\nlistne: ':9090'\n", `unknown field "listne"`},
+		{"bad duration", "nettool.yaml", "shutdownTimeout: soon\n", "invalid duration"},
+		{"unknown format", "nettool.ini", "listen=:8080\n", "unknown config format"},
+		{"malformed", "nettool.json", "{", "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Default().Load(writeConfig(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("NETTOOL_DATA_DIR", "/var/lib/nettool")
+	t.Setenv("NETTOOL_LISTEN", ":80, :443")
+	t.Setenv("NETTOOL_TLS_CLIENT_CA", "/etc/nettool/ca.pem")
+	t.Setenv("NETTOOL_TLS_REQUIRE_CLIENT_CERT", "true")
+	t.Setenv("NETTOOL_REALTIME_QUEUE_SIZE", "32")
+	t.Setenv("NETTOOL_REALTIME_PING_INTERVAL", "15s")
+	t.Setenv("NETTOOL_PROBES_INTERVALS", "traffic=2s, dhcp=5m")
+	t.Setenv("NETTOOL_CONNECTIVITY_PROBE_URLS", "http://192.0.2.1/generate_204")
+
+	cfg := Default()
+	if err := cfg.ApplyEnv(); err != nil {
+		t.Fatalf("apply env: %v", err)
+	}
+	if cfg.DataDir != "/var/lib/nettool" || !reflect.DeepEqual(cfg.Listen, List{":80", ":443"}) {
+		t.Errorf("data dir %q listen %v", cfg.DataDir, cfg.Listen)
+	}
+	if cfg.TLS.ClientCA != "/etc/nettool/ca.pem" || !cfg.TLS.RequireClientCert {
+		t.Errorf("tls = %+v", cfg.TLS)
+	}
+	if cfg.Realtime.QueueSize != 32 || cfg.Realtime.PingInterval != Duration(15*time.Second) {
+		t.Errorf("realtime = %+v", cfg.Realtime)
+	}
+	wantIntervals := map[string]Duration{"traffic": Duration(2 * time.Second), "dhcp": Duration(5 * time.Minute)}
+	if !reflect.DeepEqual(cfg.Probes.Intervals, wantIntervals) {
+		t.Errorf("probe intervals = %v, want %v", cfg.Probes.Intervals, wantIntervals)
+	}
+	if !reflect.DeepEqual(cfg.Connectivity.ProbeURLs, List{"http://192.0.2.1/generate_204"}) {
+		t.Errorf("probe URLs = %v", cfg.Connectivity.ProbeURLs)
+	}
+}
+
+func TestApplyEnvRejectsBadValues(t *testing.T) {
+	tests := map[string]string{
+		"NETTOOL_REALTIME_QUEUE_SIZE":    "many",
+		"NETTOOL_SHUTDOWN_TIMEOUT":       "30",
+		"NETTOOL_TLS_SELF_SIGNED":        "maybe",
+		"NETTOOL_PROBES_INTERVALS":       "traffic",
+		"NETTOOL_REALTIME_PING_INTERVAL": "often",
+		"NETTOOL_METRICS_RAW_RETENTION":  "1 week",
+		"NETTOOL_AUTH_SESSION_TTL":       "-",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			err := Default().ApplyEnv()
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("error = %v, want one naming %s", err, name)
+			}
+		})
+	}
+}
+
+func TestFinish(t *testing.T) {
+	cfg := Default()
+	cfg.DataDir = "/var/lib/nettool"
+	if err := cfg.Finish(); err != nil {
+		t.Fatalf("finish defaults: %v", err)
+	}
+	if cfg.Auth.File != filepath.Join(cfg.DataDir, "auth.json") || cfg.Audit.File != filepath.Join(cfg.DataDir, "audit.log") || cfg.TLS.Dir != filepath.Join(cfg.DataDir, "tls") {
+		t.Errorf("data files = %q, %q, %q", cfg.Auth.File, cfg.Audit.File, cfg.TLS.Dir)
+	}
+}
+
+func TestFinishRejectsBadValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		errText string
+	}{
+		{"no listener", func(c *Config) { c.Listen = nil }, "no listen address"},
+		{"log level", func(c *Config) { c.LogLevel = "verbose" }, "unknown log level"},
+		{"zero probe interval", func(c *Config) { c.Probes.Intervals["traffic"] = 0 }, "probe interval of traffic"},
+		{"zero metrics interval", func(c *Config) { c.Probes.MetricsInterval = 0 }, "probe intervals must be positive"},
+		{"zero ping interval", func(c *Config) { c.Realtime.PingInterval = 0 }, "ping interval must be positive"},
+		{"negative ping interval", func(c *Config) { c.Realtime.PingInterval = Duration(-time.Second) }, "ping interval must be positive"},
+		{"zero queue size", func(c *Config) { c.Realtime.QueueSize = 0 }, "queue size must be positive"},
+		{"negative replay size", func(c *Config) { c.Realtime.ReplaySize = -1 }, "replay size must not be negative"},
+		{"zero session TTL", func(c *Config) { c.Auth.SessionTTL = 0 }, "session TTL must be positive"},
+		{"zero raw retention", func(c *Config) { c.Metrics.RawRetention = 0 }, "retention must be positive"},
+		{"negative hour retention", func(c *Config) { c.Metrics.HourRetention = Duration(-time.Hour) }, "retention must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Finish()
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.errText)
+			}
+		})
+	}
+
+	// A replay buffer of zero turns replay off and is allowed
+	cfg := Default()
+	cfg.Realtime.ReplaySize = 0
+	if err := cfg.Finish(); err != nil {
+		t.Errorf("replay size 0: %v", err)
+	}
+}
+
+func TestFinishRejectsZeroFromEnv(t *testing.T) {
+	// Values from the environment are checked like those from a file
+	t.Setenv("NETTOOL_REALTIME_PING_INTERVAL", "0s")
+	cfg := Default()
+	if err := cfg.ApplyEnv(); err != nil {
+		t.Fatalf("apply env: %v", err)
+	}
+	if err := cfg.Finish(); err == nil || !strings.Contains(err.Error(), "ping interval") {
+		t.Errorf("error = %v, want the zero ping interval rejected", err)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for key, want := range map[string]string{
+		"dataDir":           "DATA_DIR",
+		"probeURLs":         "PROBE_URLS",
+		"clientCA":          "CLIENT_CA",
+		"sessionTTL":        "SESSION_TTL",
+		"requireClientCert": "REQUIRE_CLIENT_CERT",
+	} {
+		if got := envName(key); got != want {
+			t.Errorf("envName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix starts the environment variables that override settings
+const EnvPrefix = "NETTOOL"
+
+// ApplyEnv overrides settings with environment variables named after their
+// path in the config file: NETTOOL_DATA_DIR sets dataDir and
+// NETTOOL_TLS_CLIENT_CA sets tls.clientCA. Lists are comma-separated, and
+// maps such as NETTOOL_PROBES_INTERVALS take "name=value" pairs.
+func (c *Config) ApplyEnv() error {
+	return applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix)
+}
+
+// applyEnv sets each field of v from its environment variable, if set
+func applyEnv(v reflect.Value, prefix string) error {
+	var firstErr error
+	walkEnv(v, prefix, func(name string, field reflect.Value) {
+		text, ok := os.LookupEnv(name)
+		if !ok || firstErr != nil {
+			return
+		}
+		if err := setField(field, text); err != nil {
+			firstErr = fmt.Errorf("invalid %s: %v", name, err)
+		}
+	})
+	return firstErr
+}
+
+// walkEnv calls fn with the variable name of every setting in v
+func walkEnv(v reflect.Value, prefix string, fn func(name string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + envName(tag)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkEnv(field, name, fn)
+			continue
+		}
+		fn(name, field)
+	}
+}
+
+// setField parses text into a setting
+func setField(field reflect.Value, text string) error {
+	if value, ok := field.Addr().Interface().(interface{ Set(string) error }); ok {
+		return value.Set(text) // Duration and List
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Map:
+		if field.IsNil() {
+			field.Set(reflect.MakeMap(field.Type()))
+		}
+		for _, pair := range strings.Split(text, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			key, value, found := strings.Cut(pair, "=")
+			if !found {
+				return fmt.Errorf("%q is not name=value", pair)
+			}
+			element := reflect.New(field.Type().Elem())
+			if err := setField(element.Elem(), strings.TrimSpace(value)); err != nil {
+				return err
+			}
+			field.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), element.Elem())
+		}
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// envName turns a camelCase setting name into UPPER_SNAKE_CASE, keeping
+// acronyms together: probeURLs becomes PROBE_URLS
+func envName(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a string such as "30s" or "5m" in
+// config files. A bare number is a number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON accepts a duration string or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\" or a number of seconds")
+	}
+	return d.Set(text)
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// String formats the duration like time.Duration
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Set parses a duration string; it makes Duration a flag.Value
+func (d *Duration) Set(text string) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// List is a list of strings, given as an array or a comma-separated string
+type List []string
+
+// UnmarshalJSON accepts an array of strings or a comma-separated string
+func (l *List) UnmarshalJSON(data []byte) error {
+	var items []string
+	if err := json.Unmarshal(data, &items); err == nil {
+		*l = items
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("list must be an array of strings or a comma-separated string")
+	}
+	return l.Set(text)
+}
+
+// String joins the list with commas
+func (l List) String() string {
+	return strings.Join(l, ",")
+}
+
+// Set replaces the list with the comma-separated items of text; it makes
+// List a flag.Value
+func (l *List) Set(text string) error {
+	items := List{}
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*l = items
+	return nil
+}
@@ -0,0 +1,332 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Socket is one entry of the kernel's TCP or UDP socket tables
+type Socket struct {
+	Protocol      string  `json:"protocol"` // tcp, tcp6, udp or udp6
+	State         string  `json:"state"`
+	Listening     bool    `json:"listening"`
+	LocalAddress  string  `json:"localAddress"`
+	LocalPort     int     `json:"localPort"`
+	RemoteAddress string  `json:"remoteAddress"`
+	RemotePort    int     `json:"remotePort"`
+	TxQueue       uint64  `json:"txQueue"` // bytes queued for sending (unacknowledged for TCP)
+	RxQueue       uint64  `json:"rxQueue"` // bytes received but not yet read (accept backlog for listeners)
+	UID           int     `json:"uid"`
+	Inode         uint64  `json:"inode"`
+	PID           int     `json:"pid,omitempty"`
+	Command       string  `json:"command,omitempty"`
+	RTTMS         float64 `json:"rttMs,omitempty"` // smoothed RTT from tcp_info
+	RTTVarMS      float64 `json:"rttVarMs,omitempty"`
+	Retransmits   uint32  `json:"retransmits,omitempty"`      // unrecovered retransmits of the current segment
+	TotalRetrans  uint32  `json:"totalRetransmits,omitempty"` // retransmitted segments over the connection's lifetime
+}
+
+// ConnectionFilter selects sockets. Zero values match everything.
+type ConnectionFilter struct {
+	Protocol    string // tcp or udp (matches both address families), or tcp6/udp6
+	State       string // e.g. ESTABLISHED, LISTEN, TIME_WAIT
+	Port        int    // local or remote port
+	PID         int
+	Command     string // substring of the owning process name
+	Listening   bool   // only listeners (and unconnected UDP sockets)
+	Established bool   // only established TCP and connected UDP sockets
+}
+
+// ConnectionsInfo is the socket table at one point in time
+type ConnectionsInfo struct {
+	Sockets     []Socket  `json:"sockets"`
+	Total       int       `json:"total"` // sockets before filtering
+	Listening   int       `json:"listening"`
+	Established int       `json:"established"`
+	TCPInfo     bool      `json:"tcpInfo"` // whether RTT and retransmit data could be read
+	Errors      []string  `json:"errors,omitempty"`
+	CollectedAt time.Time `json:"collectedAt"`
+}
+
+// tcpStats are the tcp_info fields reported for a socket
+type tcpStats struct {
+	rttUS        uint32
+	rttVarUS     uint32
+	retransmits  uint8
+	totalRetrans uint32
+}
+
+// tcpStates maps the kernel's TCP state numbers to names
+var tcpStates = map[uint64]string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+	12: "NEW_SYN_RECV",
+}
+
+// GetConnections reads the TCP and UDP socket tables, resolves the owning
+// process of each socket and adds tcp_info RTT and retransmit counters
+func GetConnections(filter ConnectionFilter) (*ConnectionsInfo, error) {
+	info := &ConnectionsInfo{CollectedAt: time.Now()}
+
+	var sockets []Socket
+	read := 0
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open(filepath.Join("/proc/net", protocol))
+		if err != nil {
+			// IPv6 may be disabled
+			if !os.IsNotExist(err) {
+				info.Errors = append(info.Errors, err.Error())
+			}
+			continue
+		}
+		parsed, err := ParseProcNetSockets(f, protocol)
+		f.Close()
+		if err != nil {
+			info.Errors = append(info.Errors, err.Error())
+			continue
+		}
+		read++
+		sockets = append(sockets, parsed...)
+	}
+	if read == 0 {
+		return nil, fmt.Errorf("failed to read socket tables: %s", strings.Join(info.Errors, "; "))
+	}
+
+	owners := socketOwners()
+	stats, err := tcpInfoByInode()
+	if err != nil {
+		info.Errors = append(info.Errors, err.Error())
+	} else {
+		info.TCPInfo = true
+	}
+
+	for i := range sockets {
+		s := &sockets[i]
+		if owner, ok := owners[s.Inode]; ok {
+			s.PID = owner.pid
+			s.Command = owner.command
+		}
+		if st, ok := stats[s.Inode]; ok && s.Inode != 0 {
+			s.RTTMS = float64(st.rttUS) / 1000
+			s.RTTVarMS = float64(st.rttVarUS) / 1000
+			s.Retransmits = uint32(st.retransmits)
+			s.TotalRetrans = st.totalRetrans
+		}
+	}
+
+	info.Total = len(sockets)
+	for _, s := range sockets {
+		if !filter.matches(s) {
+			continue
+		}
+		info.Sockets = append(info.Sockets, s)
+		if s.Listening {
+			info.Listening++
+		} else if s.State == "ESTABLISHED" {
+			info.Established++
+		}
+	}
+
+	sort.SliceStable(info.Sockets, func(i, j int) bool {
+		a, b := info.Sockets[i], info.Sockets[j]
+		if a.Listening != b.Listening {
+			return a.Listening
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.LocalPort < b.LocalPort
+	})
+
+	return info, nil
+}
+
+// matches reports whether a socket passes the filter
+func (f ConnectionFilter) matches(s Socket) bool {
+	if f.Protocol != "" {
+		protocol := strings.ToLower(f.Protocol)
+		if protocol != s.Protocol && protocol != strings.TrimSuffix(s.Protocol, "6") {
+			return false
+		}
+	}
+	if f.State != "" && !strings.EqualFold(f.State, s.State) {
+		return false
+	}
+	if f.Port != 0 && f.Port != s.LocalPort && f.Port != s.RemotePort {
+		return false
+	}
+	if f.PID != 0 && f.PID != s.PID {
+		return false
+	}
+	if f.Command != "" && !strings.Contains(strings.ToLower(s.Command), strings.ToLower(f.Command)) {
+		return false
+	}
+	if f.Listening && !s.Listening {
+		return false
+	}
+	if f.Established && s.State != "ESTABLISHED" {
+		return false
+	}
+	return true
+}
+
+// ParseProcNetSockets parses a /proc/net/{tcp,tcp6,udp,udp6} table
+func ParseProcNetSockets(r io.Reader, protocol string) ([]Socket, error) {
+	var sockets []Socket
+	udp := strings.HasPrefix(protocol, "udp")
+
+	scanner := bufio.NewScanner(r)
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		localIP, localPort, err := parseHexEndpoint(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s local address %q: %v", protocol, fields[1], err)
+		}
+		remoteIP, remotePort, err := parseHexEndpoint(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s remote address %q: %v", protocol, fields[2], err)
+		}
+		state, _ := strconv.ParseUint(fields[3], 16, 8)
+
+		s := Socket{
+			Protocol:      protocol,
+			LocalAddress:  localIP.String(),
+			LocalPort:     localPort,
+			RemoteAddress: remoteIP.String(),
+			RemotePort:    remotePort,
+		}
+		if queues := strings.SplitN(fields[4], ":", 2); len(queues) == 2 {
+			s.TxQueue, _ = strconv.ParseUint(queues[0], 16, 64)
+			s.RxQueue, _ = strconv.ParseUint(queues[1], 16, 64)
+		}
+		s.UID, _ = strconv.Atoi(fields[7])
+		s.Inode, _ = strconv.ParseUint(fields[9], 10, 64)
+
+		switch {
+		case udp && state == 7:
+			// Unconnected UDP sockets sit in TCP_CLOSE; they are the UDP listeners
+			s.State = "UNCONN"
+			s.Listening = remotePort == 0
+		case udp && state == 1:
+			s.State = "ESTABLISHED"
+		default:
+			s.State = tcpStates[state]
+			if s.State == "" {
+				s.State = fmt.Sprintf("UNKNOWN(%d)", state)
+			}
+			s.Listening = s.State == "LISTEN"
+		}
+
+		sockets = append(sockets, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s table: %v", protocol, err)
+	}
+	return sockets, nil
+}
+
+// parseHexEndpoint parses an "ADDR:PORT" pair from /proc/net. The address is
+// written as 32-bit words in host byte order, the port in network order.
+func parseHexEndpoint(value string) (net.IP, int, error) {
+	addr, port, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("missing port")
+	}
+	raw, err := hex.DecodeString(addr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid address")
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port")
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.NativeEndian.Uint32(raw[i:]))
+	}
+	if ip4 := ip.To4(); ip4 != nil && len(ip) == net.IPv6len && !ip.Equal(net.IPv6zero) {
+		// IPv4-mapped addresses on dual-stack sockets
+		ip = ip4
+	}
+	return ip, int(p), nil
+}
+
+// socketOwner is the process holding a socket
+type socketOwner struct {
+	pid     int
+	command string
+}
+
+// socketOwners maps socket inodes to the process that has them open by
+// walking /proc/<pid>/fd. Processes of other users are only visible to root.
+func socketOwners() map[uint64]socketOwner {
+	owners := make(map[uint64]socketOwner)
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", entry.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		command := ""
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if _, seen := owners[inode]; seen {
+				// Shared after fork; keep the first (usually the parent) process
+				continue
+			}
+			if command == "" {
+				comm, _ := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+				command = strings.TrimSpace(string(comm))
+			}
+			owners[inode] = socketOwner{pid: pid, command: command}
+		}
+	}
+	return owners
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sizeofInetDiagReqV2 = 56
+	sizeofInetDiagMsg   = 72
+	inetDiagInfo        = 2 // INET_DIAG_INFO attribute, carries struct tcp_info
+)
+
+// tcpInfoByInode dumps all TCP sockets over sock_diag netlink and returns
+// their tcp_info counters keyed by socket inode
+func tcpInfoByInode() (map[uint64]tcpStats, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_INET_DIAG)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sock_diag socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	timeout := unix.Timeval{Sec: 2}
+	unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout)
+
+	stats := make(map[uint64]tcpStats)
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		if err := dumpTCPInfo(fd, family, stats); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// dumpTCPInfo requests every TCP socket of one address family
+func dumpTCPInfo(fd int, family uint8, stats map[uint64]tcpStats) error {
+	req := make([]byte, unix.SizeofNlMsghdr+sizeofInetDiagReqV2)
+	binary.NativeEndian.PutUint32(req[0:4], uint32(len(req)))
+	binary.NativeEndian.PutUint16(req[4:6], unix.SOCK_DIAG_BY_FAMILY)
+	binary.NativeEndian.PutUint16(req[6:8], unix.NLM_F_REQUEST|unix.NLM_F_DUMP)
+	binary.NativeEndian.PutUint32(req[8:12], 1)
+
+	diag := req[unix.SizeofNlMsghdr:]
+	diag[0] = family
+	diag[1] = unix.IPPROTO_TCP
+	diag[2] = 1 << (inetDiagInfo - 1)
+	binary.NativeEndian.PutUint32(diag[4:8], 0xffffffff) // all states
+
+	if err := unix.Sendto(fd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to send sock_diag request: %v", err)
+	}
+
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return fmt.Errorf("failed to read sock_diag reply: %v", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return fmt.Errorf("failed to parse sock_diag reply: %v", err)
+		}
+		for _, msg := range msgs {
+			switch msg.Header.Type {
+			case unix.NLMSG_DONE:
+				return nil
+			case unix.NLMSG_ERROR:
+				if len(msg.Data) >= 4 {
+					if errno := -int32(binary.NativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+						return fmt.Errorf("sock_diag request failed: %v", unix.Errno(errno))
+					}
+				}
+				return nil
+			}
+			if len(msg.Data) < sizeofInetDiagMsg {
+				continue
+			}
+
+			inode := uint64(binary.NativeEndian.Uint32(msg.Data[68:72]))
+			for _, attr := range parseRouteAttrs(msg.Data[sizeofInetDiagMsg:]) {
+				// Older kernels send a shorter tcp_info; total_retrans ends at 104
+				if attr.Attr.Type != inetDiagInfo || len(attr.Value) < 104 {
+					continue
+				}
+				info := attr.Value
+				stats[inode] = tcpStats{
+					retransmits:  info[2],
+					rttUS:        binary.NativeEndian.Uint32(info[68:72]),
+					rttVarUS:     binary.NativeEndian.Uint32(info[72:76]),
+					totalRetrans: binary.NativeEndian.Uint32(info[100:104]),
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package core
+
+import "errors"
+
+// tcpInfoByInode needs sock_diag netlink, which is only available on Linux
+func tcpInfoByInode() (map[uint64]tcpStats, error) {
+	return nil, errors.New("tcp_info is only available on Linux")
+}
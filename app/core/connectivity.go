@@ -0,0 +1,434 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Connectivity states, from least to most reachable. Each state is the name
+// of the last stage that passed; captive-portal means a portal intercepted
+// the internet probe.
+const (
+	ConnectivityOffline       = "offline"
+	ConnectivityLink          = "link"
+	ConnectivityLocal         = "local"
+	ConnectivityGateway       = "gateway"
+	ConnectivityDNS           = "dns"
+	ConnectivityInternet      = "internet"
+	ConnectivityCaptivePortal = "captive-portal"
+)
+
+// ConnectivityConfig sets where the connectivity check probes
+type ConnectivityConfig struct {
+	ProbeURLs []string      `json:"probeUrls"` // HTTP URLs that answer 204 No Content, tried in order
+	DNSName   string        `json:"dnsName"`   // name the DNS stage resolves; defaults to the first probe's host
+	Timeout   time.Duration `json:"timeout"`   // per stage
+}
+
+// DefaultConnectivityConfig returns the probes used unless configured otherwise
+func DefaultConnectivityConfig() ConnectivityConfig {
+	return ConnectivityConfig{
+		ProbeURLs: []string{
+			"http://connectivitycheck.gstatic.com/generate_204",
+			"http://cp.cloudflare.com/generate_204",
+		},
+		Timeout: 3 * time.Second,
+	}
+}
+
+// ConnectivityStage is the outcome of one step of the connectivity check
+type ConnectivityStage struct {
+	Name       string  `json:"name"`
+	OK         bool    `json:"ok"`
+	Detail     string  `json:"detail"`
+	DurationMS float64 `json:"durationMs"`
+}
+
+// ProxyInfo is the HTTP(S) proxy configuration of the host
+type ProxyInfo struct {
+	Configured bool   `json:"configured"`
+	HTTP       string `json:"http,omitempty"`
+	HTTPS      string `json:"https,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
+	PACURL     string `json:"pacUrl,omitempty"` // proxy auto-config script; probes cannot evaluate it and go direct
+	Source     string `json:"source,omitempty"` // environment, /etc/environment or gsettings
+}
+
+// ConnectivityInfo is how far the host can reach, stage by stage
+type ConnectivityInfo struct {
+	State       string              `json:"state"`
+	FailedStage string              `json:"failedStage,omitempty"` // first stage that failed
+	Stages      []ConnectivityStage `json:"stages"`
+	ProbeURL    string              `json:"probeUrl,omitempty"`  // probe that gave the answer
+	PortalURL   string              `json:"portalUrl,omitempty"` // where a captive portal redirected the probe
+	Proxy       ProxyInfo           `json:"proxy"`
+	CheckedAt   time.Time           `json:"checkedAt"`
+}
+
+// Status maps the state onto Connection.Status
+func (ci *ConnectivityInfo) Status() string {
+	switch ci.State {
+	case ConnectivityInternet:
+		return "connected"
+	case ConnectivityOffline:
+		return "disconnected"
+	}
+	return "limited"
+}
+
+var connectivityConfig = DefaultConnectivityConfig()
+
+// SetConnectivityConfig replaces the probes the connectivity collector uses
+func SetConnectivityConfig(cfg ConnectivityConfig) {
+	connectivityConfig = cfg
+}
+
+// CheckConnectivity walks the stages link, local, gateway, dns and internet
+// in order and stops at the first that fails
+func CheckConnectivity(cfg ConnectivityConfig) *ConnectivityInfo {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultConnectivityConfig().Timeout
+	}
+	if len(cfg.ProbeURLs) == 0 {
+		cfg.ProbeURLs = DefaultConnectivityConfig().ProbeURLs
+	}
+	if cfg.DNSName == "" {
+		if u, err := url.Parse(cfg.ProbeURLs[0]); err == nil {
+			cfg.DNSName = u.Hostname()
+		}
+	}
+
+	info := &ConnectivityInfo{State: ConnectivityOffline, Proxy: DetectProxy(), CheckedAt: time.Now()}
+	info.runStages([]connectivityCheck{
+		{ConnectivityLink, checkLink},
+		{ConnectivityLocal, checkLocalAddress},
+		{ConnectivityGateway, checkGateway},
+		{ConnectivityDNS, func() (bool, string) { return checkDNS(cfg.DNSName, cfg.Timeout) }},
+		{ConnectivityInternet, func() (bool, string) { return info.probeInternet(cfg) }},
+	})
+	return info
+}
+
+// connectivityCheck is one stage of the connectivity check
+type connectivityCheck struct {
+	name string
+	run  func() (bool, string)
+}
+
+// runStages runs the checks in order, stopping at the first that fails, and
+// sets the state from the last stage that passed
+func (ci *ConnectivityInfo) runStages(stages []connectivityCheck) {
+	for _, stage := range stages {
+		start := time.Now()
+		ok, detail := stage.run()
+		ci.Stages = append(ci.Stages, ConnectivityStage{
+			Name:       stage.name,
+			OK:         ok,
+			Detail:     detail,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		})
+		if !ok {
+			ci.FailedStage = stage.name
+			break
+		}
+		ci.State = stage.name
+	}
+	// The probe only records which URL answered when it got a 204 or a portal
+	if ci.FailedStage == ConnectivityInternet && ci.ProbeURL != "" {
+		ci.State = ConnectivityCaptivePortal
+	}
+}
+
+// upInterfaces returns the non-loopback interfaces that are up with carrier
+func upInterfaces() []net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var up []net.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 && iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagRunning != 0 {
+			up = append(up, iface)
+		}
+	}
+	return up
+}
+
+// checkLink passes when an interface is up and has carrier
+func checkLink() (bool, string) {
+	var names []string
+	for _, iface := range upInterfaces() {
+		names = append(names, iface.Name)
+	}
+	if len(names) == 0 {
+		return false, "no interface is up with carrier"
+	}
+	return true, strings.Join(names, ", ")
+}
+
+// checkLocalAddress passes when an up interface has a routable (non link-local) address
+func checkLocalAddress() (bool, string) {
+	var found []string
+	for _, iface := range upInterfaces() {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+				found = append(found, iface.Name+" "+ipNet.IP.String())
+			}
+		}
+	}
+	if len(found) == 0 {
+		return false, "no interface has a routable address (only link-local, or DHCP has not answered)"
+	}
+	return true, strings.Join(found, ", ")
+}
+
+// checkGateway passes when the default gateway answers ping, or at least ARP/NDP
+func checkGateway() (bool, string) {
+	gateway, dev := defaultRoute()
+	if gateway == "" {
+		return false, "no default route"
+	}
+
+	target := gateway
+	if strings.HasPrefix(gateway, "fe80:") && dev != "" {
+		target += "%" + dev
+	}
+	if exec.Command("ping", "-c", "1", "-W", "1", target).Run() == nil {
+		return true, gateway + " answers ping"
+	}
+
+	// Many gateways drop ICMP; a resolved neighbor entry still proves they are there
+	out, err := exec.Command("ip", "neigh", "show", gateway).Output()
+	if err == nil {
+		fields := strings.Fields(string(out))
+		state := ""
+		if len(fields) > 0 {
+			state = fields[len(fields)-1]
+		}
+		if strings.Contains(string(out), "lladdr") && state != "FAILED" && state != "INCOMPLETE" {
+			return true, gateway + " does not answer ping but its neighbor entry is " + state
+		}
+	}
+	return false, gateway + " does not answer ping or ARP/NDP"
+}
+
+// defaultRoute returns the IPv4 default gateway and device, or the IPv6 one
+// when there is no IPv4 default route
+func defaultRoute() (gateway, dev string) {
+	for _, family := range []string{"-4", "-6"} {
+		out, err := exec.Command("ip", family, "route", "show", "default").Output()
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			var via, device string
+			fields := strings.Fields(scanner.Text())
+			for i := 0; i+1 < len(fields); i++ {
+				switch fields[i] {
+				case "via":
+					via = fields[i+1]
+				case "dev":
+					device = fields[i+1]
+				}
+			}
+			if via != "" {
+				return via, device
+			}
+		}
+	}
+	return "", ""
+}
+
+// checkDNS passes when name resolves
+func checkDNS(name string, timeout time.Duration) (bool, string) {
+	if name == "" {
+		return false, "no name to resolve"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, name)
+	if err != nil {
+		return false, fmt.Sprintf("failed to resolve %s: %v", name, err)
+	}
+	return true, fmt.Sprintf("%s resolves to %s", name, strings.Join(addrs, ", "))
+}
+
+// probeInternet fetches the probe URLs without following redirects. A 204
+// means the internet is reachable; a redirect or a page instead means a
+// captive portal answered. Probes that fail outright fall through to the next.
+func (ci *ConnectivityInfo) probeInternet(cfg ConnectivityConfig) (bool, string) {
+	client := &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{Proxy: ci.Proxy.proxyFunc()},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var failures []string
+	for _, probe := range cfg.ProbeURLs {
+		resp, err := client.Get(probe)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", probe, err))
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNoContent:
+			ci.ProbeURL = probe
+			return true, probe + " returned 204"
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			ci.ProbeURL = probe
+			ci.PortalURL = resp.Header.Get("Location")
+			return false, fmt.Sprintf("%s was redirected to %s (captive portal)", probe, ci.PortalURL)
+		case resp.StatusCode == http.StatusOK && len(bytes.TrimSpace(body)) > 0:
+			ci.ProbeURL = probe
+			return false, probe + " returned a page instead of 204 (captive portal)"
+		case resp.StatusCode == http.StatusProxyAuthRequired:
+			failures = append(failures, probe+": proxy requires authentication")
+		default:
+			failures = append(failures, fmt.Sprintf("%s: unexpected status %s", probe, resp.Status))
+		}
+	}
+	return false, strings.Join(failures, "; ")
+}
+
+// proxyFunc routes probes through the detected proxy. Without a proxy, or
+// with only a PAC script, probes go direct.
+func (p ProxyInfo) proxyFunc() func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxy := p.HTTP
+		if req.URL.Scheme == "https" {
+			proxy = p.HTTPS
+		}
+		if proxy == "" || noProxyMatches(p.NoProxy, req.URL.Hostname()) {
+			return nil, nil
+		}
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		return url.Parse(proxy)
+	}
+}
+
+// noProxyMatches reports whether host is excluded by a NO_PROXY list
+func noProxyMatches(noProxy, host string) bool {
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(host); ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, "*")
+		if host == strings.TrimPrefix(entry, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectProxy reads the proxy settings from NetTool's environment, then
+// /etc/environment, then the GNOME proxy settings
+func DetectProxy() ProxyInfo {
+	if p := proxyFromVars(os.Getenv); p.Configured {
+		p.Source = "environment"
+		return p
+	}
+
+	if data, err := os.ReadFile("/etc/environment"); err == nil {
+		vars := make(map[string]string)
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+			if ok && !strings.HasPrefix(key, "#") {
+				vars[strings.TrimPrefix(key, "export ")] = strings.Trim(value, `"'`)
+			}
+		}
+		if p := proxyFromVars(func(key string) string { return vars[key] }); p.Configured {
+			p.Source = "/etc/environment"
+			return p
+		}
+	}
+
+	return proxyFromGsettings()
+}
+
+// proxyFromVars reads the conventional proxy variables, upper or lower case
+func proxyFromVars(getenv func(string) string) ProxyInfo {
+	get := func(name string) string {
+		if value := getenv(strings.ToUpper(name)); value != "" {
+			return value
+		}
+		return getenv(name)
+	}
+	all := get("all_proxy")
+	p := ProxyInfo{
+		HTTP:    firstNonEmpty(get("http_proxy"), all),
+		HTTPS:   firstNonEmpty(get("https_proxy"), all),
+		NoProxy: get("no_proxy"),
+	}
+	p.Configured = p.HTTP != "" || p.HTTPS != ""
+	return p
+}
+
+// proxyFromGsettings reads the desktop proxy settings, including a PAC URL
+func proxyFromGsettings() ProxyInfo {
+	get := func(args ...string) string {
+		out, err := exec.Command("gsettings", append([]string{"get"}, args...)...).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.Trim(strings.TrimSpace(string(out)), "'")
+	}
+
+	var p ProxyInfo
+	switch get("org.gnome.system.proxy", "mode") {
+	case "auto":
+		p.PACURL = get("org.gnome.system.proxy", "autoconfig-url")
+	case "manual":
+		for _, scheme := range []string{"http", "https"} {
+			host := get("org.gnome.system.proxy."+scheme, "host")
+			port := get("org.gnome.system.proxy."+scheme, "port")
+			if host == "" || port == "0" {
+				continue
+			}
+			if scheme == "http" {
+				p.HTTP = net.JoinHostPort(host, port)
+			} else {
+				p.HTTPS = net.JoinHostPort(host, port)
+			}
+		}
+	}
+	p.Configured = p.HTTP != "" || p.HTTPS != "" || p.PACURL != ""
+	if p.Configured {
+		p.Source = "gsettings"
+	}
+	return p
+}
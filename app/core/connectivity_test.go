@@ -0,0 +1,150 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// probeServer serves one canned answer to the internet probe
+func probeServer(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL + "/generate_204"
+}
+
+// refusedURL returns a URL on a loopback port nothing listens on
+func refusedURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return fmt.Sprintf("http://%s/generate_204", addr)
+}
+
+// checkInternet runs the connectivity stages with the local ones passing, so
+// only the internet probe against the given URLs decides the state
+func checkInternet(probeURLs ...string) *ConnectivityInfo {
+	cfg := ConnectivityConfig{ProbeURLs: probeURLs, Timeout: 2 * time.Second}
+	pass := func() (bool, string) { return true, "stubbed" }
+	info := &ConnectivityInfo{State: ConnectivityOffline}
+	info.runStages([]connectivityCheck{
+		{ConnectivityLink, pass},
+		{ConnectivityLocal, pass},
+		{ConnectivityGateway, pass},
+		{ConnectivityDNS, pass},
+		{ConnectivityInternet, func() (bool, string) { return info.probeInternet(cfg) }},
+	})
+	return info
+}
+
+func TestCheckConnectivityProbe(t *testing.T) {
+	noContent := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	portalPage := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>Accept the terms to continue</body></html>")
+	}
+	redirect := func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://portal.example/login", http.StatusFound)
+	}
+	emptyPage := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	tests := []struct {
+		name      string
+		probes    func(t *testing.T) []string
+		state     string
+		failed    string
+		portalURL string
+		detail    string
+	}{
+		{
+			name:   "204 means online",
+			probes: func(t *testing.T) []string { return []string{probeServer(t, noContent)} },
+			state:  ConnectivityInternet,
+			detail: "returned 204",
+		},
+		{
+			name:   "page instead of 204 is a captive portal",
+			probes: func(t *testing.T) []string { return []string{probeServer(t, portalPage)} },
+			state:  ConnectivityCaptivePortal,
+			failed: ConnectivityInternet,
+			detail: "captive portal",
+		},
+		{
+			name:      "redirect is a captive portal",
+			probes:    func(t *testing.T) []string { return []string{probeServer(t, redirect)} },
+			state:     ConnectivityCaptivePortal,
+			failed:    ConnectivityInternet,
+			portalURL: "http://portal.example/login",
+			detail:    "redirected to http://portal.example/login",
+		},
+		{
+			name:   "refused connection fails the internet stage",
+			probes: func(t *testing.T) []string { return []string{refusedURL(t)} },
+			state:  ConnectivityDNS,
+			failed: ConnectivityInternet,
+			detail: "connection refused",
+		},
+		{
+			name:   "empty 200 is neither online nor a portal",
+			probes: func(t *testing.T) []string { return []string{probeServer(t, emptyPage)} },
+			state:  ConnectivityDNS,
+			failed: ConnectivityInternet,
+			detail: "unexpected status 200 OK",
+		},
+		{
+			name:   "refused probe falls through to the next",
+			probes: func(t *testing.T) []string { return []string{refusedURL(t), probeServer(t, noContent)} },
+			state:  ConnectivityInternet,
+			detail: "returned 204",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := checkInternet(tt.probes(t)...)
+			if info.State != tt.state || info.FailedStage != tt.failed {
+				t.Errorf("state %q failed stage %q, want %q and %q", info.State, info.FailedStage, tt.state, tt.failed)
+			}
+			if info.PortalURL != tt.portalURL {
+				t.Errorf("portal URL = %q, want %q", info.PortalURL, tt.portalURL)
+			}
+			if len(info.Stages) != 5 {
+				t.Fatalf("ran %d stages, want 5: %+v", len(info.Stages), info.Stages)
+			}
+			internet := info.Stages[4]
+			if internet.Name != ConnectivityInternet || internet.OK != (tt.failed == "") {
+				t.Errorf("internet stage = %+v, want ok %v", internet, tt.failed == "")
+			}
+			if !strings.Contains(internet.Detail, tt.detail) {
+				t.Errorf("internet stage detail = %q, want it to mention %q", internet.Detail, tt.detail)
+			}
+		})
+	}
+}
+
+func TestCheckConnectivityStopsAtFirstFailure(t *testing.T) {
+	probed := false
+	info := &ConnectivityInfo{State: ConnectivityOffline}
+	info.runStages([]connectivityCheck{
+		{ConnectivityLink, func() (bool, string) { return true, "eth0" }},
+		{ConnectivityLocal, func() (bool, string) { return false, "no routable address" }},
+		{ConnectivityGateway, func() (bool, string) { probed = true; return true, "" }},
+	})
+	if info.State != ConnectivityLink || info.FailedStage != ConnectivityLocal {
+		t.Errorf("state %q failed stage %q, want link and local", info.State, info.FailedStage)
+	}
+	if probed || len(info.Stages) != 2 {
+		t.Errorf("ran %d stages, want the check to stop after the failed one", len(info.Stages))
+	}
+	if info.Status() != "limited" {
+		t.Errorf("status = %q, want limited", info.Status())
+	}
+}
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConntrackTuple is one direction of a tracked flow
+type ConntrackTuple struct {
+	Source          string `json:"source"`
+	Destination     string `json:"destination"`
+	SourcePort      int    `json:"sourcePort,omitempty"`
+	DestinationPort int    `json:"destinationPort,omitempty"`
+	Packets         uint64 `json:"packets"`
+	Bytes           uint64 `json:"bytes"`
+}
+
+// ConntrackFlow is a single entry of the connection tracking table
+type ConntrackFlow struct {
+	Family     string         `json:"family"` // ipv4 or ipv6
+	Protocol   string         `json:"protocol"`
+	State      string         `json:"state,omitempty"` // TCP state; empty for stateless protocols
+	TimeoutSec int            `json:"timeoutSec"`
+	Original   ConntrackTuple `json:"original"`
+	Reply      ConntrackTuple `json:"reply"`
+	NAT        string         `json:"nat,omitempty"` // snat, dnat or snat+dnat
+	Assured    bool           `json:"assured"`
+	Unreplied  bool           `json:"unreplied"`
+	Mark       int            `json:"mark"`
+	Zone       int            `json:"zone,omitempty"`
+	Packets    uint64         `json:"packets"` // both directions
+	Bytes      uint64         `json:"bytes"`
+}
+
+// ConntrackHost aggregates the flows started by one address
+type ConntrackHost struct {
+	Address     string `json:"address"`
+	Flows       int    `json:"flows"`
+	BytesSent   uint64 `json:"bytesSent"`     // original direction
+	BytesRecv   uint64 `json:"bytesReceived"` // reply direction
+	PacketsSent uint64 `json:"packetsSent"`
+	PacketsRecv uint64 `json:"packetsReceived"`
+	NATFlows    int    `json:"natFlows"`
+}
+
+// ConntrackOptions selects and limits the flows returned by GetConntrackTable
+type ConntrackOptions struct {
+	Protocol string // e.g. tcp, udp, icmp
+	Host     string // matches any address of either tuple
+	NATOnly  bool
+	Limit    int // maximum flows returned, 0 for all
+	Top      int // number of top flows by bytes, default 10
+}
+
+// ConntrackInfo is the connection tracking table at one point in time
+type ConntrackInfo struct {
+	Source          string          `json:"source"` // where the table was read from
+	Count           int             `json:"count"`  // entries in the kernel table
+	Max             int             `json:"max,omitempty"`
+	CountersEnabled bool            `json:"countersEnabled"` // nf_conntrack_acct; without it bytes and packets stay zero
+	Matched         int             `json:"matched"`
+	Flows           []ConntrackFlow `json:"flows"`
+	TopFlows        []ConntrackFlow `json:"topFlows"`
+	Hosts           []ConntrackHost `json:"hosts"`
+	CollectedAt     time.Time       `json:"collectedAt"`
+}
+
+// GetConntrackTable reads the netfilter connection tracking table, preferring
+// /proc/net/nf_conntrack and falling back to the 'conntrack' command
+func GetConntrackTable(opts ConntrackOptions) (*ConntrackInfo, error) {
+	info := &ConntrackInfo{CollectedAt: time.Now()}
+
+	var flows []ConntrackFlow
+	if f, err := os.Open("/proc/net/nf_conntrack"); err == nil {
+		flows, err = ParseConntrack(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		info.Source = "/proc/net/nf_conntrack"
+	} else {
+		cmd := exec.Command("conntrack", "-L", "-o", "extended")
+		var out, stderr bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("connection tracking is unavailable (is nf_conntrack loaded and are you root?): %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+		flows, err = ParseConntrack(&out)
+		if err != nil {
+			return nil, err
+		}
+		info.Source = "conntrack"
+	}
+
+	info.Count = len(flows)
+	info.Max = readIntFile("/proc/sys/net/netfilter/nf_conntrack_max")
+	info.CountersEnabled = readIntFile("/proc/sys/net/netfilter/nf_conntrack_acct") == 1
+
+	var matched []ConntrackFlow
+	for _, flow := range flows {
+		if opts.matches(flow) {
+			matched = append(matched, flow)
+		}
+	}
+	info.Matched = len(matched)
+	info.Hosts = conntrackHosts(matched)
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Bytes > matched[j].Bytes })
+	top := opts.Top
+	if top <= 0 {
+		top = 10
+	}
+	info.TopFlows = matched[:min(top, len(matched))]
+
+	info.Flows = matched
+	if opts.Limit > 0 && len(matched) > opts.Limit {
+		info.Flows = matched[:opts.Limit]
+	}
+	return info, nil
+}
+
+// matches reports whether a flow passes the options' filters
+func (opts ConntrackOptions) matches(flow ConntrackFlow) bool {
+	if opts.Protocol != "" && !strings.EqualFold(opts.Protocol, flow.Protocol) {
+		return false
+	}
+	if opts.NATOnly && flow.NAT == "" {
+		return false
+	}
+	if opts.Host != "" {
+		for _, addr := range []string{flow.Original.Source, flow.Original.Destination, flow.Reply.Source, flow.Reply.Destination} {
+			if addr == opts.Host {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// conntrackHosts aggregates flows by the address that started them, busiest first
+func conntrackHosts(flows []ConntrackFlow) []ConntrackHost {
+	byAddress := make(map[string]*ConntrackHost)
+	for _, flow := range flows {
+		host, ok := byAddress[flow.Original.Source]
+		if !ok {
+			host = &ConntrackHost{Address: flow.Original.Source}
+			byAddress[flow.Original.Source] = host
+		}
+		host.Flows++
+		host.BytesSent += flow.Original.Bytes
+		host.BytesRecv += flow.Reply.Bytes
+		host.PacketsSent += flow.Original.Packets
+		host.PacketsRecv += flow.Reply.Packets
+		if flow.NAT != "" {
+			host.NATFlows++
+		}
+	}
+
+	hosts := make([]ConntrackHost, 0, len(byAddress))
+	for _, host := range byAddress {
+		hosts = append(hosts, *host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := hosts[i], hosts[j]
+		if a.BytesSent+a.BytesRecv != b.BytesSent+b.BytesRecv {
+			return a.BytesSent+a.BytesRecv > b.BytesSent+b.BytesRecv
+		}
+		if a.Flows != b.Flows {
+			return a.Flows > b.Flows
+		}
+		return a.Address < b.Address
+	})
+	return hosts
+}
+
+// ParseConntrack parses /proc/net/nf_conntrack or 'conntrack -L' output.
+// Lines look like:
+//
+//	ipv4 2 tcp 6 431999 ESTABLISHED src=10.0.0.2 dst=1.1.1.1 sport=51000 dport=443 packets=5 bytes=420 src=1.1.1.1 dst=203.0.113.5 sport=443 dport=51000 packets=4 bytes=3000 [ASSURED] mark=0 zone=0 use=2
+func ParseConntrack(r io.Reader) ([]ConntrackFlow, error) {
+	var flows []ConntrackFlow
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		var flow ConntrackFlow
+		// /proc/net/nf_conntrack prefixes the layer 3 protocol; 'conntrack -L' may not
+		if fields[0] == "ipv4" || fields[0] == "ipv6" {
+			flow.Family = fields[0]
+			fields = fields[2:]
+		}
+		if len(fields) < 3 {
+			continue
+		}
+		flow.Protocol = fields[0]
+		flow.TimeoutSec, _ = strconv.Atoi(fields[2])
+
+		tuple := &flow.Original
+		seenSource := false
+		for _, field := range fields[3:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				switch field {
+				case "[ASSURED]":
+					flow.Assured = true
+				case "[UNREPLIED]":
+					flow.Unreplied = true
+				default:
+					if !strings.HasPrefix(field, "[") && flow.State == "" {
+						flow.State = field
+					}
+				}
+				continue
+			}
+
+			switch key {
+			case "src":
+				// The second src= starts the reply tuple
+				if seenSource {
+					tuple = &flow.Reply
+				}
+				seenSource = true
+				tuple.Source = value
+			case "dst":
+				tuple.Destination = value
+			case "sport":
+				tuple.SourcePort, _ = strconv.Atoi(value)
+			case "dport":
+				tuple.DestinationPort, _ = strconv.Atoi(value)
+			case "packets":
+				tuple.Packets, _ = strconv.ParseUint(value, 10, 64)
+			case "bytes":
+				tuple.Bytes, _ = strconv.ParseUint(value, 10, 64)
+			case "mark":
+				flow.Mark, _ = strconv.Atoi(value)
+			case "zone":
+				flow.Zone, _ = strconv.Atoi(value)
+			}
+		}
+		if flow.Original.Source == "" {
+			continue
+		}
+		if flow.Family == "" {
+			flow.Family = "ipv4"
+			if strings.Contains(flow.Original.Source, ":") {
+				flow.Family = "ipv6"
+			}
+		}
+
+		flow.NAT = conntrackNAT(flow.Original, flow.Reply)
+		flow.Packets = flow.Original.Packets + flow.Reply.Packets
+		flow.Bytes = flow.Original.Bytes + flow.Reply.Bytes
+		flows = append(flows, flow)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read conntrack table: %v", err)
+	}
+	return flows, nil
+}
+
+// conntrackNAT works out which translations apply to a flow. Without NAT the
+// reply tuple is the original one reversed.
+func conntrackNAT(original, reply ConntrackTuple) string {
+	if reply.Source == "" {
+		return ""
+	}
+	dnat := reply.Source != original.Destination || reply.SourcePort != original.DestinationPort
+	snat := reply.Destination != original.Source || reply.DestinationPort != original.SourcePort
+	switch {
+	case snat && dnat:
+		return "snat+dnat"
+	case snat:
+		return "snat"
+	case dnat:
+		return "dnat"
+	}
+	return ""
+}
+
+// readIntFile reads a single integer from a file such as a sysctl, returning 0 on error
+func readIntFile(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return value
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConntrack(t *testing.T) {
+	tests := []struct {
+		name string
+		line string // as printed by 'conntrack -L', without the layer 3 prefix
+		want ConntrackFlow
+	}{
+		{
+			name: "snat",
+			line: "tcp      6 431999 ESTABLISHED src=192.168.1.10 dst=93.184.216.34 sport=51000 dport=443 packets=5 bytes=420 src=93.184.216.34 dst=203.0.113.5 sport=443 dport=51000 packets=4 bytes=3000 [ASSURED] mark=0 use=2",
+			want: ConntrackFlow{
+				Family: "ipv4", Protocol: "tcp", State: "ESTABLISHED", TimeoutSec: 431999,
+				Original: ConntrackTuple{Source: "192.168.1.10", Destination: "93.184.216.34", SourcePort: 51000, DestinationPort: 443, Packets: 5, Bytes: 420},
+				Reply:    ConntrackTuple{Source: "93.184.216.34", Destination: "203.0.113.5", SourcePort: 443, DestinationPort: 51000, Packets: 4, Bytes: 3000},
+				NAT:      "snat", Assured: true, Packets: 9, Bytes: 3420,
+			},
+		},
+		{
+			name: "dnat",
+			line: "tcp      6 86399 ESTABLISHED src=198.51.100.7 dst=203.0.113.5 sport=40000 dport=8080 packets=3 bytes=180 src=192.168.1.20 dst=198.51.100.7 sport=80 dport=40000 packets=2 bytes=120 [ASSURED] mark=3 zone=5 use=1",
+			want: ConntrackFlow{
+				Family: "ipv4", Protocol: "tcp", State: "ESTABLISHED", TimeoutSec: 86399,
+				Original: ConntrackTuple{Source: "198.51.100.7", Destination: "203.0.113.5", SourcePort: 40000, DestinationPort: 8080, Packets: 3, Bytes: 180},
+				Reply:    ConntrackTuple{Source: "192.168.1.20", Destination: "198.51.100.7", SourcePort: 80, DestinationPort: 40000, Packets: 2, Bytes: 120},
+				NAT:      "dnat", Assured: true, Mark: 3, Zone: 5, Packets: 5, Bytes: 300,
+			},
+		},
+		{
+			name: "unreplied",
+			line: "udp      17 29 src=192.168.1.10 dst=192.168.1.255 sport=137 dport=137 packets=1 bytes=78 [UNREPLIED] src=192.168.1.255 dst=192.168.1.10 sport=137 dport=137 packets=0 bytes=0 mark=0 use=1",
+			want: ConntrackFlow{
+				Family: "ipv4", Protocol: "udp", TimeoutSec: 29,
+				Original:  ConntrackTuple{Source: "192.168.1.10", Destination: "192.168.1.255", SourcePort: 137, DestinationPort: 137, Packets: 1, Bytes: 78},
+				Reply:     ConntrackTuple{Source: "192.168.1.255", Destination: "192.168.1.10", SourcePort: 137, DestinationPort: 137},
+				Unreplied: true, Packets: 1, Bytes: 78,
+			},
+		},
+		{
+			name: "icmp",
+			line: "icmp     1 29 src=192.168.1.10 dst=1.1.1.1 type=8 code=0 id=7 packets=1 bytes=84 src=1.1.1.1 dst=203.0.113.5 type=0 code=0 id=7 packets=1 bytes=84 mark=0 use=1",
+			want: ConntrackFlow{
+				Family: "ipv4", Protocol: "icmp", TimeoutSec: 29,
+				Original: ConntrackTuple{Source: "192.168.1.10", Destination: "1.1.1.1", Packets: 1, Bytes: 84},
+				Reply:    ConntrackTuple{Source: "1.1.1.1", Destination: "203.0.113.5", Packets: 1, Bytes: 84},
+				NAT:      "snat", Packets: 2, Bytes: 168,
+			},
+		},
+		{
+			name: "ipv6",
+			line: "tcp      6 117 TIME_WAIT src=2001:db8::10 dst=2001:db8:1::1 sport=50000 dport=443 packets=10 bytes=1000 src=2001:db8:1::1 dst=2001:db8::10 sport=443 dport=50000 packets=8 bytes=5000 [ASSURED] mark=0 use=2",
+			want: ConntrackFlow{
+				Family: "ipv6", Protocol: "tcp", State: "TIME_WAIT", TimeoutSec: 117,
+				Original: ConntrackTuple{Source: "2001:db8::10", Destination: "2001:db8:1::1", SourcePort: 50000, DestinationPort: 443, Packets: 10, Bytes: 1000},
+				Reply:    ConntrackTuple{Source: "2001:db8:1::1", Destination: "2001:db8::10", SourcePort: 443, DestinationPort: 50000, Packets: 8, Bytes: 5000},
+				Assured:  true, Packets: 18, Bytes: 6000,
+			},
+		},
+	}
+	for _, tt := range tests {
+		// /proc/net/nf_conntrack and 'conntrack -L -o extended' prefix the
+		// layer 3 protocol name and number
+		number := "2"
+		if tt.want.Family == "ipv6" {
+			number = "10"
+		}
+		forms := map[string]string{
+			"conntrack -L":           tt.line,
+			"/proc/net/nf_conntrack": tt.want.Family + "     " + number + " " + tt.line,
+		}
+		for form, line := range forms {
+			flows, err := ParseConntrack(strings.NewReader(line + "\n"))
+			if err != nil {
+				t.Errorf("%s (%s): %v", tt.name, form, err)
+				continue
+			}
+			if len(flows) != 1 || !reflect.DeepEqual(flows[0], tt.want) {
+				t.Errorf("%s (%s) = %+v, want %+v", tt.name, form, flows, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseConntrackSkipsOtherLines(t *testing.T) {
+	input := strings.Join([]string{
+		"",
+		"conntrack v1.4.7 (conntrack-tools): 1 flow entries have been shown.",
+		"ipv4     2 tcp",
+		"udp      17 29 src=192.168.1.10 dst=192.168.1.1 sport=5353 dport=53 src=192.168.1.1 dst=192.168.1.10 sport=53 dport=5353 mark=0 use=1",
+	}, "\n")
+	flows, err := ParseConntrack(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(flows) != 1 || flows[0].Original.Source != "192.168.1.10" || flows[0].NAT != "" {
+		t.Errorf("flows = %+v, want the one UDP flow without NAT", flows)
+	}
+}
+
+func TestConntrackNAT(t *testing.T) {
+	original := ConntrackTuple{Source: "192.168.1.10", Destination: "198.51.100.1", SourcePort: 40000, DestinationPort: 80}
+	tests := []struct {
+		name  string
+		reply ConntrackTuple
+		want  string
+	}{
+		{"reversed", ConntrackTuple{Source: "198.51.100.1", Destination: "192.168.1.10", SourcePort: 80, DestinationPort: 40000}, ""},
+		{"no reply tuple", ConntrackTuple{}, ""},
+		{"source port rewritten", ConntrackTuple{Source: "198.51.100.1", Destination: "192.168.1.10", SourcePort: 80, DestinationPort: 61000}, "snat"},
+		{"destination port rewritten", ConntrackTuple{Source: "198.51.100.1", Destination: "192.168.1.10", SourcePort: 8080, DestinationPort: 40000}, "dnat"},
+		{"both rewritten", ConntrackTuple{Source: "10.0.0.5", Destination: "203.0.113.5", SourcePort: 80, DestinationPort: 40000}, "snat+dnat"},
+	}
+	for _, tt := range tests {
+		if got := conntrackNAT(original, tt.reply); got != tt.want {
+			t.Errorf("%s: conntrackNAT = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DHCPLease represents a lease held by one of the supported DHCP clients.
+// Times the client did not record are the zero time.
+type DHCPLease struct {
+	Client        string    `json:"client,omitempty"` // dhclient, dhcpcd, systemd-networkd or NetworkManager
+	Interface     string    `json:"interface,omitempty"`
+	LeaseFile     string    `json:"leaseFile,omitempty"`
+	Address       string    `json:"address,omitempty"`
+	SubnetMask    string    `json:"subnetMask,omitempty"`
+	LeaseObtained time.Time `json:"leaseObtained"`
+	LeaseExpires  time.Time `json:"leaseExpires"`
+	RenewalTime   time.Time `json:"renewalTime"`
+	RebindTime    time.Time `json:"rebindTime"`
+	DHCPServer    string    `json:"dhcpServer,omitempty"`
+	Routers       []string  `json:"routers,omitempty"`
+	DNSServers    []string  `json:"dnsServers,omitempty"`
+	NTPServers    []string  `json:"ntpServers,omitempty"`
+	DomainName    string    `json:"domainName,omitempty"`
+	Routes        []string  `json:"routes,omitempty"`
+}
+
+// Locations searched for lease files, per DHCP client
+var (
+	dhclientLeaseGlobs = []string{
+		"/var/lib/dhcp/dhclient*.leases",
+		"/var/lib/dhcp/dhclient*.lease",
+		"/var/lib/dhclient/dhclient*.leases",
+	}
+	dhcpcdLeaseGlobs = []string{
+		"/var/lib/dhcpcd/*.lease",
+		"/var/lib/dhcpcd5/*.lease",
+		"/var/db/dhcpcd/*.lease",
+		"/var/lib/dhcpcd/*.info",
+	}
+	networkdLeaseDir       = "/run/systemd/netif/leases"
+	networkManagerDevDir   = "/run/NetworkManager/devices"
+	networkManagerLeaseDir = "/var/lib/NetworkManager"
+)
+
+// GetDHCPInfo inspects the lease files of all supported DHCP clients and
+// reports whether the interface is configured by DHCP and with which lease
+func GetDHCPInfo(ifaceName, ipv4 string) DHCPInfo {
+	info := DHCPInfo{Method: "static"}
+	if ifaceName == "" {
+		return info
+	}
+
+	leases := findDHCPLeases(ifaceName)
+
+	// Prefer the lease matching the address currently assigned to the interface
+	var best *DHCPLease
+	for i := range leases {
+		lease := &leases[i]
+		if ipv4 != "" && lease.Address != "" && lease.Address != ipv4 {
+			continue
+		}
+		if best == nil || lease.LeaseObtained.After(best.LeaseObtained) {
+			best = lease
+		}
+	}
+
+	dynamic := isDynamicAddress(ifaceName, ipv4)
+	if best != nil {
+		info.DHCPLease = *best
+	}
+	if dynamic || (best != nil && best.Address == ipv4) {
+		info.Enabled = true
+		info.Method = "dhcp"
+	}
+	return info
+}
+
+// findDHCPLeases collects all leases for the interface from every known client
+func findDHCPLeases(ifaceName string) []DHCPLease {
+	var leases []DHCPLease
+
+	// dhclient keeps a history of leases in one file, possibly shared between interfaces
+	for _, path := range globAll(dhclientLeaseGlobs) {
+		leases = append(leases, readLeaseFile(path, func(r io.Reader) []DHCPLease {
+			return ParseDhclientLeases(r, "dhclient")
+		}, ifaceName)...)
+	}
+
+	// dhcpcd names its lease files after the interface (and SSID for wireless)
+	for _, path := range globAll(dhcpcdLeaseGlobs) {
+		base := strings.TrimPrefix(filepath.Base(path), "dhcpcd-")
+		if base != ifaceName+filepath.Ext(path) && !strings.HasPrefix(base, ifaceName+"-") {
+			continue
+		}
+		if lease, ok := readDhcpcdLease(path); ok {
+			lease.Interface = ifaceName
+			leases = append(leases, lease)
+		}
+	}
+
+	iface, err := net.InterfaceByName(ifaceName)
+	if err == nil {
+		index := strconv.Itoa(iface.Index)
+
+		// systemd-networkd names lease files by interface index
+		if lease, ok := readKeyValueLease(filepath.Join(networkdLeaseDir, index), "systemd-networkd"); ok {
+			lease.Interface = ifaceName
+			leases = append(leases, lease)
+		}
+
+		// NetworkManager exposes the active lease in its runtime device state
+		if lease, ok := readNetworkManagerDevice(filepath.Join(networkManagerDevDir, index)); ok {
+			lease.Interface = ifaceName
+			leases = append(leases, lease)
+		}
+	}
+
+	// NetworkManager lease files, written by its internal client or by dhclient
+	internal, _ := filepath.Glob(filepath.Join(networkManagerLeaseDir, "internal-*-"+ifaceName+".lease"))
+	for _, path := range internal {
+		if lease, ok := readKeyValueLease(path, "NetworkManager"); ok {
+			lease.Interface = ifaceName
+			leases = append(leases, lease)
+		}
+	}
+	external, _ := filepath.Glob(filepath.Join(networkManagerLeaseDir, "dhclient-*-"+ifaceName+".lease"))
+	for _, path := range external {
+		leases = append(leases, readLeaseFile(path, func(r io.Reader) []DHCPLease {
+			return ParseDhclientLeases(r, "NetworkManager")
+		}, ifaceName)...)
+	}
+
+	return leases
+}
+
+// readLeaseFile parses a lease file and keeps leases for the given interface
+func readLeaseFile(path string, parse func(io.Reader) []DHCPLease, ifaceName string) []DHCPLease {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var leases []DHCPLease
+	for _, lease := range parse(f) {
+		if lease.Interface != "" && lease.Interface != ifaceName {
+			continue
+		}
+		lease.Interface = ifaceName
+		lease.LeaseFile = path
+		leases = append(leases, lease)
+	}
+	return leases
+}
+
+// ParseDhclientLeases parses an ISC dhclient lease database. Each "lease { ... }"
+// block becomes one entry, in file order (the last one is the most recent).
+func ParseDhclientLeases(r io.Reader, client string) []DHCPLease {
+	var leases []DHCPLease
+	var current *DHCPLease
+	var leaseTime time.Duration
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Epoch times carry a readable copy as a comment: "expire epoch 1749715200; # Thu Jun 12 ..."
+		if i := strings.Index(line, "; #"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSuffix(line, ";")
+
+		switch {
+		case strings.HasPrefix(line, "lease") && strings.HasSuffix(line, "{"):
+			current = &DHCPLease{Client: client}
+			leaseTime = 0
+			continue
+		case line == "}":
+			if current != nil {
+				if leaseTime > 0 && !current.LeaseExpires.IsZero() {
+					current.LeaseObtained = current.LeaseExpires.Add(-leaseTime)
+				}
+				leases = append(leases, *current)
+			}
+			current = nil
+			continue
+		case current == nil:
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "interface":
+			current.Interface = strings.Trim(fields[1], `"`)
+		case "fixed-address":
+			current.Address = fields[1]
+		case "renew":
+			current.RenewalTime = parseDhclientTime(fields[1:])
+		case "rebind":
+			current.RebindTime = parseDhclientTime(fields[1:])
+		case "expire":
+			current.LeaseExpires = parseDhclientTime(fields[1:])
+		case "option":
+			if len(fields) < 3 {
+				continue
+			}
+			value := strings.Join(fields[2:], " ")
+			switch fields[1] {
+			case "subnet-mask":
+				current.SubnetMask = value
+			case "routers":
+				current.Routers = splitList(value)
+			case "domain-name-servers":
+				current.DNSServers = splitList(value)
+			case "ntp-servers":
+				current.NTPServers = splitList(value)
+			case "domain-name":
+				current.DomainName = strings.Trim(value, `"`)
+			case "dhcp-server-identifier":
+				current.DHCPServer = value
+			case "dhcp-lease-time":
+				if seconds, err := strconv.Atoi(value); err == nil {
+					leaseTime = time.Duration(seconds) * time.Second
+				}
+			case "rfc3442-classless-static-routes":
+				var raw []byte
+				for _, part := range splitList(value) {
+					if n, err := strconv.Atoi(part); err == nil && n >= 0 && n < 256 {
+						raw = append(raw, byte(n))
+					}
+				}
+				current.Routes = decodeClasslessRoutes(raw)
+			}
+		}
+	}
+
+	return leases
+}
+
+// parseDhclientTime parses "3 2025/06/11 10:00:00" (UTC) or "epoch 1749636000"
+func parseDhclientTime(fields []string) time.Time {
+	if len(fields) >= 2 && fields[0] == "epoch" {
+		if secs, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			return time.Unix(secs, 0)
+		}
+		return time.Time{}
+	}
+	if len(fields) >= 3 {
+		if t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// readKeyValueLease reads a systemd-networkd style lease file (also used by
+// NetworkManager's internal DHCP client)
+func readKeyValueLease(path, client string) (DHCPLease, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return DHCPLease{}, false
+	}
+	defer f.Close()
+
+	var obtained time.Time
+	if stat, err := f.Stat(); err == nil {
+		obtained = stat.ModTime()
+	}
+
+	lease := ParseNetworkdLease(f, obtained)
+	lease.Client = client
+	lease.LeaseFile = path
+	return lease, lease.Address != ""
+}
+
+// ParseNetworkdLease parses a systemd-networkd lease file. Timers in the file are
+// relative to when the lease was obtained, which is taken from the file's mtime.
+func ParseNetworkdLease(r io.Reader, obtained time.Time) DHCPLease {
+	values := parseKeyValues(r)
+	lease := DHCPLease{
+		Client:        "systemd-networkd",
+		Address:       values["ADDRESS"],
+		SubnetMask:    values["NETMASK"],
+		DHCPServer:    values["SERVER_ADDRESS"],
+		Routers:       strings.Fields(values["ROUTER"]),
+		DNSServers:    strings.Fields(values["DNS"]),
+		NTPServers:    strings.Fields(values["NTP"]),
+		DomainName:    values["DOMAINNAME"],
+		LeaseObtained: obtained,
+	}
+
+	for _, route := range strings.Fields(values["ROUTES"]) {
+		if parts := strings.SplitN(route, ",", 2); len(parts) == 2 {
+			lease.Routes = append(lease.Routes, parts[0]+" via "+parts[1])
+		}
+	}
+
+	lease.LeaseExpires = offsetTime(obtained, values["LIFETIME"])
+	lease.RenewalTime = offsetTime(obtained, values["T1"])
+	lease.RebindTime = offsetTime(obtained, values["T2"])
+	return lease
+}
+
+// readNetworkManagerDevice reads the [dhcp4] section of NetworkManager's runtime device state
+func readNetworkManagerDevice(path string) (DHCPLease, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return DHCPLease{}, false
+	}
+	defer f.Close()
+
+	lease := ParseNetworkManagerDevice(f)
+	lease.LeaseFile = path
+	return lease, lease.Address != ""
+}
+
+// ParseNetworkManagerDevice parses the [dhcp4] section of a NetworkManager device state file
+func ParseNetworkManagerDevice(r io.Reader) DHCPLease {
+	section := ""
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		if section != "dhcp4" {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = value
+		}
+	}
+
+	lease := DHCPLease{
+		Client:     "NetworkManager",
+		Address:    values["ip_address"],
+		SubnetMask: values["subnet_mask"],
+		DHCPServer: values["dhcp_server_identifier"],
+		Routers:    strings.Fields(values["routers"]),
+		DNSServers: strings.Fields(values["domain_name_servers"]),
+		NTPServers: strings.Fields(values["ntp_servers"]),
+		DomainName: values["domain_name"],
+	}
+
+	if expiry, err := strconv.ParseInt(values["expiry"], 10, 64); err == nil {
+		lease.LeaseExpires = time.Unix(expiry, 0)
+		if seconds, err := strconv.Atoi(values["dhcp_lease_time"]); err == nil {
+			lease.LeaseObtained = lease.LeaseExpires.Add(-time.Duration(seconds) * time.Second)
+			lease.RenewalTime = offsetTime(lease.LeaseObtained, values["dhcp_renewal_time"])
+			lease.RebindTime = offsetTime(lease.LeaseObtained, values["dhcp_rebinding_time"])
+		}
+	}
+	// Routes are listed as "destination gateway" pairs
+	routes := strings.Fields(values["classless_static_routes"])
+	for i := 0; i+1 < len(routes); i += 2 {
+		lease.Routes = append(lease.Routes, routes[i]+" via "+routes[i+1])
+	}
+
+	return lease
+}
+
+// readDhcpcdLease reads a dhcpcd lease, either a raw DHCP packet (dhcpcd 6+)
+// or the KEY='value' .info file written by older releases
+func readDhcpcdLease(path string) (DHCPLease, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DHCPLease{}, false
+	}
+
+	var obtained time.Time
+	if stat, err := os.Stat(path); err == nil {
+		obtained = stat.ModTime()
+	}
+
+	var lease DHCPLease
+	if strings.HasSuffix(path, ".info") {
+		lease = ParseDhcpcdInfo(bytes.NewReader(data), obtained)
+	} else {
+		lease, err = ParseDhcpcdLease(data, obtained)
+		if err != nil {
+			return DHCPLease{}, false
+		}
+	}
+	lease.LeaseFile = path
+	return lease, lease.Address != ""
+}
+
+// ParseDhcpcdLease decodes a dhcpcd lease file, which is the ACK packet as received
+func ParseDhcpcdLease(data []byte, obtained time.Time) (DHCPLease, error) {
+	msg, err := parseDHCPMessage(data)
+	if err != nil {
+		return DHCPLease{}, err
+	}
+
+	lease := DHCPLease{Client: "dhcpcd"}
+	msg.applyToLease(&lease, obtained)
+	return lease, nil
+}
+
+// ParseDhcpcdInfo parses the legacy dhcpcd .info format
+func ParseDhcpcdInfo(r io.Reader, obtained time.Time) DHCPLease {
+	values := parseKeyValues(r)
+	lease := DHCPLease{
+		Client:     "dhcpcd",
+		Address:    values["IPADDR"],
+		SubnetMask: values["NETMASK"],
+		DHCPServer: values["DHCPSID"],
+		Routers:    splitList(values["GATEWAYS"]),
+		DNSServers: splitList(values["DNSSERVERS"]),
+		NTPServers: splitList(values["NTPSERVERS"]),
+		DomainName: values["DNSDOMAIN"],
+	}
+	if lease.DomainName == "" {
+		lease.DomainName = values["DOMAIN"]
+	}
+
+	if from, err := strconv.ParseInt(values["LEASEDFROM"], 10, 64); err == nil {
+		obtained = time.Unix(from, 0)
+	}
+	lease.LeaseObtained = obtained
+	lease.LeaseExpires = offsetTime(obtained, values["LEASETIME"])
+	lease.RenewalTime = offsetTime(obtained, values["RENEWALTIME"])
+	lease.RebindTime = offsetTime(obtained, values["REBINDTIME"])
+	return lease
+}
+
+// isDynamicAddress reports whether the kernel marks the interface address as
+// dynamic (it has a finite lifetime, which is how DHCP clients install addresses)
+func isDynamicAddress(ifaceName, ipv4 string) bool {
+	cmd := exec.Command("ip", "-o", "-4", "addr", "show", "dev", ifaceName)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		// Format: 2: eth0    inet 192.168.1.23/24 brd ... scope global dynamic eth0\ valid_lft ...
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "inet" && i+1 < len(fields) {
+				addr := strings.SplitN(fields[i+1], "/", 2)[0]
+				if ipv4 != "" && addr != ipv4 {
+					break
+				}
+				for _, flag := range fields[i+2:] {
+					if flag == "dynamic" {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// parseKeyValues reads KEY=value lines, ignoring comments and unquoting values
+func parseKeyValues(r io.Reader) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `'"`)
+	}
+	return values
+}
+
+// offsetTime adds a number of seconds given as a string to a base time
+func offsetTime(base time.Time, seconds string) time.Time {
+	if base.IsZero() {
+		return time.Time{}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(seconds), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return base.Add(time.Duration(n) * time.Second)
+}
+
+// splitList splits a comma or space separated list
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// globAll expands several glob patterns into a sorted, de-duplicated list
+func globAll(patterns []string) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				paths = append(paths, match)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
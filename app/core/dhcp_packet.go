@@ -0,0 +1,168 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DHCP option codes understood by NetTool
+const (
+	dhcpOptPad             = 0
+	dhcpOptSubnetMask      = 1
+	dhcpOptRouter          = 3
+	dhcpOptDNSServers      = 6
+	dhcpOptDomainName      = 15
+	dhcpOptNTPServers      = 42
+	dhcpOptLeaseTime       = 51
+	dhcpOptMessageType     = 53
+	dhcpOptServerID        = 54
+	dhcpOptRenewalTime     = 58
+	dhcpOptRebindTime      = 59
+	dhcpOptClasslessRoutes = 121
+	dhcpOptEnd             = 255
+)
+
+// dhcpMagicCookie marks the start of the options field in a BOOTP packet
+var dhcpMagicCookie = []byte{99, 130, 83, 99}
+
+// dhcpMessage is a decoded DHCPv4 (BOOTP) packet
+type dhcpMessage struct {
+	Op        byte
+	XID       uint32
+	Flags     uint16
+	ClientIP  net.IP
+	YourIP    net.IP
+	ServerIP  net.IP
+	GatewayIP net.IP
+	ClientMAC net.HardwareAddr
+	Options   map[byte][]byte
+}
+
+// parseDHCPMessage decodes a raw BOOTP packet including its options
+func parseDHCPMessage(b []byte) (*dhcpMessage, error) {
+	if len(b) < 240 {
+		return nil, errors.New("packet too short for DHCP")
+	}
+	if string(b[236:240]) != string(dhcpMagicCookie) {
+		return nil, errors.New("missing DHCP magic cookie")
+	}
+
+	hlen := int(b[2])
+	if hlen > 16 {
+		hlen = 16
+	}
+
+	msg := &dhcpMessage{
+		Op:        b[0],
+		XID:       binary.BigEndian.Uint32(b[4:8]),
+		Flags:     binary.BigEndian.Uint16(b[10:12]),
+		ClientIP:  net.IP(append([]byte(nil), b[12:16]...)),
+		YourIP:    net.IP(append([]byte(nil), b[16:20]...)),
+		ServerIP:  net.IP(append([]byte(nil), b[20:24]...)),
+		GatewayIP: net.IP(append([]byte(nil), b[24:28]...)),
+		ClientMAC: net.HardwareAddr(append([]byte(nil), b[28:28+hlen]...)),
+		Options:   make(map[byte][]byte),
+	}
+
+	options := b[240:]
+	for i := 0; i < len(options); {
+		code := options[i]
+		if code == dhcpOptEnd {
+			break
+		}
+		if code == dhcpOptPad {
+			i++
+			continue
+		}
+		if i+1 >= len(options) {
+			break
+		}
+		length := int(options[i+1])
+		if i+2+length > len(options) {
+			return nil, fmt.Errorf("option %d overflows packet", code)
+		}
+		// Long options may be split across several instances (RFC 3396)
+		msg.Options[code] = append(msg.Options[code], options[i+2:i+2+length]...)
+		i += 2 + length
+	}
+
+	return msg, nil
+}
+
+// messageType returns the DHCP message type option, or 0 if absent
+func (m *dhcpMessage) messageType() byte {
+	if v := m.Options[dhcpOptMessageType]; len(v) == 1 {
+		return v[0]
+	}
+	return 0
+}
+
+// applyToLease copies the address and options of the message into a lease.
+// Relative timers are anchored at the given time.
+func (m *dhcpMessage) applyToLease(lease *DHCPLease, obtained time.Time) {
+	if !m.YourIP.IsUnspecified() {
+		lease.Address = m.YourIP.String()
+	}
+	if v := m.Options[dhcpOptSubnetMask]; len(v) == 4 {
+		lease.SubnetMask = net.IP(v).String()
+	}
+	if v := m.Options[dhcpOptServerID]; len(v) == 4 {
+		lease.DHCPServer = net.IP(v).String()
+	}
+	lease.Routers = ipList(m.Options[dhcpOptRouter])
+	lease.DNSServers = ipList(m.Options[dhcpOptDNSServers])
+	lease.NTPServers = ipList(m.Options[dhcpOptNTPServers])
+	if v := m.Options[dhcpOptDomainName]; len(v) > 0 {
+		lease.DomainName = strings.TrimRight(string(v), "\x00")
+	}
+	if v := m.Options[dhcpOptClasslessRoutes]; len(v) > 0 {
+		lease.Routes = decodeClasslessRoutes(v)
+	}
+
+	lease.LeaseObtained = obtained
+	if v := m.Options[dhcpOptLeaseTime]; len(v) == 4 {
+		lease.LeaseExpires = obtained.Add(time.Duration(binary.BigEndian.Uint32(v)) * time.Second)
+	}
+	if v := m.Options[dhcpOptRenewalTime]; len(v) == 4 {
+		lease.RenewalTime = obtained.Add(time.Duration(binary.BigEndian.Uint32(v)) * time.Second)
+	}
+	if v := m.Options[dhcpOptRebindTime]; len(v) == 4 {
+		lease.RebindTime = obtained.Add(time.Duration(binary.BigEndian.Uint32(v)) * time.Second)
+	}
+}
+
+// ipList decodes a list of IPv4 addresses from an option value
+func ipList(b []byte) []string {
+	var ips []string
+	for i := 0; i+4 <= len(b); i += 4 {
+		ips = append(ips, net.IP(b[i:i+4]).String())
+	}
+	return ips
+}
+
+// decodeClasslessRoutes decodes option 121 (RFC 3442) into "prefix via router" strings
+func decodeClasslessRoutes(b []byte) []string {
+	var routes []string
+	for i := 0; i < len(b); {
+		width := int(b[i])
+		if width > 32 {
+			break
+		}
+		significant := (width + 7) / 8
+		if i+1+significant+4 > len(b) {
+			break
+		}
+
+		dest := make(net.IP, 4)
+		copy(dest, b[i+1:i+1+significant])
+		router := net.IP(b[i+1+significant : i+1+significant+4])
+		routes = append(routes, fmt.Sprintf("%s/%d via %s", dest, width, router))
+
+		i += 1 + significant + 4
+	}
+	return routes
+}
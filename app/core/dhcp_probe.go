@@ -0,0 +1,416 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DHCPProbeOptions configures an active DHCP probe
+type DHCPProbeOptions struct {
+	Interface      string        // Interface to probe on (required)
+	Timeout        time.Duration // How long to collect offers
+	AllowedServers []string      // Server IDs or addresses considered legitimate
+	IPv4           bool          // Send a DHCPDISCOVER
+	IPv6           bool          // Send a DHCPv6 SOLICIT
+
+	// Addressing overrides, mainly for pointing the probe at a local stand-in responder
+	ClientPort   int    // Default 68
+	ServerPort   int    // Default 67
+	ServerAddr   string // Default 255.255.255.255
+	ClientPortV6 int    // Default 546
+	ServerPortV6 int    // Default 547
+	ServerAddrV6 string // Default ff02::1:2 (All_DHCP_Relay_Agents_and_Servers)
+}
+
+// DHCPOffer is a single OFFER (DHCPv4) or ADVERTISE (DHCPv6) received during a probe
+type DHCPOffer struct {
+	Protocol       string   `json:"protocol"` // "dhcpv4" or "dhcpv6"
+	ServerID       string   `json:"serverId"`
+	SourceAddress  string   `json:"sourceAddress"`
+	RelayAgent     string   `json:"relayAgent,omitempty"`
+	OfferedAddress string   `json:"offeredAddress,omitempty"`
+	SubnetMask     string   `json:"subnetMask,omitempty"`
+	Routers        []string `json:"routers,omitempty"`
+	DNSServers     []string `json:"dnsServers,omitempty"`
+	NTPServers     []string `json:"ntpServers,omitempty"`
+	DomainName     string   `json:"domainName,omitempty"`
+	DomainSearch   []string `json:"domainSearch,omitempty"`
+	Routes         []string `json:"routes,omitempty"`
+	LeaseTime      int64    `json:"leaseTimeSeconds,omitempty"`
+	Preference     int      `json:"preference,omitempty"`
+	ResponseTimeMS float64  `json:"responseTimeMs"`
+	Rogue          bool     `json:"rogue"`
+}
+
+// DHCPProbeResult summarises all offers received during a probe
+type DHCPProbeResult struct {
+	Interface    string      `json:"interface"`
+	Offers       []DHCPOffer `json:"offers"`
+	Servers      []string    `json:"servers"`
+	RogueServers []string    `json:"rogueServers"`
+	Errors       []string    `json:"errors,omitempty"`
+	StartedAt    time.Time   `json:"startedAt"`
+	DurationMS   float64     `json:"durationMs"`
+}
+
+// ProbeDHCP broadcasts a DHCPDISCOVER and/or DHCPv6 SOLICIT on the interface and
+// collects every answer until the timeout. No REQUEST is ever sent, so no lease
+// is accepted and the servers' address pools are left untouched.
+func ProbeDHCP(opts DHCPProbeOptions) (*DHCPProbeResult, error) {
+	if opts.Interface == "" {
+		return nil, fmt.Errorf("interface is required")
+	}
+	iface, err := net.InterfaceByName(opts.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s not found: %v", opts.Interface, err)
+	}
+	if !opts.IPv4 && !opts.IPv6 {
+		opts.IPv4 = true
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	result := &DHCPProbeResult{
+		Interface: opts.Interface,
+		Offers:    []DHCPOffer{},
+		StartedAt: time.Now(),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	run := func(probe func(*net.Interface, DHCPProbeOptions) ([]DHCPOffer, error), name string) {
+		defer wg.Done()
+		offers, err := probe(iface, opts)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", name, err))
+		}
+		result.Offers = append(result.Offers, offers...)
+	}
+
+	if opts.IPv4 {
+		wg.Add(1)
+		go run(probeDHCPv4, "dhcpv4")
+	}
+	if opts.IPv6 {
+		wg.Add(1)
+		go run(probeDHCPv6, "dhcpv6")
+	}
+	wg.Wait()
+
+	// Classify servers against the allow-list
+	allowed := make(map[string]bool)
+	for _, server := range opts.AllowedServers {
+		allowed[strings.ToLower(strings.TrimSpace(server))] = true
+	}
+	servers := make(map[string]bool)
+	rogue := make(map[string]bool)
+	for i := range result.Offers {
+		offer := &result.Offers[i]
+		id := offer.ServerID
+		if id == "" {
+			id = offer.SourceAddress
+		}
+		servers[id] = true
+		if len(allowed) > 0 && !allowed[strings.ToLower(offer.ServerID)] && !allowed[strings.ToLower(offer.SourceAddress)] {
+			offer.Rogue = true
+			rogue[id] = true
+		}
+	}
+	result.Servers = sortedKeys(servers)
+	result.RogueServers = sortedKeys(rogue)
+	result.DurationMS = float64(time.Since(result.StartedAt).Microseconds()) / 1000
+
+	if len(result.Errors) > 0 && len(result.Offers) == 0 && len(result.Errors) == countTrue(opts.IPv4, opts.IPv6) {
+		return result, fmt.Errorf("DHCP probe failed: %s", strings.Join(result.Errors, "; "))
+	}
+	return result, nil
+}
+
+// probeDHCPv4 sends a DHCPDISCOVER and collects DHCPOFFERs
+func probeDHCPv4(iface *net.Interface, opts DHCPProbeOptions) ([]DHCPOffer, error) {
+	clientPort := defaultInt(opts.ClientPort, 68)
+	serverPort := defaultInt(opts.ServerPort, 67)
+	serverAddr := opts.ServerAddr
+	if serverAddr == "" {
+		serverAddr = "255.255.255.255"
+	}
+
+	conn, err := listenDHCP("udp4", fmt.Sprintf("0.0.0.0:%d", clientPort), iface.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	xid := randomUint32()
+	discover := buildDHCPDiscover(xid, iface.HardwareAddr)
+
+	start := time.Now()
+	if _, err := conn.WriteTo(discover, &net.UDPAddr{IP: net.ParseIP(serverAddr), Port: serverPort}); err != nil {
+		return nil, fmt.Errorf("failed to send DHCPDISCOVER: %v", err)
+	}
+
+	var offers []DHCPOffer
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(start.Add(opts.Timeout))
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			break // Deadline reached
+		}
+		msg, err := parseDHCPMessage(buf[:n])
+		if err != nil || msg.Op != 2 || msg.XID != xid || msg.messageType() != 2 {
+			continue
+		}
+
+		var lease DHCPLease
+		msg.applyToLease(&lease, time.Time{})
+		offer := DHCPOffer{
+			Protocol:       "dhcpv4",
+			ServerID:       lease.DHCPServer,
+			SourceAddress:  from.(*net.UDPAddr).IP.String(),
+			OfferedAddress: lease.Address,
+			SubnetMask:     lease.SubnetMask,
+			Routers:        lease.Routers,
+			DNSServers:     lease.DNSServers,
+			NTPServers:     lease.NTPServers,
+			DomainName:     lease.DomainName,
+			Routes:         lease.Routes,
+			ResponseTimeMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if !msg.GatewayIP.IsUnspecified() {
+			offer.RelayAgent = msg.GatewayIP.String()
+		}
+		if v := msg.Options[dhcpOptLeaseTime]; len(v) == 4 {
+			offer.LeaseTime = int64(binary.BigEndian.Uint32(v))
+		}
+		offers = append(offers, offer)
+	}
+
+	return offers, nil
+}
+
+// buildDHCPDiscover builds a broadcast DHCPDISCOVER packet
+func buildDHCPDiscover(xid uint32, mac net.HardwareAddr) []byte {
+	packet := make([]byte, 240)
+	packet[0] = 1 // BOOTREQUEST
+	packet[1] = 1 // Ethernet
+	packet[2] = 6 // Hardware address length
+	binary.BigEndian.PutUint32(packet[4:8], xid)
+	binary.BigEndian.PutUint16(packet[10:12], 0x8000) // Ask servers to broadcast replies
+	copy(packet[28:44], mac)
+	copy(packet[236:240], dhcpMagicCookie)
+
+	clientID := append([]byte{1}, mac...)
+	packet = append(packet,
+		dhcpOptMessageType, 1, 1, // DHCPDISCOVER
+		61, byte(len(clientID)))
+	packet = append(packet, clientID...)
+	packet = append(packet,
+		55, 10, // Parameter request list
+		dhcpOptSubnetMask, dhcpOptRouter, dhcpOptDNSServers, dhcpOptDomainName, dhcpOptNTPServers,
+		dhcpOptLeaseTime, dhcpOptServerID, dhcpOptRenewalTime, dhcpOptRebindTime, dhcpOptClasslessRoutes,
+		dhcpOptEnd)
+
+	// Pad to the minimum BOOTP size, some servers drop shorter packets
+	for len(packet) < 300 {
+		packet = append(packet, dhcpOptPad)
+	}
+	return packet
+}
+
+// DHCPv6 message and option codes (RFC 8415)
+const (
+	dhcp6MsgSolicit    = 1
+	dhcp6MsgAdvertise  = 2
+	dhcp6OptClientID   = 1
+	dhcp6OptServerID   = 2
+	dhcp6OptIANA       = 3
+	dhcp6OptIAAddr     = 5
+	dhcp6OptORO        = 6
+	dhcp6OptPreference = 7
+	dhcp6OptElapsed    = 8
+	dhcp6OptDNSServers = 23
+	dhcp6OptDomainList = 24
+)
+
+// probeDHCPv6 sends a SOLICIT (without rapid commit) and collects ADVERTISE replies
+func probeDHCPv6(iface *net.Interface, opts DHCPProbeOptions) ([]DHCPOffer, error) {
+	clientPort := defaultInt(opts.ClientPortV6, 546)
+	serverPort := defaultInt(opts.ServerPortV6, 547)
+	serverAddr := opts.ServerAddrV6
+	if serverAddr == "" {
+		serverAddr = "ff02::1:2"
+	}
+
+	conn, err := listenDHCP("udp6", fmt.Sprintf("[::]:%d", clientPort), iface.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	xid := randomUint32() & 0xffffff
+	solicit := buildDHCPv6Solicit(xid, iface)
+
+	start := time.Now()
+	dest := &net.UDPAddr{IP: net.ParseIP(serverAddr), Port: serverPort, Zone: iface.Name}
+	if _, err := conn.WriteTo(solicit, dest); err != nil {
+		return nil, fmt.Errorf("failed to send SOLICIT: %v", err)
+	}
+
+	var offers []DHCPOffer
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(start.Add(opts.Timeout))
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			break // Deadline reached
+		}
+		if n < 4 || buf[0] != dhcp6MsgAdvertise {
+			continue
+		}
+		if uint32(buf[1])<<16|uint32(buf[2])<<8|uint32(buf[3]) != xid {
+			continue
+		}
+
+		offer := DHCPOffer{
+			Protocol:       "dhcpv6",
+			SourceAddress:  from.(*net.UDPAddr).IP.String(),
+			ResponseTimeMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		parseDHCPv6Options(buf[4:n], &offer)
+		offers = append(offers, offer)
+	}
+
+	return offers, nil
+}
+
+// buildDHCPv6Solicit builds a SOLICIT asking for one non-temporary address
+func buildDHCPv6Solicit(xid uint32, iface *net.Interface) []byte {
+	packet := []byte{dhcp6MsgSolicit, byte(xid >> 16), byte(xid >> 8), byte(xid)}
+
+	// DUID-LL (type 3, hardware type 1) built from the interface MAC
+	duid := append([]byte{0, 3, 0, 1}, iface.HardwareAddr...)
+	packet = appendDHCPv6Option(packet, dhcp6OptClientID, duid)
+	packet = appendDHCPv6Option(packet, dhcp6OptElapsed, []byte{0, 0})
+	packet = appendDHCPv6Option(packet, dhcp6OptORO, []byte{0, dhcp6OptDNSServers, 0, dhcp6OptDomainList})
+
+	// IA_NA with the interface index as IAID and T1/T2 left to the server
+	iana := make([]byte, 12)
+	binary.BigEndian.PutUint32(iana[0:4], uint32(iface.Index))
+	packet = appendDHCPv6Option(packet, dhcp6OptIANA, iana)
+	return packet
+}
+
+func appendDHCPv6Option(packet []byte, code uint16, value []byte) []byte {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint16(header[0:2], code)
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(value)))
+	packet = append(packet, header...)
+	return append(packet, value...)
+}
+
+// parseDHCPv6Options fills an offer from the options of an ADVERTISE message
+func parseDHCPv6Options(b []byte, offer *DHCPOffer) {
+	for len(b) >= 4 {
+		code := binary.BigEndian.Uint16(b[0:2])
+		length := int(binary.BigEndian.Uint16(b[2:4]))
+		if 4+length > len(b) {
+			return
+		}
+		value := b[4 : 4+length]
+
+		switch code {
+		case dhcp6OptServerID:
+			offer.ServerID = hex.EncodeToString(value)
+		case dhcp6OptPreference:
+			if length == 1 {
+				offer.Preference = int(value[0])
+			}
+		case dhcp6OptDNSServers:
+			for i := 0; i+16 <= len(value); i += 16 {
+				offer.DNSServers = append(offer.DNSServers, net.IP(value[i:i+16]).String())
+			}
+		case dhcp6OptDomainList:
+			offer.DomainSearch = decodeDNSNames(value)
+		case dhcp6OptIANA:
+			// IAID, T1, T2 followed by nested options
+			if length > 12 {
+				parseDHCPv6Options(value[12:], offer)
+			}
+		case dhcp6OptIAAddr:
+			// Address, preferred lifetime, valid lifetime, nested options
+			if length >= 24 {
+				offer.OfferedAddress = net.IP(value[0:16]).String()
+				offer.LeaseTime = int64(binary.BigEndian.Uint32(value[20:24]))
+			}
+		}
+		b = b[4+length:]
+	}
+}
+
+// decodeDNSNames decodes a list of uncompressed DNS wire-format names (RFC 1035 3.1)
+func decodeDNSNames(b []byte) []string {
+	var names []string
+	var labels []string
+	for i := 0; i < len(b); {
+		length := int(b[i])
+		i++
+		if length == 0 {
+			if len(labels) > 0 {
+				names = append(names, strings.Join(labels, "."))
+			}
+			labels = nil
+			continue
+		}
+		if i+length > len(b) {
+			break
+		}
+		labels = append(labels, string(b[i:i+length]))
+		i += length
+	}
+	return names
+}
+
+func randomUint32() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return uint32(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func defaultInt(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
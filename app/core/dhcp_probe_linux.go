@@ -0,0 +1,40 @@
+//go:build linux
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenDHCP opens a UDP socket bound to a single interface that can share
+// the DHCP client port with a running DHCP client and send broadcasts
+func listenDHCP(network, address, ifaceName string) (net.PacketConn, error) {
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				for _, opt := range []int{unix.SO_REUSEADDR, unix.SO_REUSEPORT, unix.SO_BROADCAST} {
+					if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, opt, 1); sockErr != nil {
+						return
+					}
+				}
+				sockErr = unix.BindToDevice(int(fd), ifaceName)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+
+	conn, err := lc.ListenPacket(context.Background(), network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DHCP socket on %s (root or CAP_NET_RAW/CAP_NET_BIND_SERVICE required): %v", ifaceName, err)
+	}
+	return conn, nil
+}
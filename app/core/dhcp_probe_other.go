@@ -0,0 +1,13 @@
+//go:build !linux
+
+package core
+
+import (
+	"errors"
+	"net"
+)
+
+// listenDHCP requires SO_BINDTODEVICE, which is only available on Linux
+func listenDHCP(network, address, ifaceName string) (net.PacketConn, error) {
+	return nil, errors.New("DHCP probing is only supported on Linux")
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// standInServer describes one DHCP server answering the probe
+type standInServer struct {
+	address string // source address of its OFFERs
+	offered string
+	relay   string // giaddr, if the OFFER came through a relay agent
+}
+
+// buildDHCPOffer answers a DISCOVER with an OFFER from server
+func buildDHCPOffer(discover *dhcpMessage, server standInServer) []byte {
+	packet := make([]byte, 240)
+	packet[0] = 2 // BOOTREPLY
+	packet[1] = 1
+	packet[2] = 6
+	binary.BigEndian.PutUint32(packet[4:8], discover.XID)
+	copy(packet[16:20], net.ParseIP(server.offered).To4())
+	copy(packet[20:24], net.ParseIP(server.address).To4())
+	if server.relay != "" {
+		copy(packet[24:28], net.ParseIP(server.relay).To4())
+	}
+	copy(packet[28:44], discover.ClientMAC)
+	copy(packet[236:240], dhcpMagicCookie)
+
+	option := func(code byte, value []byte) {
+		packet = append(packet, code, byte(len(value)))
+		packet = append(packet, value...)
+	}
+	ip := func(s string) []byte { return net.ParseIP(s).To4() }
+	lease := make([]byte, 4)
+	binary.BigEndian.PutUint32(lease, 3600)
+
+	option(dhcpOptMessageType, []byte{2}) // DHCPOFFER
+	option(dhcpOptServerID, ip(server.address))
+	option(dhcpOptLeaseTime, lease)
+	option(dhcpOptSubnetMask, ip("255.255.255.0"))
+	option(dhcpOptRouter, ip(server.address))
+	option(dhcpOptDNSServers, append(ip(server.address), ip("9.9.9.9")...))
+	option(dhcpOptDomainName, []byte("lan"))
+	option(dhcpOptClasslessRoutes, append([]byte{24, 10, 8, 0}, ip(server.address)...))
+	return append(packet, dhcpOptEnd)
+}
+
+// startStandInDHCP listens on loopback like a DHCP server and answers every
+// DISCOVER with one OFFER per server, each sent from the server's own address
+// as if several servers had seen the broadcast. It returns the listening port.
+func startStandInDHCP(t *testing.T, servers ...standInServer) int {
+	t.Helper()
+	listener, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	senders := make([]net.PacketConn, len(servers))
+	for i, server := range servers {
+		if senders[i], err = net.ListenPacket("udp4", server.address+":0"); err != nil {
+			t.Fatalf("listen on %s: %v", server.address, err)
+		}
+		sender := senders[i]
+		t.Cleanup(func() { sender.Close() })
+	}
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, client, err := listener.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			discover, err := parseDHCPMessage(buf[:n])
+			if err != nil || discover.Op != 1 || discover.messageType() != 1 {
+				continue
+			}
+			for i, server := range servers {
+				senders[i].WriteTo(buildDHCPOffer(discover, server), client)
+			}
+		}
+	}()
+	return listener.LocalAddr().(*net.UDPAddr).Port
+}
+
+// freeUDPPort returns a UDP port that was free a moment ago
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// probeStandIn probes the stand-in responder over loopback, skipping the
+// test off Linux or where the probe socket cannot be bound to an interface
+func probeStandIn(t *testing.T, serverPort int, allowed []string) *DHCPProbeResult {
+	t.Helper()
+	result, err := ProbeDHCP(DHCPProbeOptions{
+		Interface:      "lo",
+		Timeout:        500 * time.Millisecond,
+		AllowedServers: allowed,
+		IPv4:           true,
+		ClientPort:     freeUDPPort(t),
+		ServerPort:     serverPort,
+		ServerAddr:     "127.0.0.1",
+	})
+	if err != nil && (strings.Contains(err.Error(), "failed to open DHCP socket") || strings.Contains(err.Error(), "only supported on Linux")) {
+		t.Skipf("cannot open the probe socket here: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	return result
+}
+
+func TestProbeDHCPParsesOffers(t *testing.T) {
+	port := startStandInDHCP(t, standInServer{address: "127.0.0.1", offered: "192.168.1.50", relay: "192.168.1.254"})
+
+	result := probeStandIn(t, port, nil)
+	if len(result.Offers) != 1 {
+		t.Fatalf("got %d offers, want 1: %+v", len(result.Offers), result.Offers)
+	}
+	offer := result.Offers[0]
+	want := DHCPOffer{
+		Protocol:       "dhcpv4",
+		ServerID:       "127.0.0.1",
+		SourceAddress:  "127.0.0.1",
+		RelayAgent:     "192.168.1.254",
+		OfferedAddress: "192.168.1.50",
+		SubnetMask:     "255.255.255.0",
+		Routers:        []string{"127.0.0.1"},
+		DNSServers:     []string{"127.0.0.1", "9.9.9.9"},
+		DomainName:     "lan",
+		Routes:         []string{"10.8.0.0/24 via 127.0.0.1"},
+		LeaseTime:      3600,
+	}
+	if offer.ResponseTimeMS <= 0 {
+		t.Errorf("response time = %v, want a positive duration", offer.ResponseTimeMS)
+	}
+	offer.ResponseTimeMS = 0
+	if !reflect.DeepEqual(offer, want) {
+		t.Errorf("offer =\n%+v\nwant\n%+v", offer, want)
+	}
+	if !reflect.DeepEqual(result.Servers, []string{"127.0.0.1"}) || len(result.RogueServers) != 0 {
+		t.Errorf("servers %v, rogue %v; want one server and no rogue ones without an allow-list", result.Servers, result.RogueServers)
+	}
+}
+
+func TestProbeDHCPFlagsRogueServer(t *testing.T) {
+	port := startStandInDHCP(t,
+		standInServer{address: "127.0.0.1", offered: "192.168.1.50"},
+		standInServer{address: "127.0.0.2", offered: "10.66.0.9"},
+	)
+
+	result := probeStandIn(t, port, []string{"127.0.0.1"})
+	if len(result.Offers) != 2 {
+		t.Fatalf("got %d offers, want one from each server: %+v", len(result.Offers), result.Offers)
+	}
+	if !reflect.DeepEqual(result.Servers, []string{"127.0.0.1", "127.0.0.2"}) {
+		t.Errorf("servers = %v, want both", result.Servers)
+	}
+	if !reflect.DeepEqual(result.RogueServers, []string{"127.0.0.2"}) {
+		t.Errorf("rogue servers = %v, want the one outside the allow-list", result.RogueServers)
+	}
+	for _, offer := range result.Offers {
+		if rogue := offer.ServerID == "127.0.0.2"; offer.Rogue != rogue {
+			t.Errorf("offer from %s rogue = %v, want %v", offer.ServerID, offer.Rogue, rogue)
+		}
+	}
+}
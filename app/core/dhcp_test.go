@@ -0,0 +1,204 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leaseObtained is when every current lease in testdata/dhcp was obtained
+var leaseObtained = time.Unix(1749628800, 0).UTC()
+
+// currentLease is the lease every fixture holds for eth0, as the given client reports it
+func currentLease(client string, routes bool) DHCPLease {
+	lease := DHCPLease{
+		Client:        client,
+		Address:       "192.168.1.23",
+		SubnetMask:    "255.255.255.0",
+		LeaseObtained: leaseObtained,
+		LeaseExpires:  leaseObtained.Add(24 * time.Hour),
+		RenewalTime:   leaseObtained.Add(12 * time.Hour),
+		RebindTime:    leaseObtained.Add(21 * time.Hour),
+		DHCPServer:    "192.168.1.1",
+		Routers:       []string{"192.168.1.1"},
+		DNSServers:    []string{"192.168.1.1", "1.1.1.1"},
+		NTPServers:    []string{"192.168.1.1"},
+		DomainName:    "home.lan",
+	}
+	if routes {
+		lease.Routes = []string{"10.8.0.0/24 via 192.168.1.254", "0.0.0.0/0 via 192.168.1.1"}
+	}
+	return lease
+}
+
+// readFixture returns the contents of a file in testdata/dhcp
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "dhcp", name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return data
+}
+
+// inUTC returns the lease with its times in UTC so leases compare with reflect.DeepEqual
+func inUTC(lease DHCPLease) DHCPLease {
+	for _, t := range []*time.Time{&lease.LeaseObtained, &lease.LeaseExpires, &lease.RenewalTime, &lease.RebindTime} {
+		if !t.IsZero() {
+			*t = t.UTC()
+		}
+	}
+	return lease
+}
+
+func TestParseLeaseFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		parse func(data []byte) (DHCPLease, error)
+		want  DHCPLease
+	}{
+		{
+			name: "systemd-networkd",
+			file: "networkd.lease",
+			parse: func(data []byte) (DHCPLease, error) {
+				return ParseNetworkdLease(strings.NewReader(string(data)), leaseObtained), nil
+			},
+			want: currentLease("systemd-networkd", true),
+		},
+		{
+			name: "NetworkManager device state",
+			file: "networkmanager-device",
+			parse: func(data []byte) (DHCPLease, error) {
+				return ParseNetworkManagerDevice(strings.NewReader(string(data))), nil
+			},
+			want: currentLease("NetworkManager", true),
+		},
+		{
+			name: "dhcpcd raw lease",
+			file: "dhcpcd-eth0.lease",
+			parse: func(data []byte) (DHCPLease, error) {
+				return ParseDhcpcdLease(data, leaseObtained)
+			},
+			want: currentLease("dhcpcd", true),
+		},
+		{
+			name: "dhcpcd info",
+			file: "dhcpcd-eth0.info",
+			parse: func(data []byte) (DHCPLease, error) {
+				// LEASEDFROM in the file wins over the file time passed in
+				return ParseDhcpcdInfo(strings.NewReader(string(data)), time.Now()), nil
+			},
+			want: currentLease("dhcpcd", false),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(readFixture(t, tt.file))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got = inUTC(got); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lease =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDhcpcdLeaseRejectsTruncatedPacket(t *testing.T) {
+	data := readFixture(t, "dhcpcd-eth0.lease")
+	if _, err := ParseDhcpcdLease(data[:200], leaseObtained); err == nil {
+		t.Error("truncated packet parsed without error")
+	}
+}
+
+func TestParseDhclientLeases(t *testing.T) {
+	leases := ParseDhclientLeases(strings.NewReader(string(readFixture(t, "dhclient.leases"))), "dhclient")
+	if len(leases) != 3 {
+		t.Fatalf("got %d leases, want 3: %+v", len(leases), leases)
+	}
+
+	expiredObtained := time.Date(2025, 6, 9, 8, 0, 0, 0, time.UTC)
+	wlanObtained := time.Date(2025, 6, 11, 9, 30, 0, 0, time.UTC)
+	current := currentLease("dhclient", true)
+	current.Interface = "eth0"
+	want := []DHCPLease{
+		{
+			Client:        "dhclient",
+			Interface:     "eth0",
+			Address:       "192.168.1.50",
+			SubnetMask:    "255.255.255.0",
+			LeaseObtained: expiredObtained,
+			LeaseExpires:  expiredObtained.Add(time.Hour),
+			RenewalTime:   expiredObtained.Add(30 * time.Minute),
+			RebindTime:    expiredObtained.Add(52*time.Minute + 30*time.Second),
+			DHCPServer:    "192.168.1.1",
+			Routers:       []string{"192.168.1.1"},
+			DNSServers:    []string{"192.168.1.1"},
+			DomainName:    "old.lan",
+		},
+		{
+			Client:        "dhclient",
+			Interface:     "wlan0",
+			Address:       "10.0.0.77",
+			SubnetMask:    "255.255.255.0",
+			LeaseObtained: wlanObtained,
+			LeaseExpires:  wlanObtained.Add(2 * time.Hour),
+			RenewalTime:   wlanObtained.Add(time.Hour),
+			RebindTime:    wlanObtained.Add(105 * time.Minute),
+			DHCPServer:    "10.0.0.1",
+			Routers:       []string{"10.0.0.1"},
+			DNSServers:    []string{"10.0.0.1", "9.9.9.9"},
+		},
+		current,
+	}
+	for i := range want {
+		if got := inUTC(leases[i]); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("lease %d =\n%+v\nwant\n%+v", i, got, want[i])
+		}
+	}
+}
+
+func TestGetDHCPInfoPrefersCurrentLease(t *testing.T) {
+	// Point every lease location at the fixtures or at an empty directory
+	empty := t.TempDir()
+	oldDhclient, oldDhcpcd := dhclientLeaseGlobs, dhcpcdLeaseGlobs
+	oldNetworkd, oldDevices, oldNM := networkdLeaseDir, networkManagerDevDir, networkManagerLeaseDir
+	t.Cleanup(func() {
+		dhclientLeaseGlobs, dhcpcdLeaseGlobs = oldDhclient, oldDhcpcd
+		networkdLeaseDir, networkManagerDevDir, networkManagerLeaseDir = oldNetworkd, oldDevices, oldNM
+	})
+	dhclientLeaseGlobs = []string{filepath.Join("testdata", "dhcp", "dhclient.leases")}
+	dhcpcdLeaseGlobs = []string{filepath.Join(empty, "*.lease")}
+	networkdLeaseDir, networkManagerDevDir, networkManagerLeaseDir = empty, empty, empty
+
+	leases := findDHCPLeases("eth0")
+	if len(leases) != 2 {
+		t.Fatalf("found %d leases for eth0, want the expired and the current one: %+v", len(leases), leases)
+	}
+	for _, lease := range leases {
+		if lease.Interface != "eth0" || lease.LeaseFile != dhclientLeaseGlobs[0] {
+			t.Errorf("lease %s has interface %q and file %q", lease.Address, lease.Interface, lease.LeaseFile)
+		}
+	}
+
+	// The most recently obtained lease wins over the expired one
+	info := GetDHCPInfo("eth0", "")
+	if info.Address != "192.168.1.23" {
+		t.Errorf("chose lease for %s, want 192.168.1.23", info.Address)
+	}
+
+	// The lease for the assigned address marks the interface as DHCP configured
+	info = GetDHCPInfo("eth0", "192.168.1.23")
+	if !info.Enabled || info.Method != "dhcp" || info.DomainName != "home.lan" {
+		t.Errorf("info = %+v, want DHCP with the home.lan lease", info)
+	}
+	info = GetDHCPInfo("eth0", "192.168.1.50")
+	if info.Address != "192.168.1.50" || info.DomainName != "old.lan" {
+		t.Errorf("info for the old address = %+v, want the old.lan lease", info)
+	}
+}
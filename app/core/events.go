@@ -0,0 +1,197 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// NetworkEventType identifies the kind of change reported by the network monitor
+type NetworkEventType string
+
+const (
+	EventLinkUp             NetworkEventType = "link_up"
+	EventLinkDown           NetworkEventType = "link_down"
+	EventAddressAdded       NetworkEventType = "address_added"
+	EventAddressRemoved     NetworkEventType = "address_removed"
+	EventDefaultRouteChange NetworkEventType = "default_route_changed"
+	EventDHCPRenewal        NetworkEventType = "dhcp_renewal"
+	EventNeighborNew        NetworkEventType = "neighbor_new"
+)
+
+// NetworkEvent represents a single change in the kernel networking state
+type NetworkEvent struct {
+	ID        uint64           `json:"id"`
+	Type      NetworkEventType `json:"type"`
+	Interface string           `json:"interface,omitempty"`
+	Address   string           `json:"address,omitempty"`
+	Detail    string           `json:"detail,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// EventLog keeps the most recent network events in a fixed-size ring buffer
+type EventLog struct {
+	events []NetworkEvent
+	next   int
+	full   bool
+	mu     sync.RWMutex
+}
+
+// NewEventLog creates an event log holding at most size events
+func NewEventLog(size int) *EventLog {
+	if size <= 0 {
+		size = 500
+	}
+	return &EventLog{
+		events: make([]NetworkEvent, size),
+	}
+}
+
+// Add records an event, overwriting the oldest one when the log is full
+func (l *EventLog) Add(event NetworkEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns up to limit events, oldest first. A limit of 0 returns everything.
+func (l *EventLog) Recent(limit int) []NetworkEvent {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var ordered []NetworkEvent
+	if l.full {
+		ordered = append(ordered, l.events[l.next:]...)
+	}
+	ordered = append(ordered, l.events[:l.next]...)
+
+	if limit > 0 && len(ordered) > limit {
+		ordered = ordered[len(ordered)-limit:]
+	}
+	return ordered
+}
+
+// NetworkMonitor listens for kernel network changes and fans them out to subscribers
+type NetworkMonitor struct {
+	log         *EventLog
+	subscribers map[chan NetworkEvent]struct{}
+	nextID      uint64
+	running     bool
+	stop        chan struct{}
+	mu          sync.Mutex
+
+	// Last known state, used to turn raw netlink messages into meaningful events
+	carrier      map[int]bool
+	addresses    map[string]addressState
+	neighbors    map[string]string
+	defaultRoute map[int]string
+}
+
+// addressState tracks the lifetime of an assigned address so renewals can be detected
+type addressState struct {
+	valid   uint32
+	seenAt  time.Time
+	dynamic bool
+}
+
+// NewNetworkMonitor creates a network monitor whose event log holds logSize events
+func NewNetworkMonitor(logSize int) *NetworkMonitor {
+	return &NetworkMonitor{
+		log:          NewEventLog(logSize),
+		subscribers:  make(map[chan NetworkEvent]struct{}),
+		carrier:      make(map[int]bool),
+		addresses:    make(map[string]addressState),
+		neighbors:    make(map[string]string),
+		defaultRoute: make(map[int]string),
+	}
+}
+
+// Start begins listening for network changes in the background. The lock is
+// held while starting, so concurrent calls open a single listener.
+func (m *NetworkMonitor) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return nil
+	}
+	if err := m.start(); err != nil {
+		return err
+	}
+	m.running = true
+	return nil
+}
+
+// Stop stops listening for network changes
+func (m *NetworkMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.running {
+		return
+	}
+	close(m.stop)
+	m.running = false
+}
+
+// IsRunning reports whether the monitor is receiving kernel events
+func (m *NetworkMonitor) IsRunning() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+// Subscribe returns a channel that receives every future event
+func (m *NetworkMonitor) Subscribe() chan NetworkEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ch := make(chan NetworkEvent, 64)
+	m.subscribers[ch] = struct{}{}
+	return ch
+}
+
+// Unsubscribe stops delivering events to the given channel and closes it
+func (m *NetworkMonitor) Unsubscribe(ch chan NetworkEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.subscribers[ch]; ok {
+		delete(m.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Events returns up to limit of the most recently recorded events
+func (m *NetworkMonitor) Events(limit int) []NetworkEvent {
+	return m.log.Recent(limit)
+}
+
+// emit records an event and delivers it to subscribers without blocking
+func (m *NetworkMonitor) emit(eventType NetworkEventType, iface, address, detail string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	event := NetworkEvent{
+		ID:        m.nextID,
+		Type:      eventType,
+		Interface: iface,
+		Address:   address,
+		Detail:    detail,
+		Timestamp: time.Now(),
+	}
+	m.log.Add(event)
+
+	for ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Slow subscriber, drop the event rather than stall the monitor
+		}
+	}
+}
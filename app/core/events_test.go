@@ -0,0 +1,83 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+// eventIDs returns the IDs of events in order
+func eventIDs(events []NetworkEvent) []uint64 {
+	ids := make([]uint64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func TestEventLogBounds(t *testing.T) {
+	log := NewEventLog(3)
+	if events := log.Recent(0); len(events) != 0 {
+		t.Errorf("empty log returned %v", events)
+	}
+
+	tests := []struct {
+		added uint64 // events added so far
+		limit int
+		want  []uint64
+	}{
+		{added: 2, limit: 0, want: []uint64{1, 2}},
+		{added: 2, limit: 1, want: []uint64{2}},
+		{added: 3, limit: 0, want: []uint64{1, 2, 3}},
+		{added: 4, limit: 0, want: []uint64{2, 3, 4}},
+		{added: 5, limit: 2, want: []uint64{4, 5}},
+		{added: 5, limit: 10, want: []uint64{3, 4, 5}},
+		{added: 7, limit: 3, want: []uint64{5, 6, 7}},
+	}
+	var added uint64
+	for _, tt := range tests {
+		for added < tt.added {
+			added++
+			log.Add(NetworkEvent{ID: added, Type: EventLinkUp})
+		}
+		if got := eventIDs(log.Recent(tt.limit)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("after %d events Recent(%d) = %v, want %v", tt.added, tt.limit, got, tt.want)
+		}
+	}
+
+	// Callers get a copy of the events
+	events := log.Recent(0)
+	events[0].ID = 100
+	if got := eventIDs(log.Recent(0)); !reflect.DeepEqual(got, []uint64{5, 6, 7}) {
+		t.Errorf("changing the returned events changed the log: %v", got)
+	}
+}
+
+func TestEventLogDefaultSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		log := NewEventLog(size)
+		for i := 1; i <= 600; i++ {
+			log.Add(NetworkEvent{ID: uint64(i)})
+		}
+		events := log.Recent(0)
+		if len(events) != 500 || events[0].ID != 101 || events[499].ID != 600 {
+			t.Errorf("NewEventLog(%d) kept %d events from %d, want the last 500", size, len(events), events[0].ID)
+		}
+	}
+}
+
+func TestMonitorEmitDropsForSlowSubscribers(t *testing.T) {
+	m := NewNetworkMonitor(100)
+	slow := m.Subscribe()
+	defer m.Unsubscribe(slow)
+
+	// The subscriber buffer holds 64 events; the rest are dropped, not blocked on
+	for i := 0; i < 70; i++ {
+		m.emit(EventLinkUp, "eth0", "", "")
+	}
+	if len(slow) != 64 {
+		t.Errorf("subscriber got %d events, want its buffer of 64", len(slow))
+	}
+	if events := m.Events(0); len(events) != 70 || events[69].ID != 70 {
+		t.Errorf("log kept %d events, want all 70 numbered in order", len(events))
+	}
+}
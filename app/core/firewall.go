@@ -0,0 +1,396 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FirewallRuleset is the firewall configuration in a backend-neutral form
+type FirewallRuleset struct {
+	Backend     string          `json:"backend"` // nftables or iptables
+	Tables      []FirewallTable `json:"tables"`
+	Errors      []string        `json:"errors,omitempty"`
+	CollectedAt time.Time       `json:"collectedAt"`
+}
+
+// FirewallTable is an nftables table, or an iptables table of one address family
+type FirewallTable struct {
+	Family string          `json:"family"` // ip, ip6, inet, arp, bridge or netdev
+	Name   string          `json:"name"`
+	Chains []FirewallChain `json:"chains"`
+}
+
+// FirewallChain is a chain of rules. Base chains are attached to a netfilter hook.
+type FirewallChain struct {
+	Name     string         `json:"name"`
+	Base     bool           `json:"base"`
+	Type     string         `json:"type,omitempty"` // filter, nat or route
+	Hook     string         `json:"hook,omitempty"` // prerouting, input, forward, output or postrouting
+	Priority int            `json:"priority"`
+	Policy   string         `json:"policy,omitempty"` // accept or drop
+	Packets  uint64         `json:"packets,omitempty"`
+	Bytes    uint64         `json:"bytes,omitempty"`
+	Rules    []FirewallRule `json:"rules"`
+}
+
+// FirewallRule is one rule: every match must hold for the verdict to apply
+type FirewallRule struct {
+	Handle  int             `json:"handle,omitempty"`
+	Matches []FirewallMatch `json:"matches"`
+	Verdict string          `json:"verdict,omitempty"` // accept, drop, reject, jump, goto, return or a non-terminal action such as log or masquerade
+	Target  string          `json:"target,omitempty"`  // chain for jump and goto
+	Packets uint64          `json:"packets"`
+	Bytes   uint64          `json:"bytes"`
+	Comment string          `json:"comment,omitempty"`
+	Text    string          `json:"text"`
+}
+
+// FirewallMatch is a condition on one packet field. A rule that uses a
+// condition NetTool does not understand gets a match with Field "unsupported".
+type FirewallMatch struct {
+	Field  string   `json:"field"` // family, protocol, saddr, daddr, sport, dport, iifname, oifname, ct_state or unsupported
+	Negate bool     `json:"negate,omitempty"`
+	Values []string `json:"values"`
+}
+
+// String formats the match in a compact nft-like syntax
+func (m FirewallMatch) String() string {
+	op := ""
+	if m.Negate {
+		op = "!= "
+	}
+	value := strings.Join(m.Values, ",")
+	if len(m.Values) > 1 {
+		value = "{ " + strings.Join(m.Values, ", ") + " }"
+	}
+	if m.Field == "unsupported" {
+		return "(" + value + ")"
+	}
+	return strings.ReplaceAll(m.Field, "_", " ") + " " + op + value
+}
+
+// describeRule builds the Text of a rule from its matches and verdict
+func describeRule(rule FirewallRule) string {
+	var parts []string
+	for _, m := range rule.Matches {
+		parts = append(parts, m.String())
+	}
+	if rule.Verdict != "" {
+		parts = append(parts, strings.TrimSpace(rule.Verdict+" "+rule.Target))
+	}
+	if rule.Comment != "" {
+		parts = append(parts, fmt.Sprintf("comment %q", rule.Comment))
+	}
+	return strings.Join(parts, " ")
+}
+
+// GetFirewallRuleset reads the nftables ruleset, falling back to the legacy
+// iptables tables when nft is missing or has no tables
+func GetFirewallRuleset() (*FirewallRuleset, error) {
+	ruleset := &FirewallRuleset{CollectedAt: time.Now()}
+
+	out, err := runFirewallCommand("nft", "-j", "list", "ruleset")
+	if err == nil {
+		tables, err := ParseNftJSON(bytes.NewReader(out))
+		if err != nil {
+			ruleset.Errors = append(ruleset.Errors, err.Error())
+		} else if len(tables) > 0 {
+			ruleset.Backend = "nftables"
+			ruleset.Tables = tables
+			return ruleset, nil
+		}
+	} else {
+		ruleset.Errors = append(ruleset.Errors, err.Error())
+	}
+
+	ruleset.Backend = "iptables"
+	read := 0
+	for _, source := range []struct{ command, family string }{{"iptables-save", "ip"}, {"ip6tables-save", "ip6"}} {
+		out, err := runFirewallCommand(source.command, "-c")
+		if err != nil {
+			ruleset.Errors = append(ruleset.Errors, err.Error())
+			continue
+		}
+		tables, err := ParseIptablesSave(bytes.NewReader(out), source.family)
+		if err != nil {
+			ruleset.Errors = append(ruleset.Errors, err.Error())
+			continue
+		}
+		read++
+		ruleset.Tables = append(ruleset.Tables, tables...)
+	}
+	if read == 0 {
+		return nil, fmt.Errorf("failed to read the firewall ruleset (nft or iptables-save is needed, run as root): %s", strings.Join(ruleset.Errors, "; "))
+	}
+	return ruleset, nil
+}
+
+// runFirewallCommand runs a ruleset dump command and returns its output
+func runFirewallCommand(name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s failed: %v: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s failed: %v", name, err)
+	}
+	return out.Bytes(), nil
+}
+
+// iptablesPriorities orders iptables tables like the equivalent nftables chain priorities
+var iptablesPriorities = map[string]int{
+	"raw":      -300,
+	"mangle":   -150,
+	"nat":      -100,
+	"filter":   0,
+	"security": 50,
+}
+
+// iptablesBuiltinChains maps built-in chains to their netfilter hooks
+var iptablesBuiltinChains = map[string]string{
+	"PREROUTING":  "prerouting",
+	"INPUT":       "input",
+	"FORWARD":     "forward",
+	"OUTPUT":      "output",
+	"POSTROUTING": "postrouting",
+}
+
+// ParseIptablesSave parses the output of iptables-save (optionally with -c
+// counters) for one address family, "ip" or "ip6"
+func ParseIptablesSave(r io.Reader, family string) ([]FirewallTable, error) {
+	var tables []FirewallTable
+	var table *FirewallTable
+	chainIndex := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "*"):
+			tables = append(tables, FirewallTable{Family: family, Name: line[1:]})
+			table = &tables[len(tables)-1]
+			chainIndex = make(map[string]int)
+			continue
+		case line == "COMMIT":
+			table = nil
+			continue
+		}
+		if table == nil {
+			return nil, fmt.Errorf("iptables-save line outside a table: %q", line)
+		}
+
+		if strings.HasPrefix(line, ":") {
+			// :INPUT ACCEPT [12:3456]
+			fields := strings.Fields(line[1:])
+			chain := FirewallChain{Name: fields[0]}
+			if hook, ok := iptablesBuiltinChains[chain.Name]; ok {
+				chain.Base = true
+				chain.Hook = hook
+				chain.Type = "filter"
+				if table.Name == "nat" {
+					chain.Type = "nat"
+				}
+				chain.Priority = iptablesPriorities[table.Name]
+				if len(fields) > 1 && fields[1] != "-" {
+					chain.Policy = strings.ToLower(fields[1])
+				}
+			}
+			if len(fields) > 2 {
+				chain.Packets, chain.Bytes = parseIptablesCounters(fields[2])
+			}
+			chainIndex[chain.Name] = len(table.Chains)
+			table.Chains = append(table.Chains, chain)
+			continue
+		}
+
+		var packets, bytes uint64
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid counters in iptables-save line: %q", line)
+			}
+			packets, bytes = parseIptablesCounters(line[:end+1])
+			line = strings.TrimSpace(line[end+1:])
+		}
+
+		args := splitShellWords(line)
+		if len(args) < 2 || args[0] != "-A" {
+			continue
+		}
+		i, ok := chainIndex[args[1]]
+		if !ok {
+			return nil, fmt.Errorf("rule for undeclared chain %s in table %s", args[1], table.Name)
+		}
+
+		rule := parseIptablesRule(args[2:], chainIndex)
+		rule.Packets = packets
+		rule.Bytes = bytes
+		rule.Text = line
+		rule.Handle = len(table.Chains[i].Rules) + 1
+		table.Chains[i].Rules = append(table.Chains[i].Rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read iptables-save output: %v", err)
+	}
+	return tables, nil
+}
+
+// parseIptablesRule turns the options of one -A line into matches and a verdict
+func parseIptablesRule(args []string, chains map[string]int) FirewallRule {
+	var rule FirewallRule
+	negate := false
+	module := ""
+	moduleMatch := -1 // index of the unsupported match collecting the current module's options
+
+	value := func(i *int) string {
+		if *i+1 < len(args) {
+			*i++
+			return args[*i]
+		}
+		return ""
+	}
+	add := func(field string, values ...string) {
+		rule.Matches = append(rule.Matches, FirewallMatch{Field: field, Negate: negate, Values: values})
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "!" {
+			negate = true
+			continue
+		}
+
+		switch arg {
+		case "-p", "--protocol":
+			add("protocol", strings.ToLower(value(&i)))
+		case "-s", "--source":
+			add("saddr", strings.Split(value(&i), ",")...)
+		case "-d", "--destination":
+			add("daddr", strings.Split(value(&i), ",")...)
+		case "-i", "--in-interface":
+			add("iifname", value(&i))
+		case "-o", "--out-interface":
+			add("oifname", value(&i))
+		case "--sport", "--source-port", "--sports", "--source-ports":
+			add("sport", iptablesPorts(value(&i))...)
+		case "--dport", "--destination-port", "--dports", "--destination-ports":
+			add("dport", iptablesPorts(value(&i))...)
+		case "--ctstate", "--state":
+			add("ct_state", strings.Split(strings.ToLower(value(&i)), ",")...)
+		case "-m", "--match":
+			// Module names only enable the options that follow
+			module = value(&i)
+			moduleMatch = -1
+		case "--comment":
+			rule.Comment = value(&i)
+		case "-j", "--jump", "-g", "--goto":
+			target := value(&i)
+			switch {
+			case arg == "-g" || arg == "--goto":
+				rule.Verdict = "goto"
+				rule.Target = target
+			case chains != nil && hasChain(chains, target):
+				rule.Verdict = "jump"
+				rule.Target = target
+			default:
+				rule.Verdict = strings.ToLower(target)
+			}
+			// Everything after the target are target options such as --reject-with
+			return rule
+		default:
+			// Unknown option: keep it and its arguments as an unsupported match,
+			// one per module so "-m recent --update --seconds 60" stays together
+			text := arg
+			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") && args[i+1] != "!" {
+				i++
+				text += " " + args[i]
+			}
+			if negate {
+				text = "! " + text
+			}
+			if moduleMatch >= 0 {
+				rule.Matches[moduleMatch].Values[0] += " " + text
+			} else {
+				if module != "" {
+					text = "-m " + module + " " + text
+				}
+				moduleMatch = len(rule.Matches)
+				rule.Matches = append(rule.Matches, FirewallMatch{Field: "unsupported", Values: []string{text}})
+			}
+		}
+		negate = false
+	}
+	return rule
+}
+
+// hasChain reports whether a chain name is declared in the current table
+func hasChain(chains map[string]int, name string) bool {
+	_, ok := chains[name]
+	return ok
+}
+
+// iptablesPorts converts "80,443" and "1000:2000" to nft-style values
+func iptablesPorts(value string) []string {
+	var ports []string
+	for _, port := range strings.Split(value, ",") {
+		ports = append(ports, strings.Replace(port, ":", "-", 1))
+	}
+	return ports
+}
+
+// parseIptablesCounters parses a "[packets:bytes]" counter pair
+func parseIptablesCounters(value string) (uint64, uint64) {
+	value = strings.Trim(value, "[]")
+	p, b, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, 0
+	}
+	packets, _ := strconv.ParseUint(p, 10, 64)
+	bytes, _ := strconv.ParseUint(b, 10, 64)
+	return packets, bytes
+}
+
+// splitShellWords splits a line on spaces, keeping double-quoted strings together
+func splitShellWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	inQuotes, escaped, hasWord := false, false, false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && inQuotes:
+			escaped = true
+		case c == '"':
+			inQuotes = !inQuotes
+			hasWord = true
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if hasWord {
+				words = append(words, word.String())
+				word.Reset()
+				hasWord = false
+			}
+		default:
+			word.WriteRune(c)
+			hasWord = true
+		}
+	}
+	if hasWord {
+		words = append(words, word.String())
+	}
+	return words
+}
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// nftDocument is the top level of 'nft -j list ruleset'
+type nftDocument struct {
+	Nftables []map[string]json.RawMessage `json:"nftables"`
+}
+
+type nftTable struct {
+	Family string `json:"family"`
+	Name   string `json:"name"`
+}
+
+type nftChain struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Hook   string `json:"hook"`
+	Prio   int    `json:"prio"`
+	Policy string `json:"policy"`
+}
+
+type nftRule struct {
+	Family  string                       `json:"family"`
+	Table   string                       `json:"table"`
+	Chain   string                       `json:"chain"`
+	Handle  int                          `json:"handle"`
+	Comment string                       `json:"comment"`
+	Expr    []map[string]json.RawMessage `json:"expr"`
+}
+
+// nftMatch is the "match" statement of a rule expression
+type nftMatch struct {
+	Op    string          `json:"op"`
+	Left  json.RawMessage `json:"left"`
+	Right json.RawMessage `json:"right"`
+}
+
+// ParseNftJSON parses the JSON output of 'nft -j list ruleset'
+func ParseNftJSON(r io.Reader) ([]FirewallTable, error) {
+	var doc nftDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse nft JSON: %v", err)
+	}
+
+	var tables []FirewallTable
+	tableIndex := make(map[string]int)
+	chainIndex := make(map[string]int)
+	key := func(parts ...string) string { return strings.Join(parts, "\x00") }
+
+	for _, object := range doc.Nftables {
+		if raw, ok := object["table"]; ok {
+			var t nftTable
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return nil, fmt.Errorf("failed to parse nft table: %v", err)
+			}
+			tableIndex[key(t.Family, t.Name)] = len(tables)
+			tables = append(tables, FirewallTable{Family: t.Family, Name: t.Name})
+		}
+
+		if raw, ok := object["chain"]; ok {
+			var c nftChain
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return nil, fmt.Errorf("failed to parse nft chain: %v", err)
+			}
+			ti, ok := tableIndex[key(c.Family, c.Table)]
+			if !ok {
+				return nil, fmt.Errorf("nft chain %s refers to unknown table %s %s", c.Name, c.Family, c.Table)
+			}
+			chain := FirewallChain{
+				Name:     c.Name,
+				Base:     c.Hook != "",
+				Type:     c.Type,
+				Hook:     c.Hook,
+				Priority: c.Prio,
+				Policy:   c.Policy,
+			}
+			if chain.Base && chain.Policy == "" {
+				chain.Policy = "accept"
+			}
+			chainIndex[key(c.Family, c.Table, c.Name)] = len(tables[ti].Chains)
+			tables[ti].Chains = append(tables[ti].Chains, chain)
+		}
+
+		if raw, ok := object["rule"]; ok {
+			var nr nftRule
+			if err := json.Unmarshal(raw, &nr); err != nil {
+				return nil, fmt.Errorf("failed to parse nft rule: %v", err)
+			}
+			ti, ok := tableIndex[key(nr.Family, nr.Table)]
+			if !ok {
+				return nil, fmt.Errorf("nft rule refers to unknown table %s %s", nr.Family, nr.Table)
+			}
+			ci, ok := chainIndex[key(nr.Family, nr.Table, nr.Chain)]
+			if !ok {
+				return nil, fmt.Errorf("nft rule refers to unknown chain %s", nr.Chain)
+			}
+			rule := parseNftRule(nr)
+			tables[ti].Chains[ci].Rules = append(tables[ti].Chains[ci].Rules, rule)
+		}
+	}
+	return tables, nil
+}
+
+// parseNftRule converts the statements of an nft rule into matches and a verdict
+func parseNftRule(nr nftRule) FirewallRule {
+	rule := FirewallRule{Handle: nr.Handle, Comment: nr.Comment}
+
+	for _, expr := range nr.Expr {
+		for statement, raw := range expr {
+			switch statement {
+			case "match":
+				var m nftMatch
+				if err := json.Unmarshal(raw, &m); err != nil {
+					rule.Matches = append(rule.Matches, FirewallMatch{Field: "unsupported", Values: []string{string(raw)}})
+					continue
+				}
+				rule.Matches = append(rule.Matches, nftMatches(m)...)
+			case "counter":
+				var counter struct {
+					Packets uint64 `json:"packets"`
+					Bytes   uint64 `json:"bytes"`
+				}
+				json.Unmarshal(raw, &counter)
+				rule.Packets = counter.Packets
+				rule.Bytes = counter.Bytes
+			case "jump", "goto":
+				var target struct {
+					Target string `json:"target"`
+				}
+				json.Unmarshal(raw, &target)
+				rule.Verdict = statement
+				rule.Target = target.Target
+			case "accept", "drop", "reject", "return", "queue", "masquerade", "snat", "dnat", "redirect":
+				rule.Verdict = statement
+			case "log", "mangle", "meta", "ct", "notrack":
+				// Side effects only; they do not decide the packet's fate
+			case "limit", "xt":
+				// Whether these let the packet through depends on state a trace cannot see
+				rule.Matches = append(rule.Matches, FirewallMatch{Field: "unsupported", Values: []string{statement + " " + string(raw)}})
+			default:
+				rule.Matches = append(rule.Matches, FirewallMatch{Field: "unsupported", Values: []string{statement}})
+			}
+		}
+	}
+
+	rule.Text = describeRule(rule)
+	return rule
+}
+
+// nftMatches maps one nft match expression onto normalized matches. Matching
+// a transport header field also implies the protocol, and an IP header field
+// the address family.
+func nftMatches(m nftMatch) []FirewallMatch {
+	negate := m.Op == "!="
+	values := nftValues(m.Right)
+	unsupported := []FirewallMatch{{Field: "unsupported", Values: []string{strings.TrimSpace(string(m.Left) + " " + m.Op + " " + string(m.Right))}}}
+	if m.Op != "" && m.Op != "==" && m.Op != "!=" && m.Op != "in" {
+		return unsupported
+	}
+
+	var left struct {
+		Payload *struct {
+			Protocol string `json:"protocol"`
+			Field    string `json:"field"`
+		} `json:"payload"`
+		Meta *struct {
+			Key string `json:"key"`
+		} `json:"meta"`
+		Ct *struct {
+			Key string `json:"key"`
+		} `json:"ct"`
+	}
+	if err := json.Unmarshal(m.Left, &left); err != nil {
+		return unsupported
+	}
+
+	switch {
+	case left.Payload != nil:
+		proto, field := left.Payload.Protocol, left.Payload.Field
+		switch {
+		case (proto == "ip" || proto == "ip6") && (field == "saddr" || field == "daddr"):
+			family := "ipv4"
+			if proto == "ip6" {
+				family = "ipv6"
+			}
+			return []FirewallMatch{{Field: "family", Values: []string{family}}, {Field: field, Negate: negate, Values: values}}
+		case proto == "ip" && field == "protocol", proto == "ip6" && field == "nexthdr":
+			return []FirewallMatch{{Field: "protocol", Negate: negate, Values: values}}
+		case (proto == "tcp" || proto == "udp" || proto == "sctp") && (field == "sport" || field == "dport"):
+			return []FirewallMatch{{Field: "protocol", Values: []string{proto}}, {Field: field, Negate: negate, Values: values}}
+		}
+	case left.Meta != nil:
+		switch left.Meta.Key {
+		case "l4proto":
+			return []FirewallMatch{{Field: "protocol", Negate: negate, Values: values}}
+		case "nfproto":
+			return []FirewallMatch{{Field: "family", Negate: negate, Values: values}}
+		case "iifname", "iif":
+			return []FirewallMatch{{Field: "iifname", Negate: negate, Values: values}}
+		case "oifname", "oif":
+			return []FirewallMatch{{Field: "oifname", Negate: negate, Values: values}}
+		}
+	case left.Ct != nil && left.Ct.Key == "state":
+		return []FirewallMatch{{Field: "ct_state", Negate: negate, Values: values}}
+	}
+	return unsupported
+}
+
+// nftValues flattens the right-hand side of a match: a scalar, a list, a set,
+// a prefix or a range
+func nftValues(raw json.RawMessage) []string {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return []string{string(raw)}
+	}
+	return flattenNftValue(value)
+}
+
+func flattenNftValue(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, flattenNftValue(item)...)
+		}
+		return values
+	case map[string]interface{}:
+		if set, ok := v["set"]; ok {
+			return flattenNftValue(set)
+		}
+		if prefix, ok := v["prefix"].(map[string]interface{}); ok {
+			return []string{fmt.Sprintf("%v/%v", prefix["addr"], prefix["len"])}
+		}
+		if bounds, ok := v["range"].([]interface{}); ok && len(bounds) == 2 {
+			low, high := flattenNftValue(bounds[0]), flattenNftValue(bounds[1])
+			if len(low) == 1 && len(high) == 1 {
+				return []string{low[0] + "-" + high[0]}
+			}
+		}
+	}
+	encoded, _ := json.Marshal(value)
+	return []string{string(encoded)}
+}
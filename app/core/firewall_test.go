@@ -0,0 +1,157 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// traceCase is one entry of testdata/firewall/trace_cases.json
+type traceCase struct {
+	Name      string      `json:"name"`
+	Ruleset   string      `json:"ruleset"`
+	Packet    PacketTuple `json:"packet"`
+	Verdict   string      `json:"verdict"`
+	Chain     string      `json:"chain"`
+	Handle    int         `json:"handle"`
+	Policy    bool        `json:"policy"`
+	Uncertain bool        `json:"uncertain"`
+}
+
+// loadFirewallFixture parses one of the ruleset fixtures
+func loadFirewallFixture(t *testing.T, name string) *FirewallRuleset {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "firewall", name))
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+
+	ruleset := &FirewallRuleset{}
+	switch filepath.Ext(name) {
+	case ".json":
+		ruleset.Backend = "nftables"
+		ruleset.Tables, err = ParseNftJSON(f)
+	default:
+		ruleset.Backend = "iptables"
+		ruleset.Tables, err = ParseIptablesSave(f, "ip")
+	}
+	if err != nil {
+		t.Fatalf("parse %s: %v", name, err)
+	}
+	if len(ruleset.Tables) == 0 {
+		t.Fatalf("parse %s: no tables", name)
+	}
+	return ruleset
+}
+
+// rulesetChain returns the named chain of the named table
+func rulesetChain(rs *FirewallRuleset, table string, chain string) *FirewallChain {
+	for ti := range rs.Tables {
+		if rs.Tables[ti].Name != table {
+			continue
+		}
+		for ci := range rs.Tables[ti].Chains {
+			if rs.Tables[ti].Chains[ci].Name == chain {
+				return &rs.Tables[ti].Chains[ci]
+			}
+		}
+	}
+	return nil
+}
+
+func TestParseNftJSON(t *testing.T) {
+	rs := loadFirewallFixture(t, "nft_ruleset.json")
+
+	input := rulesetChain(rs, "filter", "input")
+	if input == nil {
+		t.Fatalf("no input chain in %+v", rs.Tables)
+	}
+	if !input.Base || input.Hook != "input" || input.Type != "filter" || input.Policy != "drop" {
+		t.Errorf("input chain = base %v hook %q type %q policy %q, want a filter base chain on input with policy drop", input.Base, input.Hook, input.Type, input.Policy)
+	}
+	if len(input.Rules) == 0 {
+		t.Fatal("input chain has no rules")
+	}
+	for _, rule := range input.Rules {
+		if rule.Handle == 0 || rule.Text == "" {
+			t.Errorf("rule %+v has no handle or text", rule)
+		}
+	}
+
+	if lan := rulesetChain(rs, "filter", "lan_services"); lan == nil || lan.Base {
+		t.Errorf("lan_services = %+v, want a regular chain", lan)
+	}
+}
+
+func TestParseIptablesSave(t *testing.T) {
+	rs := loadFirewallFixture(t, "iptables_save.txt")
+
+	input := rulesetChain(rs, "filter", "INPUT")
+	if input == nil {
+		t.Fatalf("no INPUT chain in %+v", rs.Tables)
+	}
+	if !input.Base || input.Hook != "input" || input.Policy != "drop" {
+		t.Errorf("INPUT = base %v hook %q policy %q, want a base chain on input with policy drop", input.Base, input.Hook, input.Policy)
+	}
+	for _, table := range rs.Tables {
+		if table.Family != "ip" {
+			t.Errorf("table %s has family %q, want ip", table.Name, table.Family)
+		}
+	}
+
+	trusted := rulesetChain(rs, "filter", "TRUSTED")
+	if trusted == nil || trusted.Base {
+		t.Errorf("TRUSTED = %+v, want a user chain", trusted)
+	}
+	if raw := rulesetChain(rs, "raw", "PREROUTING"); raw == nil || raw.Hook != "prerouting" {
+		t.Errorf("raw PREROUTING = %+v, want a chain on prerouting", raw)
+	}
+}
+
+func TestTraceCases(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "firewall", "trace_cases.json"))
+	if err != nil {
+		t.Fatalf("read cases: %v", err)
+	}
+	var cases []traceCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatalf("parse cases: %v", err)
+	}
+
+	rulesets := make(map[string]*FirewallRuleset)
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rs, ok := rulesets[tc.Ruleset]
+			if !ok {
+				rs = loadFirewallFixture(t, tc.Ruleset)
+				rulesets[tc.Ruleset] = rs
+			}
+
+			result, err := rs.Trace(tc.Packet)
+			if err != nil {
+				t.Fatalf("trace: %v", err)
+			}
+			if result.Verdict != tc.Verdict {
+				t.Errorf("verdict = %q, want %q", result.Verdict, tc.Verdict)
+			}
+			if result.Uncertain != tc.Uncertain {
+				t.Errorf("uncertain = %v, want %v", result.Uncertain, tc.Uncertain)
+			}
+			deciding := result.Deciding
+			if deciding == nil {
+				t.Fatalf("no deciding step in %+v", result.Steps)
+			}
+			if deciding.Chain != tc.Chain {
+				t.Errorf("deciding chain = %q, want %q", deciding.Chain, tc.Chain)
+			}
+			if deciding.Policy != tc.Policy {
+				t.Errorf("deciding policy = %v, want %v", deciding.Policy, tc.Policy)
+			}
+			if !tc.Policy && deciding.Handle != tc.Handle {
+				t.Errorf("deciding handle = %d, want %d (%s)", deciding.Handle, tc.Handle, deciding.Rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PacketTuple describes a packet to trace through the firewall
+type PacketTuple struct {
+	Family          string `json:"family,omitempty"` // ipv4 or ipv6; derived from the addresses when empty
+	Protocol        string `json:"protocol"`         // tcp, udp, icmp, ...
+	Source          string `json:"source"`
+	Destination     string `json:"destination"`
+	SourcePort      int    `json:"sourcePort,omitempty"`
+	DestinationPort int    `json:"destinationPort,omitempty"`
+	InInterface     string `json:"inInterface,omitempty"`
+	OutInterface    string `json:"outInterface,omitempty"`
+	Direction       string `json:"direction,omitempty"` // input (default), output or forward
+	State           string `json:"state,omitempty"`     // conntrack state, default new
+}
+
+// TraceStep is one rule that matched, or a chain policy that applied, on the packet's path
+type TraceStep struct {
+	Family    string `json:"family"`
+	Table     string `json:"table"`
+	Chain     string `json:"chain"`
+	Handle    int    `json:"handle,omitempty"`
+	Rule      string `json:"rule"`
+	Verdict   string `json:"verdict,omitempty"`
+	Policy    bool   `json:"policy,omitempty"`    // The chain's default policy applied
+	Uncertain bool   `json:"uncertain,omitempty"` // The rule has conditions the tracer cannot evaluate
+}
+
+// TraceResult is the outcome of tracing a packet
+type TraceResult struct {
+	Packet    PacketTuple `json:"packet"`
+	Verdict   string      `json:"verdict"` // accept, drop or reject
+	Deciding  *TraceStep  `json:"deciding,omitempty"`
+	Steps     []TraceStep `json:"steps"`
+	Uncertain bool        `json:"uncertain"` // Rules the tracer could not evaluate were skipped
+	Notes     []string    `json:"notes,omitempty"`
+}
+
+// tracePaths lists the hooks a packet passes through for each direction
+var tracePaths = map[string][]string{
+	"input":   {"prerouting", "input"},
+	"forward": {"prerouting", "forward", "postrouting"},
+	"output":  {"output", "postrouting"},
+}
+
+// maxTraceDepth bounds jump nesting so a looping ruleset cannot hang a trace
+const maxTraceDepth = 32
+
+// Normalize fills in defaults and checks that the packet can be traced
+func (p *PacketTuple) Normalize() error {
+	p.Protocol = strings.ToLower(p.Protocol)
+	if p.Protocol == "" {
+		return fmt.Errorf("protocol is required")
+	}
+	if p.Direction == "" {
+		p.Direction = "input"
+	}
+	if _, ok := tracePaths[p.Direction]; !ok {
+		return fmt.Errorf("direction must be input, output or forward")
+	}
+	if p.State == "" {
+		p.State = "new"
+	}
+	p.State = strings.ToLower(p.State)
+
+	for _, addr := range []string{p.Source, p.Destination} {
+		if addr == "" {
+			continue
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+		family := "ipv6"
+		if ip.To4() != nil {
+			family = "ipv4"
+		}
+		if p.Family == "" {
+			p.Family = family
+		} else if p.Family != family {
+			return fmt.Errorf("address %s is not %s", addr, p.Family)
+		}
+	}
+	if p.Family == "" {
+		p.Family = "ipv4"
+	}
+	return nil
+}
+
+// Trace evaluates which rules a packet would hit and what the final verdict is.
+// Only filter-type chains are evaluated; NAT and routing chains never drop.
+func (rs *FirewallRuleset) Trace(packet PacketTuple) (*TraceResult, error) {
+	if err := packet.Normalize(); err != nil {
+		return nil, err
+	}
+	t := &tracer{packet: packet, result: &TraceResult{Packet: packet, Verdict: "accept"}}
+
+	for _, hook := range tracePaths[packet.Direction] {
+		// Base chains on the same hook run in priority order, across tables
+		type baseChain struct {
+			table *FirewallTable
+			chain *FirewallChain
+		}
+		var chains []baseChain
+		for ti := range rs.Tables {
+			table := &rs.Tables[ti]
+			if !familyApplies(table.Family, packet.Family) {
+				continue
+			}
+			for ci := range table.Chains {
+				chain := &table.Chains[ci]
+				if chain.Base && chain.Hook == hook && (chain.Type == "filter" || chain.Type == "") {
+					chains = append(chains, baseChain{table, chain})
+				}
+			}
+		}
+		sort.SliceStable(chains, func(i, j int) bool { return chains[i].chain.Priority < chains[j].chain.Priority })
+
+		for _, bc := range chains {
+			verdict := t.evalChain(bc.table, bc.chain, 0)
+			if verdict == "" {
+				verdict = bc.chain.Policy
+				if verdict == "" {
+					verdict = "accept"
+				}
+				t.step(TraceStep{Family: bc.table.Family, Table: bc.table.Name, Chain: bc.chain.Name, Rule: "policy " + verdict, Verdict: verdict, Policy: true})
+			}
+			// Accept ends this base chain only; the next one still sees the packet
+			if verdict != "accept" {
+				t.result.Verdict = verdict
+				return t.result, nil
+			}
+		}
+	}
+
+	if len(t.result.Steps) == 0 {
+		t.result.Notes = append(t.result.Notes, "no filter chains apply to this packet")
+	}
+	return t.result, nil
+}
+
+// tracer holds the state of one trace
+type tracer struct {
+	packet PacketTuple
+	result *TraceResult
+}
+
+// step records a step, remembering it as the deciding one
+func (t *tracer) step(s TraceStep) {
+	t.result.Steps = append(t.result.Steps, s)
+	if s.Verdict == "accept" || s.Verdict == "drop" || s.Verdict == "reject" {
+		decided := t.result.Steps[len(t.result.Steps)-1]
+		t.result.Deciding = &decided
+	}
+}
+
+// evalChain runs the packet through a chain. It returns accept, drop or
+// reject, or "" when the chain ended without a terminal verdict.
+func (t *tracer) evalChain(table *FirewallTable, chain *FirewallChain, depth int) string {
+	if depth > maxTraceDepth {
+		t.result.Notes = append(t.result.Notes, fmt.Sprintf("jumps nested deeper than %d at chain %s; stopped following them", maxTraceDepth, chain.Name))
+		t.result.Uncertain = true
+		return ""
+	}
+
+	for _, rule := range chain.Rules {
+		matched, certain := t.matchRule(rule)
+		if !certain {
+			// Record rules we could not evaluate; the trace assumes they do not match
+			t.result.Uncertain = true
+			t.result.Steps = append(t.result.Steps, TraceStep{Family: table.Family, Table: table.Name, Chain: chain.Name, Handle: rule.Handle, Rule: rule.Text, Uncertain: true})
+		}
+		if !matched {
+			continue
+		}
+
+		step := TraceStep{Family: table.Family, Table: table.Name, Chain: chain.Name, Handle: rule.Handle, Rule: rule.Text, Verdict: rule.Verdict}
+		switch rule.Verdict {
+		case "accept", "drop", "reject":
+			t.step(step)
+			return rule.Verdict
+		case "return":
+			t.step(step)
+			return ""
+		case "jump", "goto":
+			t.step(step)
+			target := findChain(table, rule.Target)
+			if target == nil {
+				t.result.Notes = append(t.result.Notes, fmt.Sprintf("chain %s jumps to unknown chain %s", chain.Name, rule.Target))
+				continue
+			}
+			verdict := t.evalChain(table, target, depth+1)
+			if verdict != "" || rule.Verdict == "goto" {
+				return verdict
+			}
+		case "":
+			// Counting or logging rule; evaluation continues
+			t.step(step)
+		default:
+			// Non-terminal actions such as log or queue
+			t.step(step)
+			if rule.Verdict == "queue" {
+				t.result.Notes = append(t.result.Notes, "packet is queued to userspace; its fate depends on the listening program")
+				t.result.Uncertain = true
+				return "accept"
+			}
+		}
+	}
+	return ""
+}
+
+// findChain looks up a chain by name within a table
+func findChain(table *FirewallTable, name string) *FirewallChain {
+	for i := range table.Chains {
+		if table.Chains[i].Name == name {
+			return &table.Chains[i]
+		}
+	}
+	return nil
+}
+
+// familyApplies reports whether a table of the given family sees packets of a family
+func familyApplies(tableFamily, packetFamily string) bool {
+	switch tableFamily {
+	case "inet":
+		return true
+	case "ip":
+		return packetFamily == "ipv4"
+	case "ip6":
+		return packetFamily == "ipv6"
+	}
+	return false
+}
+
+// matchRule reports whether all of a rule's matches hold, and whether the
+// answer is certain (false when the rule uses conditions the tracer cannot evaluate)
+func (t *tracer) matchRule(rule FirewallRule) (matched, certain bool) {
+	certain = true
+	for _, m := range rule.Matches {
+		if m.Field == "unsupported" {
+			certain = false
+			continue
+		}
+		if t.matchField(m) == m.Negate {
+			// A definite mismatch makes the answer certain regardless of unknown conditions
+			return false, true
+		}
+	}
+	if !certain {
+		return false, false
+	}
+	return true, true
+}
+
+// matchField reports whether any value of a match equals the packet's field
+func (t *tracer) matchField(m FirewallMatch) bool {
+	p := t.packet
+	for _, value := range m.Values {
+		var ok bool
+		switch m.Field {
+		case "family":
+			ok = value == p.Family
+		case "protocol":
+			ok = protocolName(value) == "all" || protocolName(value) == protocolName(p.Protocol)
+		case "saddr":
+			ok = addressMatches(value, p.Source)
+		case "daddr":
+			ok = addressMatches(value, p.Destination)
+		case "sport":
+			ok = portMatches(value, p.SourcePort, p.Protocol)
+		case "dport":
+			ok = portMatches(value, p.DestinationPort, p.Protocol)
+		case "iifname":
+			ok = interfaceMatches(value, p.InInterface)
+		case "oifname":
+			ok = interfaceMatches(value, p.OutInterface)
+		case "ct_state":
+			ok = strings.EqualFold(value, p.State)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// protocolName normalizes protocol numbers and aliases to names
+func protocolName(value string) string {
+	switch strings.ToLower(value) {
+	case "6", "tcp":
+		return "tcp"
+	case "17", "udp":
+		return "udp"
+	case "1", "icmp":
+		return "icmp"
+	case "58", "icmpv6", "ipv6-icmp":
+		return "icmpv6"
+	case "132", "sctp":
+		return "sctp"
+	case "all", "0":
+		return "all"
+	}
+	return strings.ToLower(value)
+}
+
+// addressMatches checks an address against an IP, CIDR prefix or "low-high" range
+func addressMatches(value, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network.Contains(ip)
+	}
+	if low, high, ok := strings.Cut(value, "-"); ok {
+		lowIP, highIP := net.ParseIP(low), net.ParseIP(high)
+		if lowIP == nil || highIP == nil {
+			return false
+		}
+		return compareIP(ip, lowIP) >= 0 && compareIP(ip, highIP) <= 0
+	}
+	if other := net.ParseIP(value); other != nil {
+		return other.Equal(ip)
+	}
+	return false
+}
+
+// compareIP orders two addresses of the same family
+func compareIP(a, b net.IP) int {
+	a16, b16 := a.To16(), b.To16()
+	for i := range a16 {
+		if a16[i] != b16[i] {
+			if a16[i] < b16[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// portMatches checks a port against a number, a "low-high" range or a service name
+func portMatches(value string, port int, protocol string) bool {
+	if low, high, ok := strings.Cut(value, "-"); ok {
+		lowPort, err1 := strconv.Atoi(low)
+		highPort, err2 := strconv.Atoi(high)
+		return err1 == nil && err2 == nil && port >= lowPort && port <= highPort
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return n == port
+	}
+	if n, err := net.LookupPort(protocolName(protocol), value); err == nil {
+		return n == port
+	}
+	return false
+}
+
+// interfaceMatches checks an interface name against a pattern ending in "*" (nft) or "+" (iptables)
+func interfaceMatches(pattern, name string) bool {
+	if strings.HasSuffix(pattern, "*") || strings.HasSuffix(pattern, "+") {
+		return strings.HasPrefix(name, pattern[:len(pattern)-1])
+	}
+	return pattern == name
+}
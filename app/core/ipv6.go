@@ -0,0 +1,520 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPv6Address is an IPv6 address of an interface and where it came from
+type IPv6Address struct {
+	Interface            string `json:"interface"`
+	Address              string `json:"address"`
+	PrefixLength         int    `json:"prefixLength"`
+	Scope                string `json:"scope"`     // global, ula or link-local
+	Source               string `json:"source"`    // slaac, dhcpv6, static or link-local
+	Temporary            bool   `json:"temporary"` // privacy extension address
+	Deprecated           bool   `json:"deprecated"`
+	ValidLifetimeSec     int64  `json:"validLifetimeSec"` // -1 when forever
+	PreferredLifetimeSec int64  `json:"preferredLifetimeSec"`
+}
+
+// IPv6Route is an IPv6 default route
+type IPv6Route struct {
+	Gateway    string `json:"gateway"`
+	Interface  string `json:"interface"`
+	Protocol   string `json:"protocol"` // ra when learned from a router advertisement
+	Metric     int    `json:"metric"`
+	Preference string `json:"preference,omitempty"`
+	ExpiresSec int    `json:"expiresSec,omitempty"`
+}
+
+// AAAACheck is the outcome of resolving a name's IPv6 addresses
+type AAAACheck struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// FamilyProbe is a latency measurement over one address family
+type FamilyProbe struct {
+	Address   string  `json:"address,omitempty"`
+	LatencyMS float64 `json:"latencyMs,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// DualStackResult compares reaching a target over IPv4 and IPv6
+type DualStackResult struct {
+	Target string      `json:"target"`
+	Host   string      `json:"host"`
+	Method string      `json:"method"` // tcp or icmp
+	IPv4   FamilyProbe `json:"ipv4"`
+	IPv6   FamilyProbe `json:"ipv6"`
+	// Winner is the family a happy eyeballs client (RFC 8305) would end up
+	// using: IPv6 unless it fails or is more than 250 ms slower than IPv4
+	Winner        string  `json:"winner,omitempty"`
+	IPv6PenaltyMS float64 `json:"ipv6PenaltyMs"` // IPv6 minus IPv4 latency
+}
+
+// ReadinessCheck is one pass/fail item of the IPv6 readiness report
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// IPv6Readiness is how well the host can use IPv6
+type IPv6Readiness struct {
+	Status               string                `json:"status"` // ready, partial or unavailable
+	Checks               []ReadinessCheck      `json:"checks"`
+	Addresses            []IPv6Address         `json:"addresses"`
+	DefaultRoutes        []IPv6Route           `json:"defaultRoutes"`
+	RouterAdvertisements []RouterAdvertisement `json:"routerAdvertisements"`
+	AAAA                 []AAAACheck           `json:"aaaa"`
+	DualStack            []DualStackResult     `json:"dualStack"`
+	Errors               []string              `json:"errors,omitempty"`
+	CollectedAt          time.Time             `json:"collectedAt"`
+}
+
+// IPv6Options tunes the readiness report
+type IPv6Options struct {
+	Listen  time.Duration   // how long to wait for router advertisements, default 3s, at most MaxIPv6Listen
+	Targets []LatencyTarget // dual-stack comparison targets, default the configured latency targets
+}
+
+// MaxIPv6Listen caps how long a readiness report waits for router advertisements
+const MaxIPv6Listen = 10 * time.Second
+
+// happyEyeballsDelay is the head start RFC 8305 gives IPv6 connection attempts
+const happyEyeballsDelay = 250 * time.Millisecond
+
+// GetIPv6Readiness classifies the host's IPv6 addresses, listens for router
+// advertisements, checks the default route and AAAA resolution, and compares
+// reaching each target over IPv4 and IPv6
+func GetIPv6Readiness(opts IPv6Options) (*IPv6Readiness, error) {
+	if opts.Listen <= 0 {
+		opts.Listen = 3 * time.Second
+	}
+	opts.Listen = min(opts.Listen, MaxIPv6Listen)
+	if len(opts.Targets) == 0 {
+		opts.Targets = latencyTargets()
+	}
+	report := &IPv6Readiness{CollectedAt: time.Now()}
+
+	addresses, err := GetIPv6Addresses("")
+	if err != nil {
+		return nil, err
+	}
+	report.Addresses = addresses
+
+	report.DefaultRoutes, err = ipv6DefaultRoutes()
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	// Solicit on every interface that can talk IPv6 on its link
+	var ifaces []string
+	seen := make(map[string]bool)
+	for _, addr := range addresses {
+		if addr.Scope == "link-local" && !seen[addr.Interface] {
+			seen[addr.Interface] = true
+			ifaces = append(ifaces, addr.Interface)
+		}
+	}
+
+	// Router discovery and the probes run side by side; both mostly wait
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if len(ifaces) == 0 {
+			return
+		}
+		ras, err := listenRouterAdvertisements(ifaces, opts.Listen)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		report.RouterAdvertisements = ras
+	}()
+	go func() {
+		defer wg.Done()
+		report.AAAA, report.DualStack = probeDualStack(opts.Targets)
+	}()
+	wg.Wait()
+
+	report.assess()
+	return report, nil
+}
+
+// assess fills in the checks and the overall status
+func (r *IPv6Readiness) assess() {
+	counts := make(map[string]int)
+	sources := make(map[string]bool)
+	for _, addr := range r.Addresses {
+		counts[addr.Scope]++
+		if addr.Scope != "link-local" {
+			sources[addr.Source] = true
+		}
+	}
+	var sourceNames []string
+	for _, source := range []string{"slaac", "dhcpv6", "static"} {
+		if sources[source] {
+			sourceNames = append(sourceNames, source)
+		}
+	}
+	check := func(name string, ok bool, detail string) {
+		r.Checks = append(r.Checks, ReadinessCheck{Name: name, OK: ok, Detail: detail})
+	}
+
+	check("global address", counts["global"] > 0,
+		fmt.Sprintf("%d global, %d ULA, %d link-local addresses; configured by %s", counts["global"], counts["ula"], counts["link-local"], firstNonEmpty(strings.Join(sourceNames, ", "), "nothing")))
+
+	if len(r.DefaultRoutes) > 0 {
+		route := r.DefaultRoutes[0]
+		detail := fmt.Sprintf("via %s dev %s", route.Gateway, route.Interface)
+		if route.Protocol != "" {
+			detail += " (proto " + route.Protocol + ")"
+		}
+		check("default route", true, detail)
+	} else {
+		check("default route", false, "no IPv6 default route")
+	}
+
+	switch {
+	case len(r.RouterAdvertisements) > 0:
+		ra := r.RouterAdvertisements[0]
+		mode := "SLAAC"
+		if ra.Managed {
+			mode = "DHCPv6 addresses (M flag)"
+		} else if ra.Other {
+			mode = "SLAAC with DHCPv6 for other configuration (O flag)"
+		}
+		check("router advertisement", true, fmt.Sprintf("%d router(s); %s from %s, lifetime %ds, %d prefix(es), %d RDNSS", len(r.RouterAdvertisements), mode, ra.Router, ra.RouterLifetimeSec, len(ra.Prefixes), len(ra.RDNSS)))
+	case hasRARoute(r.DefaultRoutes):
+		check("router advertisement", true, "none heard while listening, but the kernel learned its default route from one")
+	default:
+		check("router advertisement", false, "no router advertisement received")
+	}
+
+	resolved := 0
+	for _, aaaa := range r.AAAA {
+		if len(aaaa.Addresses) > 0 {
+			resolved++
+		}
+	}
+	check("AAAA resolution", resolved > 0, fmt.Sprintf("%d of %d target names have IPv6 addresses", resolved, len(r.AAAA)))
+
+	reachable, preferred := 0, 0
+	for _, result := range r.DualStack {
+		if result.IPv6.Error == "" && result.IPv6.Address != "" {
+			reachable++
+		}
+		if result.Winner == "ipv6" {
+			preferred++
+		}
+	}
+	check("IPv6 reachability", reachable > 0, fmt.Sprintf("%d of %d dual-stack targets reachable over IPv6; happy eyeballs would pick IPv6 for %d", reachable, len(r.DualStack), preferred))
+
+	r.Status = "ready"
+	for _, c := range r.Checks {
+		if !c.OK {
+			r.Status = "partial"
+		}
+	}
+	if counts["global"] == 0 || len(r.DefaultRoutes) == 0 {
+		r.Status = "unavailable"
+	}
+}
+
+// hasRARoute reports whether a default route was learned from a router advertisement
+func hasRARoute(routes []IPv6Route) bool {
+	for _, route := range routes {
+		if route.Protocol == "ra" {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAddrInfo is one address in the output of 'ip -j -6 addr show'
+type ipAddrInfo struct {
+	Local         string  `json:"local"`
+	PrefixLen     int     `json:"prefixlen"`
+	Dynamic       bool    `json:"dynamic"`
+	Temporary     bool    `json:"temporary"`
+	MngTmpAddr    bool    `json:"mngtmpaddr"`
+	Deprecated    bool    `json:"deprecated"`
+	Protocol      string  `json:"protocol"`
+	ValidLife     float64 `json:"valid_life_time"`
+	PreferredLife float64 `json:"preferred_life_time"`
+}
+
+// GetIPv6Addresses lists the IPv6 addresses of an interface, or of all
+// interfaces when name is empty, skipping loopback
+func GetIPv6Addresses(name string) ([]IPv6Address, error) {
+	args := []string{"-j", "-6", "addr", "show"}
+	if name != "" {
+		args = append(args, "dev", name)
+	}
+	out, err := exec.Command("ip", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list IPv6 addresses: %v", err)
+	}
+
+	var links []struct {
+		Name     string       `json:"ifname"`
+		AddrInfo []ipAddrInfo `json:"addr_info"`
+	}
+	if err := json.Unmarshal(out, &links); err != nil {
+		return nil, fmt.Errorf("failed to parse ip address output: %v", err)
+	}
+
+	addresses := []IPv6Address{}
+	for _, link := range links {
+		for _, info := range link.AddrInfo {
+			ip := net.ParseIP(info.Local)
+			if ip == nil || ip.IsLoopback() {
+				continue
+			}
+			addresses = append(addresses, IPv6Address{
+				Interface:            link.Name,
+				Address:              info.Local,
+				PrefixLength:         info.PrefixLen,
+				Scope:                ipv6Scope(ip),
+				Source:               ipv6AddressSource(ip, info),
+				Temporary:            info.Temporary,
+				Deprecated:           info.Deprecated,
+				ValidLifetimeSec:     ipLifetime(info.ValidLife),
+				PreferredLifetimeSec: ipLifetime(info.PreferredLife),
+			})
+		}
+	}
+	return addresses, nil
+}
+
+// ipv6Scope classifies an address as global, ula or link-local
+func ipv6Scope(ip net.IP) string {
+	switch {
+	case ip.IsLinkLocalUnicast():
+		return "link-local"
+	case ip.IsPrivate():
+		return "ula" // fc00::/7
+	case ip.IsGlobalUnicast():
+		return "global"
+	}
+	return "other"
+}
+
+// ipv6ScopeRank orders scopes by how useful an address is to show
+func ipv6ScopeRank(ip net.IP) int {
+	switch ipv6Scope(ip) {
+	case "global":
+		return 3
+	case "ula":
+		return 2
+	case "link-local":
+		return 1
+	}
+	return 0
+}
+
+// ipv6AddressSource works out how an address was configured. The kernel
+// marks SLAAC addresses; DHCPv6 clients add dynamic /128 addresses.
+func ipv6AddressSource(ip net.IP, info ipAddrInfo) string {
+	switch {
+	case ip.IsLinkLocalUnicast():
+		return "link-local"
+	case info.Protocol == "kernel_ra" || info.MngTmpAddr || info.Temporary:
+		return "slaac"
+	case info.Dynamic && info.PrefixLen == 128:
+		return "dhcpv6"
+	case info.Dynamic:
+		return "slaac"
+	}
+	return "static"
+}
+
+// ipLifetime converts an address lifetime, where 2^32-1 means forever
+func ipLifetime(seconds float64) int64 {
+	if seconds >= 4294967295 {
+		return -1
+	}
+	return int64(seconds)
+}
+
+// ipv6DefaultRoutes lists the IPv6 default routes
+func ipv6DefaultRoutes() ([]IPv6Route, error) {
+	cmd := exec.Command("ip", "-j", "-6", "route", "show", "default")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list IPv6 routes: %v", err)
+	}
+
+	var entries []struct {
+		Gateway  string `json:"gateway"`
+		Dev      string `json:"dev"`
+		Protocol string `json:"protocol"`
+		Metric   int    `json:"metric"`
+		Pref     string `json:"pref"`
+		Expires  int    `json:"expires"`
+		Nexthops []struct {
+			Gateway string `json:"gateway"`
+			Dev     string `json:"dev"`
+		} `json:"nexthops"`
+	}
+	if out.Len() > 0 {
+		if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse IPv6 routes: %v", err)
+		}
+	}
+
+	routes := []IPv6Route{}
+	for _, entry := range entries {
+		route := IPv6Route{Gateway: entry.Gateway, Interface: entry.Dev, Protocol: entry.Protocol, Metric: entry.Metric, Preference: entry.Pref, ExpiresSec: entry.Expires}
+		if len(entry.Nexthops) == 0 {
+			routes = append(routes, route)
+		}
+		// Multipath routes list each router as a next hop
+		for _, hop := range entry.Nexthops {
+			route.Gateway, route.Interface = hop.Gateway, hop.Dev
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+// latencyTargets returns the configured latency targets, or the defaults
+func latencyTargets() []LatencyTarget {
+	if latencyManager != nil {
+		return latencyManager.Targets()
+	}
+	return DefaultLatencyTargets()
+}
+
+// dualStackEndpoint derives the host to compare and how to probe it. DNS
+// targets measure a resolver rather than a host and are skipped.
+func dualStackEndpoint(target LatencyTarget) (host string, port int, ok bool) {
+	switch target.Method {
+	case LatencyICMP:
+		return target.Host, 0, true
+	case LatencyTCP:
+		return target.Host, target.Port, true
+	case LatencyHTTP:
+		u, err := url.Parse(target.URL)
+		if err != nil || u.Hostname() == "" {
+			return "", 0, false
+		}
+		port, _ := strconv.Atoi(u.Port())
+		if port == 0 {
+			port = 80
+			if u.Scheme == "https" {
+				port = 443
+			}
+		}
+		return u.Hostname(), port, true
+	}
+	return "", 0, false
+}
+
+// probeDualStack resolves each target's A and AAAA records and measures it
+// over both families
+func probeDualStack(targets []LatencyTarget) ([]AAAACheck, []DualStackResult) {
+	aaaa := []AAAACheck{}
+	results := []DualStackResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, target := range targets {
+		host, port, ok := dualStackEndpoint(target)
+		// Address literals belong to a single family
+		if !ok || net.ParseIP(host) != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(target LatencyTarget, host string, port int) {
+			defer wg.Done()
+			timeout := time.Duration(target.TimeoutMS) * time.Millisecond
+			if timeout <= 0 {
+				timeout = 2 * time.Second
+			}
+
+			check := AAAACheck{Name: host, Addresses: []string{}}
+			result := DualStackResult{Target: target.Name, Host: host, Method: "tcp"}
+			if port == 0 {
+				result.Method = "icmp"
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			v6, err := net.DefaultResolver.LookupIP(ctx, "ip6", host)
+			cancel()
+			if err != nil {
+				check.Error = err.Error()
+			}
+			for _, ip := range v6 {
+				check.Addresses = append(check.Addresses, ip.String())
+			}
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+			v4, v4Err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+			cancel()
+
+			result.IPv4 = probeFamily(v4, v4Err, port, timeout)
+			result.IPv6 = probeFamily(v6, err, port, timeout)
+			result.decide()
+
+			mu.Lock()
+			aaaa = append(aaaa, check)
+			results = append(results, result)
+			mu.Unlock()
+		}(target, host, port)
+	}
+	wg.Wait()
+	return aaaa, results
+}
+
+// probeFamily measures the first resolved address of one family
+func probeFamily(ips []net.IP, lookupErr error, port int, timeout time.Duration) FamilyProbe {
+	if lookupErr != nil || len(ips) == 0 {
+		return FamilyProbe{Error: "no address"}
+	}
+	probe := FamilyProbe{Address: ips[0].String()}
+	var latency float64
+	var err error
+	if port == 0 {
+		latency, err = probeICMP(probe.Address, timeout)
+	} else {
+		latency, err = probeTCP(probe.Address, port, timeout)
+	}
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	probe.LatencyMS = latency
+	return probe
+}
+
+// decide picks the family happy eyeballs would use and the IPv6 penalty
+func (r *DualStackResult) decide() {
+	v4OK := r.IPv4.Address != "" && r.IPv4.Error == ""
+	v6OK := r.IPv6.Address != "" && r.IPv6.Error == ""
+	switch {
+	case v4OK && v6OK:
+		r.IPv6PenaltyMS = r.IPv6.LatencyMS - r.IPv4.LatencyMS
+		r.Winner = "ipv6"
+		if r.IPv6PenaltyMS > float64(happyEyeballsDelay.Milliseconds()) {
+			r.Winner = "ipv4"
+		}
+	case v6OK:
+		r.Winner = "ipv6"
+	case v4OK:
+		r.Winner = "ipv4"
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// RAPrefix is a prefix information option of a router advertisement
+type RAPrefix struct {
+	Prefix               string `json:"prefix"`
+	OnLink               bool   `json:"onLink"`     // L flag
+	Autonomous           bool   `json:"autonomous"` // A flag: hosts may form SLAAC addresses
+	ValidLifetimeSec     uint32 `json:"validLifetimeSec"`
+	PreferredLifetimeSec uint32 `json:"preferredLifetimeSec"`
+}
+
+// RouterAdvertisement is a decoded ICMPv6 router advertisement (RFC 4861)
+type RouterAdvertisement struct {
+	Router            string     `json:"router"`
+	Interface         string     `json:"interface"`
+	Managed           bool       `json:"managed"` // M flag: addresses from DHCPv6
+	Other             bool       `json:"other"`   // O flag: other configuration from DHCPv6
+	Preference        string     `json:"preference"`
+	HopLimit          int        `json:"hopLimit"`
+	RouterLifetimeSec int        `json:"routerLifetimeSec"` // 0 means not a default router
+	ReachableTimeMS   uint32     `json:"reachableTimeMs,omitempty"`
+	RetransTimerMS    uint32     `json:"retransTimerMs,omitempty"`
+	MTU               int        `json:"mtu,omitempty"`
+	SourceMAC         string     `json:"sourceMac,omitempty"`
+	Prefixes          []RAPrefix `json:"prefixes"`
+	RDNSS             []string   `json:"rdnss,omitempty"`
+	RDNSSLifetimeSec  uint32     `json:"rdnssLifetimeSec,omitempty"`
+	DNSSL             []string   `json:"dnssl,omitempty"`
+	ReceivedAt        time.Time  `json:"receivedAt"`
+}
+
+// ICMPv6 message types used for router discovery
+const (
+	icmpv6RouterSolicitation  = 133
+	icmpv6RouterAdvertisement = 134
+)
+
+// ParseRouterAdvertisement decodes an ICMPv6 router advertisement message,
+// starting at the ICMPv6 type byte
+func ParseRouterAdvertisement(b []byte) (*RouterAdvertisement, error) {
+	if len(b) < 16 {
+		return nil, fmt.Errorf("router advertisement too short: %d bytes", len(b))
+	}
+	if b[0] != icmpv6RouterAdvertisement || b[1] != 0 {
+		return nil, fmt.Errorf("not a router advertisement (type %d code %d)", b[0], b[1])
+	}
+
+	ra := &RouterAdvertisement{
+		HopLimit:          int(b[4]),
+		Managed:           b[5]&0x80 != 0,
+		Other:             b[5]&0x40 != 0,
+		Preference:        raPreference(b[5] >> 3 & 3),
+		RouterLifetimeSec: int(binary.BigEndian.Uint16(b[6:])),
+		ReachableTimeMS:   binary.BigEndian.Uint32(b[8:]),
+		RetransTimerMS:    binary.BigEndian.Uint32(b[12:]),
+	}
+
+	options := b[16:]
+	for len(options) >= 2 {
+		length := int(options[1]) * 8
+		if length == 0 || length > len(options) {
+			return nil, fmt.Errorf("malformed router advertisement option %d", options[0])
+		}
+		option := options[:length]
+		options = options[length:]
+
+		switch option[0] {
+		case 1: // Source link-layer address
+			ra.SourceMAC = net.HardwareAddr(option[2:8]).String()
+		case 3: // Prefix information
+			if length < 32 {
+				continue
+			}
+			prefix := net.IPNet{IP: net.IP(option[16:32]), Mask: net.CIDRMask(int(option[2]), 128)}
+			ra.Prefixes = append(ra.Prefixes, RAPrefix{
+				Prefix:               prefix.String(),
+				OnLink:               option[3]&0x80 != 0,
+				Autonomous:           option[3]&0x40 != 0,
+				ValidLifetimeSec:     binary.BigEndian.Uint32(option[4:]),
+				PreferredLifetimeSec: binary.BigEndian.Uint32(option[8:]),
+			})
+		case 5: // MTU
+			ra.MTU = int(binary.BigEndian.Uint32(option[4:]))
+		case 25: // Recursive DNS servers (RFC 8106)
+			ra.RDNSSLifetimeSec = binary.BigEndian.Uint32(option[4:])
+			for addr := option[8:]; len(addr) >= 16; addr = addr[16:] {
+				ra.RDNSS = append(ra.RDNSS, net.IP(addr[:16]).String())
+			}
+		case 31: // DNS search list (RFC 8106)
+			ra.DNSSL = append(ra.DNSSL, decodeDNSNames(option[8:])...)
+		}
+	}
+	return ra, nil
+}
+
+// raPreference names the default router preference bits (RFC 4191)
+func raPreference(bits byte) string {
+	switch bits {
+	case 1:
+		return "high"
+	case 3:
+		return "low"
+	case 2:
+		return "reserved"
+	}
+	return "medium"
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package core
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenRouterAdvertisements sends a router solicitation on each interface
+// and collects the advertisements that arrive within the listen time
+func listenRouterAdvertisements(ifaces []string, listen time.Duration) ([]RouterAdvertisement, error) {
+	conn, err := net.ListenIP("ip6:ipv6-icmp", &net.IPAddr{IP: net.IPv6unspecified})
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for router advertisements (CAP_NET_RAW is required): %v", err)
+	}
+	defer conn.Close()
+
+	// Routers ignore solicitations that did not come with hop limit 255
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var sockErr error
+	raw.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_HOPS, 255)
+	})
+	if sockErr != nil {
+		return nil, fmt.Errorf("failed to set hop limit: %v", sockErr)
+	}
+
+	solicitation := []byte{icmpv6RouterSolicitation, 0, 0, 0, 0, 0, 0, 0}
+	allRouters := net.ParseIP("ff02::2")
+	for _, name := range ifaces {
+		// The checksum is filled in by the kernel
+		conn.WriteToIP(solicitation, &net.IPAddr{IP: allRouters, Zone: name})
+	}
+
+	seen := make(map[string]int)
+	var ras []RouterAdvertisement
+	conn.SetReadDeadline(time.Now().Add(listen))
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFromIP(buf)
+		if err != nil {
+			break // Listen time is over
+		}
+		// Advertisements always come from the router's link-local address
+		if n == 0 || buf[0] != icmpv6RouterAdvertisement || !addr.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ra, err := ParseRouterAdvertisement(buf[:n])
+		if err != nil {
+			continue
+		}
+		ra.Router = addr.IP.String()
+		ra.Interface = addr.Zone
+		ra.ReceivedAt = time.Now()
+
+		// Keep the latest advertisement of each router
+		key := ra.Interface + "/" + ra.Router
+		if i, ok := seen[key]; ok {
+			ras[i] = *ra
+			continue
+		}
+		seen[key] = len(ras)
+		ras = append(ras, *ra)
+	}
+	return ras, nil
+}
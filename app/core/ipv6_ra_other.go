@@ -0,0 +1,13 @@
+//go:build !linux
+
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+// listenRouterAdvertisements needs raw ICMPv6 socket options only available on Linux
+func listenRouterAdvertisements(ifaces []string, listen time.Duration) ([]RouterAdvertisement, error) {
+	return nil, errors.New("listening for router advertisements is only supported on Linux")
+}
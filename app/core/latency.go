@@ -0,0 +1,488 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LatencyMethod is the probe used to measure a latency target
+type LatencyMethod string
+
+const (
+	LatencyICMP LatencyMethod = "icmp"
+	LatencyTCP  LatencyMethod = "tcp"
+	LatencyHTTP LatencyMethod = "http"
+	LatencyDNS  LatencyMethod = "dns"
+)
+
+// Latency result states
+const (
+	LatencyStatusPending  = "pending"
+	LatencyStatusOK       = "ok"
+	LatencyStatusWarning  = "warning"
+	LatencyStatusCritical = "critical"
+	LatencyStatusDown     = "down"
+)
+
+// LatencyTarget is a named endpoint probed periodically for latency
+type LatencyTarget struct {
+	Name            string        `json:"name"`
+	Method          LatencyMethod `json:"method"`
+	Host            string        `json:"host,omitempty"`           // ICMP/TCP host, or DNS server (empty uses the system resolver)
+	Port            int           `json:"port,omitempty"`           // TCP port
+	URL             string        `json:"url,omitempty"`            // HTTP URL
+	ExpectedStatus  int           `json:"expectedStatus,omitempty"` // HTTP status, 0 accepts anything below 400
+	Query           string        `json:"query,omitempty"`          // DNS name to resolve
+	IntervalSeconds int           `json:"intervalSeconds"`
+	TimeoutMS       int           `json:"timeoutMs"`
+	WarnMS          float64       `json:"warnMs"`
+	CritMS          float64       `json:"critMs"`
+}
+
+// LatencyResult is the latest measurement of a latency target
+type LatencyResult struct {
+	Name      string        `json:"name"`
+	Method    LatencyMethod `json:"method"`
+	LatencyMS float64       `json:"latencyMs"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// DefaultLatencyTargets returns the targets used when no configuration exists
+func DefaultLatencyTargets() []LatencyTarget {
+	icmp := func(name, host string) LatencyTarget {
+		return LatencyTarget{Name: name, Method: LatencyICMP, Host: host, IntervalSeconds: 30, TimeoutMS: 2000, WarnMS: 100, CritMS: 250}
+	}
+	return []LatencyTarget{
+		icmp("google", "google.com"),
+		icmp("amazon", "amazon.com"),
+		icmp("cloudflare", "cloudflare.com"),
+		icmp("microsoft", "microsoft.com"),
+		{Name: "dns", Method: LatencyDNS, Query: "www.google.com", IntervalSeconds: 30, TimeoutMS: 2000, WarnMS: 50, CritMS: 100},
+		{Name: "http", Method: LatencyHTTP, URL: "https://www.google.com", IntervalSeconds: 30, TimeoutMS: 3000, WarnMS: 100, CritMS: 200},
+	}
+}
+
+// Validate checks that the target has the fields its method needs and fills in defaults
+func (t *LatencyTarget) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("target name is required")
+	}
+
+	switch t.Method {
+	case LatencyICMP:
+		if t.Host == "" {
+			return fmt.Errorf("target %s: host is required for icmp", t.Name)
+		}
+	case LatencyTCP:
+		if t.Host == "" || t.Port <= 0 || t.Port > 65535 {
+			return fmt.Errorf("target %s: host and a valid port are required for tcp", t.Name)
+		}
+	case LatencyHTTP:
+		if t.URL == "" {
+			return fmt.Errorf("target %s: url is required for http", t.Name)
+		}
+	case LatencyDNS:
+		if t.Query == "" {
+			return fmt.Errorf("target %s: query is required for dns", t.Name)
+		}
+	default:
+		return fmt.Errorf("target %s: unknown method %q", t.Name, t.Method)
+	}
+
+	if t.IntervalSeconds <= 0 {
+		t.IntervalSeconds = 30
+	}
+	if t.TimeoutMS <= 0 {
+		t.TimeoutMS = 2000
+	}
+	if t.CritMS > 0 && t.WarnMS > t.CritMS {
+		return fmt.Errorf("target %s: warning threshold exceeds critical threshold", t.Name)
+	}
+	return nil
+}
+
+// LatencyManager probes the configured latency targets on their own intervals
+// and keeps the latest result for each
+type LatencyManager struct {
+	configPath string
+	targets    []LatencyTarget
+	results    map[string]LatencyResult
+	stop       chan struct{}
+	mu         sync.RWMutex
+}
+
+// NewLatencyManager creates a manager and loads its targets from configPath,
+// falling back to the defaults if the file does not exist
+func NewLatencyManager(configPath string) (*LatencyManager, error) {
+	if configPath == "" {
+		configPath = "app/data/latency_targets.json"
+	}
+
+	lm := &LatencyManager{
+		configPath: configPath,
+		targets:    DefaultLatencyTargets(),
+		results:    make(map[string]LatencyResult),
+	}
+
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return lm, nil
+	}
+	if err != nil {
+		return lm, fmt.Errorf("failed to read latency targets: %v", err)
+	}
+
+	var targets []LatencyTarget
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return lm, fmt.Errorf("failed to parse latency targets: %v", err)
+	}
+	for i := range targets {
+		if err := targets[i].Validate(); err != nil {
+			return lm, err
+		}
+	}
+	lm.targets = targets
+	return lm, nil
+}
+
+// Start begins probing every target in the background
+func (lm *LatencyManager) Start() {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.start()
+}
+
+// start launches a probe per target unless they are running; the caller holds the lock
+func (lm *LatencyManager) start() {
+	if lm.stop != nil {
+		return
+	}
+	lm.stop = make(chan struct{})
+	for _, target := range lm.targets {
+		lm.results[target.Name] = LatencyResult{Name: target.Name, Method: target.Method, Status: LatencyStatusPending}
+		go lm.run(target, lm.stop)
+	}
+}
+
+// Stop halts all probes
+func (lm *LatencyManager) Stop() {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.stop != nil {
+		close(lm.stop)
+		lm.stop = nil
+	}
+}
+
+// run probes a single target until stop is closed
+func (lm *LatencyManager) run(target LatencyTarget, stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(target.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		result := ProbeLatency(target)
+
+		lm.mu.Lock()
+		// Discard results from probes of a replaced configuration
+		if lm.stop == stop {
+			lm.results[target.Name] = result
+		}
+		lm.mu.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Results returns the latest result for each target keyed by name
+func (lm *LatencyManager) Results() map[string]LatencyResult {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	results := make(map[string]LatencyResult, len(lm.results))
+	for name, result := range lm.results {
+		results[name] = result
+	}
+	return results
+}
+
+// Targets returns a copy of the configured targets
+func (lm *LatencyManager) Targets() []LatencyTarget {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	return append([]LatencyTarget(nil), lm.targets...)
+}
+
+// SetTargets replaces the whole target list, saves it and restarts probing
+func (lm *LatencyManager) SetTargets(targets []LatencyTarget) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.setTargets(append([]LatencyTarget(nil), targets...))
+}
+
+// setTargets validates targets, filling in their defaults, makes them the
+// target list, saves it and restarts probing; the caller holds the lock
+func (lm *LatencyManager) setTargets(targets []LatencyTarget) error {
+	seen := make(map[string]bool)
+	for i := range targets {
+		if err := targets[i].Validate(); err != nil {
+			return err
+		}
+		if seen[targets[i].Name] {
+			return fmt.Errorf("duplicate target name %s", targets[i].Name)
+		}
+		seen[targets[i].Name] = true
+	}
+
+	running := lm.stop != nil
+	if running {
+		close(lm.stop)
+		lm.stop = nil
+	}
+	lm.targets = targets
+	lm.results = make(map[string]LatencyResult)
+	err := lm.save()
+	if running {
+		lm.start()
+	}
+	return err
+}
+
+// AddTarget adds a new target and returns it as stored, with defaults filled in
+func (lm *LatencyManager) AddTarget(target LatencyTarget) (LatencyTarget, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, t := range lm.targets {
+		if t.Name == target.Name {
+			return LatencyTarget{}, fmt.Errorf("target %s already exists", target.Name)
+		}
+	}
+	targets := append(append([]LatencyTarget(nil), lm.targets...), target)
+	if err := lm.setTargets(targets); err != nil {
+		return LatencyTarget{}, err
+	}
+	return targets[len(targets)-1], nil
+}
+
+// UpdateTarget replaces the target with the given name and returns the new
+// target as stored, with defaults filled in
+func (lm *LatencyManager) UpdateTarget(name string, target LatencyTarget) (LatencyTarget, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for i, t := range lm.targets {
+		if t.Name == name {
+			targets := append([]LatencyTarget(nil), lm.targets...)
+			targets[i] = target
+			if err := lm.setTargets(targets); err != nil {
+				return LatencyTarget{}, err
+			}
+			return targets[i], nil
+		}
+	}
+	return LatencyTarget{}, fmt.Errorf("target %s not found", name)
+}
+
+// RemoveTarget deletes the target with the given name
+func (lm *LatencyManager) RemoveTarget(name string) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for i, t := range lm.targets {
+		if t.Name == name {
+			targets := append([]LatencyTarget(nil), lm.targets[:i]...)
+			return lm.setTargets(append(targets, lm.targets[i+1:]...))
+		}
+	}
+	return fmt.Errorf("target %s not found", name)
+}
+
+// save writes the targets to the config file; the caller holds the lock
+func (lm *LatencyManager) save() error {
+	data, err := json.MarshalIndent(lm.targets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal latency targets: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(lm.configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	if err := os.WriteFile(lm.configPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write latency targets: %v", err)
+	}
+	return nil
+}
+
+// ProbeLatency measures a target once and classifies the result against its thresholds
+func ProbeLatency(target LatencyTarget) LatencyResult {
+	result := LatencyResult{Name: target.Name, Method: target.Method, CheckedAt: time.Now()}
+	timeout := time.Duration(target.TimeoutMS) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	var latency float64
+	var err error
+	switch target.Method {
+	case LatencyICMP:
+		latency, err = probeICMP(target.Host, timeout)
+	case LatencyTCP:
+		latency, err = probeTCP(target.Host, target.Port, timeout)
+	case LatencyHTTP:
+		latency, err = probeHTTP(target.URL, target.ExpectedStatus, timeout)
+	case LatencyDNS:
+		latency, err = probeDNS(target.Query, target.Host, timeout)
+	default:
+		err = fmt.Errorf("unknown method %q", target.Method)
+	}
+
+	if err != nil {
+		result.Status = LatencyStatusDown
+		result.Error = err.Error()
+		return result
+	}
+
+	result.LatencyMS = latency
+	switch {
+	case target.CritMS > 0 && latency >= target.CritMS:
+		result.Status = LatencyStatusCritical
+	case target.WarnMS > 0 && latency >= target.WarnMS:
+		result.Status = LatencyStatusWarning
+	default:
+		result.Status = LatencyStatusOK
+	}
+	return result
+}
+
+var pingTimePattern = regexp.MustCompile(`time=(\d+\.?\d*) ms`)
+
+// probeICMP sends a single echo request using the system ping utility
+func probeICMP(host string, timeout time.Duration) (float64, error) {
+	seconds := int(timeout.Round(time.Second).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	cmd := exec.Command("ping", "-c", "1", "-W", strconv.Itoa(seconds), host)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("no reply from %s", host)
+	}
+
+	matches := pingTimePattern.FindStringSubmatch(out.String())
+	if len(matches) < 2 {
+		return 0, fmt.Errorf("could not parse ping output")
+	}
+	return strconv.ParseFloat(matches[1], 64)
+}
+
+// probeTCP measures the time to complete a TCP handshake
+func probeTCP(host string, port int, timeout time.Duration) (float64, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+	return float64(elapsed.Microseconds()) / 1000, nil
+}
+
+// probeHTTP measures the time until the response headers of a GET arrive
+func probeHTTP(url string, expectedStatus int, timeout time.Duration) (float64, error) {
+	client := &http.Client{Timeout: timeout}
+
+	start := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	resp.Body.Close()
+
+	if expectedStatus != 0 && resp.StatusCode != expectedStatus {
+		return 0, fmt.Errorf("unexpected status %d, want %d", resp.StatusCode, expectedStatus)
+	}
+	if expectedStatus == 0 && resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return float64(elapsed.Microseconds()) / 1000, nil
+}
+
+// probeDNS measures the time to resolve a name, through a specific server if one is given
+func probeDNS(query, server string, timeout time.Duration) (float64, error) {
+	resolver := net.DefaultResolver
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := resolver.LookupHost(ctx, query); err != nil {
+		return 0, err
+	}
+	return float64(time.Since(start).Microseconds()) / 1000, nil
+}
+
+// latencyManager supplies the ServiceLatency results of GetNetworkInfo
+var latencyManager *LatencyManager
+
+// SetLatencyManager makes GetNetworkInfo report results from the given manager
+func SetLatencyManager(lm *LatencyManager) {
+	latencyManager = lm
+}
+
+// serviceLatencyResults returns the manager's latest results, or probes the
+// default targets once when no manager is running
+func serviceLatencyResults() map[string]LatencyResult {
+	if latencyManager != nil {
+		return latencyManager.Results()
+	}
+
+	targets := DefaultLatencyTargets()
+	results := make(map[string]LatencyResult, len(targets))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target LatencyTarget) {
+			defer wg.Done()
+			result := ProbeLatency(target)
+			mu.Lock()
+			results[target.Name] = result
+			mu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+	return results
+}
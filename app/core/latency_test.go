@@ -0,0 +1,281 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatencyTargetValidate(t *testing.T) {
+	target := LatencyTarget{Name: "router", Method: LatencyTCP, Host: "192.0.2.1", Port: 443}
+	if err := target.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if target.IntervalSeconds != 30 || target.TimeoutMS != 2000 {
+		t.Errorf("defaults: interval %ds timeout %dms, want 30s and 2000ms", target.IntervalSeconds, target.TimeoutMS)
+	}
+
+	target = LatencyTarget{Name: "web", Method: LatencyHTTP, URL: "http://192.0.2.1/", IntervalSeconds: 5, TimeoutMS: 500, WarnMS: 50, CritMS: 50}
+	if err := target.Validate(); err != nil || target.IntervalSeconds != 5 || target.TimeoutMS != 500 {
+		t.Errorf("given values: %+v, %v; want them kept", target, err)
+	}
+
+	tests := []struct {
+		name    string
+		target  LatencyTarget
+		errText string
+	}{
+		{"no name", LatencyTarget{Method: LatencyICMP, Host: "192.0.2.1"}, "name is required"},
+		{"icmp without host", LatencyTarget{Name: "a", Method: LatencyICMP}, "host is required"},
+		{"tcp without port", LatencyTarget{Name: "a", Method: LatencyTCP, Host: "192.0.2.1"}, "valid port"},
+		{"tcp port out of range", LatencyTarget{Name: "a", Method: LatencyTCP, Host: "192.0.2.1", Port: 70000}, "valid port"},
+		{"http without url", LatencyTarget{Name: "a", Method: LatencyHTTP}, "url is required"},
+		{"dns without query", LatencyTarget{Name: "a", Method: LatencyDNS, Host: "192.0.2.53"}, "query is required"},
+		{"unknown method", LatencyTarget{Name: "a", Method: "udp", Host: "192.0.2.1"}, `unknown method "udp"`},
+		{"warning above critical", LatencyTarget{Name: "a", Method: LatencyICMP, Host: "192.0.2.1", WarnMS: 300, CritMS: 200}, "warning threshold exceeds"},
+	}
+	for _, tt := range tests {
+		if err := tt.target.Validate(); err == nil || !strings.Contains(err.Error(), tt.errText) {
+			t.Errorf("%s: error = %v, want it to mention %q", tt.name, err, tt.errText)
+		}
+	}
+}
+
+// startDNSResponder answers A queries for any name with 192.0.2.7, and other
+// queries with no records, or every query with rcode if it is not zero
+func startDNSResponder(t *testing.T, rcode byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, client, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 12 {
+				continue
+			}
+			// The question ends after the name's terminating zero and type and class
+			end := 12
+			for end < n && buf[end] != 0 {
+				end += int(buf[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			queryType := binary.BigEndian.Uint16(buf[end-4:])
+
+			reply := append([]byte(nil), buf[:end]...)
+			reply[2], reply[3] = 0x81, 0x80|rcode // response, recursion desired and available
+			binary.BigEndian.PutUint16(reply[6:], 0)
+			binary.BigEndian.PutUint16(reply[8:], 0)
+			binary.BigEndian.PutUint16(reply[10:], 0)
+			if rcode == 0 && queryType == 1 {
+				binary.BigEndian.PutUint16(reply[6:], 1)
+				reply = append(reply, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 0, 2, 7)
+			}
+			conn.WriteTo(reply, client)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// closedPort returns a loopback port nothing listens on
+func closedPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestProbeLatency(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	status := func(code int, delay time.Duration) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(code)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	tests := []struct {
+		name    string
+		target  LatencyTarget
+		status  string
+		errText string
+	}{
+		{"tcp handshake", LatencyTarget{Method: LatencyTCP, Host: "127.0.0.1", Port: openPort}, LatencyStatusOK, ""},
+		{"tcp refused", LatencyTarget{Method: LatencyTCP, Host: "127.0.0.1", Port: closedPort(t)}, LatencyStatusDown, "connection refused"},
+		{"http below 400", LatencyTarget{Method: LatencyHTTP, URL: status(http.StatusNoContent, 0)}, LatencyStatusOK, ""},
+		{"http error status", LatencyTarget{Method: LatencyHTTP, URL: status(http.StatusInternalServerError, 0)}, LatencyStatusDown, "unexpected status 500"},
+		{"http expected status", LatencyTarget{Method: LatencyHTTP, URL: status(http.StatusNotFound, 0), ExpectedStatus: 404}, LatencyStatusOK, ""},
+		{"http other status", LatencyTarget{Method: LatencyHTTP, URL: status(http.StatusOK, 0), ExpectedStatus: 204}, LatencyStatusDown, "unexpected status 200, want 204"},
+		{"http timeout", LatencyTarget{Method: LatencyHTTP, URL: status(http.StatusOK, 300*time.Millisecond), TimeoutMS: 50}, LatencyStatusDown, "Timeout"},
+		{"http warning", LatencyTarget{Method: LatencyHTTP, URL: status(http.StatusOK, 30*time.Millisecond), WarnMS: 20, CritMS: 1000}, LatencyStatusWarning, ""},
+		{"http critical", LatencyTarget{Method: LatencyHTTP, URL: status(http.StatusOK, 30*time.Millisecond), WarnMS: 10, CritMS: 20}, LatencyStatusCritical, ""},
+		{"dns answer", LatencyTarget{Method: LatencyDNS, Host: startDNSResponder(t, 0), Query: "nettool.test"}, LatencyStatusOK, ""},
+		{"dns name error", LatencyTarget{Method: LatencyDNS, Host: startDNSResponder(t, 3), Query: "nettool.test"}, LatencyStatusDown, "no such host"},
+		{"unknown method", LatencyTarget{Method: "udp"}, LatencyStatusDown, "unknown method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.target.Name = "target"
+			result := ProbeLatency(tt.target)
+			if result.Status != tt.status || !strings.Contains(result.Error, tt.errText) {
+				t.Errorf("status %q error %q, want %q mentioning %q", result.Status, result.Error, tt.status, tt.errText)
+			}
+			if result.Name != "target" || result.Method != tt.target.Method || result.CheckedAt.IsZero() {
+				t.Errorf("result = %+v, want it named and timed", result)
+			}
+			if tt.status != LatencyStatusDown && (result.LatencyMS <= 0 || result.LatencyMS > 1000) {
+				t.Errorf("latency = %v ms, want a small positive value", result.LatencyMS)
+			}
+		})
+	}
+}
+
+// fakePing puts a ping command that prints output and exits with status
+// first on PATH
+func fakePing(t *testing.T, output string, status int) {
+	t.Helper()
+	dir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\ncat <<'EOF'\n%s\nEOF\nexit %d\n", output, status)
+	if err := os.WriteFile(filepath.Join(dir, "ping"), []byte(script), 0755); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestProbeICMP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stand-in ping is a shell script")
+	}
+	target := LatencyTarget{Name: "router", Method: LatencyICMP, Host: "192.0.2.1", TimeoutMS: 1000, WarnMS: 100, CritMS: 250}
+
+	fakePing(t, "PING 192.0.2.1 (192.0.2.1) 56(84) bytes of data.\n64 bytes from 192.0.2.1: icmp_seq=1 ttl=64 time=123.4 ms", 0)
+	if result := ProbeLatency(target); result.Status != LatencyStatusWarning || result.LatencyMS != 123.4 {
+		t.Errorf("reply: %+v, want a warning at 123.4 ms", result)
+	}
+
+	fakePing(t, "1 packets transmitted, 0 received, 100% packet loss", 1)
+	if result := ProbeLatency(target); result.Status != LatencyStatusDown || result.Error != "no reply from 192.0.2.1" {
+		t.Errorf("no reply: %+v", result)
+	}
+
+	fakePing(t, "64 bytes from 192.0.2.1: icmp_seq=1 ttl=64", 0)
+	if result := ProbeLatency(target); result.Status != LatencyStatusDown || !strings.Contains(result.Error, "could not parse") {
+		t.Errorf("unparsable reply: %+v", result)
+	}
+}
+
+func TestLatencyManagerTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latency_targets.json")
+	lm, err := NewLatencyManager(path)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	if len(lm.Targets()) != len(DefaultLatencyTargets()) {
+		t.Errorf("targets = %v, want the defaults without a config file", lm.Targets())
+	}
+
+	if err := lm.SetTargets(nil); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	stored, err := lm.AddTarget(LatencyTarget{Name: "router", Method: LatencyTCP, Host: "192.0.2.1", Port: 22})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if stored.IntervalSeconds != 30 || stored.TimeoutMS != 2000 || stored.Host != "192.0.2.1" {
+		t.Errorf("added target = %+v, want it with defaults filled in", stored)
+	}
+	if _, err := lm.AddTarget(LatencyTarget{Name: "router", Method: LatencyICMP, Host: "192.0.2.1"}); err == nil {
+		t.Error("added a second target named router")
+	}
+
+	stored, err = lm.UpdateTarget("router", LatencyTarget{Name: "router", Method: LatencyICMP, Host: "192.0.2.254", IntervalSeconds: 10})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if stored.Method != LatencyICMP || stored.IntervalSeconds != 10 || stored.TimeoutMS != 2000 {
+		t.Errorf("updated target = %+v", stored)
+	}
+	if _, err := lm.UpdateTarget("router", LatencyTarget{Name: "router", Method: LatencyICMP}); err == nil {
+		t.Error("invalid update accepted")
+	}
+	if _, err := lm.UpdateTarget("missing", stored); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("update of a missing target: %v", err)
+	}
+	if targets := lm.Targets(); len(targets) != 1 || targets[0] != stored {
+		t.Errorf("targets = %+v, want only the updated router", targets)
+	}
+
+	// The targets are saved and loaded back as stored
+	loaded, err := NewLatencyManager(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if targets := loaded.Targets(); len(targets) != 1 || targets[0] != stored {
+		t.Errorf("reloaded targets = %+v, want %+v", targets, stored)
+	}
+
+	if err := lm.RemoveTarget("router"); err != nil || len(lm.Targets()) != 0 {
+		t.Errorf("remove: %v, left %v", err, lm.Targets())
+	}
+	if err := lm.RemoveTarget("router"); err == nil {
+		t.Error("removed a missing target")
+	}
+}
+
+func TestLatencyManagerConcurrentAdds(t *testing.T) {
+	lm, err := NewLatencyManager(filepath.Join(t.TempDir(), "latency_targets.json"))
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	if err := lm.SetTargets(nil); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+
+	// Each add reads and replaces the whole list, so none may be lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			target := LatencyTarget{Name: fmt.Sprintf("host%d", i), Method: LatencyICMP, Host: "192.0.2.1"}
+			if _, err := lm.AddTarget(target); err != nil {
+				t.Errorf("add %s: %v", target.Name, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(lm.Targets()); n != 20 {
+		t.Errorf("%d targets after 20 concurrent adds", n)
+	}
+}
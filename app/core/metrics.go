@@ -0,0 +1,66 @@
+package core
+
+import "time"
+
+// Metrics flattens the numeric values of a snapshot into named series for
+// the time-series store. Only sections collected successfully after since are
+// included, so a value is never recorded twice.
+func (info *NetworkInfo) Metrics(since time.Time) map[string]float64 {
+	metrics := make(map[string]float64)
+	fresh := func(section string) bool {
+		status, ok := info.Sections[section]
+		return ok && status.Error == "" && status.UpdatedAt.After(since)
+	}
+
+	if fresh("connection") {
+		metrics["connection.latency_ms"] = info.Connection.LatencyMS
+		metrics["connection.packet_loss"] = info.Connection.PacketLoss
+	}
+	if fresh("wireless") && info.SSID != "" {
+		metrics["wireless.signal_dbm"] = float64(info.Connection.SignalStrength)
+	}
+
+	if fresh("traffic") {
+		if !info.Traffic.Rates.Reset && info.Traffic.Rates.IntervalSec > 0 {
+			metrics["traffic.rx_bps"] = info.Traffic.Rates.RxBps
+			metrics["traffic.tx_bps"] = info.Traffic.Rates.TxBps
+		}
+		// Interfaces are recorded as rates rather than raw counters: buckets
+		// average their samples, which is meaningless for a cumulative counter
+		// that wraps or resets, while a rate averages into the mean rate of
+		// the bucket. The raw counters are on /metrics for Prometheus.
+		for name, r := range info.InterfaceRates {
+			// The first sample and samples across a counter reset carry no rate
+			if r.Reset || r.IntervalSec == 0 {
+				continue
+			}
+			prefix := "iface." + name + "."
+			metrics[prefix+"rx_bps"] = r.RxBps
+			metrics[prefix+"tx_bps"] = r.TxBps
+			metrics[prefix+"rx_pps"] = r.RxPps
+			metrics[prefix+"tx_pps"] = r.TxPps
+			metrics[prefix+"rx_errors_per_sec"] = r.RxErrorsPerSec
+			metrics[prefix+"tx_errors_per_sec"] = r.TxErrorsPerSec
+			metrics[prefix+"rx_drops_per_sec"] = r.RxDropsPerSec
+			metrics[prefix+"tx_drops_per_sec"] = r.TxDropsPerSec
+			metrics[prefix+"rx_fifo_per_sec"] = r.RxFifoPerSec
+			metrics[prefix+"tx_fifo_per_sec"] = r.TxFifoPerSec
+		}
+	}
+
+	if fresh("serviceLatency") {
+		for name, result := range info.ServiceLatency {
+			switch {
+			case result.Status == LatencyStatusPending, !result.CheckedAt.After(since):
+				continue
+			case result.Status == LatencyStatusDown:
+				metrics["latency."+name+".up"] = 0
+			default:
+				metrics["latency."+name+".up"] = 1
+				metrics["latency."+name+".ms"] = result.LatencyMS
+			}
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,366 @@
+//go:build linux
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// rtnetlink multicast groups the monitor subscribes to
+const monitorGroups = unix.RTMGRP_LINK |
+	unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR |
+	unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE |
+	unix.RTMGRP_NEIGH
+
+// start opens the rtnetlink socket, seeds the known state and starts the
+// listener. It is called with m.mu held; seeding does not emit events, and the
+// listener's first emit waits for Start to return.
+func (m *NetworkMonitor) start() error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("failed to open netlink socket: %v", err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: monitorGroups}); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("failed to subscribe to rtnetlink groups: %v", err)
+	}
+
+	// Wake up periodically so Stop is honoured, and give bursts some room
+	timeout := unix.Timeval{Sec: 1}
+	unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout)
+	unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, 1<<20)
+
+	// Learn the current state first so existing links, addresses and
+	// neighbors are not reported as new
+	m.resync(false)
+
+	m.stop = make(chan struct{})
+	go m.listen(fd, m.stop)
+	return nil
+}
+
+// listen reads rtnetlink notifications until the monitor is stopped
+func (m *NetworkMonitor) listen(fd int, stop chan struct{}) {
+	defer unix.Close(fd)
+
+	buf := make([]byte, 1<<16)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			switch err {
+			case unix.EAGAIN, unix.EINTR:
+			case unix.ENOBUFS:
+				// The kernel dropped notifications, catch up with a full dump
+				m.resync(true)
+			default:
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, msg := range msgs {
+			m.handleMessage(msg, true)
+		}
+	}
+}
+
+// resync dumps links, addresses, routes and neighbors and folds them into the known state
+func (m *NetworkMonitor) resync(notify bool) {
+	for _, request := range []int{unix.RTM_GETLINK, unix.RTM_GETADDR, unix.RTM_GETROUTE, unix.RTM_GETNEIGH} {
+		data, err := syscall.NetlinkRIB(request, unix.AF_UNSPEC)
+		if err != nil {
+			continue
+		}
+		msgs, err := syscall.ParseNetlinkMessage(data)
+		if err != nil {
+			continue
+		}
+		for _, msg := range msgs {
+			m.handleMessage(msg, notify)
+		}
+	}
+}
+
+// handleMessage dispatches a single rtnetlink message. The known-state maps are
+// only touched from here, which runs on the listener goroutine (or before it starts).
+func (m *NetworkMonitor) handleMessage(msg syscall.NetlinkMessage, notify bool) {
+	switch msg.Header.Type {
+	case unix.RTM_NEWLINK, unix.RTM_DELLINK:
+		m.handleLink(msg, notify)
+	case unix.RTM_NEWADDR, unix.RTM_DELADDR:
+		m.handleAddress(msg, notify)
+	case unix.RTM_NEWROUTE, unix.RTM_DELROUTE:
+		m.handleRoute(msg, notify)
+	case unix.RTM_NEWNEIGH, unix.RTM_DELNEIGH:
+		m.handleNeighbor(msg, notify)
+	}
+}
+
+func (m *NetworkMonitor) handleLink(msg syscall.NetlinkMessage, notify bool) {
+	if len(msg.Data) < unix.SizeofIfInfomsg {
+		return
+	}
+	index := int(int32(binary.NativeEndian.Uint32(msg.Data[4:8])))
+	flags := binary.NativeEndian.Uint32(msg.Data[8:12])
+	name := interfaceName(index)
+	for _, attr := range parseRouteAttrs(msg.Data[unix.SizeofIfInfomsg:]) {
+		if attr.Attr.Type == unix.IFLA_IFNAME {
+			name = cString(attr.Value)
+		}
+	}
+
+	previous, known := m.carrier[index]
+
+	if msg.Header.Type == unix.RTM_DELLINK {
+		delete(m.carrier, index)
+		if known && previous && notify {
+			m.emit(EventLinkDown, name, "", "interface removed")
+		}
+		return
+	}
+
+	carrier := flags&unix.IFF_UP != 0 && flags&unix.IFF_LOWER_UP != 0
+	m.carrier[index] = carrier
+
+	if !notify || (known && previous == carrier) {
+		return
+	}
+	if carrier {
+		m.emit(EventLinkUp, name, "", "carrier detected")
+	} else if known {
+		m.emit(EventLinkDown, name, "", "carrier lost")
+	}
+}
+
+func (m *NetworkMonitor) handleAddress(msg syscall.NetlinkMessage, notify bool) {
+	if len(msg.Data) < unix.SizeofIfAddrmsg {
+		return
+	}
+	family := msg.Data[0]
+	prefixLen := msg.Data[1]
+	flags := uint32(msg.Data[2])
+	index := int(binary.NativeEndian.Uint32(msg.Data[4:8]))
+
+	var ip net.IP
+	valid := uint32(0xffffffff)
+	for _, attr := range parseRouteAttrs(msg.Data[unix.SizeofIfAddrmsg:]) {
+		switch attr.Attr.Type {
+		case unix.IFA_LOCAL:
+			ip = net.IP(attr.Value)
+		case unix.IFA_ADDRESS:
+			if ip == nil {
+				ip = net.IP(attr.Value)
+			}
+		case unix.IFA_FLAGS:
+			if len(attr.Value) >= 4 {
+				flags = binary.NativeEndian.Uint32(attr.Value)
+			}
+		case unix.IFA_CACHEINFO:
+			// struct ifa_cacheinfo { prefered, valid, cstamp, tstamp }
+			if len(attr.Value) >= 8 {
+				valid = binary.NativeEndian.Uint32(attr.Value[4:8])
+			}
+		}
+	}
+	if ip == nil {
+		return
+	}
+
+	name := interfaceName(index)
+	address := fmt.Sprintf("%s/%d", ip, prefixLen)
+	key := fmt.Sprintf("%d/%s", index, address)
+	previous, known := m.addresses[key]
+
+	if msg.Header.Type == unix.RTM_DELADDR {
+		delete(m.addresses, key)
+		if known && notify {
+			m.emit(EventAddressRemoved, name, address, "")
+		}
+		return
+	}
+
+	now := time.Now()
+	current := addressState{
+		valid:   valid,
+		seenAt:  now,
+		dynamic: flags&unix.IFA_F_PERMANENT == 0,
+	}
+	m.addresses[key] = current
+
+	if !notify {
+		return
+	}
+	if !known {
+		m.emit(EventAddressAdded, name, address, "")
+		return
+	}
+
+	// A DHCP client renews by re-adding the address with a fresh lifetime.
+	// IPv6 lifetimes are refreshed by router advertisements, so only IPv4 counts.
+	if family == unix.AF_INET && current.dynamic && valid != 0xffffffff {
+		elapsed := uint32(now.Sub(previous.seenAt).Seconds())
+		remaining := uint32(0)
+		if previous.valid > elapsed {
+			remaining = previous.valid - elapsed
+		}
+		if valid > remaining+5 {
+			m.emit(EventDHCPRenewal, name, address, fmt.Sprintf("lease valid for %ds", valid))
+		}
+	}
+}
+
+func (m *NetworkMonitor) handleRoute(msg syscall.NetlinkMessage, notify bool) {
+	if len(msg.Data) < unix.SizeofRtMsg {
+		return
+	}
+	family := int(msg.Data[0])
+	dstLen := msg.Data[1]
+	table := uint32(msg.Data[4])
+	routeType := msg.Data[7]
+
+	var gateway net.IP
+	var oif int
+	for _, attr := range parseRouteAttrs(msg.Data[unix.SizeofRtMsg:]) {
+		switch attr.Attr.Type {
+		case unix.RTA_GATEWAY:
+			gateway = net.IP(attr.Value)
+		case unix.RTA_OIF:
+			if len(attr.Value) >= 4 {
+				oif = int(binary.NativeEndian.Uint32(attr.Value))
+			}
+		case unix.RTA_TABLE:
+			if len(attr.Value) >= 4 {
+				table = binary.NativeEndian.Uint32(attr.Value)
+			}
+		}
+	}
+
+	// Only default routes in the main table are interesting
+	if dstLen != 0 || table != unix.RT_TABLE_MAIN || routeType != unix.RTN_UNICAST {
+		return
+	}
+
+	name := interfaceName(oif)
+	description := "dev " + name
+	if gateway != nil {
+		description = fmt.Sprintf("via %s dev %s", gateway, name)
+	}
+	gatewayStr := ""
+	if gateway != nil {
+		gatewayStr = gateway.String()
+	}
+	previous, known := m.defaultRoute[family]
+
+	if msg.Header.Type == unix.RTM_DELROUTE {
+		if known && previous == description {
+			delete(m.defaultRoute, family)
+			if notify {
+				m.emit(EventDefaultRouteChange, name, gatewayStr, "default route removed")
+			}
+		}
+		return
+	}
+
+	if known && previous == description {
+		return
+	}
+	m.defaultRoute[family] = description
+	if notify {
+		m.emit(EventDefaultRouteChange, name, gatewayStr, "default route "+description)
+	}
+}
+
+func (m *NetworkMonitor) handleNeighbor(msg syscall.NetlinkMessage, notify bool) {
+	if len(msg.Data) < unix.SizeofNdMsg {
+		return
+	}
+	index := int(int32(binary.NativeEndian.Uint32(msg.Data[4:8])))
+	state := binary.NativeEndian.Uint16(msg.Data[8:10])
+
+	var ip net.IP
+	var mac net.HardwareAddr
+	for _, attr := range parseRouteAttrs(msg.Data[unix.SizeofNdMsg:]) {
+		switch attr.Attr.Type {
+		case unix.NDA_DST:
+			ip = net.IP(attr.Value)
+		case unix.NDA_LLADDR:
+			mac = net.HardwareAddr(attr.Value)
+		}
+	}
+	if ip == nil {
+		return
+	}
+
+	key := fmt.Sprintf("%s%%%d", ip, index)
+	if msg.Header.Type == unix.RTM_DELNEIGH {
+		delete(m.neighbors, key)
+		return
+	}
+
+	// Ignore entries that never resolved to a link-layer address
+	if len(mac) == 0 || state&(unix.NUD_INCOMPLETE|unix.NUD_FAILED|unix.NUD_NOARP) != 0 {
+		return
+	}
+
+	previous, known := m.neighbors[key]
+	m.neighbors[key] = mac.String()
+	if !notify || (known && previous == mac.String()) {
+		return
+	}
+
+	detail := "lladdr " + mac.String()
+	if known {
+		detail = fmt.Sprintf("lladdr changed from %s to %s", previous, mac)
+	}
+	m.emit(EventNeighborNew, interfaceName(index), ip.String(), detail)
+}
+
+// parseRouteAttrs splits a buffer into rtnetlink attributes. Unlike
+// syscall.ParseNetlinkRouteAttr it works for any message type, including neighbors.
+func parseRouteAttrs(b []byte) []syscall.NetlinkRouteAttr {
+	var attrs []syscall.NetlinkRouteAttr
+	for len(b) >= unix.SizeofRtAttr {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		attrType := binary.NativeEndian.Uint16(b[2:4])
+		if length < unix.SizeofRtAttr || length > len(b) {
+			break
+		}
+		attrs = append(attrs, syscall.NetlinkRouteAttr{
+			Attr:  syscall.RtAttr{Len: uint16(length), Type: attrType},
+			Value: b[unix.SizeofRtAttr:length],
+		})
+		aligned := (length + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+		if aligned > len(b) {
+			break
+		}
+		b = b[aligned:]
+	}
+	return attrs
+}
+
+// cString converts a NUL-terminated byte slice to a string
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
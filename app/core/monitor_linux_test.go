@@ -0,0 +1,274 @@
+//go:build linux
+
+package core
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// Interface indexes that do not exist on the test host, so names fall back to ifN
+const (
+	testIndex      = 9999
+	otherTestIndex = 10000
+)
+
+// u32 encodes a value in host byte order, as rtnetlink does
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.NativeEndian.PutUint32(b, v)
+	return b
+}
+
+// rtAttr encodes an rtnetlink attribute, padded to four bytes
+func rtAttr(attrType uint16, value []byte) []byte {
+	length := unix.SizeofRtAttr + len(value)
+	b := make([]byte, (length+unix.NLMSG_ALIGNTO-1)&^(unix.NLMSG_ALIGNTO-1))
+	binary.NativeEndian.PutUint16(b[0:2], uint16(length))
+	binary.NativeEndian.PutUint16(b[2:4], attrType)
+	copy(b[unix.SizeofRtAttr:], value)
+	return b
+}
+
+// ifInfoMsg encodes a struct ifinfomsg followed by attributes
+func ifInfoMsg(index int32, flags uint32, attrs ...[]byte) []byte {
+	b := make([]byte, unix.SizeofIfInfomsg)
+	binary.NativeEndian.PutUint32(b[4:8], uint32(index))
+	binary.NativeEndian.PutUint32(b[8:12], flags)
+	return appendAttrs(b, attrs)
+}
+
+// ifAddrMsg encodes a struct ifaddrmsg followed by attributes
+func ifAddrMsg(family, prefixLen, flags byte, index uint32, attrs ...[]byte) []byte {
+	b := []byte{family, prefixLen, flags, unix.RT_SCOPE_UNIVERSE}
+	b = append(b, u32(index)...)
+	return appendAttrs(b, attrs)
+}
+
+// rtMsg encodes a struct rtmsg followed by attributes
+func rtMsg(family, dstLen, table, routeType byte, attrs ...[]byte) []byte {
+	b := []byte{family, dstLen, 0, 0, table, unix.RTPROT_DHCP, unix.RT_SCOPE_UNIVERSE, routeType}
+	b = append(b, u32(0)...)
+	return appendAttrs(b, attrs)
+}
+
+// ndMsg encodes a struct ndmsg followed by attributes
+func ndMsg(family byte, index uint32, state uint16, attrs ...[]byte) []byte {
+	b := []byte{family, 0, 0, 0}
+	b = append(b, u32(index)...)
+	b = binary.NativeEndian.AppendUint16(b, state)
+	b = append(b, 0, unix.RTN_UNICAST)
+	return appendAttrs(b, attrs)
+}
+
+// appendAttrs appends encoded attributes to a message header
+func appendAttrs(b []byte, attrs [][]byte) []byte {
+	for _, attr := range attrs {
+		b = append(b, attr...)
+	}
+	return b
+}
+
+// cacheInfo encodes a struct ifa_cacheinfo with the given preferred and
+// valid lifetimes and zero timestamps
+func cacheInfo(valid uint32) []byte {
+	b := append(u32(valid), u32(valid)...)
+	return append(b, make([]byte, 8)...)
+}
+
+// monitorStep is one rtnetlink message and the events it should produce
+type monitorStep struct {
+	name    string
+	msgType uint16
+	data    []byte
+	notify  bool
+	want    []NetworkEvent // only Type, Interface, Address and Detail are compared
+}
+
+// runMonitorSteps feeds the messages to a fresh monitor in order and checks
+// the events each one emits
+func runMonitorSteps(t *testing.T, steps []monitorStep) {
+	t.Helper()
+	m := NewNetworkMonitor(100)
+	seen := 0
+	for _, step := range steps {
+		m.handleMessage(syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: step.msgType}, Data: step.data}, step.notify)
+		events := m.Events(0)[seen:]
+		seen += len(events)
+
+		var got []NetworkEvent
+		for _, event := range events {
+			got = append(got, NetworkEvent{Type: event.Type, Interface: event.Interface, Address: event.Address, Detail: event.Detail})
+		}
+		if len(got) != len(step.want) {
+			t.Errorf("%s: events %+v, want %+v", step.name, got, step.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != step.want[i] {
+				t.Errorf("%s: event %+v, want %+v", step.name, got[i], step.want[i])
+			}
+		}
+	}
+}
+
+func TestHandleLink(t *testing.T) {
+	up := uint32(unix.IFF_UP | unix.IFF_LOWER_UP)
+	name := rtAttr(unix.IFLA_IFNAME, []byte("eth9\x00"))
+	runMonitorSteps(t, []monitorStep{
+		{"seeded link", unix.RTM_NEWLINK, ifInfoMsg(testIndex, up, name), false, nil},
+		{"carrier lost", unix.RTM_NEWLINK, ifInfoMsg(testIndex, unix.IFF_UP, name), true,
+			[]NetworkEvent{{Type: EventLinkDown, Interface: "eth9", Detail: "carrier lost"}}},
+		{"unchanged", unix.RTM_NEWLINK, ifInfoMsg(testIndex, unix.IFF_UP, name), true, nil},
+		{"carrier back", unix.RTM_NEWLINK, ifInfoMsg(testIndex, up, name), true,
+			[]NetworkEvent{{Type: EventLinkUp, Interface: "eth9", Detail: "carrier detected"}}},
+		{"removed", unix.RTM_DELLINK, ifInfoMsg(testIndex, up, name), true,
+			[]NetworkEvent{{Type: EventLinkDown, Interface: "eth9", Detail: "interface removed"}}},
+		{"new link without carrier", unix.RTM_NEWLINK, ifInfoMsg(otherTestIndex, unix.IFF_UP), true, nil},
+		{"new link gains carrier, named by index", unix.RTM_NEWLINK, ifInfoMsg(otherTestIndex, up), true,
+			[]NetworkEvent{{Type: EventLinkUp, Interface: "if10000", Detail: "carrier detected"}}},
+		{"truncated", unix.RTM_NEWLINK, ifInfoMsg(testIndex, up)[:8], true, nil},
+	})
+}
+
+func TestHandleAddress(t *testing.T) {
+	v4 := func(valid uint32) []byte {
+		return ifAddrMsg(unix.AF_INET, 24, 0, testIndex,
+			rtAttr(unix.IFA_ADDRESS, net.ParseIP("192.0.2.10").To4()),
+			rtAttr(unix.IFA_LOCAL, net.ParseIP("192.0.2.10").To4()),
+			rtAttr(unix.IFA_CACHEINFO, cacheInfo(valid)))
+	}
+	static := ifAddrMsg(unix.AF_INET6, 64, unix.IFA_F_PERMANENT, testIndex,
+		rtAttr(unix.IFA_ADDRESS, net.ParseIP("2001:db8::10")))
+	// On point-to-point links IFA_ADDRESS is the peer and IFA_LOCAL our address
+	peer := ifAddrMsg(unix.AF_INET, 32, 0, otherTestIndex,
+		rtAttr(unix.IFA_ADDRESS, net.ParseIP("198.51.100.1").To4()),
+		rtAttr(unix.IFA_LOCAL, net.ParseIP("198.51.100.2").To4()))
+
+	runMonitorSteps(t, []monitorStep{
+		{"seeded address", unix.RTM_NEWADDR, static, false, nil},
+		{"seeded address again", unix.RTM_NEWADDR, static, true, nil},
+		{"new DHCP address", unix.RTM_NEWADDR, v4(3600), true,
+			[]NetworkEvent{{Type: EventAddressAdded, Interface: "if9999", Address: "192.0.2.10/24"}}},
+		{"same lifetime", unix.RTM_NEWADDR, v4(3600), true, nil},
+		{"lease renewed", unix.RTM_NEWADDR, v4(7200), true,
+			[]NetworkEvent{{Type: EventDHCPRenewal, Interface: "if9999", Address: "192.0.2.10/24", Detail: "lease valid for 7200s"}}},
+		{"removed", unix.RTM_DELADDR, v4(0), true,
+			[]NetworkEvent{{Type: EventAddressRemoved, Interface: "if9999", Address: "192.0.2.10/24"}}},
+		{"removed again", unix.RTM_DELADDR, v4(0), true, nil},
+		{"point-to-point", unix.RTM_NEWADDR, peer, true,
+			[]NetworkEvent{{Type: EventAddressAdded, Interface: "if10000", Address: "198.51.100.2/32"}}},
+		{"no address attribute", unix.RTM_NEWADDR, ifAddrMsg(unix.AF_INET, 24, 0, testIndex), true, nil},
+		{"truncated", unix.RTM_NEWADDR, v4(3600)[:4], true, nil},
+	})
+}
+
+func TestHandleRoute(t *testing.T) {
+	defaultRoute := func(gateway string, attrs ...[]byte) []byte {
+		attrs = append([][]byte{
+			rtAttr(unix.RTA_GATEWAY, net.ParseIP(gateway).To4()),
+			rtAttr(unix.RTA_OIF, u32(testIndex)),
+		}, attrs...)
+		return rtMsg(unix.AF_INET, 0, unix.RT_TABLE_MAIN, unix.RTN_UNICAST, attrs...)
+	}
+
+	runMonitorSteps(t, []monitorStep{
+		{"new default route", unix.RTM_NEWROUTE, defaultRoute("192.0.2.1"), true,
+			[]NetworkEvent{{Type: EventDefaultRouteChange, Interface: "if9999", Address: "192.0.2.1", Detail: "default route via 192.0.2.1 dev if9999"}}},
+		{"unchanged", unix.RTM_NEWROUTE, defaultRoute("192.0.2.1"), true, nil},
+		{"other gateway", unix.RTM_NEWROUTE, defaultRoute("192.0.2.254"), true,
+			[]NetworkEvent{{Type: EventDefaultRouteChange, Interface: "if9999", Address: "192.0.2.254", Detail: "default route via 192.0.2.254 dev if9999"}}},
+		{"subnet route", unix.RTM_NEWROUTE,
+			rtMsg(unix.AF_INET, 24, unix.RT_TABLE_MAIN, unix.RTN_UNICAST, rtAttr(unix.RTA_OIF, u32(testIndex))), true, nil},
+		{"default route in another table", unix.RTM_NEWROUTE,
+			defaultRoute("192.0.2.1", rtAttr(unix.RTA_TABLE, u32(100))), true, nil},
+		{"local route", unix.RTM_NEWROUTE,
+			rtMsg(unix.AF_INET, 0, unix.RT_TABLE_MAIN, unix.RTN_LOCAL), true, nil},
+		{"removing an older route", unix.RTM_DELROUTE, defaultRoute("192.0.2.1"), true, nil},
+		{"removed", unix.RTM_DELROUTE, defaultRoute("192.0.2.254"), true,
+			[]NetworkEvent{{Type: EventDefaultRouteChange, Interface: "if9999", Address: "192.0.2.254", Detail: "default route removed"}}},
+		{"IPv6 route without gateway", unix.RTM_NEWROUTE,
+			rtMsg(unix.AF_INET6, 0, unix.RT_TABLE_MAIN, unix.RTN_UNICAST, rtAttr(unix.RTA_OIF, u32(testIndex))), true,
+			[]NetworkEvent{{Type: EventDefaultRouteChange, Interface: "if9999", Detail: "default route dev if9999"}}},
+		{"truncated", unix.RTM_NEWROUTE, defaultRoute("192.0.2.1")[:6], true, nil},
+	})
+}
+
+func TestHandleNeighbor(t *testing.T) {
+	neighbor := func(state uint16, mac string) []byte {
+		attrs := [][]byte{rtAttr(unix.NDA_DST, net.ParseIP("192.0.2.1").To4())}
+		if mac != "" {
+			hw, _ := net.ParseMAC(mac)
+			attrs = append(attrs, rtAttr(unix.NDA_LLADDR, hw))
+		}
+		return ndMsg(unix.AF_INET, testIndex, state, attrs...)
+	}
+
+	runMonitorSteps(t, []monitorStep{
+		{"unresolved", unix.RTM_NEWNEIGH, neighbor(unix.NUD_INCOMPLETE, ""), true, nil},
+		{"failed", unix.RTM_NEWNEIGH, neighbor(unix.NUD_FAILED, "02:00:00:00:00:01"), true, nil},
+		{"resolved", unix.RTM_NEWNEIGH, neighbor(unix.NUD_REACHABLE, "02:00:00:00:00:01"), true,
+			[]NetworkEvent{{Type: EventNeighborNew, Interface: "if9999", Address: "192.0.2.1", Detail: "lladdr 02:00:00:00:00:01"}}},
+		{"state change only", unix.RTM_NEWNEIGH, neighbor(unix.NUD_STALE, "02:00:00:00:00:01"), true, nil},
+		{"new MAC", unix.RTM_NEWNEIGH, neighbor(unix.NUD_REACHABLE, "02:00:00:00:00:02"), true,
+			[]NetworkEvent{{Type: EventNeighborNew, Interface: "if9999", Address: "192.0.2.1", Detail: "lladdr changed from 02:00:00:00:00:01 to 02:00:00:00:00:02"}}},
+		{"removed", unix.RTM_DELNEIGH, neighbor(unix.NUD_REACHABLE, "02:00:00:00:00:02"), true, nil},
+		{"back after removal", unix.RTM_NEWNEIGH, neighbor(unix.NUD_REACHABLE, "02:00:00:00:00:02"), true,
+			[]NetworkEvent{{Type: EventNeighborNew, Interface: "if9999", Address: "192.0.2.1", Detail: "lladdr 02:00:00:00:00:02"}}},
+		{"truncated", unix.RTM_NEWNEIGH, neighbor(unix.NUD_REACHABLE, "02:00:00:00:00:03")[:10], true, nil},
+	})
+}
+
+func TestParseRouteAttrs(t *testing.T) {
+	name := rtAttr(unix.IFLA_IFNAME, []byte("eth0\x00")) // 9 bytes, padded to 12
+	mtu := rtAttr(unix.IFLA_MTU, u32(1500))
+
+	attrs := parseRouteAttrs(append(append([]byte{}, name...), mtu...))
+	if len(attrs) != 2 || cString(attrs[0].Value) != "eth0" || binary.NativeEndian.Uint32(attrs[1].Value) != 1500 {
+		t.Errorf("attrs = %+v, want the name and MTU", attrs)
+	}
+
+	// A length past the end of the buffer stops parsing instead of overrunning
+	bad := append([]byte{}, name...)
+	bad = append(bad, mtu[:6]...)
+	binary.NativeEndian.PutUint16(bad[len(name):], 64)
+	if attrs := parseRouteAttrs(bad); len(attrs) != 1 {
+		t.Errorf("parsed %d attributes from a truncated buffer, want 1", len(attrs))
+	}
+	// So does a length shorter than the attribute header
+	if attrs := parseRouteAttrs([]byte{2, 0, 3, 0, 0, 0, 0, 0}); len(attrs) != 0 {
+		t.Errorf("parsed %+v from a zero-length attribute", attrs)
+	}
+}
+
+func TestStartConcurrently(t *testing.T) {
+	m := NewNetworkMonitor(10)
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- m.Start()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Skipf("rtnetlink is not available: %v", err)
+		}
+	}
+	if !m.IsRunning() {
+		t.Fatal("monitor not running after Start")
+	}
+	m.Stop()
+	if m.IsRunning() {
+		t.Error("monitor still running after Stop")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package core
+
+import "errors"
+
+// start is not supported without rtnetlink; callers fall back to polling
+func (m *NetworkMonitor) start() error {
+	return errors.New("network monitor is only supported on Linux")
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Netns is a network namespace that collectors and plugins can run in
+type Netns struct {
+	Name      string `json:"name"` // name under /run/netns, or "pid:<pid>" for an unnamed one
+	Path      string `json:"path"`
+	Inode     uint64 `json:"inode"`
+	Named     bool   `json:"named"`
+	Current   bool   `json:"current"` // NetTool's own namespace
+	PID       int    `json:"pid,omitempty"`
+	Command   string `json:"command,omitempty"` // command of PID, e.g. a container's init
+	Processes int    `json:"processes"`
+}
+
+// NetnsHelperFlag is the command line flag that starts NetTool as a helper
+// serving one NetnsRequest inside another network namespace
+const NetnsHelperFlag = "netns-helper"
+
+// NetnsHelperArgs are passed to helper processes after NetnsHelperFlag, so
+// they see the same settings as the server, such as its plugin directory
+var NetnsHelperArgs []string
+
+// NetnsRequest asks a helper process to collect something in its namespace
+type NetnsRequest struct {
+	Action string                 `json:"action"` // network-info, arp or plugin
+	Plugin string                 `json:"plugin,omitempty"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// netnsResponse is what a helper process writes back
+type netnsResponse struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// netnsDirs are where 'ip netns' keeps named namespaces
+var netnsDirs = []string{"/run/netns", "/var/run/netns"}
+
+// ResolveNetns turns a namespace reference into the path of its nsfs file.
+// A reference is a name under /run/netns, "pid:<pid>" or a bare pid, or a
+// path under /run/netns or /proc. An empty reference resolves to "".
+func ResolveNetns(ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+
+	var path string
+	pid := strings.TrimPrefix(ref, "pid:")
+	switch {
+	case isDigits(pid):
+		path = filepath.Join("/proc", pid, "ns", "net")
+	case filepath.IsAbs(ref):
+		path = filepath.Clean(ref)
+		if !strings.HasPrefix(path, "/proc/") && !strings.HasPrefix(path, "/run/netns/") && !strings.HasPrefix(path, "/var/run/netns/") {
+			return "", fmt.Errorf("network namespace path must be under /run/netns or /proc")
+		}
+	case strings.ContainsAny(ref, "/\x00") || ref == "." || ref == "..":
+		return "", fmt.Errorf("invalid network namespace name %q", ref)
+	default:
+		for _, dir := range netnsDirs {
+			candidate := filepath.Join(dir, ref)
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate, nil
+			}
+		}
+		return "", fmt.Errorf("network namespace %q not found", ref)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("network namespace %q not found", ref)
+	}
+	return path, nil
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// RunNetnsHelper runs req in a NetTool helper process inside the referenced
+// namespace and decodes its result into result. The helper is a fresh
+// process, so every thread, socket and command it uses lives in the namespace.
+func RunNetnsHelper(ref string, req NetnsRequest, result interface{}) error {
+	path, err := ResolveNetns(ref)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return errors.New("no network namespace given")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the NetTool executable: %v", err)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode namespace request: %v", err)
+	}
+
+	cmd := exec.Command(self, append([]string{"-" + NetnsHelperFlag}, NetnsHelperArgs...)...)
+	var out, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := RunInNetns(path, cmd.Run); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("namespace helper failed: %v: %s", err, msg)
+		}
+		return fmt.Errorf("namespace helper failed: %v", err)
+	}
+
+	var resp netnsResponse
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		return fmt.Errorf("failed to parse namespace helper output: %v", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("failed to parse namespace helper result: %v", err)
+		}
+	}
+	return nil
+}
+
+// ServeNetnsHelper handles one NetnsRequest read from r and writes the
+// response to w. Plugins are run through runPlugin.
+func ServeNetnsHelper(r io.Reader, w io.Writer, runPlugin func(id string, params map[string]interface{}) (interface{}, error)) error {
+	var req NetnsRequest
+	var result interface{}
+	err := json.NewDecoder(r).Decode(&req)
+	if err != nil {
+		err = fmt.Errorf("failed to parse namespace request: %v", err)
+	} else {
+		switch req.Action {
+		case "network-info":
+			result, err = GetNetworkInfo()
+		case "arp":
+			result, err = GetARPTable()
+		case "plugin":
+			result, err = runPlugin(req.Plugin, req.Params)
+		default:
+			err = fmt.Errorf("unknown namespace action %q", req.Action)
+		}
+	}
+
+	var resp netnsResponse
+	if err != nil {
+		resp.Error = err.Error()
+	} else if resp.Result, err = json.Marshal(result); err != nil {
+		resp = netnsResponse{Error: fmt.Sprintf("failed to encode result: %v", err)}
+	}
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// GetNetworkInfoInNetns collects network info inside the referenced namespace,
+// or in NetTool's own when the reference is empty
+func GetNetworkInfoInNetns(ref string) (*NetworkInfo, error) {
+	if ref == "" {
+		return GetNetworkInfo()
+	}
+	var info NetworkInfo
+	if err := RunNetnsHelper(ref, NetnsRequest{Action: "network-info"}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetARPTableInNetns reads the ARP table of the referenced namespace, or of
+// NetTool's own when the reference is empty
+func GetARPTableInNetns(ref string) ([]ARPEntry, error) {
+	if ref == "" {
+		return GetARPTable()
+	}
+	var entries []ARPEntry
+	if err := RunNetnsHelper(ref, NetnsRequest{Action: "arp"}, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// netnsInode parses the inode from a /proc/<pid>/ns/net link such as "net:[4026531840]"
+func netnsInode(link string) (uint64, bool) {
+	value, ok := strings.CutPrefix(link, "net:[")
+	if !ok {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(strings.TrimSuffix(value, "]"), 10, 64)
+	return inode, err == nil
+}
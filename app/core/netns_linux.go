@@ -0,0 +1,121 @@
+//go:build linux
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// RunInNetns calls fn on a thread switched into the namespace at path.
+// Processes fn starts inherit the namespace; goroutines it starts do not,
+// and /proc/net still shows NetTool's own namespace.
+func RunInNetns(path string, fn func() error) error {
+	target, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open network namespace %s: %v", path, err)
+	}
+	defer target.Close()
+
+	runtime.LockOSThread()
+	original, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to open current network namespace: %v", err)
+	}
+	defer original.Close()
+
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to enter network namespace %s (CAP_SYS_ADMIN is required): %v", path, err)
+	}
+	fnErr := fn()
+	if err := unix.Setns(int(original.Fd()), unix.CLONE_NEWNET); err != nil {
+		// The thread stays locked so the runtime discards it when this goroutine exits
+		return fmt.Errorf("failed to leave network namespace %s: %v", path, err)
+	}
+	runtime.UnlockOSThread()
+	return fnErr
+}
+
+// ListNetns lists named namespaces and the unnamed ones processes live in,
+// such as those of containers
+func ListNetns() ([]Netns, error) {
+	var current uint64
+	if link, err := os.Readlink("/proc/self/ns/net"); err == nil {
+		current, _ = netnsInode(link)
+	}
+
+	byInode := make(map[uint64]*Netns)
+	var namespaces []*Netns
+	for _, dir := range netnsDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			var st unix.Stat_t
+			if err := unix.Stat(path, &st); err != nil {
+				continue
+			}
+			// /var/run is usually a link to /run, so the same namespace shows up twice
+			if _, seen := byInode[st.Ino]; seen {
+				continue
+			}
+			ns := &Netns{Name: entry.Name(), Path: path, Inode: st.Ino, Named: true, Current: st.Ino == current}
+			byInode[st.Ino] = ns
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc: %v", err)
+	}
+	pids := make([]int, 0, len(procs))
+	for _, proc := range procs {
+		if pid, err := strconv.Atoi(proc.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+
+	for _, pid := range pids {
+		path := filepath.Join("/proc", strconv.Itoa(pid), "ns", "net")
+		link, err := os.Readlink(path)
+		if err != nil {
+			continue // The process exited or belongs to another user
+		}
+		inode, ok := netnsInode(link)
+		if !ok {
+			continue
+		}
+		ns, ok := byInode[inode]
+		if !ok {
+			ns = &Netns{Name: "pid:" + strconv.Itoa(pid), Path: path, Inode: inode, Current: inode == current}
+			byInode[inode] = ns
+			namespaces = append(namespaces, ns)
+		}
+		ns.Processes++
+		if ns.PID == 0 {
+			ns.PID = pid
+			if comm, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm")); err == nil {
+				ns.Command = strings.TrimSpace(string(comm))
+			}
+		}
+	}
+
+	result := make([]Netns, 0, len(namespaces))
+	for _, ns := range namespaces {
+		result = append(result, *ns)
+	}
+	return result, nil
+}
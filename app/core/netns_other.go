@@ -0,0 +1,15 @@
+//go:build !linux
+
+package core
+
+import "errors"
+
+// RunInNetns needs setns, which is only available on Linux
+func RunInNetns(path string, fn func() error) error {
+	return errors.New("network namespaces are only available on Linux")
+}
+
+// ListNetns needs network namespaces, which are only available on Linux
+func ListNetns() ([]Netns, error) {
+	return nil, errors.New("network namespaces are only available on Linux")
+}
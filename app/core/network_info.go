@@ -3,12 +3,12 @@ package core
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"net"
-	"net/http"
 	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	psnet "github.com/shirou/gopsutil/v3/net"
@@ -16,20 +16,26 @@ import (
 
 // NetworkInfo represents the network information for the device
 type NetworkInfo struct {
-	IPv4Address    string         `json:"ipv4Address"`
-	IPv6Address    string         `json:"ipv6Address"`
-	SubnetMask     string         `json:"subnetMask"`
-	Gateway        string         `json:"gateway"`
-	SSID           string         `json:"ssid,omitempty"`
-	EthernetInfo   EthernetInfo   `json:"ethernetInfo,omitempty"`
-	DNSServers     []string       `json:"dnsServers"`
-	DHCPInfo       DHCPInfo       `json:"dhcpInfo"`
-	VLANInfo       VLANInfo       `json:"vlanInfo,omitempty"`
-	Connection     Connection     `json:"connection"`
-	Traffic        Traffic        `json:"traffic"`
-	ARPEntries     []ARPEntry     `json:"arpEntries"`
-	ServiceLatency ServiceLatency `json:"serviceLatency"`
-	Timestamp      time.Time      `json:"timestamp"`
+	IPv4Address    string                    `json:"ipv4Address"`
+	IPv6Address    string                    `json:"ipv6Address"`
+	IPv6Addresses  []IPv6Address             `json:"ipv6Addresses"` // every IPv6 address of the active interface
+	SubnetMask     string                    `json:"subnetMask"`
+	Gateway        string                    `json:"gateway"`
+	SSID           string                    `json:"ssid,omitempty"`
+	EthernetInfo   EthernetInfo              `json:"ethernetInfo,omitempty"`
+	DNSServers     []string                  `json:"dnsServers"`
+	Resolver       ResolverInfo              `json:"resolver"`
+	DHCPInfo       DHCPInfo                  `json:"dhcpInfo"`
+	VLANInfo       VLANInfo                  `json:"vlanInfo,omitempty"`
+	Connection     Connection                `json:"connection"`
+	Connectivity   ConnectivityInfo          `json:"connectivity"`
+	Traffic        Traffic                   `json:"traffic"`
+	InterfaceRates map[string]InterfaceRates `json:"interfaceRates"`
+	ARPEntries     []ARPEntry                `json:"arpEntries"`
+	ServiceLatency map[string]LatencyResult  `json:"serviceLatency"`
+	TimeSync       TimeSyncInfo              `json:"timeSync"`
+	Sections       map[string]SectionStatus  `json:"sections"` // Freshness of each collected section
+	Timestamp      time.Time                 `json:"timestamp"`
 }
 
 // EthernetInfo represents ethernet connection details
@@ -42,10 +48,9 @@ type EthernetInfo struct {
 
 // DHCPInfo represents DHCP configuration
 type DHCPInfo struct {
-	Enabled       bool      `json:"enabled"`
-	LeaseObtained time.Time `json:"leaseObtained,omitempty"`
-	LeaseExpires  time.Time `json:"leaseExpires,omitempty"`
-	DHCPServer    string    `json:"dhcpServer,omitempty"`
+	Enabled bool   `json:"enabled"`
+	Method  string `json:"method"` // "dhcp" or "static"
+	DHCPLease
 }
 
 // VLANInfo represents VLAN configuration if applicable
@@ -54,11 +59,13 @@ type VLANInfo struct {
 	VLANID   int    `json:"vlanId,omitempty"`
 	Priority int    `json:"priority,omitempty"`
 	Name     string `json:"name,omitempty"`
+	Parent   string `json:"parent,omitempty"`   // Interface the VLAN is stacked on
+	Protocol string `json:"protocol,omitempty"` // 802.1Q or 802.1ad
 }
 
 // Connection represents connection status and metrics
 type Connection struct {
-	Status         string  `json:"status"` // "connected", "disconnected", "limited"
+	Status         string  `json:"status"` // "connected", "disconnected", "limited"; see Connectivity for why
 	Uptime         int64   `json:"uptime"` // in seconds
 	LatencyMS      float64 `json:"latencyMs"`
 	PacketLoss     float64 `json:"packetLoss"`               // percentage
@@ -67,11 +74,12 @@ type Connection struct {
 
 // Traffic represents network traffic statistics
 type Traffic struct {
-	BytesReceived    int64   `json:"bytesReceived"`
-	BytesSent        int64   `json:"bytesSent"`
-	PacketsReceived  int64   `json:"packetsReceived"`
-	PacketsSent      int64   `json:"packetsSent"`
-	CurrentBandwidth float64 `json:"currentBandwidth"` // in Mbps
+	BytesReceived    int64          `json:"bytesReceived"`
+	BytesSent        int64          `json:"bytesSent"`
+	PacketsReceived  int64          `json:"packetsReceived"`
+	PacketsSent      int64          `json:"packetsSent"`
+	CurrentBandwidth float64        `json:"currentBandwidth"` // rx+tx in Mbit/s (SI)
+	Rates            InterfaceRates `json:"rates"`
 }
 
 // ARPEntry represents a single entry in the ARP table (IP to MAC mapping)
@@ -82,144 +90,356 @@ type ARPEntry struct {
 	State      string `json:"state"`
 }
 
-// ServiceLatency represents latency measurements to various major services
-type ServiceLatency struct {
-	Google     float64 `json:"google"`     // Google latency in ms
-	Amazon     float64 `json:"amazon"`     // Amazon latency in ms
-	Cloudflare float64 `json:"cloudflare"` // Cloudflare latency in ms
-	Microsoft  float64 `json:"microsoft"`  // Microsoft latency in ms
-	DNS        float64 `json:"dns"`        // DNS latency in ms
-	HTTP       float64 `json:"http"`       // HTTP latency in ms
-}
+// oneShotRateInterval is the least time between the two traffic samples
+// GetNetworkInfo takes to compute rates
+const oneShotRateInterval = time.Second
 
-// GetNetworkInfo retrieves the current network information
+// GetNetworkInfo collects every section once, concurrently, and returns the
+// result. Traffic is sampled a second time, at least oneShotRateInterval after
+// the first, so the rates are not empty. Long-running callers should use a
+// started SnapshotCollector instead.
 func GetNetworkInfo() (*NetworkInfo, error) {
-	// Get network interfaces
-	ifaces, err := net.Interfaces()
-	if err != nil {
+	sc := NewSnapshotCollector(DefaultCollectors())
+	start := time.Now()
+	sc.Refresh()
+	if err := sc.Err("interface"); err != nil {
 		return nil, err
 	}
+	time.Sleep(oneShotRateInterval - time.Since(start))
+	sc.Refresh("traffic")
+	return sc.Snapshot(), nil
+}
 
-	// Get IO counters for traffic statistics
-	ioCounters, err := psnet.IOCounters(true)
-	if err != nil {
-		return nil, err
-	}
+// interfaceSection is the collected state of the active interface
+type interfaceSection struct {
+	Ethernet   EthernetInfo
+	IPv4       string
+	IPv6       string
+	IPv6All    []IPv6Address
+	SubnetMask string
+	VLAN       VLANInfo
+}
 
-	// For simplicity, we'll focus on the first active interface
-	var activeIface net.Interface
-	var activeIOCounter psnet.IOCountersStat
+// connectionSection is the collected gateway reachability
+type connectionSection struct {
+	LatencyMS  float64
+	PacketLoss float64
+}
 
-	for _, iface := range ifaces {
-		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
-			activeIface = iface
+// trafficSection is the collected counters of the active interface and the rates of all interfaces
+type trafficSection struct {
+	Active Traffic
+	Rates  map[string]InterfaceRates
+}
 
-			// Find matching IO counter
-			for _, counter := range ioCounters {
-				if counter.Name == iface.Name {
-					activeIOCounter = counter
-					break
-				}
-			}
-			break
-		}
-	}
+// wirelessSection is the collected wireless association
+type wirelessSection struct {
+	SSID           string
+	SignalStrength int
+}
 
-	// Get IP addresses
-	var ipv4, ipv6, subnet string
-	addrs, err := activeIface.Addrs()
-	if err == nil {
-		for _, addr := range addrs {
-			if ipNet, ok := addr.(*net.IPNet); ok {
-				if ipNet.IP.To4() != nil {
-					ipv4 = ipNet.IP.String()
-					mask := ipNet.Mask
-					ones, _ := mask.Size()
-					subnet = cidrToSubnet(ones)
-				} else {
-					ipv6 = ipNet.IP.String()
+// DefaultCollectors returns the collectors that make up a NetworkInfo snapshot.
+// Cheap counters refresh often; probes that send packets refresh slowly.
+func DefaultCollectors() []Collector {
+	rates := NewRateTracker()
+
+	return []Collector{
+		{
+			Name:     "interface",
+			Interval: 5 * time.Second,
+			Timeout:  2 * time.Second,
+			Collect: func() (interface{}, error) {
+				iface, err := activeInterface()
+				if err != nil {
+					return nil, err
 				}
-			}
-		}
-	}
-
-	// Create network info object
-	networkInfo := &NetworkInfo{
-		IPv4Address: ipv4,
-		IPv6Address: ipv6,
-		SubnetMask:  subnet,
-		Gateway:     getDefaultGateway(),
-		DNSServers:  getDNSServers(),
-		DHCPInfo: DHCPInfo{
-			Enabled:    true, // Assumption for simplicity
-			DHCPServer: getDHCPServer(),
+				ipv4, ipv6, subnet := interfaceAddresses(iface)
+				section := interfaceSection{
+					Ethernet: EthernetInfo{
+						InterfaceName: iface.Name,
+						MACAddress:    iface.HardwareAddr.String(),
+						Speed:         "1 Gbps", // Placeholder - would need specific system calls to get real values
+						Duplex:        "Full",   // Placeholder
+					},
+					IPv4:       ipv4,
+					IPv6:       ipv6,
+					SubnetMask: subnet,
+				}
+				section.VLAN = GetVLANInfo(iface.Name)
+				section.IPv6All, _ = GetIPv6Addresses(iface.Name)
+				return section, nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				section := value.(interfaceSection)
+				info.EthernetInfo = section.Ethernet
+				info.IPv4Address = section.IPv4
+				info.IPv6Address = section.IPv6
+				info.IPv6Addresses = section.IPv6All
+				info.SubnetMask = section.SubnetMask
+				info.VLANInfo = section.VLAN
+			},
+		},
+		{
+			Name:     "traffic",
+			Interval: 2 * time.Second,
+			Timeout:  time.Second,
+			Collect: func() (interface{}, error) {
+				iface, err := activeInterface()
+				if err != nil {
+					return nil, err
+				}
+				ioCounters, err := psnet.IOCounters(true)
+				if err != nil {
+					return nil, err
+				}
+				section := trafficSection{Rates: rates.Update(ioCounters, time.Now())}
+				for _, counter := range ioCounters {
+					if counter.Name == iface.Name {
+						ifaceRates := section.Rates[iface.Name]
+						section.Active = Traffic{
+							BytesReceived:    int64(counter.BytesRecv),
+							BytesSent:        int64(counter.BytesSent),
+							PacketsReceived:  int64(counter.PacketsRecv),
+							PacketsSent:      int64(counter.PacketsSent),
+							CurrentBandwidth: (ifaceRates.RxBps + ifaceRates.TxBps) / 1e6,
+							Rates:            ifaceRates,
+						}
+					}
+				}
+				return section, nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				section := value.(trafficSection)
+				info.Traffic = section.Active
+				info.InterfaceRates = section.Rates
+			},
 		},
-		EthernetInfo: EthernetInfo{
-			InterfaceName: activeIface.Name,
-			MACAddress:    activeIface.HardwareAddr.String(),
-			Speed:         "1 Gbps", // Placeholder - would need specific system calls to get real values
-			Duplex:        "Full",   // Placeholder
+		{
+			Name:     "uptime",
+			Interval: 5 * time.Second,
+			Timeout:  time.Second,
+			Collect: func() (interface{}, error) {
+				return getUptime(), nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				info.Connection.Uptime = value.(int64)
+			},
 		},
-		Connection: Connection{
-			Status:     "connected", // Assumption
-			Uptime:     getUptime(),
-			LatencyMS:  getPingLatency(),
-			PacketLoss: getPacketLoss(),
+		{
+			Name:     "connectivity",
+			Interval: 30 * time.Second,
+			Timeout:  15 * time.Second,
+			Collect: func() (interface{}, error) {
+				return CheckConnectivity(connectivityConfig), nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				connectivity := value.(*ConnectivityInfo)
+				info.Connectivity = *connectivity
+				info.Connection.Status = connectivity.Status()
+			},
 		},
-		Traffic: Traffic{
-			BytesReceived:    int64(activeIOCounter.BytesRecv),
-			BytesSent:        int64(activeIOCounter.BytesSent),
-			PacketsReceived:  int64(activeIOCounter.PacketsRecv),
-			PacketsSent:      int64(activeIOCounter.PacketsSent),
-			CurrentBandwidth: calculateBandwidth(activeIOCounter),
+		{
+			Name:     "gateway",
+			Interval: 10 * time.Second,
+			Timeout:  2 * time.Second,
+			Collect: func() (interface{}, error) {
+				return getDefaultGateway(), nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				info.Gateway = value.(string)
+			},
 		},
-		ServiceLatency: ServiceLatency{
-			Google:     measureServiceLatency("google.com"),
-			Amazon:     measureServiceLatency("amazon.com"),
-			Cloudflare: measureServiceLatency("cloudflare.com"),
-			Microsoft:  measureServiceLatency("microsoft.com"),
-			DNS:        measureDNSLatency(),
-			HTTP:       measureHTTPLatency(),
+		{
+			Name:     "connection",
+			Interval: 15 * time.Second,
+			Timeout:  8 * time.Second,
+			Collect: func() (interface{}, error) {
+				var section connectionSection
+				var wg sync.WaitGroup
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					section.LatencyMS = getPingLatency()
+				}()
+				go func() {
+					defer wg.Done()
+					section.PacketLoss = getPacketLoss()
+				}()
+				wg.Wait()
+				return section, nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				section := value.(connectionSection)
+				info.Connection.LatencyMS = section.LatencyMS
+				info.Connection.PacketLoss = section.PacketLoss
+			},
+		},
+		{
+			Name:     "wireless",
+			Interval: 15 * time.Second,
+			Timeout:  3 * time.Second,
+			Collect: func() (interface{}, error) {
+				iface, err := activeInterface()
+				if err != nil || !isWireless(iface.Name) {
+					return wirelessSection{}, nil
+				}
+				return wirelessSection{
+					SSID:           getWirelessSSID(iface.Name),
+					SignalStrength: getSignalStrength(iface.Name),
+				}, nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				section := value.(wirelessSection)
+				info.SSID = section.SSID
+				info.Connection.SignalStrength = section.SignalStrength
+			},
+		},
+		{
+			Name:     "resolver",
+			Interval: 30 * time.Second,
+			Timeout:  5 * time.Second,
+			Collect: func() (interface{}, error) {
+				return GetResolverInfo(), nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				resolver := value.(ResolverInfo)
+				info.Resolver = resolver
+				info.DNSServers = resolver.EffectiveServers()
+			},
+		},
+		{
+			Name:     "dhcp",
+			Interval: 30 * time.Second,
+			Timeout:  5 * time.Second,
+			Collect: func() (interface{}, error) {
+				iface, err := activeInterface()
+				if err != nil {
+					return nil, err
+				}
+				ipv4, _, _ := interfaceAddresses(iface)
+				return GetDHCPInfo(iface.Name, ipv4), nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				info.DHCPInfo = value.(DHCPInfo)
+			},
+		},
+		{
+			Name:     "arp",
+			Interval: 10 * time.Second,
+			Timeout:  3 * time.Second,
+			Collect: func() (interface{}, error) {
+				return GetARPTable()
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				info.ARPEntries = value.([]ARPEntry)
+			},
+		},
+		{
+			Name:     "timeSync",
+			Interval: time.Minute,
+			Timeout:  5 * time.Second,
+			Collect: func() (interface{}, error) {
+				return GetTimeSync(), nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				info.TimeSync = *value.(*TimeSyncInfo)
+			},
+		},
+		{
+			Name:     "serviceLatency",
+			Interval: 5 * time.Second,
+			Timeout:  5 * time.Second,
+			Collect: func() (interface{}, error) {
+				return serviceLatencyResults(), nil
+			},
+			Apply: func(info *NetworkInfo, value interface{}) {
+				info.ServiceLatency = value.(map[string]LatencyResult)
+			},
 		},
-		Timestamp: time.Now(),
 	}
+}
 
-	// Check if it's a wireless connection
-	if isWireless(activeIface.Name) {
-		networkInfo.SSID = getWirelessSSID(activeIface.Name)
-		networkInfo.Connection.SignalStrength = getSignalStrength(activeIface.Name)
+// activeInterface returns the first interface that is up and not a loopback
+func activeInterface() (net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return net.Interface{}, err
 	}
-
-	// Check for VLAN info
-	if strings.Contains(activeIface.Name, ".") {
-		networkInfo.VLANInfo = VLANInfo{
-			Enabled: true,
-			VLANID:  getVLANID(activeIface.Name),
-			Name:    "VLAN " + string(activeIface.Name[strings.LastIndex(activeIface.Name, ".")+1:]),
-		}
-	} else {
-		networkInfo.VLANInfo = VLANInfo{
-			Enabled: false,
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
+			return iface, nil
 		}
 	}
+	return net.Interface{}, fmt.Errorf("no active network interface")
+}
 
-	// Get ARP table entries using 'ip neigh show' instead of 'arp -a'
-	arpEntries, err := GetARPTable()
-	if err == nil {
-		networkInfo.ARPEntries = arpEntries
+// interfaceAddresses returns the IPv4 address, the most widely scoped IPv6 address and the IPv4 subnet mask of an interface
+func interfaceAddresses(iface net.Interface) (ipv4, ipv6, subnet string) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", "", ""
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			if ipNet.IP.To4() != nil {
+				ipv4 = ipNet.IP.String()
+				ones, _ := ipNet.Mask.Size()
+				subnet = cidrToSubnet(ones)
+			} else if ipv6 == "" || ipv6ScopeRank(ipNet.IP) > ipv6ScopeRank(net.ParseIP(ipv6)) {
+				// Prefer a global address over a ULA over a link-local one
+				ipv6 = ipNet.IP.String()
+			}
+		}
 	}
+	return ipv4, ipv6, subnet
+}
 
-	// Measure service latencies
-	networkInfo.ServiceLatency = ServiceLatency{
-		Google:     measureServiceLatency("google.com"),
-		Amazon:     measureServiceLatency("amazon.com"),
-		Cloudflare: measureServiceLatency("cloudflare.com"),
-		Microsoft:  measureServiceLatency("microsoft.com"),
-		DNS:        measureDNSLatency(),
-		HTTP:       measureHTTPLatency(),
+// InterfaceStatus is the state of one interface, taken from a network snapshot
+// and the interface itself
+type InterfaceStatus struct {
+	Name       string          `json:"name"`
+	Active     bool            `json:"active"` // the interface the snapshot describes
+	Up         bool            `json:"up"`
+	MTU        int             `json:"mtu"`
+	MACAddress string          `json:"macAddress,omitempty"`
+	Addresses  []string        `json:"addresses"`
+	Rates      *InterfaceRates `json:"rates,omitempty"`
+	Neighbors  []ARPEntry      `json:"neighbors"`
+	Timestamp  time.Time       `json:"timestamp"`
+}
+
+// GetInterfaceStatus returns the state of an interface, with its rates and
+// neighbors from info
+func GetInterfaceStatus(info *NetworkInfo, name string) (*InterfaceStatus, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %v", name, err)
 	}
 
-	return networkInfo, nil
+	status := &InterfaceStatus{
+		Name:       name,
+		Active:     info.EthernetInfo.InterfaceName == name,
+		Up:         iface.Flags&net.FlagUp != 0,
+		MTU:        iface.MTU,
+		MACAddress: iface.HardwareAddr.String(),
+		Addresses:  []string{},
+		Neighbors:  []ARPEntry{},
+		Timestamp:  info.Timestamp,
+	}
+	if addrs, err := iface.Addrs(); err == nil {
+		for _, addr := range addrs {
+			status.Addresses = append(status.Addresses, addr.String())
+		}
+	}
+	if rates, ok := info.InterfaceRates[name]; ok {
+		status.Rates = &rates
+	}
+	for _, entry := range info.ARPEntries {
+		if entry.Device == name {
+			status.Neighbors = append(status.Neighbors, entry)
+		}
+	}
+	return status, nil
 }
 
 // GetARPTable retrieves the current ARP table using the modern 'ip neigh show' command
@@ -300,81 +520,6 @@ func getDefaultGateway() string {
 	return "N/A"
 }
 
-func getDNSServers() []string {
-	// Read DNS servers from /etc/resolv.conf
-	cmd := exec.Command("cat", "/etc/resolv.conf")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		return []string{"N/A"}
-	}
-
-	var servers []string
-	scanner := bufio.NewScanner(&out)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "nameserver") {
-			fields := strings.Fields(line)
-			if len(fields) >= 2 {
-				servers = append(servers, fields[1])
-			}
-		}
-	}
-
-	if len(servers) == 0 {
-		return []string{"N/A"}
-	}
-	return servers
-}
-
-func getDHCPServer() string {
-	// Try to get DHCP server from dhclient lease files
-	cmd := exec.Command("grep", "-l", "dhcp-server-identifier", "/var/lib/dhcp/dhclient*.leases", "/var/lib/dhcp/*.leases", "/var/lib/NetworkManager/*.lease")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		// Try another common location
-		cmd = exec.Command("grep", "DHCPSID=", "/var/lib/dhcpcd/*.info")
-		cmd.Stdout = &out
-		err = cmd.Run()
-		if err != nil {
-			return getDefaultGateway() // Fallback to gateway address
-		}
-	}
-
-	leaseFiles := strings.Fields(out.String())
-	if len(leaseFiles) == 0 {
-		return getDefaultGateway() // Fallback to gateway address
-	}
-
-	// Read the most recent lease file
-	mostRecentFile := leaseFiles[len(leaseFiles)-1]
-	cmd = exec.Command("grep", "dhcp-server-identifier", mostRecentFile)
-	out.Reset()
-	cmd.Stdout = &out
-	err = cmd.Run()
-	if err != nil {
-		return getDefaultGateway()
-	}
-
-	// Parse output like: "option dhcp-server-identifier 192.168.1.1;"
-	output := out.String()
-	if output == "" {
-		return getDefaultGateway()
-	}
-
-	fields := strings.Fields(output)
-	if len(fields) >= 3 {
-		// Remove trailing semicolon if present
-		serverIP := fields[len(fields)-1]
-		return strings.TrimSuffix(serverIP, ";")
-	}
-
-	return getDefaultGateway() // Fallback to gateway address
-}
-
 func getUptime() int64 {
 	// Read uptime from /proc/uptime
 	cmd := exec.Command("cat", "/proc/uptime")
@@ -558,83 +703,6 @@ func getSignalStrength(ifaceName string) int {
 	return signalInt
 }
 
-func getVLANID(ifaceName string) int {
-	// Extract VLAN ID from interface name (e.g., eth0.10 -> 10)
-	if idx := strings.LastIndex(ifaceName, "."); idx != -1 {
-		vlanStr := ifaceName[idx+1:]
-		vlanID, err := strconv.Atoi(vlanStr)
-		if err == nil {
-			return vlanID
-		}
-	}
-
-	// Try reading from sysfs
-	cmd := exec.Command("cat", "/proc/net/vlan/"+ifaceName)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err == nil {
-		output := out.String()
-		vlanIDIndex := strings.Index(output, "VID: ")
-		if vlanIDIndex != -1 {
-			vlanStr := strings.TrimSpace(output[vlanIDIndex+5:])
-			endIndex := strings.Index(vlanStr, " ")
-			if endIndex != -1 {
-				vlanStr = vlanStr[:endIndex]
-			}
-			vlanID, err := strconv.Atoi(vlanStr)
-			if err == nil {
-				return vlanID
-			}
-		}
-	}
-
-	return 0
-}
-
-// Stores the last measured network counter values for bandwidth calculation
-var (
-	lastMeasurementTime time.Time
-	lastBytesRecv       uint64
-	lastBytesSent       uint64
-	currentBandwidth    float64
-)
-
-func calculateBandwidth(counter psnet.IOCountersStat) float64 {
-	now := time.Now()
-
-	// Initialize on first call
-	if lastMeasurementTime.IsZero() {
-		lastMeasurementTime = now
-		lastBytesRecv = counter.BytesRecv
-		lastBytesSent = counter.BytesSent
-		return 0 // No history for calculation yet
-	}
-
-	// Calculate time difference in seconds
-	timeDiffSecs := now.Sub(lastMeasurementTime).Seconds()
-
-	// Avoid division by zero or negative time
-	if timeDiffSecs <= 0 {
-		return currentBandwidth // Return last known bandwidth
-	}
-
-	// Calculate bytes transferred since last measurement
-	bytesDiff := (counter.BytesRecv - lastBytesRecv) + (counter.BytesSent - lastBytesSent)
-
-	// Calculate bandwidth in Megabits per second (1 Byte = 8 bits)
-	// bytes/second * 8 / 1024 / 1024 = Mbps
-	bandwidth := float64(bytesDiff) * 8 / 1024 / 1024 / timeDiffSecs
-
-	// Update last values for next calculation
-	lastMeasurementTime = now
-	lastBytesRecv = counter.BytesRecv
-	lastBytesSent = counter.BytesSent
-	currentBandwidth = bandwidth
-
-	return bandwidth
-}
-
 func cidrToSubnet(ones int) string {
 	// Convert CIDR notation to subnet mask
 	// For example, /24 -> 255.255.255.0
@@ -651,148 +719,3 @@ func cidrToSubnet(ones int) string {
 		return "255.255.255.0" // Default
 	}
 }
-
-// MeasureDNSLatency pings a DNS server to measure latency
-func MeasureDNSLatency() float64 {
-	// For simplicity, we use the first DNS server from the list
-	dnsServers := getDNSServers()
-	if len(dnsServers) == 0 {
-		return 0
-	}
-
-	dnsServer := dnsServers[0]
-	cmd := exec.Command("ping", "-c", "3", "-W", "1", dnsServer)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		return 0
-	}
-
-	// Parse the output for average latency
-	output := out.String()
-	avgIndex := strings.Index(output, "min/avg/max/mdev")
-	if avgIndex == -1 {
-		return 0
-	}
-
-	statsLine := output[avgIndex:]
-	stats := strings.Split(statsLine, " ")
-	for _, stat := range stats {
-		if strings.Contains(stat, "/") {
-			values := strings.Split(stat, "/")
-			if len(values) >= 2 {
-				avgLatency, err := strconv.ParseFloat(values[1], 64)
-				if err == nil {
-					return avgLatency
-				}
-			}
-			break
-		}
-	}
-
-	return 0
-}
-
-// MeasureHTTPLatency measures latency to a public HTTP server
-func MeasureHTTPLatency() float64 {
-	httpServer := "http://www.google.com"
-
-	startTime := time.Now()
-	resp, err := http.Get(httpServer)
-	if err != nil {
-		return 0
-	}
-	defer resp.Body.Close()
-
-	// Measure time taken to get response
-	elapsed := time.Since(startTime).Seconds() * 1000 // Convert to ms
-	return elapsed
-}
-
-// measureServiceLatency measures latency to a service by hostname
-func measureServiceLatency(hostname string) float64 {
-	// Use ping with a timeout to avoid hanging
-	cmd := exec.Command("ping", "-c", "1", "-w", "2", hostname)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-
-	// Execute ping command
-	err := cmd.Run()
-	if err != nil {
-		return 0
-	}
-
-	// Parse the output for average latency
-	output := out.String()
-
-	// Try to parse the time from the first successful ping
-	timePattern := regexp.MustCompile(`time=(\d+\.?\d*) ms`)
-	matches := timePattern.FindStringSubmatch(output)
-	if len(matches) > 1 {
-		latency, err := strconv.ParseFloat(matches[1], 64)
-		if err == nil {
-			return latency
-		}
-	}
-
-	// Fallback to traditional min/avg/max parsing
-	avgIndex := strings.Index(output, "min/avg/max/mdev")
-	if avgIndex == -1 {
-		return 0
-	}
-
-	statsLine := output[avgIndex:]
-	stats := strings.Split(statsLine, " ")
-	for _, stat := range stats {
-		if strings.Contains(stat, "/") {
-			values := strings.Split(stat, "/")
-			if len(values) >= 2 {
-				avgLatency, err := strconv.ParseFloat(values[1], 64)
-				if err == nil {
-					return avgLatency
-				}
-			}
-			break
-		}
-	}
-
-	return 0
-}
-
-// measureDNSLatency measures DNS resolution latency
-func measureDNSLatency() float64 {
-	startTime := time.Now()
-	_, err := net.LookupHost("www.google.com")
-	if err != nil {
-		return 0
-	}
-	elapsed := time.Since(startTime)
-	return float64(elapsed.Milliseconds())
-}
-
-// measureHTTPLatency measures HTTP connection latency
-func measureHTTPLatency() float64 {
-	httpServer := "https://www.google.com"
-
-	// Create a client with a timeout to avoid hanging
-	client := &http.Client{
-		Timeout: 3 * time.Second,
-	}
-
-	startTime := time.Now()
-	resp, err := client.Get(httpServer)
-	if err != nil {
-		// Try a fallback if the first one fails
-		httpServer = "https://www.cloudflare.com"
-		startTime = time.Now()
-		resp, err = client.Get(httpServer)
-		if err != nil {
-			return 0
-		}
-	}
-	defer resp.Body.Close()
-
-	elapsed := time.Since(startTime)
-	return float64(elapsed.Milliseconds())
-}
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// InterfaceRates holds per-second rates derived from two counter samples of one interface
+type InterfaceRates struct {
+	Interface      string    `json:"interface"`
+	RxBps          float64   `json:"rxBps"` // bits per second
+	TxBps          float64   `json:"txBps"`
+	RxPps          float64   `json:"rxPps"` // packets per second
+	TxPps          float64   `json:"txPps"`
+	RxErrorsPerSec float64   `json:"rxErrorsPerSec"`
+	TxErrorsPerSec float64   `json:"txErrorsPerSec"`
+	RxDropsPerSec  float64   `json:"rxDropsPerSec"`
+	TxDropsPerSec  float64   `json:"txDropsPerSec"`
+	RxFifoPerSec   float64   `json:"rxFifoPerSec"` // overruns
+	TxFifoPerSec   float64   `json:"txFifoPerSec"`
+	IntervalSec    float64   `json:"intervalSec"`
+	Reset          bool      `json:"reset"` // Counters were reset or the interface re-created; rates restart next sample
+	SampledAt      time.Time `json:"sampledAt"`
+}
+
+// counterSample is the last raw counter reading of an interface
+type counterSample struct {
+	index     int
+	linkSpeed float64 // bits per second, 0 when the driver does not report it
+	at        time.Time
+	counters  psnet.IOCountersStat
+}
+
+// fallbackLinkSpeed bounds a counter wrap on interfaces that report no link
+// speed (wireless, bridges, tunnels), in bits per second
+const fallbackLinkSpeed = 100e9
+
+// minFrameSize is the smallest Ethernet frame, which bounds the packet rate at a link speed
+const minFrameSize = 64
+
+// RateTracker turns cumulative interface counters into rates. Each interface
+// keeps its own baseline, so callers sampling different interfaces or at
+// different times do not disturb each other.
+type RateTracker struct {
+	last  map[string]counterSample
+	rates map[string]InterfaceRates
+	mu    sync.Mutex
+}
+
+// NewRateTracker creates an empty rate tracker
+func NewRateTracker() *RateTracker {
+	return &RateTracker{
+		last:  make(map[string]counterSample),
+		rates: make(map[string]InterfaceRates),
+	}
+}
+
+// Update records a counter sample for every interface and returns the rates
+// since the previous sample. Interfaces missing from the sample are forgotten.
+func (rt *RateTracker) Update(counters []psnet.IOCountersStat, now time.Time) map[string]InterfaceRates {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	seen := make(map[string]bool, len(counters))
+	for _, c := range counters {
+		seen[c.Name] = true
+
+		index := 0
+		if iface, err := net.InterfaceByName(c.Name); err == nil {
+			index = iface.Index
+		}
+		current := counterSample{index: index, linkSpeed: linkSpeed(c.Name), at: now, counters: c}
+		previous, ok := rt.last[c.Name]
+		rt.last[c.Name] = current
+
+		rates := InterfaceRates{Interface: c.Name, SampledAt: now}
+		switch {
+		case !ok:
+			// First sample is only a baseline
+		case previous.index != index:
+			// Same name, new interface: its counters started from zero
+			rates.Reset = true
+		default:
+			rates = computeRates(previous, current)
+		}
+		rt.rates[c.Name] = rates
+	}
+
+	for name := range rt.last {
+		if !seen[name] {
+			delete(rt.last, name)
+			delete(rt.rates, name)
+		}
+	}
+
+	result := make(map[string]InterfaceRates, len(rt.rates))
+	for name, rates := range rt.rates {
+		result[name] = rates
+	}
+	return result
+}
+
+// linkSpeed reads an interface's link speed from sysfs in bits per second,
+// or 0 when it is unknown
+func linkSpeed(name string) float64 {
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", name, "speed"))
+	if err != nil {
+		return 0
+	}
+	mbps, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || mbps <= 0 {
+		return 0
+	}
+	return float64(mbps) * 1e6
+}
+
+// computeRates derives rates between two samples of the same interface
+func computeRates(previous, current counterSample) InterfaceRates {
+	rates := InterfaceRates{Interface: current.counters.Name, SampledAt: current.at}
+
+	elapsed := current.at.Sub(previous.at).Seconds()
+	if elapsed <= 0 {
+		return rates
+	}
+	rates.IntervalSec = elapsed
+
+	// A wrap is only believable if the link could have carried the wrapped
+	// delta in the interval; packet, error and drop counts are bounded by
+	// minimum sized frames
+	speed := current.linkSpeed
+	if speed <= 0 {
+		speed = fallbackLinkSpeed
+	}
+	byteLimit := uint64(speed / 8 * elapsed)
+	packetLimit := byteLimit / minFrameSize
+
+	p, c := previous.counters, current.counters
+	reset := false
+	rate := func(prev, cur, limit uint64) float64 {
+		d, ok := counterDelta(prev, cur, limit)
+		if !ok {
+			reset = true
+			return 0
+		}
+		return float64(d) / elapsed
+	}
+
+	rates.RxBps = rate(p.BytesRecv, c.BytesRecv, byteLimit) * 8
+	rates.TxBps = rate(p.BytesSent, c.BytesSent, byteLimit) * 8
+	rates.RxPps = rate(p.PacketsRecv, c.PacketsRecv, packetLimit)
+	rates.TxPps = rate(p.PacketsSent, c.PacketsSent, packetLimit)
+	rates.RxErrorsPerSec = rate(p.Errin, c.Errin, packetLimit)
+	rates.TxErrorsPerSec = rate(p.Errout, c.Errout, packetLimit)
+	rates.RxDropsPerSec = rate(p.Dropin, c.Dropin, packetLimit)
+	rates.TxDropsPerSec = rate(p.Dropout, c.Dropout, packetLimit)
+	rates.RxFifoPerSec = rate(p.Fifoin, c.Fifoin, packetLimit)
+	rates.TxFifoPerSec = rate(p.Fifoout, c.Fifoout, packetLimit)
+
+	// A reset in any counter makes the whole sample unreliable
+	if reset {
+		rates = InterfaceRates{Interface: c.Name, SampledAt: current.at, IntervalSec: elapsed, Reset: true}
+	}
+	return rates
+}
+
+// counterDelta returns cur-prev, allowing for a 32-bit counter wrapping once
+// when the wrapped delta is no more than limit. It reports false when the
+// counter went backwards in a way that can only be a reset.
+func counterDelta(prev, cur, limit uint64) (uint64, bool) {
+	if cur >= prev {
+		return cur - prev, true
+	}
+	// Drivers with 32-bit counters wrap at 2^32
+	if prev <= math.MaxUint32 {
+		if wrapped := (math.MaxUint32 - prev) + cur + 1; wrapped <= limit {
+			return wrapped, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint64
+		limit     uint64
+		delta     uint64
+		ok        bool
+	}{
+		{"forward", 1000, 1500, 100, 500, true},
+		{"32-bit wrap within the limit", math.MaxUint32 - 99, 400, 1000, 500, true},
+		{"32-bit wrap beyond the limit is a reset", math.MaxUint32 - 99, 400, 499, 0, false},
+		{"small counter going back is a reset", 5000, 10, 1 << 20, 0, false},
+		{"64-bit counter going back is a reset", math.MaxUint32 + 5000, 10, math.MaxUint64, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, ok := counterDelta(tt.prev, tt.cur, tt.limit)
+			if delta != tt.delta || ok != tt.ok {
+				t.Errorf("counterDelta(%d, %d, %d) = %d, %v; want %d, %v", tt.prev, tt.cur, tt.limit, delta, ok, tt.delta, tt.ok)
+			}
+		})
+	}
+}
+
+func TestComputeRates(t *testing.T) {
+	start := time.Date(2025, 6, 11, 8, 0, 0, 0, time.UTC)
+	sample := func(at time.Time, speed float64, bytes, packets uint64) counterSample {
+		return counterSample{linkSpeed: speed, at: at, counters: psnet.IOCountersStat{
+			Name: "eth0", BytesRecv: bytes, PacketsRecv: packets,
+		}}
+	}
+
+	// 1 MB and 1000 packets in 2 s, with the byte counter wrapping on the way
+	rates := computeRates(
+		sample(start, 1e9, math.MaxUint32-499_999, 5000),
+		sample(start.Add(2*time.Second), 1e9, 500_000, 6000),
+	)
+	if rates.Reset || rates.IntervalSec != 2 || rates.RxBps != 4e6 || rates.RxPps != 500 {
+		t.Errorf("wrapped rates = %+v, want 4 Mbit/s and 500 packets/s", rates)
+	}
+
+	// Packets going back by a few thousand on a 1 Gbit/s link cannot be a wrap
+	rates = computeRates(
+		sample(start, 1e9, 1_000_000, 6000),
+		sample(start.Add(2*time.Second), 1e9, 1_200_000, 100),
+	)
+	if !rates.Reset || rates.RxBps != 0 || rates.RxPps != 0 {
+		t.Errorf("reset rates = %+v, want a reset with zero rates", rates)
+	}
+}
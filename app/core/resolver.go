@@ -0,0 +1,398 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ResolverInfo describes how name resolution is actually configured on the host
+type ResolverInfo struct {
+	ResolvConf      string          `json:"resolvConf"`
+	Nameservers     []string        `json:"nameservers"` // As listed in resolv.conf
+	Search          []string        `json:"search,omitempty"`
+	Options         ResolverOptions `json:"options"`
+	StubResolver    bool            `json:"stubResolver"` // resolv.conf points at a local stub (127.0.0.53)
+	SystemdResolved bool            `json:"systemdResolved"`
+	ResolvConfMode  string          `json:"resolvConfMode,omitempty"`
+	Upstream        []string        `json:"upstream"` // Effective upstream resolvers
+	Global          LinkDNS         `json:"global"`
+	Links           []LinkDNS       `json:"links,omitempty"`
+	NSSwitchHosts   []string        `json:"nsswitchHosts,omitempty"`
+}
+
+// ResolverOptions holds the "options" line of resolv.conf with glibc defaults applied
+type ResolverOptions struct {
+	Ndots    int      `json:"ndots"`
+	Timeout  int      `json:"timeout"` // seconds
+	Attempts int      `json:"attempts"`
+	Rotate   bool     `json:"rotate"`
+	EDNS0    bool     `json:"edns0"`
+	TrustAD  bool     `json:"trustAd"`
+	Raw      []string `json:"raw,omitempty"`
+}
+
+// LinkDNS is the DNS configuration systemd-resolved applies globally or to one link
+type LinkDNS struct {
+	Interface     string   `json:"interface,omitempty"`
+	CurrentServer string   `json:"currentServer,omitempty"`
+	Servers       []string `json:"servers,omitempty"`
+	Domains       []string `json:"domains,omitempty"`
+	DefaultRoute  bool     `json:"defaultRoute"`
+	DNSSEC        string   `json:"dnssec,omitempty"`
+	DNSOverTLS    string   `json:"dnsOverTls,omitempty"`
+	LLMNR         string   `json:"llmnr,omitempty"`
+	MulticastDNS  string   `json:"mdns,omitempty"`
+}
+
+// Locations of the resolver configuration files
+var (
+	resolvConfPath       = "/etc/resolv.conf"
+	resolvedUpstreamPath = "/run/systemd/resolve/resolv.conf"
+	resolvedRuntimeDir   = "/run/systemd/resolve"
+	resolvedConfPath     = "/etc/systemd/resolved.conf"
+	networkdLinksDir     = "/run/systemd/netif/links"
+	nsswitchPath         = "/etc/nsswitch.conf"
+)
+
+// GetResolverInfo collects the resolver configuration from resolv.conf,
+// systemd-resolved and nsswitch.conf
+func GetResolverInfo() ResolverInfo {
+	info := ResolverInfo{
+		ResolvConf: resolvConfPath,
+		Options:    ResolverOptions{Ndots: 1, Timeout: 5, Attempts: 2},
+	}
+
+	if f, err := os.Open(resolvConfPath); err == nil {
+		parseResolvConf(f, &info)
+		f.Close()
+	}
+
+	for _, server := range info.Nameservers {
+		if ip := net.ParseIP(server); ip != nil && ip.IsLoopback() {
+			info.StubResolver = true
+		}
+	}
+
+	if _, err := os.Stat(resolvedRuntimeDir); err == nil {
+		info.SystemdResolved = true
+		collectResolvedState(&info)
+	}
+
+	// Without a local stub the servers in resolv.conf are the upstream ones
+	if len(info.Upstream) == 0 && !info.StubResolver {
+		info.Upstream = info.Nameservers
+	}
+
+	if f, err := os.Open(nsswitchPath); err == nil {
+		info.NSSwitchHosts = ParseNSSwitchHosts(f)
+		f.Close()
+	}
+
+	return info
+}
+
+// EffectiveServers returns the upstream resolvers, or "N/A" if none are known
+func (r ResolverInfo) EffectiveServers() []string {
+	if len(r.Upstream) == 0 {
+		return []string{"N/A"}
+	}
+	return r.Upstream
+}
+
+// collectResolvedState fills in upstream, global and per-link settings from systemd-resolved
+func collectResolvedState(info *ResolverInfo) {
+	// resolved writes the real upstream servers to a second resolv.conf
+	if f, err := os.Open(resolvedUpstreamPath); err == nil {
+		var upstream ResolverInfo
+		parseResolvConf(f, &upstream)
+		f.Close()
+		info.Upstream = upstream.Nameservers
+	}
+
+	// resolvectl reports links configured by any manager, including NetworkManager
+	cmd := exec.Command("resolvectl", "status", "--no-pager")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err == nil {
+		global, links, mode := ParseResolvectlStatus(&out)
+		info.Global = global
+		info.Links = links
+		info.ResolvConfMode = mode
+	} else {
+		// Fall back to the state files systemd-networkd shares with resolved
+		info.Global = readResolvedConf()
+		info.Links = readNetworkdLinks()
+	}
+
+	// Upstream list from the links if resolved did not write its own resolv.conf
+	if len(info.Upstream) == 0 {
+		seen := make(map[string]bool)
+		for _, link := range append([]LinkDNS{info.Global}, info.Links...) {
+			for _, server := range link.Servers {
+				if !seen[server] {
+					seen[server] = true
+					info.Upstream = append(info.Upstream, server)
+				}
+			}
+		}
+	}
+}
+
+// parseResolvConf reads nameserver, search/domain and options lines
+func parseResolvConf(r io.Reader, info *ResolverInfo) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			info.Nameservers = append(info.Nameservers, fields[1])
+		case "search", "domain":
+			// The last search/domain line wins
+			info.Search = fields[1:]
+		case "options":
+			for _, opt := range fields[1:] {
+				info.Options.Raw = append(info.Options.Raw, opt)
+				name, value, _ := strings.Cut(opt, ":")
+				n, _ := strconv.Atoi(value)
+				switch name {
+				case "ndots":
+					info.Options.Ndots = n
+				case "timeout":
+					info.Options.Timeout = n
+				case "attempts":
+					info.Options.Attempts = n
+				case "rotate":
+					info.Options.Rotate = true
+				case "edns0":
+					info.Options.EDNS0 = true
+				case "trust-ad":
+					info.Options.TrustAD = true
+				}
+			}
+		}
+	}
+}
+
+var (
+	resolvectlLinkHeader = regexp.MustCompile(`^Link \d+ \(([^)]+)\)`)
+	resolvectlKeyLine    = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z .]*):(?:\s+(.*))?$`)
+)
+
+// ParseResolvectlStatus parses the output of "resolvectl status" into the global
+// settings, the per-link settings and the resolv.conf mode
+func ParseResolvectlStatus(r io.Reader) (LinkDNS, []LinkDNS, string) {
+	var global LinkDNS
+	var links []LinkDNS
+	var mode string
+	var current *LinkDNS
+	lastKey := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Section headers; the longest keys are not indented either
+		if line == "Global" {
+			current = &global
+			lastKey = ""
+			continue
+		}
+		if m := resolvectlLinkHeader.FindStringSubmatch(line); m != nil {
+			links = append(links, LinkDNS{Interface: m[1]})
+			current = &links[len(links)-1]
+			lastKey = ""
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		key, value := "", strings.TrimSpace(line)
+		if m := resolvectlKeyLine.FindStringSubmatch(line); m != nil {
+			key, value = m[1], strings.TrimSpace(m[2])
+			lastKey = key
+		} else {
+			// Continuation of a wrapped list
+			key = lastKey
+		}
+
+		switch key {
+		case "Current DNS Server":
+			current.CurrentServer = value
+		case "DNS Servers":
+			current.Servers = append(current.Servers, strings.Fields(value)...)
+		case "DNS Domain":
+			current.Domains = append(current.Domains, strings.Fields(value)...)
+		case "resolv.conf mode":
+			mode = value
+		case "Protocols":
+			applyResolvedProtocols(current, strings.Fields(value))
+		case "DNSSEC setting":
+			current.DNSSEC = value
+		case "DNSOverTLS setting":
+			current.DNSOverTLS = value
+		case "LLMNR setting":
+			current.LLMNR = value
+		case "MulticastDNS setting":
+			current.MulticastDNS = value
+		case "DefaultRoute setting":
+			current.DefaultRoute = value == "yes"
+		}
+	}
+
+	return global, links, mode
+}
+
+// applyResolvedProtocols interprets tokens like "+DefaultRoute -mDNS DNSSEC=no/unsupported"
+func applyResolvedProtocols(link *LinkDNS, tokens []string) {
+	for _, token := range tokens {
+		if name, value, ok := strings.Cut(token, "="); ok {
+			if name == "DNSSEC" {
+				link.DNSSEC = value
+			}
+			continue
+		}
+		if len(token) < 2 {
+			continue
+		}
+		state := "no"
+		if token[0] == '+' {
+			state = "yes"
+		}
+		switch token[1:] {
+		case "DefaultRoute":
+			link.DefaultRoute = state == "yes"
+		case "DNSOverTLS":
+			link.DNSOverTLS = state
+		case "LLMNR":
+			link.LLMNR = state
+		case "mDNS":
+			link.MulticastDNS = state
+		}
+	}
+}
+
+// readResolvedConf reads the [Resolve] section of resolved.conf and its drop-ins
+func readResolvedConf() LinkDNS {
+	global := LinkDNS{DefaultRoute: true}
+	paths := []string{resolvedConfPath}
+	dropIns, _ := filepath.Glob(resolvedConfPath + ".d/*.conf")
+	paths = append(paths, dropIns...)
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		section := ""
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "[") {
+				section = strings.Trim(line, "[]")
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if section != "Resolve" || !ok || strings.HasPrefix(line, "#") {
+				continue
+			}
+			switch key {
+			case "DNS":
+				global.Servers = strings.Fields(value)
+			case "Domains":
+				global.Domains = strings.Fields(value)
+			case "DNSSEC":
+				global.DNSSEC = value
+			case "DNSOverTLS":
+				global.DNSOverTLS = value
+			case "LLMNR":
+				global.LLMNR = value
+			case "MulticastDNS":
+				global.MulticastDNS = value
+			}
+		}
+		f.Close()
+	}
+	return global
+}
+
+// readNetworkdLinks reads the per-link DNS state systemd-networkd publishes for resolved
+func readNetworkdLinks() []LinkDNS {
+	entries, err := os.ReadDir(networkdLinksDir)
+	if err != nil {
+		return nil
+	}
+
+	var links []LinkDNS
+	for _, entry := range entries {
+		index, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		f, err := os.Open(filepath.Join(networkdLinksDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		values := parseKeyValues(f)
+		f.Close()
+
+		if values["DNS"] == "" && values["DOMAINS"] == "" {
+			continue
+		}
+		links = append(links, LinkDNS{
+			Interface:    interfaceName(index),
+			Servers:      strings.Fields(values["DNS"]),
+			Domains:      strings.Fields(values["DOMAINS"]),
+			DefaultRoute: values["DNS_DEFAULT_ROUTE"] != "no",
+			DNSSEC:       values["DNSSEC"],
+			DNSOverTLS:   values["DNS_OVER_TLS"],
+			LLMNR:        values["LLMNR"],
+			MulticastDNS: values["MDNS"],
+		})
+	}
+	return links
+}
+
+// ParseNSSwitchHosts returns the sources of the "hosts:" database in lookup order
+func ParseNSSwitchHosts(r io.Reader) []string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "hosts:") {
+			continue
+		}
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		return strings.Fields(strings.TrimPrefix(line, "hosts:"))
+	}
+	return nil
+}
+
+// interfaceName resolves an interface index to its name
+func interfaceName(index int) string {
+	if iface, err := net.InterfaceByIndex(index); err == nil {
+		return iface.Name
+	}
+	return fmt.Sprintf("if%d", index)
+}
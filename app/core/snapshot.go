@@ -0,0 +1,231 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Collector gathers one section of the network snapshot on its own schedule.
+// Collect must be safe to call concurrently with the other collectors; Apply
+// copies a collected value into a NetworkInfo.
+type Collector struct {
+	Name     string
+	Interval time.Duration
+	Timeout  time.Duration
+	Collect  func() (interface{}, error)
+	Apply    func(info *NetworkInfo, value interface{})
+}
+
+// SectionStatus reports how fresh one section of a snapshot is
+type SectionStatus struct {
+	UpdatedAt  time.Time `json:"updatedAt"`
+	AgeMS      int64     `json:"ageMs"`
+	DurationMS float64   `json:"durationMs"`
+	IntervalMS int64     `json:"intervalMs"`
+	Stale      bool      `json:"stale"` // No value yet, or older than two intervals
+	Error      string    `json:"error,omitempty"`
+}
+
+// section holds the cached state of one collector
+type section struct {
+	collector Collector
+	value     interface{}
+	hasValue  bool
+	updatedAt time.Time
+	duration  time.Duration
+	err       error
+	done      chan struct{} // Non-nil while a collection is in flight
+}
+
+// SnapshotCollector runs collectors concurrently on their own intervals and
+// caches their results, so snapshots can be assembled without waiting on probes
+type SnapshotCollector struct {
+	sections []*section
+	byName   map[string]*section
+	stop     chan struct{}
+	mu       sync.RWMutex
+}
+
+// NewSnapshotCollector creates a snapshot collector for the given collectors
+func NewSnapshotCollector(collectors []Collector) *SnapshotCollector {
+	sc := &SnapshotCollector{byName: make(map[string]*section)}
+	for _, c := range collectors {
+		s := &section{collector: c}
+		sc.sections = append(sc.sections, s)
+		sc.byName[c.Name] = s
+	}
+	return sc
+}
+
+// Start begins refreshing every section in the background
+func (sc *SnapshotCollector) Start() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.stop != nil {
+		return
+	}
+	sc.stop = make(chan struct{})
+	for _, s := range sc.sections {
+		go sc.loop(s, sc.stop)
+	}
+}
+
+// Stop halts the background refresh
+func (sc *SnapshotCollector) Stop() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.stop != nil {
+		close(sc.stop)
+		sc.stop = nil
+	}
+}
+
+// loop refreshes a section on its interval
+func (sc *SnapshotCollector) loop(s *section, stop chan struct{}) {
+	ticker := time.NewTicker(s.collector.Interval)
+	defer ticker.Stop()
+
+	for {
+		sc.run(s)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh collects the named sections (all of them if none are named)
+// concurrently and waits until each has finished or hit its deadline
+func (sc *SnapshotCollector) Refresh(names ...string) {
+	targets := sc.sections
+	if len(names) > 0 {
+		targets = nil
+		for _, name := range names {
+			if s, ok := sc.byName[name]; ok {
+				targets = append(targets, s)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range targets {
+		wg.Add(1)
+		go func(s *section) {
+			defer wg.Done()
+			sc.run(s)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// run collects a section once, waiting at most for its timeout. A collection
+// already in flight is joined rather than started again, and a late result is
+// still cached when it eventually arrives.
+func (sc *SnapshotCollector) run(s *section) {
+	sc.mu.Lock()
+	done := s.done
+	if done == nil {
+		done = make(chan struct{})
+		s.done = done
+		go sc.collect(s, done)
+	}
+	sc.mu.Unlock()
+
+	timer := time.NewTimer(s.collector.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		sc.mu.Lock()
+		if s.done == done {
+			s.err = fmt.Errorf("timed out after %v", s.collector.Timeout)
+		}
+		sc.mu.Unlock()
+	}
+}
+
+// collect calls the collector and stores its result
+func (sc *SnapshotCollector) collect(s *section, done chan struct{}) {
+	start := time.Now()
+	value, err := s.collector.Collect()
+	elapsed := time.Since(start)
+
+	sc.mu.Lock()
+	s.duration = elapsed
+	s.err = err
+	if err == nil {
+		s.value = value
+		s.hasValue = true
+		s.updatedAt = time.Now()
+	}
+	s.done = nil
+	sc.mu.Unlock()
+
+	close(done)
+}
+
+// Snapshot assembles a NetworkInfo from the cached section values
+func (sc *SnapshotCollector) Snapshot() *NetworkInfo {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	now := time.Now()
+	info := &NetworkInfo{
+		Sections:  make(map[string]SectionStatus, len(sc.sections)),
+		Timestamp: now,
+	}
+
+	for _, s := range sc.sections {
+		status := SectionStatus{
+			DurationMS: float64(s.duration.Microseconds()) / 1000,
+			IntervalMS: s.collector.Interval.Milliseconds(),
+			Stale:      !s.hasValue,
+		}
+		if s.err != nil {
+			status.Error = s.err.Error()
+		}
+		if s.hasValue {
+			s.collector.Apply(info, s.value)
+			status.UpdatedAt = s.updatedAt
+			status.AgeMS = now.Sub(s.updatedAt).Milliseconds()
+			status.Stale = now.Sub(s.updatedAt) > 2*s.collector.Interval
+		}
+		info.Sections[s.collector.Name] = status
+	}
+
+	return info
+}
+
+// Err returns the last error of the named section
+func (sc *SnapshotCollector) Err(name string) error {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	if s, ok := sc.byName[name]; ok {
+		return s.err
+	}
+	return nil
+}
+
+// EventSections returns the snapshot sections affected by a network event
+func EventSections(event NetworkEvent) []string {
+	switch event.Type {
+	case EventLinkUp, EventLinkDown:
+		return []string{"interface", "traffic", "wireless", "gateway", "resolver", "dhcp", "connectivity"}
+	case EventAddressAdded, EventAddressRemoved:
+		return []string{"interface", "resolver", "dhcp", "connectivity"}
+	case EventDefaultRouteChange:
+		return []string{"gateway", "connectivity"}
+	case EventDHCPRenewal:
+		return []string{"dhcp"}
+	case EventNeighborNew:
+		return []string{"arp"}
+	}
+	return nil
+}
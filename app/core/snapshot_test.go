@@ -0,0 +1,158 @@
+package core
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ssidCollector returns a collector that stores collect's result as the SSID
+func ssidCollector(name string, interval, timeout time.Duration, collect func() (interface{}, error)) Collector {
+	return Collector{
+		Name:     name,
+		Interval: interval,
+		Timeout:  timeout,
+		Collect:  collect,
+		Apply:    func(info *NetworkInfo, value interface{}) { info.SSID = value.(string) },
+	}
+}
+
+// blocker is a collector body that hangs until released
+type blocker struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+// newBlocker creates a blocker that is released when the test ends
+func newBlocker(t *testing.T) *blocker {
+	t.Helper()
+	b := &blocker{release: make(chan struct{})}
+	t.Cleanup(func() {
+		select {
+		case <-b.release:
+		default:
+			close(b.release)
+		}
+	})
+	return b
+}
+
+func (b *blocker) collect() (interface{}, error) {
+	b.calls.Add(1)
+	<-b.release
+	return "slow", nil
+}
+
+func TestSlowCollectorDoesNotDelayFast(t *testing.T) {
+	slow := newBlocker(t)
+	var fastCalls atomic.Int32
+	sc := NewSnapshotCollector([]Collector{
+		ssidCollector("slow", 10*time.Millisecond, time.Hour, slow.collect),
+		ssidCollector("fast", 10*time.Millisecond, time.Second, func() (interface{}, error) {
+			fastCalls.Add(1)
+			return "fast", nil
+		}),
+	})
+
+	// Refreshing one section does not wait for another
+	start := time.Now()
+	sc.Refresh("fast")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("refreshing the fast section took %v", elapsed)
+	}
+
+	// Nor do the background loops: the fast section keeps refreshing while
+	// the slow one hangs
+	sc.Start()
+	defer sc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	if n := fastCalls.Load(); n < 4 {
+		t.Errorf("fast collector ran %d times in 100ms with a 10ms interval", n)
+	}
+	if n := slow.calls.Load(); n != 1 {
+		t.Errorf("slow collector started %d times, want its one hung collection joined", n)
+	}
+
+	info := sc.Snapshot()
+	if info.SSID != "fast" || info.Sections["fast"].Stale {
+		t.Errorf("fast section = %+v with SSID %q, want fresh", info.Sections["fast"], info.SSID)
+	}
+	if status := info.Sections["slow"]; !status.Stale || !status.UpdatedAt.IsZero() {
+		t.Errorf("slow section = %+v, want stale without a value", status)
+	}
+}
+
+func TestCollectorTimeoutKeepsLastValue(t *testing.T) {
+	hang := newBlocker(t)
+	var calls atomic.Int32
+	sc := NewSnapshotCollector([]Collector{
+		ssidCollector("wireless", time.Hour, 20*time.Millisecond, func() (interface{}, error) {
+			if calls.Add(1) == 1 {
+				return "office", nil
+			}
+			return hang.collect()
+		}),
+	})
+
+	sc.Refresh()
+	first := sc.Snapshot().Sections["wireless"]
+	if sc.Err("wireless") != nil || first.UpdatedAt.IsZero() {
+		t.Fatalf("first collection = %+v, %v", first, sc.Err("wireless"))
+	}
+
+	start := time.Now()
+	sc.Refresh()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("refresh waited %v for a collector with a 20ms timeout", elapsed)
+	}
+	if err := sc.Err("wireless"); err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Errorf("error = %v, want a timeout", err)
+	}
+	info := sc.Snapshot()
+	status := info.Sections["wireless"]
+	if info.SSID != "office" || !status.UpdatedAt.Equal(first.UpdatedAt) {
+		t.Errorf("SSID %q updated %v, want the cached office from %v", info.SSID, status.UpdatedAt, first.UpdatedAt)
+	}
+	if !strings.Contains(status.Error, "timed out") {
+		t.Errorf("section error = %q, want the timeout", status.Error)
+	}
+
+	// The late result is cached once it arrives and clears the error
+	close(hang.release)
+	deadline := time.Now().Add(time.Second)
+	for sc.Snapshot().SSID != "slow" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	info = sc.Snapshot()
+	if info.SSID != "slow" || info.Sections["wireless"].Error != "" {
+		t.Errorf("after the late result: SSID %q section %+v", info.SSID, info.Sections["wireless"])
+	}
+}
+
+func TestSnapshotReportsSectionAge(t *testing.T) {
+	sc := NewSnapshotCollector([]Collector{
+		ssidCollector("wireless", 10*time.Millisecond, time.Second, func() (interface{}, error) {
+			time.Sleep(5 * time.Millisecond)
+			return "office", nil
+		}),
+		ssidCollector("never", time.Minute, time.Second, func() (interface{}, error) { return "", nil }),
+	})
+
+	sc.Refresh("wireless")
+	fresh := sc.Snapshot().Sections["wireless"]
+	if fresh.AgeMS >= 50 || fresh.IntervalMS != 10 || fresh.DurationMS < 5 {
+		t.Errorf("fresh section = %+v, want younger than 50ms, a 10ms interval and at least 5ms duration", fresh)
+	}
+
+	// Older than two intervals is stale, and the age grows from the last success
+	time.Sleep(50 * time.Millisecond)
+	old := sc.Snapshot().Sections["wireless"]
+	if !old.Stale || old.AgeMS < 50 || !old.UpdatedAt.Equal(fresh.UpdatedAt) {
+		t.Errorf("old section = %+v, want stale and at least 50ms old", old)
+	}
+
+	if never := sc.Snapshot().Sections["never"]; !never.Stale || never.AgeMS != 0 || !never.UpdatedAt.IsZero() {
+		t.Errorf("uncollected section = %+v, want stale with no age", never)
+	}
+}
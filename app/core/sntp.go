@@ -0,0 +1,193 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// SNTPSample is the outcome of one request to an NTP server
+type SNTPSample struct {
+	OffsetMS float64 `json:"offsetMs"` // positive when the local clock is ahead
+	DelayMS  float64 `json:"delayMs"`  // round trip minus the server's processing time
+	Error    string  `json:"error,omitempty"`
+}
+
+// SNTPResult is what an NTP server reported, from the sample with the lowest delay
+type SNTPResult struct {
+	Server           string       `json:"server"`
+	Address          string       `json:"address"`
+	Stratum          int          `json:"stratum"`
+	ReferenceID      string       `json:"referenceId"`
+	Leap             int          `json:"leap"` // 0 none, 1 insert, 2 delete, 3 unsynchronized
+	Version          int          `json:"version"`
+	OffsetMS         float64      `json:"offsetMs"`
+	DelayMS          float64      `json:"delayMs"`
+	RootDelayMS      float64      `json:"rootDelayMs"`
+	RootDispersionMS float64      `json:"rootDispersionMs"`
+	ServerTime       time.Time    `json:"serverTime"`
+	Samples          []SNTPSample `json:"samples"`
+}
+
+// ntpEpochOffset is the number of seconds between 1900 (NTP) and 1970 (Unix)
+const ntpEpochOffset = 2208988800
+
+// sntpPacketSize is the size of an NTP packet without extensions
+const sntpPacketSize = 48
+
+// errKissOfDeath is returned when a server tells the client to stop asking
+var errKissOfDeath = errors.New("server sent a kiss-of-death")
+
+// QuerySNTP measures the local clock against an NTP server, as "host" or
+// "host:port", sending count requests and keeping the one with the lowest
+// delay. Offset and delay follow RFC 4330.
+func QuerySNTP(server string, count int, timeout time.Duration) (*SNTPResult, error) {
+	if count < 1 {
+		count = 1
+	}
+	address := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		address = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %v", server, err)
+	}
+	defer conn.Close()
+
+	var best *SNTPResult
+	samples := make([]SNTPSample, 0, count)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			// Servers may rate limit clients that ask more often than this
+			time.Sleep(500 * time.Millisecond)
+		}
+		result, err := sntpExchange(conn, timeout)
+		if err != nil {
+			samples = append(samples, SNTPSample{Error: err.Error()})
+			if errors.Is(err, errKissOfDeath) {
+				break
+			}
+			continue
+		}
+		samples = append(samples, SNTPSample{OffsetMS: result.OffsetMS, DelayMS: result.DelayMS})
+		if best == nil || result.DelayMS < best.DelayMS {
+			best = result
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no valid reply from %s: %s", server, samples[len(samples)-1].Error)
+	}
+	best.Server = server
+	best.Address = conn.RemoteAddr().String()
+	best.Samples = samples
+	return best, nil
+}
+
+// sntpExchange sends one client request and decodes the reply
+func sntpExchange(conn net.Conn, timeout time.Duration) (*SNTPResult, error) {
+	request := make([]byte, sntpPacketSize)
+	request[0] = 4<<3 | 3 // version 4, client mode
+
+	t1 := time.Now()
+	transmit := ntpTimestamp(t1)
+	binary.BigEndian.PutUint64(request[40:], transmit)
+
+	conn.SetDeadline(t1.Add(timeout))
+	if _, err := conn.Write(request); err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+
+	reply := make([]byte, 512)
+	for {
+		n, err := conn.Read(reply)
+		if err != nil {
+			return nil, fmt.Errorf("no reply: %v", err)
+		}
+		// The monotonic clock keeps the round trip right even if the wall clock steps
+		t4 := t1.Add(time.Since(t1))
+		if n < sntpPacketSize {
+			continue
+		}
+		// Replies to an earlier, timed out request carry a different origin
+		if binary.BigEndian.Uint64(reply[24:]) != transmit {
+			continue
+		}
+		return decodeSNTPReply(reply[:n], t1, t4)
+	}
+}
+
+// decodeSNTPReply checks a server reply and computes offset and delay from
+// the client send (t1) and receive (t4) times
+func decodeSNTPReply(reply []byte, t1, t4 time.Time) (*SNTPResult, error) {
+	leap := int(reply[0] >> 6)
+	version := int(reply[0] >> 3 & 7)
+	mode := reply[0] & 7
+	stratum := int(reply[1])
+
+	if mode != 4 && mode != 5 {
+		return nil, fmt.Errorf("unexpected NTP mode %d in reply", mode)
+	}
+	if stratum == 0 {
+		return nil, fmt.Errorf("%w: %s", errKissOfDeath, strings.TrimRight(string(reply[12:16]), "\x00"))
+	}
+	if leap == 3 {
+		return nil, fmt.Errorf("server clock is not synchronized")
+	}
+
+	t2 := ntpTime(binary.BigEndian.Uint64(reply[32:]))
+	t3 := ntpTime(binary.BigEndian.Uint64(reply[40:]))
+	if t3.IsZero() {
+		return nil, fmt.Errorf("reply has no transmit timestamp")
+	}
+
+	// The offset of the server relative to us; report ours relative to it
+	serverOffset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+
+	result := &SNTPResult{
+		Stratum:          stratum,
+		Leap:             leap,
+		Version:          version,
+		OffsetMS:         -float64(serverOffset.Microseconds()) / 1000,
+		DelayMS:          float64(delay.Microseconds()) / 1000,
+		RootDelayMS:      ntpShortMS(binary.BigEndian.Uint32(reply[4:])),
+		RootDispersionMS: ntpShortMS(binary.BigEndian.Uint32(reply[8:])),
+		ServerTime:       t3.UTC(),
+	}
+	if stratum == 1 {
+		// Primary servers name their reference clock, e.g. GPS or PPS
+		result.ReferenceID = strings.TrimRight(string(reply[12:16]), "\x00")
+	} else {
+		result.ReferenceID = net.IP(reply[12:16]).String()
+	}
+	return result, nil
+}
+
+// ntpTimestamp converts a time to the 32.32 fixed point NTP format
+func ntpTimestamp(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / 1e9
+	return seconds<<32 | fraction
+}
+
+// ntpTime converts a 32.32 NTP timestamp to a time, rounding to the nearest
+// nanosecond so times survive a round trip through ntpTimestamp; zero stays zero
+func ntpTime(timestamp uint64) time.Time {
+	if timestamp == 0 {
+		return time.Time{}
+	}
+	seconds := int64(timestamp>>32) - ntpEpochOffset
+	nanos := int64(((timestamp&0xffffffff)*1e9 + 1<<31) >> 32)
+	return time.Unix(seconds, nanos)
+}
+
+// ntpShortMS converts a 16.16 fixed point NTP duration to milliseconds
+func ntpShortMS(value uint32) float64 {
+	return float64(value) / 65536 * 1000
+}
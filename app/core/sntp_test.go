@@ -0,0 +1,177 @@
+package core
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serverAhead is how far the stand-in NTP server's clock is ahead of ours
+const serverAhead = time.Hour
+
+// startNTPResponder answers every NTP request on loopback with the packet
+// built by reply and returns the server address and a request counter
+func startNTPResponder(t *testing.T, reply func(request []byte) []byte) (string, *atomic.Int32) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var requests atomic.Int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, client, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < sntpPacketSize {
+				continue
+			}
+			requests.Add(1)
+			conn.WriteTo(reply(buf[:n]), client)
+		}
+	}()
+	return conn.LocalAddr().String(), &requests
+}
+
+// ntpReply builds a server reply to request with the given stratum and
+// reference ID, received and sent at the given times
+func ntpReply(request []byte, stratum byte, refID string, received, sent time.Time) []byte {
+	reply := make([]byte, sntpPacketSize)
+	reply[0] = 4<<3 | 4 // no leap warning, version 4, server mode
+	reply[1] = stratum
+	binary.BigEndian.PutUint32(reply[4:], 0x00008000) // root delay 500 ms
+	binary.BigEndian.PutUint32(reply[8:], 0x00004000) // root dispersion 250 ms
+	if ip := net.ParseIP(refID).To4(); ip != nil {
+		copy(reply[12:16], ip)
+	} else {
+		copy(reply[12:16], refID)
+	}
+	copy(reply[24:32], request[40:48]) // origin is the client's transmit time
+	if !received.IsZero() {
+		binary.BigEndian.PutUint64(reply[32:], ntpTimestamp(received))
+	}
+	if !sent.IsZero() {
+		binary.BigEndian.PutUint64(reply[40:], ntpTimestamp(sent))
+	}
+	return reply
+}
+
+func TestDecodeSNTPReply(t *testing.T) {
+	t1 := time.Date(2025, 6, 11, 8, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second + 10*time.Millisecond) // server receives, its clock ahead
+	t3 := t2.Add(2 * time.Millisecond)              // server answers after 2 ms
+	t4 := t1.Add(20 * time.Millisecond)             // reply arrives
+
+	request := make([]byte, sntpPacketSize)
+	binary.BigEndian.PutUint64(request[40:], ntpTimestamp(t1))
+	result, err := decodeSNTPReply(ntpReply(request, 2, "192.0.2.1", t2, t3), t1, t4)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	// Offset ((t2-t1)+(t3-t4))/2 = (1010+992)/2 ms, with our clock behind
+	if result.OffsetMS != -1001 {
+		t.Errorf("offset = %v ms, want -1001", result.OffsetMS)
+	}
+	// Delay (t4-t1)-(t3-t2) = 20-2 ms
+	if result.DelayMS != 18 {
+		t.Errorf("delay = %v ms, want 18", result.DelayMS)
+	}
+	if result.Stratum != 2 || result.ReferenceID != "192.0.2.1" || result.Version != 4 || result.Leap != 0 {
+		t.Errorf("stratum %d reference %q version %d leap %d, want 2, 192.0.2.1, 4 and 0",
+			result.Stratum, result.ReferenceID, result.Version, result.Leap)
+	}
+	if result.RootDelayMS != 500 || result.RootDispersionMS != 250 {
+		t.Errorf("root delay %v dispersion %v, want 500 and 250", result.RootDelayMS, result.RootDispersionMS)
+	}
+	if !result.ServerTime.Equal(t3) {
+		t.Errorf("server time = %v, want %v", result.ServerTime, t3)
+	}
+}
+
+func TestQuerySNTP(t *testing.T) {
+	// The server stamps the reply an hour ahead of the client's send time and
+	// claims no processing time, so the whole round trip counts as delay
+	addr, requests := startNTPResponder(t, func(request []byte) []byte {
+		stamp := ntpTime(binary.BigEndian.Uint64(request[40:])).Add(serverAhead)
+		return ntpReply(request, 1, "GPS", stamp, stamp)
+	})
+
+	result, err := QuerySNTP(addr, 2, time.Second)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if requests.Load() != 2 || len(result.Samples) != 2 {
+		t.Errorf("sent %d requests and kept %d samples, want 2 each", requests.Load(), len(result.Samples))
+	}
+	if result.Stratum != 1 || result.ReferenceID != "GPS" {
+		t.Errorf("stratum %d reference %q, want a stratum 1 server on GPS", result.Stratum, result.ReferenceID)
+	}
+	if result.Server != addr || result.Address != addr {
+		t.Errorf("server %q address %q, want %q", result.Server, result.Address, addr)
+	}
+	// Over loopback the delay is well under the tolerance, and it bounds the offset error
+	if result.DelayMS < 0 || result.DelayMS > 100 {
+		t.Errorf("delay = %v ms, want a small positive round trip", result.DelayMS)
+	}
+	wantOffset := -float64(serverAhead.Milliseconds())
+	if math.Abs(result.OffsetMS-wantOffset) > 100 {
+		t.Errorf("offset = %v ms, want about %v", result.OffsetMS, wantOffset)
+	}
+	for _, sample := range result.Samples {
+		if sample.Error != "" || sample.DelayMS < result.DelayMS {
+			t.Errorf("sample %+v is failed or faster than the kept one (%v ms)", sample, result.DelayMS)
+		}
+	}
+}
+
+func TestQuerySNTPRejectsBadReplies(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    func(request []byte) []byte
+		requests int32
+		errText  string
+	}{
+		{
+			name: "kiss-of-death stops asking",
+			reply: func(request []byte) []byte {
+				now := time.Now()
+				return ntpReply(request, 0, "RATE", now, now)
+			},
+			requests: 1,
+			errText:  "kiss-of-death: RATE",
+		},
+		{
+			name: "zero transmit timestamp",
+			reply: func(request []byte) []byte {
+				return ntpReply(request, 2, "192.0.2.1", time.Now(), time.Time{})
+			},
+			requests: 2,
+			errText:  "no transmit timestamp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, requests := startNTPResponder(t, tt.reply)
+			result, err := QuerySNTP(addr, 2, time.Second)
+			if err == nil {
+				t.Fatalf("query succeeded with %+v, want an error", result)
+			}
+			if !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.errText)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("sent %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
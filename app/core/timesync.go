@@ -0,0 +1,231 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeServer is an NTP server the clock is configured to use
+type TimeServer struct {
+	Address   string  `json:"address"`
+	Selected  bool    `json:"selected"` // the server the clock currently follows
+	Stratum   int     `json:"stratum,omitempty"`
+	Reachable bool    `json:"reachable"`
+	OffsetMS  float64 `json:"offsetMs,omitempty"` // positive when the local clock is ahead
+}
+
+// TimeSyncInfo is the health of the system clock
+type TimeSyncInfo struct {
+	Synchronized     bool         `json:"synchronized"`
+	Source           string       `json:"source"`              // chrony, timesyncd or kernel
+	OffsetMS         float64      `json:"offsetMs"`            // positive when the local clock is ahead
+	Stratum          int          `json:"stratum,omitempty"`   // of the local clock
+	Reference        string       `json:"reference,omitempty"` // server the clock is synchronized to
+	RootDelayMS      float64      `json:"rootDelayMs,omitempty"`
+	RootDispersionMS float64      `json:"rootDispersionMs,omitempty"`
+	MaxErrorMS       float64      `json:"maxErrorMs,omitempty"` // kernel's bound on the clock error
+	FrequencyPPM     float64      `json:"frequencyPpm"`
+	LeapStatus       string       `json:"leapStatus,omitempty"`
+	Servers          []TimeServer `json:"servers"`
+	Errors           []string     `json:"errors,omitempty"`
+	CollectedAt      time.Time    `json:"collectedAt"`
+}
+
+// timeConfigFiles lists NTP client configurations to read servers from when
+// no daemon can be asked
+var timeConfigFiles = []string{"/etc/chrony/chrony.conf", "/etc/chrony.conf", "/etc/systemd/timesyncd.conf", "/etc/ntp.conf", "/etc/ntpsec/ntp.conf"}
+
+// GetTimeSync reports the clock's synchronization state from chrony or
+// systemd-timesyncd, with the kernel's view from adjtimex as a fallback
+func GetTimeSync() *TimeSyncInfo {
+	info := &TimeSyncInfo{Source: "kernel", CollectedAt: time.Now()}
+
+	kernel, err := kernelClock()
+	if err != nil {
+		info.Errors = append(info.Errors, err.Error())
+	} else {
+		info.Synchronized = kernel.Synchronized
+		info.OffsetMS = kernel.OffsetMS
+		info.MaxErrorMS = kernel.MaxErrorMS
+		info.FrequencyPPM = kernel.FrequencyPPM
+	}
+
+	if tracking, err := exec.Command("chronyc", "-c", "tracking").Output(); err == nil {
+		info.Source = "chrony"
+		parseChronyTracking(string(tracking), info)
+		if sources, err := exec.Command("chronyc", "-c", "sources").Output(); err == nil {
+			info.Servers = parseChronySources(string(sources))
+		}
+	} else if status, err := exec.Command("timedatectl", "show", "--property=NTPSynchronized", "--value").Output(); err == nil {
+		info.Synchronized = strings.TrimSpace(string(status)) == "yes"
+		if timesync, err := exec.Command("timedatectl", "show-timesync").Output(); err == nil {
+			info.Source = "timesyncd"
+			parseTimesyncd(string(timesync), info)
+		}
+	}
+
+	if len(info.Servers) == 0 {
+		info.Servers = configuredTimeServers()
+	}
+	return info
+}
+
+// kernelClockState is what adjtimex reports about the clock
+type kernelClockState struct {
+	Synchronized bool
+	OffsetMS     float64
+	MaxErrorMS   float64
+	FrequencyPPM float64
+}
+
+// parseChronyTracking fills info from 'chronyc -c tracking'. The fields are
+// reference ID, reference name, stratum, reference time, system time
+// correction, last offset, RMS offset, frequency, residual frequency, skew,
+// root delay, root dispersion, update interval and leap status.
+func parseChronyTracking(output string, info *TimeSyncInfo) {
+	fields := strings.Split(strings.TrimSpace(output), ",")
+	if len(fields) < 14 {
+		return
+	}
+	float := func(i int) float64 {
+		value, _ := strconv.ParseFloat(fields[i], 64)
+		return value
+	}
+
+	info.Reference = fields[1]
+	info.Stratum, _ = strconv.Atoi(fields[2])
+	// A positive correction means the clock is behind and will be sped up
+	info.OffsetMS = -float(4) * 1000
+	info.FrequencyPPM = float(7)
+	info.RootDelayMS = float(10) * 1000
+	info.RootDispersionMS = float(11) * 1000
+	info.LeapStatus = fields[13]
+	info.Synchronized = info.LeapStatus != "Not synchronised" && info.Stratum > 0 && info.Stratum < 16
+}
+
+// parseChronySources parses 'chronyc -c sources'. The fields are mode, state,
+// name, stratum, poll, reach (octal), last receive, adjusted offset,
+// measured offset and error; offsets are positive when the local clock is ahead.
+func parseChronySources(output string) []TimeServer {
+	var servers []TimeServer
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 8 || fields[0] == "#" {
+			continue // Reference clocks are not network servers
+		}
+		server := TimeServer{Address: fields[2], Selected: fields[1] == "*"}
+		server.Stratum, _ = strconv.Atoi(fields[3])
+		reach, _ := strconv.ParseUint(fields[5], 8, 16)
+		server.Reachable = reach != 0
+		if offset, err := strconv.ParseFloat(fields[7], 64); err == nil {
+			server.OffsetMS = offset * 1000
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+// parseTimesyncd fills info from 'timedatectl show-timesync', whose NTPMessage
+// property holds the last reply from the server in use
+func parseTimesyncd(output string, info *TimeSyncInfo) {
+	properties := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			properties[key] = value
+		}
+	}
+
+	info.Reference = properties["ServerName"]
+	if address := properties["ServerAddress"]; address != "" && address != info.Reference {
+		info.Reference = strings.TrimSpace(info.Reference + " (" + address + ")")
+	}
+
+	message := strings.Trim(properties["NTPMessage"], "{} ")
+	for _, field := range strings.Split(message, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Stratum":
+			// The local clock is one stratum below its server
+			if stratum, err := strconv.Atoi(value); err == nil && stratum > 0 {
+				info.Stratum = stratum + 1
+			}
+		case "RootDelay":
+			info.RootDelayMS = parseDurationMS(value)
+		case "RootDispersion":
+			info.RootDispersionMS = parseDurationMS(value)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range []string{"LinkNTPServers", "SystemNTPServers", "FallbackNTPServers"} {
+		for _, address := range strings.Fields(properties[key]) {
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+			server := TimeServer{Address: address}
+			if address == properties["ServerName"] || address == properties["ServerAddress"] {
+				server.Selected = true
+				server.Reachable = info.Synchronized
+				server.Stratum = info.Stratum - 1
+			}
+			info.Servers = append(info.Servers, server)
+		}
+	}
+}
+
+// parseDurationMS parses a systemd duration such as "10.345ms" or "1us" into milliseconds
+func parseDurationMS(value string) float64 {
+	d, err := time.ParseDuration(strings.ReplaceAll(strings.TrimSpace(value), "μs", "us"))
+	if err != nil {
+		return 0
+	}
+	return float64(d.Microseconds()) / 1000
+}
+
+// configuredTimeServers reads server, pool and NTP= entries from the NTP client configurations
+func configuredTimeServers() []TimeServer {
+	servers := []TimeServer{}
+	seen := make(map[string]bool)
+	add := func(address string) {
+		if address != "" && !seen[address] {
+			seen[address] = true
+			servers = append(servers, TimeServer{Address: address})
+		}
+	}
+
+	for _, path := range timeConfigFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			switch {
+			case fields[0] == "server" || fields[0] == "pool" || fields[0] == "peer":
+				if len(fields) > 1 {
+					add(fields[1])
+				}
+			case strings.HasPrefix(fields[0], "NTP="):
+				add(strings.TrimPrefix(fields[0], "NTP="))
+				for _, address := range fields[1:] {
+					add(address)
+				}
+			}
+		}
+	}
+	return servers
+}
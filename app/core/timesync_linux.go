@@ -0,0 +1,29 @@
+//go:build linux
+
+package core
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernelClock reads the kernel's clock discipline state with adjtimex
+func kernelClock() (kernelClockState, error) {
+	var tx unix.Timex
+	state, err := unix.Adjtimex(&tx)
+	if err != nil {
+		return kernelClockState{}, fmt.Errorf("adjtimex failed: %v", err)
+	}
+
+	offset := float64(tx.Offset) / 1000 // microseconds
+	if tx.Status&unix.STA_NANO != 0 {
+		offset /= 1000
+	}
+	return kernelClockState{
+		Synchronized: state != unix.TIME_ERROR && tx.Status&unix.STA_UNSYNC == 0,
+		OffsetMS:     offset,
+		MaxErrorMS:   float64(tx.Maxerror) / 1000,
+		FrequencyPPM: float64(tx.Freq) / 65536, // 16.16 fixed point
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package core
+
+import "errors"
+
+// kernelClock needs adjtimex, which is only available on Linux
+func kernelClock() (kernelClockState, error) {
+	return kernelClockState{}, errors.New("adjtimex is only available on Linux")
+}
@@ -0,0 +1,478 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TopologyNode is one network interface
+type TopologyNode struct {
+	ID        string   `json:"id"` // interface name, prefixed with "<namespace>/" outside the default namespace
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"` // physical, wireless, loopback, bridge, bond, vlan, vrf, veth, wireguard, vxlan, gre, ...
+	Namespace string   `json:"namespace,omitempty"`
+	Index     int      `json:"index"`
+	MAC       string   `json:"mac,omitempty"`
+	MTU       int      `json:"mtu"`
+	OperState string   `json:"operState"`
+	Up        bool     `json:"up"`
+	Addresses []string `json:"addresses,omitempty"`
+	Master    string   `json:"master,omitempty"` // ID of the bridge, bond or VRF this interface belongs to
+
+	VLAN   *VLANInfo       `json:"vlan,omitempty"`
+	Bridge *TopologyBridge `json:"bridge,omitempty"`
+	Bond   *TopologyBond   `json:"bond,omitempty"`
+	VRF    *TopologyVRF    `json:"vrf,omitempty"`
+	Tunnel *TopologyTunnel `json:"tunnel,omitempty"`
+	Port   *TopologyPort   `json:"port,omitempty"` // state as a member of Master
+}
+
+// TopologyBridge describes a Linux bridge
+type TopologyBridge struct {
+	STP           string `json:"stp"` // disabled, kernel or user
+	VLANFiltering bool   `json:"vlanFiltering"`
+	BridgeID      string `json:"bridgeId,omitempty"`
+	RootID        string `json:"rootId,omitempty"`
+}
+
+// TopologyBond describes a bonding interface
+type TopologyBond struct {
+	Mode        string `json:"mode"`
+	ActiveSlave string `json:"activeSlave,omitempty"`
+	MIIMonMS    int    `json:"miimonMs,omitempty"`
+}
+
+// TopologyVRF describes a VRF device
+type TopologyVRF struct {
+	Table int `json:"table"`
+}
+
+// TopologyTunnel describes a tunnel endpoint
+type TopologyTunnel struct {
+	Local      string   `json:"local,omitempty"`
+	Remote     string   `json:"remote,omitempty"`
+	VNI        int      `json:"vni,omitempty"` // VXLAN and Geneve
+	Port       int      `json:"port,omitempty"`
+	ListenPort int      `json:"listenPort,omitempty"` // WireGuard
+	Peers      int      `json:"peers,omitempty"`
+	Endpoints  []string `json:"endpoints,omitempty"`
+}
+
+// TopologyPort is an interface's state as a member of a bridge, bond or VRF
+type TopologyPort struct {
+	Kind      string `json:"kind"`            // bridge, bond or vrf
+	State     string `json:"state,omitempty"` // STP port state (forwarding, blocking, ...) or bond slave state (ACTIVE, BACKUP)
+	Cost      int    `json:"cost,omitempty"`
+	Priority  int    `json:"priority,omitempty"`
+	MIIStatus string `json:"miiStatus,omitempty"`
+}
+
+// TopologyEdge links two nodes
+type TopologyEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind"` // bridge, bond or vrf (member to master), vlan (VLAN to parent), lower (device to underlay), veth (peers)
+	Label string `json:"label,omitempty"`
+	State string `json:"state,omitempty"`
+}
+
+// Topology is the graph of interfaces and how they are stacked
+type Topology struct {
+	Nodes       []TopologyNode `json:"nodes"`
+	Edges       []TopologyEdge `json:"edges"`
+	Namespaces  []Netns        `json:"namespaces"`
+	Errors      []string       `json:"errors,omitempty"`
+	CollectedAt time.Time      `json:"collectedAt"`
+}
+
+// ipLink is one interface in the output of 'ip -j -d addr show'
+type ipLink struct {
+	Index       int      `json:"ifindex"`
+	Name        string   `json:"ifname"`
+	Flags       []string `json:"flags"`
+	MTU         int      `json:"mtu"`
+	OperState   string   `json:"operstate"`
+	LinkType    string   `json:"link_type"`
+	Address     string   `json:"address"`
+	Link        string   `json:"link"`
+	LinkIndex   int      `json:"link_index"`
+	LinkNetnsID *int     `json:"link_netnsid"`
+	Master      string   `json:"master"`
+	LinkInfo    *struct {
+		Kind      string                 `json:"info_kind"`
+		Data      map[string]interface{} `json:"info_data"`
+		SlaveKind string                 `json:"info_slave_kind"`
+		SlaveData map[string]interface{} `json:"info_slave_data"`
+	} `json:"linkinfo"`
+	AddrInfo []struct {
+		Local     string `json:"local"`
+		PrefixLen int    `json:"prefixlen"`
+	} `json:"addr_info"`
+}
+
+// GetTopology builds the interface graph of NetTool's namespace and every
+// other namespace ListNetns finds, using 'ip -j -d' for the details of each link
+func GetTopology() (*Topology, error) {
+	topology := &Topology{CollectedAt: time.Now()}
+
+	links, err := readIPLinks(nil)
+	if err != nil {
+		return nil, err
+	}
+	byNamespace := map[string][]ipLink{"": links}
+
+	namespaces, err := ListNetns()
+	if err != nil {
+		topology.Errors = append(topology.Errors, err.Error())
+	}
+	for _, ns := range namespaces {
+		if ns.Current {
+			continue
+		}
+		topology.Namespaces = append(topology.Namespaces, ns)
+		nsLinks, err := readIPLinks(&ns)
+		if err != nil {
+			// Entering another namespace needs CAP_SYS_ADMIN
+			topology.Errors = append(topology.Errors, err.Error())
+			continue
+		}
+		byNamespace[ns.Name] = nsLinks
+	}
+
+	wireguard := wireguardDevices()
+	namespaceNames := make([]string, 0, len(byNamespace))
+	for name := range byNamespace {
+		namespaceNames = append(namespaceNames, name)
+	}
+	sort.Strings(namespaceNames)
+
+	for _, ns := range namespaceNames {
+		for _, link := range byNamespace[ns] {
+			node, edges := topologyNode(link, ns)
+			if ns == "" && node.Kind == "wireguard" {
+				if wg, ok := wireguard[node.Name]; ok {
+					node.Tunnel = &wg
+				}
+			}
+			topology.Nodes = append(topology.Nodes, node)
+			topology.Edges = append(topology.Edges, edges...)
+		}
+	}
+	topology.Edges = append(topology.Edges, vethEdges(byNamespace)...)
+
+	return topology, nil
+}
+
+// nodeID names an interface uniquely across namespaces
+func nodeID(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// topologyNode converts one link into a node and the edges to its master and lower devices
+func topologyNode(link ipLink, namespace string) (TopologyNode, []TopologyEdge) {
+	node := TopologyNode{
+		ID:        nodeID(namespace, link.Name),
+		Name:      link.Name,
+		Kind:      linkKind(link, namespace),
+		Namespace: namespace,
+		Index:     link.Index,
+		MAC:       link.Address,
+		MTU:       link.MTU,
+		OperState: link.OperState,
+	}
+	for _, flag := range link.Flags {
+		if flag == "UP" {
+			node.Up = true
+		}
+	}
+	for _, addr := range link.AddrInfo {
+		node.Addresses = append(node.Addresses, fmt.Sprintf("%s/%d", addr.Local, addr.PrefixLen))
+	}
+
+	var edges []TopologyEdge
+	var data, slave map[string]interface{}
+	if link.LinkInfo != nil {
+		data, slave = link.LinkInfo.Data, link.LinkInfo.SlaveData
+	}
+
+	switch node.Kind {
+	case "vlan":
+		node.VLAN = &VLANInfo{Enabled: true, VLANID: jsonInt(data, "id"), Name: link.Name, Parent: link.Link, Protocol: jsonString(data, "protocol")}
+	case "bridge":
+		node.Bridge = &TopologyBridge{
+			STP:           bridgeSTP(jsonInt(data, "stp_state")),
+			VLANFiltering: jsonInt(data, "vlan_filtering") == 1,
+			BridgeID:      jsonString(data, "bridge_id"),
+			RootID:        jsonString(data, "root_id"),
+		}
+	case "bond":
+		node.Bond = &TopologyBond{Mode: jsonString(data, "mode"), ActiveSlave: jsonString(data, "active_slave"), MIIMonMS: jsonInt(data, "miimon")}
+	case "vrf":
+		node.VRF = &TopologyVRF{Table: jsonInt(data, "table")}
+	case "vxlan", "geneve", "gre", "gretap", "ip6gre", "ip6gretap", "ipip", "sit", "ip6tnl", "vti", "vti6":
+		node.Tunnel = &TopologyTunnel{
+			Local:  jsonString(data, "local"),
+			Remote: firstNonEmpty(jsonString(data, "remote"), jsonString(data, "group")),
+			VNI:    jsonInt(data, "id"),
+			Port:   jsonInt(data, "port"),
+		}
+		// Tunnels bound to an underlay device name it in their data
+		if lower := jsonString(data, "link"); lower != "" {
+			edges = append(edges, TopologyEdge{From: node.ID, To: nodeID(namespace, lower), Kind: "lower"})
+		}
+	}
+
+	// Stacked devices name their parent in "link"; veth peers are handled separately
+	if link.Link != "" && node.Kind != "veth" && link.LinkNetnsID == nil && link.Link != jsonString(data, "link") {
+		edge := TopologyEdge{From: node.ID, To: nodeID(namespace, link.Link), Kind: "lower"}
+		if node.VLAN != nil {
+			edge.Kind = "vlan"
+			edge.Label = fmt.Sprintf("VLAN %d", node.VLAN.VLANID)
+		}
+		edges = append(edges, edge)
+	}
+
+	if link.Master != "" {
+		node.Master = nodeID(namespace, link.Master)
+		port := &TopologyPort{Kind: "master"}
+		if link.LinkInfo != nil && link.LinkInfo.SlaveKind != "" {
+			port.Kind = link.LinkInfo.SlaveKind
+		}
+		port.State = jsonString(slave, "state")
+		port.Cost = jsonInt(slave, "cost")
+		port.Priority = jsonInt(slave, "priority")
+		port.MIIStatus = jsonString(slave, "mii_status")
+		node.Port = port
+		edges = append(edges, TopologyEdge{From: node.ID, To: node.Master, Kind: port.Kind, State: port.State})
+	}
+
+	return node, edges
+}
+
+// linkKind classifies a link by its rtnetlink kind, falling back to sysfs for real hardware
+func linkKind(link ipLink, namespace string) string {
+	if link.LinkInfo != nil && link.LinkInfo.Kind != "" {
+		return link.LinkInfo.Kind
+	}
+	if link.LinkType == "loopback" {
+		return "loopback"
+	}
+	// sysfs shows the namespace NetTool runs in
+	if namespace == "" {
+		if isWireless(link.Name) {
+			return "wireless"
+		}
+		if _, err := os.Stat(filepath.Join("/sys/class/net", link.Name, "device")); err == nil {
+			return "physical"
+		}
+	}
+	if link.LinkType != "" {
+		return link.LinkType
+	}
+	return "unknown"
+}
+
+// vethEdges pairs veth peers, including peers that live in another namespace.
+// A link_netnsid only means something inside the namespace that reports it, so
+// peers across namespaces are matched by each pointing at the other's index.
+func vethEdges(byNamespace map[string][]ipLink) []TopologyEdge {
+	var edges []TopologyEdge
+	seen := make(map[string]bool)
+	for ns, links := range byNamespace {
+		for _, link := range links {
+			if link.LinkInfo == nil || link.LinkInfo.Kind != "veth" {
+				continue
+			}
+			from := nodeID(ns, link.Name)
+			to := ""
+			switch {
+			case link.LinkNetnsID == nil && link.Link != "":
+				to = nodeID(ns, link.Link)
+			case link.LinkNetnsID != nil:
+				for peerNS, peers := range byNamespace {
+					if peerNS == ns {
+						continue
+					}
+					for _, peer := range peers {
+						if peer.Index == link.LinkIndex && peer.LinkIndex == link.Index && peer.LinkNetnsID != nil {
+							to = nodeID(peerNS, peer.Name)
+						}
+					}
+				}
+				if to == "" && ns == "" {
+					// The peer's namespace could not be read; still show that the peer exists
+					to = nodeID(fmt.Sprintf("netnsid:%d", *link.LinkNetnsID), fmt.Sprintf("if%d", link.LinkIndex))
+				}
+			}
+			if to == "" {
+				continue
+			}
+
+			a, b := from, to
+			if b < a {
+				a, b = b, a
+			}
+			if seen[a+"\x00"+b] {
+				continue
+			}
+			seen[a+"\x00"+b] = true
+			edges = append(edges, TopologyEdge{From: from, To: to, Kind: "veth"})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].From < edges[j].From })
+	return edges
+}
+
+// readIPLinks runs 'ip -j -d addr show', inside a namespace when one is given
+func readIPLinks(ns *Netns) ([]ipLink, error) {
+	var out, stderr bytes.Buffer
+	run := func() error {
+		cmd := exec.Command("ip", "-j", "-d", "addr", "show")
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		return cmd.Run()
+	}
+
+	if ns == nil {
+		if err := run(); err != nil {
+			return nil, fmt.Errorf("failed to list links: %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+	} else if err := RunInNetns(ns.Path, run); err != nil {
+		return nil, fmt.Errorf("failed to list links in namespace %s: %v %s", ns.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var links []ipLink
+	if err := json.Unmarshal(out.Bytes(), &links); err != nil {
+		return nil, fmt.Errorf("failed to parse ip link output: %v", err)
+	}
+	return links, nil
+}
+
+// wireguardDevices reads listen ports and peers from 'wg show all dump'.
+// It needs root; without it WireGuard interfaces are shown without details.
+func wireguardDevices() map[string]TopologyTunnel {
+	devices := make(map[string]TopologyTunnel)
+
+	cmd := exec.Command("wg", "show", "all", "dump")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return devices
+	}
+
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch len(fields) {
+		case 5:
+			// interface private-key public-key listen-port fwmark
+			device := devices[fields[0]]
+			device.ListenPort, _ = strconv.Atoi(fields[3])
+			devices[fields[0]] = device
+		case 9:
+			// interface public-key preshared-key endpoint allowed-ips latest-handshake rx tx keepalive
+			device := devices[fields[0]]
+			device.Peers++
+			if fields[3] != "(none)" {
+				device.Endpoints = append(device.Endpoints, fields[3])
+			}
+			devices[fields[0]] = device
+		}
+	}
+	return devices
+}
+
+// GetVLANInfo returns the 802.1Q configuration of an interface from
+// 'ip -j -d link show', falling back to /proc/net/vlan/config
+func GetVLANInfo(ifaceName string) VLANInfo {
+	cmd := exec.Command("ip", "-j", "-d", "link", "show", "dev", ifaceName)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err == nil {
+		var links []ipLink
+		if json.Unmarshal(out.Bytes(), &links) == nil && len(links) == 1 {
+			link := links[0]
+			if link.LinkInfo == nil || link.LinkInfo.Kind != "vlan" {
+				return VLANInfo{}
+			}
+			return VLANInfo{
+				Enabled:  true,
+				VLANID:   jsonInt(link.LinkInfo.Data, "id"),
+				Name:     link.Name,
+				Parent:   link.Link,
+				Protocol: jsonString(link.LinkInfo.Data, "protocol"),
+			}
+		}
+	}
+
+	// /proc/net/vlan/config lines look like: eth0.10 | 10 | eth0
+	data, err := os.ReadFile("/proc/net/vlan/config")
+	if err != nil {
+		return VLANInfo{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) != 3 || strings.TrimSpace(fields[0]) != ifaceName {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil {
+			continue
+		}
+		return VLANInfo{Enabled: true, VLANID: id, Name: ifaceName, Parent: strings.TrimSpace(fields[2]), Protocol: "802.1Q"}
+	}
+	return VLANInfo{}
+}
+
+// bridgeSTP names a bridge's stp_state
+func bridgeSTP(state int) string {
+	switch state {
+	case 1:
+		return "kernel"
+	case 2:
+		return "user"
+	}
+	return "disabled"
+}
+
+// jsonInt reads a number from decoded JSON, returning 0 when missing
+func jsonInt(data map[string]interface{}, key string) int {
+	switch v := data[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// jsonString reads a string from decoded JSON, returning "" when missing
+func jsonString(data map[string]interface{}, key string) string {
+	if v, ok := data[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
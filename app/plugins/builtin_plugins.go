@@ -0,0 +1,129 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NetScout-Go/NetTool/app/core"
+)
+
+// Execute functions for the plugins built into NetTool itself. Unlike the
+// plugins in the plugins directory these do not need to be installed.
+
+// executeDHCPProbe looks for DHCP servers on an interface and flags rogue ones
+func executeDHCPProbe(params map[string]interface{}) (interface{}, error) {
+	iface, ok := params["interface"].(string)
+	if !ok || iface == "" {
+		return nil, fmt.Errorf("interface parameter is required")
+	}
+
+	timeout, _ := params["timeout"].(float64)
+	if timeout <= 0 {
+		timeout = 5
+	}
+
+	ipv6 := true
+	if v, ok := params["ipv6"].(bool); ok {
+		ipv6 = v
+	}
+
+	var allowed []string
+	if allowedStr, ok := params["allowedServers"].(string); ok {
+		for _, server := range strings.Split(allowedStr, ",") {
+			if server = strings.TrimSpace(server); server != "" {
+				allowed = append(allowed, server)
+			}
+		}
+	}
+
+	return core.ProbeDHCP(core.DHCPProbeOptions{
+		Interface:      iface,
+		Timeout:        time.Duration(timeout * float64(time.Second)),
+		AllowedServers: allowed,
+		IPv4:           true,
+		IPv6:           ipv6,
+	})
+}
+
+// executeConnections lists sockets with their owning process and TCP statistics
+func executeConnections(params map[string]interface{}) (interface{}, error) {
+	filter := core.ConnectionFilter{}
+
+	if protocol, ok := params["protocol"].(string); ok && protocol != "all" {
+		filter.Protocol = protocol
+	}
+	if state, ok := params["state"].(string); ok && state != "all" {
+		filter.State = state
+	}
+	if port, ok := params["port"].(float64); ok {
+		filter.Port = int(port)
+	}
+	if pid, ok := params["pid"].(float64); ok {
+		filter.PID = int(pid)
+	}
+	if command, ok := params["command"].(string); ok {
+		filter.Command = strings.TrimSpace(command)
+	}
+	if listening, ok := params["listening"].(bool); ok {
+		filter.Listening = listening
+	}
+	if established, ok := params["established"].(bool); ok {
+		filter.Established = established
+	}
+
+	return core.GetConnections(filter)
+}
+
+// executeSNTPQuery measures the clock offset against an NTP server
+func executeSNTPQuery(params map[string]interface{}) (interface{}, error) {
+	server, _ := params["server"].(string)
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return nil, fmt.Errorf("server parameter is required")
+	}
+
+	samples := 4
+	if value, ok := params["samples"].(float64); ok && value >= 1 {
+		samples = min(int(value), 16)
+	}
+	timeout := 2 * time.Second
+	if value, ok := params["timeout"].(float64); ok && value > 0 {
+		timeout = time.Duration(value * float64(time.Second))
+	}
+
+	return core.QuerySNTP(server, samples, timeout)
+}
+
+// executeIPv6Readiness assesses how well this device can use IPv6
+func executeIPv6Readiness(params map[string]interface{}) (interface{}, error) {
+	opts := core.IPv6Options{}
+	if listen, ok := params["listen"].(float64); ok && listen > 0 {
+		opts.Listen = time.Duration(listen * float64(time.Second))
+	}
+	return core.GetIPv6Readiness(opts)
+}
+
+// executeFirewallTrace traces a packet through the local firewall ruleset
+func executeFirewallTrace(params map[string]interface{}) (interface{}, error) {
+	packet := core.PacketTuple{}
+	packet.Protocol, _ = params["protocol"].(string)
+	packet.Source, _ = params["source"].(string)
+	packet.Destination, _ = params["destination"].(string)
+	packet.Direction, _ = params["direction"].(string)
+	packet.InInterface, _ = params["inInterface"].(string)
+	packet.OutInterface, _ = params["outInterface"].(string)
+	packet.State, _ = params["state"].(string)
+	if port, ok := params["sourcePort"].(float64); ok {
+		packet.SourcePort = int(port)
+	}
+	if port, ok := params["destinationPort"].(float64); ok {
+		packet.DestinationPort = int(port)
+	}
+
+	ruleset, err := core.GetFirewallRuleset()
+	if err != nil {
+		return nil, err
+	}
+	return ruleset.Trace(packet)
+}
@@ -125,7 +125,11 @@ func (cm *ConfigManager) LoadConfiguration() error {
 func (cm *ConfigManager) SaveConfiguration() error {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
+	return cm.saveLocked()
+}
 
+// saveLocked writes the configuration; callers hold cm.mu
+func (cm *ConfigManager) saveLocked() error {
 	// Marshal the configuration
 	data, err := json.MarshalIndent(cm.configuration, "", "  ")
 	if err != nil {
@@ -139,7 +143,7 @@ func (cm *ConfigManager) SaveConfiguration() error {
 	}
 
 	// Write the config file
-	if err := os.WriteFile(cm.configPath, data, 0644); err != nil {
+	if err := os.WriteFile(cm.configPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config: %v", err)
 	}
 
@@ -157,7 +161,7 @@ func (cm *ConfigManager) AddGitHubToken(name, token, organization string) error
 			// Update the existing token
 			cm.configuration.GitHub.Tokens[i].Token = token
 			cm.configuration.GitHub.Tokens[i].Organization = organization
-			return cm.SaveConfiguration()
+			return cm.saveLocked()
 		}
 	}
 
@@ -168,7 +172,7 @@ func (cm *ConfigManager) AddGitHubToken(name, token, organization string) error
 		Organization: organization,
 	})
 
-	return cm.SaveConfiguration()
+	return cm.saveLocked()
 }
 
 // RemoveGitHubToken removes a GitHub token from the configuration
@@ -195,7 +199,7 @@ func (cm *ConfigManager) RemoveGitHubToken(name string) error {
 		cm.configuration.GitHub.Tokens[index+1:]...,
 	)
 
-	return cm.SaveConfiguration()
+	return cm.saveLocked()
 }
 
 // GetGitHubToken returns the GitHub token for the specified name
@@ -268,7 +272,7 @@ func (cm *ConfigManager) AddSource(name, organization, pattern string, isDefault
 			cm.configuration.Sources[i].Organization = organization
 			cm.configuration.Sources[i].Pattern = pattern
 			cm.configuration.Sources[i].IsDefault = isDefault
-			return cm.SaveConfiguration()
+			return cm.saveLocked()
 		}
 	}
 
@@ -280,7 +284,7 @@ func (cm *ConfigManager) AddSource(name, organization, pattern string, isDefault
 		IsDefault:    isDefault,
 	})
 
-	return cm.SaveConfiguration()
+	return cm.saveLocked()
 }
 
 // RemoveSource removes a plugin source from the configuration
@@ -307,7 +311,7 @@ func (cm *ConfigManager) RemoveSource(name string) error {
 		cm.configuration.Sources[index+1:]...,
 	)
 
-	return cm.SaveConfiguration()
+	return cm.saveLocked()
 }
 
 // SetLoadedCallback sets a callback function to be called when the configuration is loaded
@@ -0,0 +1,359 @@
+package plugins
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NetScout-Go/NetTool/app/plugins/types"
+)
+
+// JobStatus is the state of a plugin run
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Job is a plugin run in the background whose output and iteration results
+// are published while it runs
+type Job struct {
+	ID            string                 `json:"id"`
+	PluginID      string                 `json:"pluginId"`
+	Netns         string                 `json:"netns,omitempty"`
+	Params        map[string]interface{} `json:"params"`
+	Status        JobStatus              `json:"status"`
+	Output        []string               `json:"output"` // the last maxJobOutputLines lines
+	OutputLines   int                    `json:"outputLines"`
+	Result        interface{}            `json:"result,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	Iteration     int                    `json:"iteration"` // iterations completed
+	MaxIterations int                    `json:"maxIterations,omitempty"`
+	StartedAt     time.Time              `json:"startedAt"`
+	FinishedAt    *time.Time             `json:"finishedAt,omitempty"`
+
+	stop     chan struct{} // closed when the job is cancelled
+	finished chan struct{} // closed when the job is done
+	endless  bool          // iterates until cancelled
+}
+
+// Done reports whether the job has finished
+func (j *Job) Done() bool {
+	return j.Status != JobRunning
+}
+
+// JobEvent kinds
+const (
+	JobEventStatus    = "status"    // the job started, finished or was cancelled
+	JobEventOutput    = "output"    // a line of plugin output
+	JobEventIteration = "iteration" // an iteration of an iterating job completed
+)
+
+// JobEvent is published for every change of a job
+type JobEvent struct {
+	Kind      string                 `json:"kind"`
+	JobID     string                 `json:"jobId"`
+	Job       *Job                   `json:"job,omitempty"`       // status events
+	Line      string                 `json:"line,omitempty"`      // output events
+	Seq       int                    `json:"seq,omitempty"`       // output line number, from 1
+	Iteration *types.IterationResult `json:"iteration,omitempty"` // iteration events
+}
+
+// ErrShuttingDown is returned by Start once Shutdown has been called
+var ErrShuttingDown = errors.New("NetTool is shutting down and accepts no new jobs")
+
+// Limits on what is kept of jobs
+const (
+	maxJobOutputLines = 1000
+	maxFinishedJobs   = 50
+)
+
+// JobManager runs plugins as background jobs and publishes their progress
+type JobManager struct {
+	manager *PluginManager
+	publish func(JobEvent)
+	jobs    map[string]*Job
+	closed  bool
+	mu      sync.Mutex
+}
+
+// NewJobManager creates a job manager that runs plugins of manager and passes
+// every job event to publish
+func NewJobManager(manager *PluginManager, publish func(JobEvent)) *JobManager {
+	return &JobManager{
+		manager: manager,
+		publish: publish,
+		jobs:    make(map[string]*Job),
+	}
+}
+
+// Start runs a plugin in the background. With continueToIterate set in params
+// the plugin is run again every iterationDelay milliseconds until
+// maxIterations is reached (0 means until cancelled).
+func (jm *JobManager) Start(pluginID string, netns string, params map[string]interface{}) (*Job, error) {
+	if _, err := jm.manager.GetPlugin(pluginID); err != nil {
+		return nil, err
+	}
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	config := types.ExtractIterationConfig(params)
+	job := &Job{
+		ID:        id,
+		PluginID:  pluginID,
+		Netns:     netns,
+		Params:    params,
+		Status:    JobRunning,
+		Output:    []string{},
+		StartedAt: time.Now(),
+		stop:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}
+	if config.Iterate {
+		job.MaxIterations = config.MaxIterations
+		job.endless = config.MaxIterations == 0
+	}
+
+	jm.mu.Lock()
+	if jm.closed {
+		jm.mu.Unlock()
+		return nil, ErrShuttingDown
+	}
+	jm.jobs[id] = job
+	jm.pruneLocked()
+	jm.mu.Unlock()
+
+	jm.publishStatus(job)
+	go jm.run(job, config)
+	return jm.snapshot(job), nil
+}
+
+// run executes the plugin of job once, or repeatedly for iterating jobs
+func (jm *JobManager) run(job *Job, config types.PluginExecutionConfig) {
+	output := func(line string) {
+		jm.mu.Lock()
+		if job.Done() {
+			jm.mu.Unlock()
+			return // Output of a cancelled run
+		}
+		job.OutputLines++
+		job.Output = append(job.Output, line)
+		if len(job.Output) > maxJobOutputLines {
+			job.Output = job.Output[len(job.Output)-maxJobOutputLines:]
+		}
+		seq := job.OutputLines
+		jm.mu.Unlock()
+		jm.publish(JobEvent{Kind: JobEventOutput, JobID: job.ID, Line: line, Seq: seq})
+	}
+
+	for iteration := 0; ; iteration++ {
+		params := job.Params
+		if config.Iterate {
+			params = make(map[string]interface{}, len(job.Params)+1)
+			for key, value := range job.Params {
+				params[key] = value
+			}
+			params["iterationCount"] = float64(iteration)
+		}
+
+		result, err := jm.manager.RunPluginStream(job.PluginID, job.Netns, params, output)
+
+		jm.mu.Lock()
+		if job.Done() {
+			jm.mu.Unlock()
+			return
+		}
+		job.Result = result
+		job.Error = ""
+		if err != nil {
+			job.Error = err.Error()
+		}
+		job.Iteration = iteration + 1
+		jm.mu.Unlock()
+
+		if !config.Iterate {
+			jm.finish(job, err)
+			return
+		}
+
+		iterationResult := &types.IterationResult{
+			IterationCount:    iteration + 1,
+			Result:            result,
+			ContinueIteration: config.MaxIterations == 0 || iteration+1 < config.MaxIterations,
+			Timestamp:         time.Now(),
+		}
+		if err != nil {
+			iterationResult.Error = err.Error()
+			iterationResult.ContinueIteration = iterationResult.ContinueIteration && config.ContinueOnError
+		}
+		jm.publish(JobEvent{Kind: JobEventIteration, JobID: job.ID, Iteration: iterationResult})
+		if !iterationResult.ContinueIteration {
+			jm.finish(job, err)
+			return
+		}
+
+		select {
+		case <-job.stop:
+			return
+		case <-time.After(time.Duration(config.IterationDelay) * time.Millisecond):
+		}
+	}
+}
+
+// finish records the outcome of a job unless it was cancelled meanwhile
+func (jm *JobManager) finish(job *Job, err error) {
+	jm.mu.Lock()
+	if job.Done() {
+		jm.mu.Unlock()
+		return
+	}
+	job.Status = JobSucceeded
+	if err != nil {
+		job.Status = JobFailed
+	}
+	now := time.Now()
+	job.FinishedAt = &now
+	close(job.finished)
+	jm.mu.Unlock()
+
+	jm.publishStatus(job)
+}
+
+// Cancel stops a running job. A plugin run in progress is left to complete,
+// but its output and result are discarded.
+func (jm *JobManager) Cancel(id string) (*Job, error) {
+	jm.mu.Lock()
+	job, ok := jm.jobs[id]
+	if !ok {
+		jm.mu.Unlock()
+		return nil, fmt.Errorf("job not found: %s", id)
+	}
+	if job.Done() {
+		jm.mu.Unlock()
+		return nil, fmt.Errorf("job %s already %s", id, job.Status)
+	}
+	job.Status = JobCancelled
+	now := time.Now()
+	job.FinishedAt = &now
+	close(job.stop)
+	close(job.finished)
+	jm.mu.Unlock()
+
+	jm.publishStatus(job)
+	return jm.snapshot(job), nil
+}
+
+// Shutdown refuses new jobs and waits for the running ones to finish. Jobs
+// that iterate until cancelled are cancelled at once, and jobs still running
+// when ctx is done are cancelled then.
+func (jm *JobManager) Shutdown(ctx context.Context) error {
+	jm.mu.Lock()
+	jm.closed = true
+	var running, endless []*Job
+	for _, job := range jm.jobs {
+		switch {
+		case job.Done():
+		case job.endless:
+			endless = append(endless, job)
+		default:
+			running = append(running, job)
+		}
+	}
+	jm.mu.Unlock()
+
+	for _, job := range endless {
+		jm.Cancel(job.ID)
+	}
+	for _, job := range running {
+		select {
+		case <-job.finished:
+		case <-ctx.Done():
+			for _, job := range running {
+				jm.Cancel(job.ID) // Fails for jobs that finished meanwhile
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Get returns a copy of a job
+func (jm *JobManager) Get(id string) (*Job, error) {
+	jm.mu.Lock()
+	job, ok := jm.jobs[id]
+	jm.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", id)
+	}
+	return jm.snapshot(job), nil
+}
+
+// List returns copies of all jobs, newest first
+func (jm *JobManager) List() []*Job {
+	jm.mu.Lock()
+	jobs := make([]*Job, 0, len(jm.jobs))
+	for _, job := range jm.jobs {
+		jobs = append(jobs, job)
+	}
+	jm.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	for i, job := range jobs {
+		jobs[i] = jm.snapshot(job)
+	}
+	return jobs
+}
+
+// publishStatus publishes the current state of a job
+func (jm *JobManager) publishStatus(job *Job) {
+	jm.publish(JobEvent{Kind: JobEventStatus, JobID: job.ID, Job: jm.snapshot(job)})
+}
+
+// snapshot copies a job so it can be handed out while the job keeps running
+func (jm *JobManager) snapshot(job *Job) *Job {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	copied := *job
+	copied.Output = append([]string{}, job.Output...)
+	copied.stop, copied.finished = nil, nil
+	return &copied
+}
+
+// pruneLocked forgets the oldest finished jobs beyond maxFinishedJobs
+func (jm *JobManager) pruneLocked() {
+	var finished []*Job
+	for _, job := range jm.jobs {
+		if job.Done() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartedAt.Before(finished[j].StartedAt) })
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(jm.jobs, job.ID)
+	}
+}
+
+// newJobID returns a random job ID
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -15,6 +16,7 @@ import (
 // PluginRegistry is a simple registry for plugin execution functions
 type PluginRegistry struct {
 	pluginFuncs map[string]func(map[string]interface{}) (interface{}, error)
+	streamFuncs map[string]StreamFunc
 	mutex       sync.RWMutex
 }
 
@@ -22,6 +24,7 @@ type PluginRegistry struct {
 func NewPluginRegistry() *PluginRegistry {
 	return &PluginRegistry{
 		pluginFuncs: make(map[string]func(map[string]interface{}) (interface{}, error)),
+		streamFuncs: make(map[string]StreamFunc),
 	}
 }
 
@@ -43,6 +46,31 @@ func (r *PluginRegistry) GetPluginFunc(id string) (func(map[string]interface{})
 	return fn, nil
 }
 
+// RegisterStreamFunc registers a plugin execution function that streams its output
+func (r *PluginRegistry) RegisterStreamFunc(id string, fn StreamFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.streamFuncs[id] = fn
+}
+
+// UnregisterStreamFunc removes the streaming execution function of a plugin
+func (r *PluginRegistry) UnregisterStreamFunc(id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.streamFuncs, id)
+}
+
+// GetStreamFunc returns the streaming execution function of a plugin
+func (r *PluginRegistry) GetStreamFunc(id string) (StreamFunc, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	fn, ok := r.streamFuncs[id]
+	if !ok {
+		return nil, fmt.Errorf("plugin stream function not found: %s", id)
+	}
+	return fn, nil
+}
+
 // The global plugin registry
 var registry *PluginRegistry
 var registryOnce sync.Once
@@ -73,6 +101,39 @@ func (c *Command) Run() (string, error) {
 	return string(output), err
 }
 
+// Stream executes the command, passing each line of its combined output to
+// output as it is printed, and returns the whole output
+func (c *Command) Stream(output OutputFunc) (string, error) {
+	return streamCommand(exec.Command("bash", "-c", c.cmd), output)
+}
+
+// streamCommand runs cmd with stdout and stderr merged, passing each line to
+// output as it is printed, and returns the whole output
+func streamCommand(cmd *exec.Cmd, output OutputFunc) (string, error) {
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var all strings.Builder
+	reader := bufio.NewReader(pipe)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			all.WriteString(line)
+			output(strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			break
+		}
+	}
+	return all.String(), cmd.Wait()
+}
+
 // PluginLoader handles loading plugins from the filesystem
 type PluginLoader struct {
 	pluginsDir         string
@@ -164,6 +225,10 @@ func (p *PluginLoader) LoadPlugins() ([]types.Plugin, error) {
 
 		// Register with the registry
 		registry.RegisterPluginFunc(pluginID, p.pluginExecuteFuncs[pluginID])
+		registry.RegisterStreamFunc(pluginID, func(params map[string]interface{}, output OutputFunc) (interface{}, error) {
+			pluginInstance := &DynamicPlugin{pluginID: pluginID, pluginDir: pluginDir}
+			return pluginInstance.ExecuteStream(params, output)
+		})
 
 		// Also register the plugin execution functions from the helper
 		// Skip override for plugins that have proper standalone implementations
@@ -171,6 +236,11 @@ func (p *PluginLoader) LoadPlugins() ([]types.Plugin, error) {
 			if helperFunc, err := LoadPluginFunc(pluginDir, pluginID); err == nil {
 				// Override with the helper function if available
 				registry.RegisterPluginFunc(pluginID, helperFunc)
+				if streamFunc, ok := LoadPluginStreamFunc(pluginID); ok {
+					registry.RegisterStreamFunc(pluginID, streamFunc)
+				} else {
+					registry.UnregisterStreamFunc(pluginID)
+				}
 			}
 		}
 	}
@@ -262,6 +332,12 @@ func (p *DynamicPlugin) GetDefinition() types.PluginDefinition {
 
 // Execute runs the plugin with the given parameters
 func (p *DynamicPlugin) Execute(params map[string]interface{}) (interface{}, error) {
+	return p.ExecuteStream(params, nil)
+}
+
+// ExecuteStream runs the plugin like Execute, passing the output of plugins
+// with a main function to output line by line. A nil output only collects it.
+func (p *DynamicPlugin) ExecuteStream(params map[string]interface{}, output OutputFunc) (interface{}, error) {
 	// Check if the plugin has a main function by looking for package main
 	pluginGoPath := filepath.Join(p.pluginDir, "plugin.go")
 	pluginContent, err := os.ReadFile(pluginGoPath)
@@ -272,7 +348,7 @@ func (p *DynamicPlugin) Execute(params map[string]interface{}) (interface{}, err
 	// Check if plugin uses package main
 	if strings.Contains(string(pluginContent), "package main") {
 		// Plugin has main function, run it with command line arguments
-		return p.executeWithMain(params)
+		return p.executeWithMain(params, output)
 	} else {
 		// Plugin doesn't have main function, try to use it as a library
 		return p.executeWithLibrary(params)
@@ -280,7 +356,7 @@ func (p *DynamicPlugin) Execute(params map[string]interface{}) (interface{}, err
 }
 
 // executeWithMain runs plugins that have a main function
-func (p *DynamicPlugin) executeWithMain(params map[string]interface{}) (interface{}, error) {
+func (p *DynamicPlugin) executeWithMain(params map[string]interface{}, output OutputFunc) (interface{}, error) {
 	// Convert parameters to JSON
 	paramsJSON, err := json.Marshal(params)
 	if err != nil {
@@ -290,17 +366,24 @@ func (p *DynamicPlugin) executeWithMain(params map[string]interface{}) (interfac
 	// Run the plugin.go file with the parameters
 	cmdStr := fmt.Sprintf("cd %s && go run plugin.go --execute='%s'", p.pluginDir, string(paramsJSON))
 	cmd := exec.Command("bash", "-c", cmdStr)
-	output, err := cmd.CombinedOutput()
+	var combined []byte
+	if output != nil {
+		var text string
+		text, err = streamCommand(cmd, output)
+		combined = []byte(text)
+	} else {
+		combined, err = cmd.CombinedOutput()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute plugin %s: %v\nOutput: %s", p.pluginID, err, string(output))
+		return nil, fmt.Errorf("failed to execute plugin %s: %v\nOutput: %s", p.pluginID, err, string(combined))
 	}
 
 	// Try to parse the output as JSON
 	var result interface{}
-	if err := json.Unmarshal(output, &result); err != nil {
+	if err := json.Unmarshal(combined, &result); err != nil {
 		// If not valid JSON, return as string
 		return map[string]interface{}{
-			"result": string(output),
+			"result": string(combined),
 			"params": params,
 		}, nil
 	}
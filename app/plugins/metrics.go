@@ -0,0 +1,36 @@
+package plugins
+
+import (
+	"time"
+
+	"github.com/NetScout-Go/NetTool/app/telemetry"
+)
+
+// Plugin system metrics exposed on /metrics
+var (
+	pluginRuns = telemetry.Default.NewCounter("nettool_plugin_runs_total",
+		"Plugin executions by plugin ID and result.", "plugin", "result")
+	pluginRunDuration = telemetry.Default.NewHistogram("nettool_plugin_run_duration_seconds",
+		"Time taken by plugin executions.", nil, "plugin")
+	installerOps = telemetry.Default.NewCounter("nettool_plugin_installer_operations_total",
+		"Plugin installer operations by operation and result.", "operation", "result")
+)
+
+// recordPluginRun records the outcome and duration of a plugin execution
+func recordPluginRun(id string, start time.Time, err error) {
+	pluginRunDuration.Observe(time.Since(start).Seconds(), id)
+	pluginRuns.Inc(id, resultLabel(err))
+}
+
+// recordInstallerOp records the outcome of an installer operation
+func recordInstallerOp(operation string, err error) {
+	installerOps.Inc(operation, resultLabel(err))
+}
+
+// resultLabel maps an error to the "result" label value
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
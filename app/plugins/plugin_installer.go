@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // PluginMetadata represents the metadata of a plugin
@@ -54,6 +55,19 @@ type PluginInstaller struct {
 	config     *ConfigManager
 	// List of GitHub organizations from which plugins can be installed
 	pluginSources []PluginSource
+	// Receives the progress of install, update and uninstall operations
+	progress func(InstallerProgress)
+}
+
+// InstallerProgress reports a step of an installer operation
+type InstallerProgress struct {
+	Operation string    `json:"operation"`
+	Target    string    `json:"target"`          // repository, URL or plugin ID
+	Stage     string    `json:"stage"`           // started, progress, succeeded or failed
+	Error     string    `json:"error,omitempty"` // for failed operations
+	Index     int       `json:"index,omitempty"` // for bulk installs, the repository being installed (from 1)
+	Total     int       `json:"total,omitempty"` // for bulk installs, the number of repositories
+	Time      time.Time `json:"time"`
 }
 
 // PluginSource represents a source for plugins
@@ -115,31 +129,75 @@ type PluginCatalog struct {
 }
 
 // NewPluginInstaller creates a new plugin installer
-func NewPluginInstaller(pluginsDir string, manager *PluginManager) *PluginInstaller {
-	// Initialize with NetScout-Go as the default plugin source
-	defaultSources := []PluginSource{
-		{
-			Name:         "NetScout-Go",
-			Organization: "NetScout-Go",
-			IsDefault:    true,
-			Pattern:      "Plugin_*",
-		},
-	}
-
+func NewPluginInstaller(pluginsDir string, configPath string, manager *PluginManager) *PluginInstaller {
 	// Create config manager
-	configManager := NewConfigManager("app/plugins/config.json")
+	configManager := NewConfigManager(configPath)
 	err := configManager.LoadConfiguration()
 	if err != nil {
 		fmt.Printf("Warning: Failed to load configuration: %v\n", err)
 	}
 
 	// Create plugin installer
-	return &PluginInstaller{
-		pluginsDir:    pluginsDir,
-		manager:       manager,
-		config:        configManager,
-		pluginSources: defaultSources,
+	pi := &PluginInstaller{
+		pluginsDir: pluginsDir,
+		manager:    manager,
+		config:     configManager,
+	}
+	pi.ReloadSources()
+	return pi
+}
+
+// Config returns the configuration holding GitHub tokens and plugin sources
+func (pi *PluginInstaller) Config() *ConfigManager {
+	return pi.config
+}
+
+// ReloadSources makes the plugin sources in the configuration the ones the
+// installer lists and installs from, with NetScout-Go as the default when
+// the configuration has none
+func (pi *PluginInstaller) ReloadSources() {
+	sources := pi.config.GetSources()
+	if len(sources) == 0 {
+		sources = []PluginSource{
+			{
+				Name:         "NetScout-Go",
+				Organization: "NetScout-Go",
+				IsDefault:    true,
+				Pattern:      "Plugin_*",
+			},
+		}
+	}
+	pi.pluginSources = sources
+}
+
+// SetProgressHandler sets the function that receives the progress of installer operations
+func (pi *PluginInstaller) SetProgressHandler(handler func(InstallerProgress)) {
+	pi.progress = handler
+}
+
+// reportProgress passes the progress of an operation to the progress handler
+func (pi *PluginInstaller) reportProgress(progress InstallerProgress) {
+	if pi.progress == nil {
+		return
+	}
+	progress.Time = time.Now()
+	pi.progress(progress)
+}
+
+// startOp reports that an operation started
+func (pi *PluginInstaller) startOp(operation string, target string) {
+	pi.reportProgress(InstallerProgress{Operation: operation, Target: target, Stage: "started"})
+}
+
+// endOp records the outcome of an operation and reports it
+func (pi *PluginInstaller) endOp(operation string, target string, err error) {
+	recordInstallerOp(operation, err)
+	progress := InstallerProgress{Operation: operation, Target: target, Stage: "succeeded"}
+	if err != nil {
+		progress.Stage = "failed"
+		progress.Error = err.Error()
 	}
+	pi.reportProgress(progress)
 }
 
 // ListInstalledPlugins returns a list of installed plugins with metadata
@@ -219,6 +277,14 @@ func (pi *PluginInstaller) GetPluginDetails(pluginID string) (PluginMetadata, er
 
 // InstallPlugin installs a plugin from a URL or Git repository
 func (pi *PluginInstaller) InstallPlugin(url string) (PluginMetadata, error) {
+	pi.startOp("install", url)
+	metadata, err := pi.installPlugin(url)
+	pi.endOp("install", url, err)
+	return metadata, err
+}
+
+// installPlugin does the work of InstallPlugin; the exported method records its outcome
+func (pi *PluginInstaller) installPlugin(url string) (PluginMetadata, error) {
 	// Create a temporary directory
 	tempDir, err := os.MkdirTemp("", "nettool-plugin-")
 	if err != nil {
@@ -304,6 +370,14 @@ func (pi *PluginInstaller) InstallPlugin(url string) (PluginMetadata, error) {
 
 // UploadPlugin installs a plugin from an uploaded ZIP file
 func (pi *PluginInstaller) UploadPlugin(file io.Reader) (PluginMetadata, error) {
+	pi.startOp("upload", "")
+	metadata, err := pi.uploadPlugin(file)
+	pi.endOp("upload", metadata.ID, err)
+	return metadata, err
+}
+
+// uploadPlugin does the work of UploadPlugin; the exported method records its outcome
+func (pi *PluginInstaller) uploadPlugin(file io.Reader) (PluginMetadata, error) {
 	// Create a temporary directory
 	tempDir, err := os.MkdirTemp("", "nettool-plugin-upload-")
 	if err != nil {
@@ -373,6 +447,14 @@ func (pi *PluginInstaller) UploadPlugin(file io.Reader) (PluginMetadata, error)
 
 // UpdatePlugin updates a plugin to the latest version
 func (pi *PluginInstaller) UpdatePlugin(pluginID string) (PluginMetadata, error) {
+	pi.startOp("update", pluginID)
+	metadata, err := pi.updatePlugin(pluginID)
+	pi.endOp("update", pluginID, err)
+	return metadata, err
+}
+
+// updatePlugin does the work of UpdatePlugin; the exported method records its outcome
+func (pi *PluginInstaller) updatePlugin(pluginID string) (PluginMetadata, error) {
 	// Find the plugin directory
 	pluginDir := filepath.Join(pi.pluginsDir, pluginID)
 	if _, err := os.Stat(pluginDir); os.IsNotExist(err) {
@@ -421,6 +503,14 @@ func (pi *PluginInstaller) UpdatePlugin(pluginID string) (PluginMetadata, error)
 
 // UninstallPlugin uninstalls a plugin
 func (pi *PluginInstaller) UninstallPlugin(pluginID string) (PluginMetadata, error) {
+	pi.startOp("uninstall", pluginID)
+	metadata, err := pi.uninstallPlugin(pluginID)
+	pi.endOp("uninstall", pluginID, err)
+	return metadata, err
+}
+
+// uninstallPlugin does the work of UninstallPlugin; the exported method records its outcome
+func (pi *PluginInstaller) uninstallPlugin(pluginID string) (PluginMetadata, error) {
 	// Find the plugin directory
 	pluginDir := filepath.Join(pi.pluginsDir, pluginID)
 	if _, err := os.Stat(pluginDir); os.IsNotExist(err) {
@@ -594,6 +684,15 @@ func (pi *PluginInstaller) updatePluginJsonWithGitInfo(pluginDir string, gitInfo
 
 // InstallFromGitHub installs a plugin from a GitHub repository in the specified organization
 func (pi *PluginInstaller) InstallFromGitHub(org string, repo string, branch string) (PluginMetadata, error) {
+	target := org + "/" + repo
+	pi.startOp("install_github", target)
+	metadata, err := pi.installFromGitHub(org, repo, branch)
+	pi.endOp("install_github", target, err)
+	return metadata, err
+}
+
+// installFromGitHub does the work of InstallFromGitHub; the exported method records its outcome
+func (pi *PluginInstaller) installFromGitHub(org string, repo string, branch string) (PluginMetadata, error) {
 	// If branch is empty, use main as default
 	if branch == "" {
 		branch = "main"
@@ -1657,7 +1756,16 @@ func (pi *PluginInstaller) buildPlugin(pluginDir string) error {
 }
 
 // InstallPluginFromRepository installs a plugin from a GitHub repository
-func (pi *PluginInstaller) InstallPluginFromRepository(repository string) error { // Extract organization and repo name from repository URL
+func (pi *PluginInstaller) InstallPluginFromRepository(repository string) error {
+	pi.startOp("install_repository", repository)
+	err := pi.installPluginFromRepository(repository)
+	pi.endOp("install_repository", repository, err)
+	return err
+}
+
+// installPluginFromRepository does the work of InstallPluginFromRepository; the exported method records its outcome
+func (pi *PluginInstaller) installPluginFromRepository(repository string) error {
+	// Extract organization and repo name from repository URL
 	// Example: https://github.com/NetScout-Go/Plugin_ping
 	parts := strings.Split(repository, "/")
 	if len(parts) < 2 {
@@ -1720,10 +1828,12 @@ func (pi *PluginInstaller) BulkInstallPlugins(repositories []string) BulkInstall
 	successCount := 0
 	failureCount := 0
 
-	for _, repo := range repositories {
+	pi.reportProgress(InstallerProgress{Operation: "bulk_install", Stage: "started", Total: len(repositories)})
+	for i, repo := range repositories {
 		result := BulkInstallResult{
 			PluginID: extractPluginIDFromRepo(repo),
 		}
+		pi.reportProgress(InstallerProgress{Operation: "bulk_install", Target: repo, Stage: "progress", Index: i + 1, Total: len(repositories)})
 
 		plugin, err := pi.InstallPlugin(repo)
 		if err != nil {
@@ -1738,6 +1848,11 @@ func (pi *PluginInstaller) BulkInstallPlugins(repositories []string) BulkInstall
 
 		results = append(results, result)
 	}
+	stage := "succeeded"
+	if failureCount > 0 {
+		stage = "failed"
+	}
+	pi.reportProgress(InstallerProgress{Operation: "bulk_install", Stage: stage, Total: len(repositories)})
 
 	return BulkInstallResponse{
 		Results:        results,
@@ -126,11 +126,33 @@ func LoadPluginFunc(pluginDir, pluginID string) (func(map[string]interface{}) (i
 	}, nil
 }
 
+// LoadPluginStreamFunc returns a streaming execution function for helper
+// implementations that run long commands, such as ping and traceroute
+func LoadPluginStreamFunc(pluginID string) (StreamFunc, bool) {
+	switch pluginID {
+	case "ping":
+		return executePingStream, true
+	case "traceroute":
+		return executeTracerouteStream, true
+	case "port_scanner":
+		return executePortScannerStream, true
+	}
+	return nil, false
+}
+
 // Helper function to execute a shell command
 func executeCommand(command string) (string, error) {
+	return streamCommandOutput(command, nil)
+}
+
+// streamCommandOutput executes a shell command, passing its output line by
+// line to output when it is set
+func streamCommandOutput(command string, output OutputFunc) (string, error) {
 	cmd := NewCommand(command)
-	output, err := cmd.Run()
-	return output, err
+	if output != nil {
+		return cmd.Stream(output)
+	}
+	return cmd.Run()
 }
 
 // Specific implementations for each plugin
@@ -248,6 +270,10 @@ func executeNetworkLatencyHeatmap(params map[string]interface{}) (interface{}, e
 }
 
 func executePing(params map[string]interface{}) (interface{}, error) {
+	return executePingStream(params, nil)
+}
+
+func executePingStream(params map[string]interface{}, stream OutputFunc) (interface{}, error) {
 	// Direct implementation without recursion
 	host, _ := params["host"].(string)
 	countParam, _ := params["count"].(float64)
@@ -260,7 +286,7 @@ func executePing(params map[string]interface{}) (interface{}, error) {
 	}
 
 	cmd := fmt.Sprintf("ping -c %d %s", int(countParam), host)
-	output, err := executeCommand(cmd)
+	output, err := streamCommandOutput(cmd, stream)
 	if err != nil {
 		return nil, fmt.Errorf("ping failed: %v", err)
 	}
@@ -273,6 +299,10 @@ func executePing(params map[string]interface{}) (interface{}, error) {
 }
 
 func executeTraceroute(params map[string]interface{}) (interface{}, error) {
+	return executeTracerouteStream(params, nil)
+}
+
+func executeTracerouteStream(params map[string]interface{}, stream OutputFunc) (interface{}, error) {
 	// Similar implementation to ping
 	host, _ := params["host"].(string)
 	if host == "" {
@@ -280,7 +310,7 @@ func executeTraceroute(params map[string]interface{}) (interface{}, error) {
 	}
 
 	cmd := fmt.Sprintf("traceroute %s", host)
-	output, err := executeCommand(cmd)
+	output, err := streamCommandOutput(cmd, stream)
 
 	return map[string]interface{}{
 		"command": cmd,
@@ -306,13 +336,17 @@ func executeDNSLookup(params map[string]interface{}) (interface{}, error) {
 }
 
 func executePortScanner(params map[string]interface{}) (interface{}, error) {
+	return executePortScannerStream(params, nil)
+}
+
+func executePortScannerStream(params map[string]interface{}, stream OutputFunc) (interface{}, error) {
 	host, _ := params["host"].(string)
 	if host == "" {
 		return nil, fmt.Errorf("host parameter is required")
 	}
 
 	cmd := fmt.Sprintf("nmap -p 1-1000 %s", host)
-	output, err := executeCommand(cmd)
+	output, err := streamCommandOutput(cmd, stream)
 
 	return map[string]interface{}{
 		"command": cmd,
@@ -6,7 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
+	"github.com/NetScout-Go/NetTool/app/core"
 	"github.com/NetScout-Go/NetTool/app/plugins/types"
 )
 
@@ -53,18 +55,34 @@ type Plugin struct {
 	Icon        string                                            `json:"icon"`
 	Parameters  []Parameter                                       `json:"parameters"`
 	Execute     func(map[string]interface{}) (interface{}, error) `json:"-"`
+	Stream      StreamFunc                                        `json:"-"`         // Optional; reports output while running
+	Streaming   bool                                              `json:"streaming"` // Whether Stream is set
 }
 
+// OutputFunc receives a line of plugin output as soon as it is produced
+type OutputFunc func(line string)
+
+// StreamFunc runs a plugin like Execute, passing its partial output to output
+type StreamFunc func(params map[string]interface{}, output OutputFunc) (interface{}, error)
+
 // PluginManager manages the plugins in NetTool
 type PluginManager struct {
-	plugins map[string]*Plugin
-	mu      sync.RWMutex
+	pluginsDir string
+	plugins    map[string]*Plugin
+	mu         sync.RWMutex
 }
 
-// NewPluginManager creates a new plugin manager
-func NewPluginManager() *PluginManager {
+// DefaultPluginsDir is where plugins are installed unless configured otherwise
+const DefaultPluginsDir = "app/plugins/plugins"
+
+// NewPluginManager creates a new plugin manager for the plugins in pluginsDir
+func NewPluginManager(pluginsDir string) *PluginManager {
+	if pluginsDir == "" {
+		pluginsDir = DefaultPluginsDir
+	}
 	return &PluginManager{
-		plugins: make(map[string]*Plugin),
+		pluginsDir: pluginsDir,
+		plugins:    make(map[string]*Plugin),
 	}
 }
 
@@ -106,17 +124,76 @@ func (pm *PluginManager) RunPlugin(id string, params map[string]interface{}) (in
 		return nil, err
 	}
 
+	start := time.Now()
+
 	// Validate parameters
+	if err := checkRequiredParams(plugin, params); err != nil {
+		recordPluginRun(id, start, err)
+		return nil, err
+	}
+
+	// Execute plugin
+	result, err := plugin.Execute(params)
+	recordPluginRun(id, start, err)
+	return result, err
+}
+
+// RunPluginStream runs a plugin like RunPluginInNetns, passing partial output
+// to output when the plugin can stream it. Runs in other network namespaces
+// only report their final result.
+func (pm *PluginManager) RunPluginStream(id string, netns string, params map[string]interface{}, output OutputFunc) (interface{}, error) {
+	plugin, err := pm.GetPlugin(id)
+	if err != nil {
+		return nil, err
+	}
+	if netns != "" || plugin.Stream == nil {
+		return pm.RunPluginInNetns(id, netns, params)
+	}
+
+	start := time.Now()
+	if err := checkRequiredParams(plugin, params); err != nil {
+		recordPluginRun(id, start, err)
+		return nil, err
+	}
+
+	result, err := plugin.Stream(params, output)
+	recordPluginRun(id, start, err)
+	return result, err
+}
+
+// RunPluginInNetns runs a plugin inside a network namespace through a helper
+// process. An empty netns runs it in NetTool's own namespace.
+func (pm *PluginManager) RunPluginInNetns(id string, netns string, params map[string]interface{}) (interface{}, error) {
+	if netns == "" {
+		return pm.RunPlugin(id, params)
+	}
+	plugin, err := pm.GetPlugin(id)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if err := checkRequiredParams(plugin, params); err != nil {
+		recordPluginRun(id, start, err)
+		return nil, err
+	}
+
+	var result interface{}
+	err = core.RunNetnsHelper(netns, core.NetnsRequest{Action: "plugin", Plugin: id, Params: params}, &result)
+	recordPluginRun(id, start, err)
+	return result, err
+}
+
+// checkRequiredParams makes sure every required parameter of a plugin is present
+func checkRequiredParams(plugin *Plugin, params map[string]interface{}) error {
 	for _, param := range plugin.Parameters {
 		if param.Required {
 			if _, ok := params[param.ID]; !ok {
-				return nil, errors.New("missing required parameter: " + param.ID)
+				return errors.New("missing required parameter: " + param.ID)
 			}
 		}
 	}
-
-	// Execute plugin
-	return plugin.Execute(params)
+	return nil
 }
 
 // RegisterPlugins refreshes and registers all plugins
@@ -128,7 +205,7 @@ func (pm *PluginManager) RegisterPlugins() error {
 // RefreshPlugins refreshes the list of plugins from the plugins directory
 func (pm *PluginManager) RefreshPlugins() error {
 	// Create a plugin loader
-	loader := NewPluginLoader("app/plugins/plugins")
+	loader := NewPluginLoader(pm.pluginsDir)
 
 	// Load plugins
 	_, err := loader.LoadPlugins()
@@ -147,7 +224,7 @@ func (pm *PluginManager) RefreshPlugins() error {
 	pm.plugins = make(map[string]*Plugin)
 
 	// List directories in the plugins directory
-	entries, err := os.ReadDir("app/plugins/plugins")
+	entries, err := os.ReadDir(pm.pluginsDir)
 	if err != nil {
 		return fmt.Errorf("failed to read plugins directory: %v", err)
 	}
@@ -158,7 +235,7 @@ func (pm *PluginManager) RefreshPlugins() error {
 			continue
 		}
 
-		pluginDir := filepath.Join("app/plugins/plugins", entry.Name())
+		pluginDir := filepath.Join(pm.pluginsDir, entry.Name())
 		pluginID := entry.Name()
 
 		// Get the plugin execution function from the registry
@@ -190,6 +267,10 @@ func (pm *PluginManager) RefreshPlugins() error {
 			Parameters:  convertParameters(definition.Parameters),
 			Execute:     executeFunc,
 		}
+		if streamFunc, err := registry.GetStreamFunc(pluginID); err == nil {
+			pm.plugins[pluginID].Stream = streamFunc
+			pm.plugins[pluginID].Streaming = true
+		}
 
 		fmt.Printf("Registered plugin: %s (%s)\n", definition.Name, definition.ID)
 	}
@@ -218,6 +299,284 @@ func (pm *PluginManager) RefreshPlugins() error {
 		},
 	})
 
+	// Register dhcp_probe plugin
+	registerIfNotExists(&Plugin{
+		ID:          "dhcp_probe",
+		Name:        "DHCP Server Probe",
+		Description: "Broadcasts DHCPDISCOVER and DHCPv6 SOLICIT without accepting a lease and flags servers outside the allow-list",
+		Version:     "1.0.0",
+		Author:      "NetTool Team",
+		License:     "MIT",
+		Icon:        "shield-exclamation",
+		Parameters: []Parameter{
+			{
+				ID:          "interface",
+				Name:        "Interface",
+				Description: "Network interface to probe on",
+				Type:        TypeString,
+				Required:    true,
+			},
+			{
+				ID:          "timeout",
+				Name:        "Timeout (seconds)",
+				Description: "How long to collect offers",
+				Type:        TypeNumber,
+				Default:     5,
+				Min:         floatPtr(1),
+				Max:         floatPtr(30),
+			},
+			{
+				ID:          "allowedServers",
+				Name:        "Allowed Servers",
+				Description: "Comma-separated server IDs or addresses of legitimate DHCP servers",
+				Type:        TypeString,
+			},
+			{
+				ID:          "ipv6",
+				Name:        "Probe DHCPv6",
+				Description: "Also send a DHCPv6 SOLICIT",
+				Type:        TypeBoolean,
+				Default:     true,
+			},
+		},
+		Execute: executeDHCPProbe,
+	})
+
+	// Register SNTP query plugin
+	registerIfNotExists(&Plugin{
+		ID:          "sntp_query",
+		Name:        "SNTP Query",
+		Description: "Measures this device's clock offset and the network delay against any NTP server",
+		Version:     "1.0.0",
+		Author:      "NetTool Team",
+		License:     "MIT",
+		Icon:        "clock",
+		Parameters: []Parameter{
+			{
+				ID:          "server",
+				Name:        "NTP Server",
+				Description: "Hostname or IP address, optionally with :port",
+				Type:        TypeString,
+				Required:    true,
+				Default:     "pool.ntp.org",
+			},
+			{
+				ID:          "samples",
+				Name:        "Samples",
+				Description: "Number of requests; the one with the lowest delay is reported",
+				Type:        TypeNumber,
+				Default:     4,
+				Min:         floatPtr(1),
+				Max:         floatPtr(16),
+			},
+			{
+				ID:          "timeout",
+				Name:        "Timeout (seconds)",
+				Description: "How long to wait for each reply",
+				Type:        TypeNumber,
+				Default:     2,
+				Min:         floatPtr(1),
+				Max:         floatPtr(10),
+			},
+		},
+		Execute: executeSNTPQuery,
+	})
+
+	// Register IPv6 readiness plugin
+	registerIfNotExists(&Plugin{
+		ID:          "ipv6_readiness",
+		Name:        "IPv6 Readiness",
+		Description: "Checks IPv6 addresses, router advertisements, the default route, AAAA resolution and dual-stack performance",
+		Version:     "1.0.0",
+		Author:      "NetTool Team",
+		License:     "MIT",
+		Icon:        "globe",
+		Parameters: []Parameter{
+			{
+				ID:          "listen",
+				Name:        "Listen Time (seconds)",
+				Description: "How long to wait for router advertisements after soliciting them",
+				Type:        TypeNumber,
+				Default:     3,
+				Min:         floatPtr(1),
+				Max:         floatPtr(10),
+			},
+		},
+		Execute: executeIPv6Readiness,
+	})
+
+	// Register connections plugin
+	registerIfNotExists(&Plugin{
+		ID:          "connections",
+		Name:        "Connections",
+		Description: "Lists TCP and UDP listeners and flows with their queues, RTT, retransmits and owning process",
+		Version:     "1.0.0",
+		Author:      "NetTool Team",
+		License:     "MIT",
+		Icon:        "diagram-3",
+		Parameters: []Parameter{
+			{
+				ID:          "protocol",
+				Name:        "Protocol",
+				Description: "Only show sockets of this protocol",
+				Type:        TypeSelect,
+				Default:     "all",
+				Options: []Option{
+					{Value: "all", Label: "All"},
+					{Value: "tcp", Label: "TCP"},
+					{Value: "udp", Label: "UDP"},
+					{Value: "tcp6", Label: "TCP (IPv6 only)"},
+					{Value: "udp6", Label: "UDP (IPv6 only)"},
+				},
+			},
+			{
+				ID:          "state",
+				Name:        "State",
+				Description: "Only show sockets in this state",
+				Type:        TypeSelect,
+				Default:     "all",
+				Options: []Option{
+					{Value: "all", Label: "All"},
+					{Value: "LISTEN", Label: "Listen"},
+					{Value: "ESTABLISHED", Label: "Established"},
+					{Value: "TIME_WAIT", Label: "Time wait"},
+					{Value: "CLOSE_WAIT", Label: "Close wait"},
+					{Value: "SYN_SENT", Label: "SYN sent"},
+					{Value: "UNCONN", Label: "Unconnected (UDP)"},
+				},
+			},
+			{
+				ID:          "port",
+				Name:        "Port",
+				Description: "Only show sockets with this local or remote port",
+				Type:        TypeNumber,
+				Min:         floatPtr(1),
+				Max:         floatPtr(65535),
+			},
+			{
+				ID:          "pid",
+				Name:        "PID",
+				Description: "Only show sockets owned by this process ID",
+				Type:        TypeNumber,
+				Min:         floatPtr(1),
+			},
+			{
+				ID:          "command",
+				Name:        "Process Name",
+				Description: "Only show sockets whose process name contains this text",
+				Type:        TypeString,
+			},
+			{
+				ID:          "listening",
+				Name:        "Listeners Only",
+				Description: "Only show listening TCP sockets and unconnected UDP sockets",
+				Type:        TypeBoolean,
+				Default:     false,
+			},
+			{
+				ID:          "established",
+				Name:        "Established Only",
+				Description: "Only show established connections",
+				Type:        TypeBoolean,
+				Default:     false,
+			},
+		},
+		Execute: executeConnections,
+	})
+
+	// Register firewall_trace plugin
+	registerIfNotExists(&Plugin{
+		ID:          "firewall_trace",
+		Name:        "Firewall Packet Tracer",
+		Description: "Evaluates which nftables/iptables chain and rule a packet would hit on this device and whether it would be accepted",
+		Version:     "1.0.0",
+		Author:      "NetTool Team",
+		License:     "MIT",
+		Icon:        "bricks",
+		Parameters: []Parameter{
+			{
+				ID:          "protocol",
+				Name:        "Protocol",
+				Description: "Transport protocol of the packet",
+				Type:        TypeSelect,
+				Required:    true,
+				Default:     "tcp",
+				Options: []Option{
+					{Value: "tcp", Label: "TCP"},
+					{Value: "udp", Label: "UDP"},
+					{Value: "icmp", Label: "ICMP"},
+					{Value: "icmpv6", Label: "ICMPv6"},
+				},
+			},
+			{
+				ID:          "source",
+				Name:        "Source Address",
+				Description: "Source IP address",
+				Type:        TypeString,
+			},
+			{
+				ID:          "destination",
+				Name:        "Destination Address",
+				Description: "Destination IP address",
+				Type:        TypeString,
+			},
+			{
+				ID:          "sourcePort",
+				Name:        "Source Port",
+				Description: "Source port (TCP/UDP)",
+				Type:        TypeNumber,
+				Min:         floatPtr(0),
+				Max:         floatPtr(65535),
+			},
+			{
+				ID:          "destinationPort",
+				Name:        "Destination Port",
+				Description: "Destination port (TCP/UDP)",
+				Type:        TypeNumber,
+				Min:         floatPtr(0),
+				Max:         floatPtr(65535),
+			},
+			{
+				ID:          "direction",
+				Name:        "Direction",
+				Description: "Whether the packet is addressed to, sent by or routed through this device",
+				Type:        TypeSelect,
+				Default:     "input",
+				Options: []Option{
+					{Value: "input", Label: "Incoming"},
+					{Value: "output", Label: "Outgoing"},
+					{Value: "forward", Label: "Forwarded"},
+				},
+			},
+			{
+				ID:          "inInterface",
+				Name:        "Input Interface",
+				Description: "Interface the packet arrives on (incoming and forwarded packets)",
+				Type:        TypeString,
+			},
+			{
+				ID:          "outInterface",
+				Name:        "Output Interface",
+				Description: "Interface the packet leaves on (outgoing and forwarded packets)",
+				Type:        TypeString,
+			},
+			{
+				ID:          "state",
+				Name:        "Connection State",
+				Description: "Conntrack state of the packet",
+				Type:        TypeSelect,
+				Default:     "new",
+				Options: []Option{
+					{Value: "new", Label: "New"},
+					{Value: "established", Label: "Established"},
+					{Value: "related", Label: "Related"},
+					{Value: "invalid", Label: "Invalid"},
+				},
+			},
+		},
+		Execute: executeFirewallTrace,
+	})
+
 	return nil
 }
 
@@ -0,0 +1,533 @@
+package realtime
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Hub defaults
+const (
+	DefaultQueueSize    = 256
+	DefaultWriteTimeout = 10 * time.Second
+	DefaultPingInterval = 30 * time.Second
+	DefaultReplaySize   = 256
+)
+
+// Reasons a client is disconnected, as counted in HubStats
+const (
+	DisconnectClosed      = "closed"       // the client closed the connection or sent something unreadable
+	DisconnectSlow        = "slow"         // the send queue overflowed
+	DisconnectWriteError  = "write_error"  // a write failed or timed out
+	DisconnectPingTimeout = "ping_timeout" // no pong arrived in time
+	DisconnectShutdown    = "shutdown"     // the hub was closed
+)
+
+// Hub tracks WebSocket and Server-Sent Events clients and routes published
+// messages to the clients subscribed to their topic. Each client has a writer
+// goroutine fed by a bounded queue, so a slow client never blocks publishers
+// or other clients: snapshots it has not received yet are replaced by newer
+// ones, and a client whose queue of other messages overflows is disconnected.
+// Published messages get increasing IDs and the latest are kept for clients
+// resuming an event stream.
+type Hub struct {
+	// InitialState returns the messages a client receives right after
+	// subscribing to a topic, such as the current snapshot or the job so far
+	InitialState func(topic string) []Message
+
+	// QueueSize, WriteTimeout and PingInterval fall back to their defaults
+	// when not positive; a ReplaySize that is not positive keeps nothing
+	QueueSize    int           // messages waiting to be written per client
+	WriteTimeout time.Duration // for each write
+	PingInterval time.Duration // WebSocket clients must answer a ping within twice this
+	ReplaySize   int           // published messages kept for resuming event streams
+
+	clients     map[*Client]bool
+	closed      bool
+	nextID      uint64
+	replay      []Message // ring buffer of the latest published messages
+	replayNext  int
+	sent        atomic.Uint64
+	coalesced   atomic.Uint64
+	disconnects map[string]uint64
+	serving     sync.WaitGroup // registered clients not yet removed
+	mu          sync.Mutex
+}
+
+// HubStats describes the hub's clients and what it delivered to them
+type HubStats struct {
+	Clients     int               `json:"clients"`
+	Queued      int               `json:"queued"`      // messages waiting in client queues
+	Sent        uint64            `json:"sent"`        // messages written to clients
+	Coalesced   uint64            `json:"coalesced"`   // snapshots replaced by a newer one before being written
+	Disconnects map[string]uint64 `json:"disconnects"` // by reason
+}
+
+// NewHub creates an empty hub with the default queue size and timeouts.
+// Message IDs start from the current time in microseconds, so IDs from
+// before a restart are older than anything the new hub can replay.
+func NewHub() *Hub {
+	return &Hub{
+		QueueSize:    DefaultQueueSize,
+		WriteTimeout: DefaultWriteTimeout,
+		PingInterval: DefaultPingInterval,
+		ReplaySize:   DefaultReplaySize,
+		clients:      make(map[*Client]bool),
+		nextID:       uint64(time.Now().UnixMicro()),
+		disconnects:  make(map[string]uint64),
+	}
+}
+
+// queueSize returns QueueSize, or the default if it is not positive
+func (h *Hub) queueSize() int {
+	if h.QueueSize <= 0 {
+		return DefaultQueueSize
+	}
+	return h.QueueSize
+}
+
+// writeTimeout returns WriteTimeout, or the default if it is not positive
+func (h *Hub) writeTimeout() time.Duration {
+	if h.WriteTimeout <= 0 {
+		return DefaultWriteTimeout
+	}
+	return h.WriteTimeout
+}
+
+// pingInterval returns PingInterval, or the default if it is not positive
+func (h *Hub) pingInterval() time.Duration {
+	if h.PingInterval <= 0 {
+		return DefaultPingInterval
+	}
+	return h.PingInterval
+}
+
+// transport writes messages to a connected client
+type transport interface {
+	write(message Message, timeout time.Duration) error
+	ping(timeout time.Duration) error
+	// close tells the client why it is being disconnected, when the protocol allows
+	close(reason string, timeout time.Duration)
+}
+
+// Client is a connection and the topics it follows
+type Client struct {
+	hub       *Hub
+	transport transport
+	queue     []Message // waiting to be written, in publishing order
+	queued    int       // messages in queue that are not snapshots
+	queueSize int
+	wake      chan struct{} // signals that the queue is not empty
+	subs      map[string]*subscription
+	done      chan struct{} // closed when the client is disconnected
+	reason    string
+	closeOnce sync.Once
+	mu        sync.Mutex
+}
+
+// subscription is a followed topic and its rate limit state
+type subscription struct {
+	minInterval time.Duration
+	lastSent    time.Time
+	pending     *Message // the latest update held back by the rate limit
+	timer       *time.Timer
+}
+
+// newClient creates a client following topics
+func newClient(h *Hub, t transport, topics []Subscription) *Client {
+	c := &Client{
+		hub:       h,
+		transport: t,
+		queueSize: h.queueSize(),
+		wake:      make(chan struct{}, 1),
+		subs:      make(map[string]*subscription),
+		done:      make(chan struct{}),
+	}
+	for _, s := range topics {
+		c.subs[s.Topic] = &subscription{minInterval: time.Duration(s.MinIntervalMS) * time.Millisecond}
+	}
+	return c
+}
+
+// register adds a client to the hub and queues the published messages after
+// lastID for it. It returns false if the hub is closed, and whether the
+// messages after lastID were still all available for replay.
+func (h *Hub) register(c *Client, lastID uint64) (registered bool, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false, false
+	}
+	h.clients[c] = true
+	h.serving.Add(1)
+	if lastID == 0 {
+		return true, true
+	}
+
+	// Registering and replaying under the lock keeps publishers from
+	// slipping a newer message in before the replayed ones. An ID older than
+	// the oldest kept message, or newer than the last published one (from
+	// before a restart), means the client missed messages.
+	oldest := h.nextID - uint64(len(h.replay)) + 1
+	complete = lastID+1 >= oldest && lastID <= h.nextID
+	if !complete {
+		c.enqueue(NewMessage(TypeResync, "", map[string]interface{}{"lastEventId": lastID}))
+	}
+	for _, message := range h.replayedAfter(lastID) {
+		c.deliver(message)
+	}
+	return true, complete
+}
+
+// replayedAfter returns the kept messages with an ID above lastID, oldest first
+func (h *Hub) replayedAfter(lastID uint64) []Message {
+	var messages []Message
+	n := len(h.replay)
+	for i := 0; i < n; i++ {
+		message := h.replay[(h.replayNext+i)%n]
+		if message.ID > lastID {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// serve writes queued messages to the client until it is disconnected
+func (h *Hub) serve(c *Client) {
+	c.writeLoop()
+	h.remove(c)
+	h.serving.Done()
+}
+
+// Close disconnects every client, telling them the server is going away, and
+// refuses new ones
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		client.disconnect(DisconnectShutdown)
+	}
+}
+
+// Shutdown closes the hub and waits until every client has been written the
+// messages still queued for it and disconnected, or until ctx is done
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.Close()
+	done := make(chan struct{})
+	go func() {
+		h.serving.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ClientCount returns the number of connected clients
+func (h *Hub) ClientCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Stats returns the hub's client count, queued messages and counters
+func (h *Hub) Stats() HubStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := HubStats{
+		Clients:     len(h.clients),
+		Sent:        h.sent.Load(),
+		Coalesced:   h.coalesced.Load(),
+		Disconnects: make(map[string]uint64, len(h.disconnects)),
+	}
+	for client := range h.clients {
+		client.mu.Lock()
+		stats.Queued += len(client.queue)
+		client.mu.Unlock()
+	}
+	for reason, count := range h.disconnects {
+		stats.Disconnects[reason] = count
+	}
+	return stats
+}
+
+// DisconnectReasons returns the reasons in stats in a stable order
+func (s HubStats) DisconnectReasons() []string {
+	reasons := make([]string, 0, len(s.Disconnects))
+	for reason := range s.Disconnects {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// HasSubscribers reports whether any client follows a topic, so publishers can
+// skip building messages nobody receives
+func (h *Hub) HasSubscribers(topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if client.subscription(topic) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish gives a message the next ID, keeps it for replay and queues it for
+// every client subscribed to its topic. It never waits for clients.
+func (h *Hub) Publish(message Message) {
+	h.mu.Lock()
+	h.nextID++
+	message.ID = h.nextID
+	if h.ReplaySize > 0 {
+		if len(h.replay) < h.ReplaySize {
+			h.replay = append(h.replay, message)
+		} else {
+			h.replay[h.replayNext] = message
+			h.replayNext = (h.replayNext + 1) % len(h.replay)
+		}
+	}
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		client.deliver(message)
+	}
+}
+
+// remove forgets a disconnected client
+func (h *Hub) remove(client *Client) {
+	client.disconnect(DisconnectClosed)
+
+	h.mu.Lock()
+	delete(h.clients, client)
+	h.disconnects[client.reason]++
+	h.mu.Unlock()
+
+	client.mu.Lock()
+	for _, sub := range client.subs {
+		if sub.timer != nil {
+			sub.timer.Stop()
+		}
+	}
+	client.mu.Unlock()
+}
+
+// writeLoop is the only goroutine writing to the client. It writes queued
+// messages in order and pings the client while it is idle.
+func (c *Client) writeLoop() {
+	ticker := time.NewTicker(c.hub.pingInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.wake:
+			for {
+				message, ok := c.next()
+				if !ok {
+					break
+				}
+				if err := c.transport.write(message, c.hub.writeTimeout()); err != nil {
+					c.disconnect(DisconnectWriteError)
+					return
+				}
+				c.hub.sent.Add(1)
+			}
+		case <-ticker.C:
+			if err := c.transport.ping(c.hub.writeTimeout()); err != nil {
+				c.disconnect(DisconnectWriteError)
+				return
+			}
+		case <-c.done:
+			if c.reason == DisconnectShutdown {
+				c.drain()
+			}
+			c.transport.close(c.reason, c.hub.writeTimeout())
+			return
+		}
+	}
+}
+
+// drain writes the messages still queued, so clients disconnected by a
+// shutdown receive everything published before it
+func (c *Client) drain() {
+	for {
+		message, ok := c.next()
+		if !ok {
+			return
+		}
+		if err := c.transport.write(message, c.hub.writeTimeout()); err != nil {
+			return
+		}
+		c.hub.sent.Add(1)
+	}
+}
+
+// next removes and returns the oldest queued message
+func (c *Client) next() (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 {
+		return Message{}, false
+	}
+	message := c.queue[0]
+	c.queue = c.queue[1:]
+	if !coalesces(message) {
+		c.queued--
+	}
+	return message, true
+}
+
+// disconnect stops the client; the first reason given is the one recorded
+func (c *Client) disconnect(reason string) {
+	c.closeOnce.Do(func() {
+		c.reason = reason
+		close(c.done)
+	})
+}
+
+// enqueue hands a message to the writer without waiting. A snapshot replaces
+// an unsent snapshot of the same type and topic and moves to the end of the
+// queue; other messages are appended, and a client with queueSize of them
+// waiting is disconnected as too slow.
+func (c *Client) enqueue(message Message) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	c.mu.Lock()
+	if coalesces(message) {
+		for i, waiting := range c.queue {
+			if waiting.Type == message.Type && waiting.Topic == message.Topic {
+				c.queue = append(c.queue[:i], c.queue[i+1:]...)
+				c.hub.coalesced.Add(1)
+				break
+			}
+		}
+	} else {
+		if c.queued >= c.queueSize {
+			c.mu.Unlock()
+			c.disconnect(DisconnectSlow)
+			return
+		}
+		c.queued++
+	}
+	c.queue = append(c.queue, message)
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default: // The writer has already been woken
+	}
+}
+
+// subscription returns the client's subscription matching a topic, either
+// for the topic itself or a wildcard such as job:*
+func (c *Client) subscription(topic string) *subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscriptionLocked(topic)
+}
+
+// subscriptionLocked is subscription for callers holding c.mu
+func (c *Client) subscriptionLocked(topic string) *subscription {
+	if sub, ok := c.subs[topic]; ok {
+		return sub
+	}
+	if kind, _, ok := strings.Cut(topic, ":"); ok {
+		return c.subs[Topic(kind, "*")]
+	}
+	return nil
+}
+
+// subscribe starts following a topic and queues its initial state
+func (c *Client) subscribe(s Subscription) {
+	c.mu.Lock()
+	if old, ok := c.subs[s.Topic]; ok && old.timer != nil {
+		old.timer.Stop()
+	}
+	c.subs[s.Topic] = &subscription{minInterval: time.Duration(s.MinIntervalMS) * time.Millisecond}
+	c.mu.Unlock()
+}
+
+// sendInitialState queues the current state of a topic, if the hub has one
+func (c *Client) sendInitialState(topic string) {
+	if c.hub.InitialState == nil || strings.HasSuffix(topic, ":*") {
+		return
+	}
+	for _, message := range c.hub.InitialState(topic) {
+		c.deliver(message)
+	}
+}
+
+// unsubscribe stops following a topic
+func (c *Client) unsubscribe(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sub, ok := c.subs[topic]; ok {
+		if sub.timer != nil {
+			sub.timer.Stop()
+		}
+		delete(c.subs, topic)
+	}
+}
+
+// deliver queues a message if the client follows its topic, holding back
+// snapshots that arrive faster than the client's rate hint
+func (c *Client) deliver(message Message) {
+	c.mu.Lock()
+	sub := c.subscriptionLocked(message.Topic)
+	if sub == nil {
+		c.mu.Unlock()
+		return
+	}
+	if sub.minInterval > 0 && coalesces(message) {
+		if wait := sub.minInterval - time.Since(sub.lastSent); wait > 0 {
+			// Keep only the latest update and send it when the interval ends
+			sub.pending = &message
+			if sub.timer == nil {
+				sub.timer = time.AfterFunc(wait, func() { c.flush(sub) })
+			}
+			c.mu.Unlock()
+			return
+		}
+	}
+	sub.lastSent = time.Now()
+	c.mu.Unlock()
+
+	c.enqueue(message)
+}
+
+// flush queues the update held back for a rate limited subscription
+func (c *Client) flush(sub *subscription) {
+	c.mu.Lock()
+	message := sub.pending
+	sub.pending, sub.timer = nil, nil
+	if message == nil || c.subscriptionLocked(message.Topic) != sub {
+		c.mu.Unlock()
+		return // Unsubscribed meanwhile
+	}
+	sub.lastSent = time.Now()
+	c.mu.Unlock()
+
+	c.enqueue(*message)
+}
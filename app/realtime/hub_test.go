@@ -0,0 +1,425 @@
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startHub serves a hub on a test server and returns its WebSocket URL
+func startHub(t *testing.T, configure func(h *Hub)) (*Hub, string) {
+	t.Helper()
+	hub := NewHub()
+	if configure != nil {
+		configure(hub)
+	}
+	upgrader := &websocket.Upgrader{CheckOrigin: CheckOrigin(nil)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub.ServeWS(upgrader, w, r)
+	}))
+	t.Cleanup(func() {
+		hub.Close()
+		server.Close()
+	})
+	return hub, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// dial connects a test client and waits until the hub has registered it
+func dial(t *testing.T, hub *Hub, url string) *websocket.Conn {
+	t.Helper()
+	want := hub.ClientCount() + 1
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitFor(t, "client registration", func() bool { return hub.ClientCount() >= want })
+	return conn
+}
+
+// send writes a request
+func send(t *testing.T, conn *websocket.Conn, request interface{}) {
+	t.Helper()
+	if err := conn.WriteJSON(request); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+// read reads the next message, failing the test if none arrives in time
+func read(t *testing.T, conn *websocket.Conn) Message {
+	t.Helper()
+	var message Message
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return message
+}
+
+// waitFor polls condition until it holds or a second has passed
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribeRoutesByTopic(t *testing.T) {
+	hub, url := startHub(t, nil)
+	conn := dial(t, hub, url)
+
+	send(t, conn, Request{Type: RequestUnsubscribe, Topics: []Subscription{{Topic: TopicNetwork}, {Topic: TopicEvents}}})
+	read(t, conn)
+	read(t, conn)
+	send(t, conn, map[string]interface{}{"type": "subscribe", "requestId": "r1", "topics": []interface{}{"job:a", "bogus"}})
+
+	if m := read(t, conn); m.Type != TypeSubscribed || m.Topic != "job:a" || m.RequestID != "r1" {
+		t.Fatalf("got %+v, want subscribed to job:a for r1", m)
+	}
+	if m := read(t, conn); m.Type != TypeError || m.Topic != "bogus" || m.RequestID != "r1" {
+		t.Fatalf("got %+v, want an error for the unknown topic", m)
+	}
+
+	hub.Publish(NewMessage(TypeNetworkUpdate, TopicNetwork, "unsubscribed"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:b", "other job"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "line 1"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "line 2"))
+	for _, want := range []string{"line 1", "line 2"} {
+		if m := read(t, conn); m.Topic != "job:a" || m.Data != want {
+			t.Fatalf("got %+v, want %q on job:a", m, want)
+		}
+	}
+}
+
+func TestInitialStateFollowsSubscribe(t *testing.T) {
+	hub, url := startHub(t, func(h *Hub) {
+		h.InitialState = func(topic string) []Message {
+			return []Message{NewMessage(TypeJobStatus, topic, "so far")}
+		}
+	})
+	conn := dial(t, hub, url)
+
+	send(t, conn, Request{Type: RequestSubscribe, Topics: []Subscription{{Topic: "job:a"}}})
+	if m := read(t, conn); m.Type != TypeSubscribed {
+		t.Fatalf("got %+v, want subscribed", m)
+	}
+	if m := read(t, conn); m.Type != TypeJobStatus || m.Data != "so far" {
+		t.Fatalf("got %+v, want the initial job status", m)
+	}
+}
+
+func TestInvalidRequestKeepsConnection(t *testing.T) {
+	hub, url := startHub(t, nil)
+	conn := dial(t, hub, url)
+
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	if m := read(t, conn); m.Type != TypeError {
+		t.Fatalf("got %+v, want an error", m)
+	}
+	send(t, conn, Request{Type: RequestPing, RequestID: "p"})
+	if m := read(t, conn); m.Type != TypePong || m.RequestID != "p" {
+		t.Fatalf("got %+v, want pong for p", m)
+	}
+}
+
+func TestRateHintKeepsLatestSnapshot(t *testing.T) {
+	hub, url := startHub(t, nil)
+	conn := dial(t, hub, url)
+
+	send(t, conn, Request{Type: RequestSubscribe, Topics: []Subscription{{Topic: TopicNetwork, MinIntervalMS: 300}}})
+	read(t, conn)
+	for i := 0; i < 10; i++ {
+		hub.Publish(NewMessage(TypeNetworkUpdate, TopicNetwork, float64(i)))
+	}
+
+	if m := read(t, conn); m.Data != float64(0) {
+		t.Fatalf("got %+v, want the first snapshot right away", m)
+	}
+	start := time.Now()
+	if m := read(t, conn); m.Data != float64(9) {
+		t.Fatalf("got %+v, want only the latest snapshot after the interval", m)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("second snapshot after %v, want it held back for the interval", elapsed)
+	}
+}
+
+func TestSnapshotsCoalesceForSlowClients(t *testing.T) {
+	hub := NewHub()
+	client := newClient(hub, nil, nil)
+
+	client.enqueue(NewMessage(TypeJobOutput, "job:a", "before"))
+	for i := 0; i < 10; i++ {
+		client.enqueue(NewMessage(TypeNetworkUpdate, TopicNetwork, i))
+	}
+	client.enqueue(NewMessage(TypeJobOutput, "job:a", "between"))
+	client.enqueue(NewMessage(TypeInterfaceUpdate, "interface:eth0", "eth0"))
+	client.enqueue(NewMessage(TypeNetworkUpdate, TopicNetwork, 10))
+
+	// The latest network snapshot replaces the unsent ones and keeps its
+	// place after the messages published before it
+	want := []interface{}{"before", "between", "eth0", 10}
+	for _, data := range want {
+		m, ok := client.next()
+		if !ok || m.Data != data {
+			t.Fatalf("got %+v, want %v next", m, data)
+		}
+	}
+	if m, ok := client.next(); ok {
+		t.Fatalf("got %+v, want an empty queue", m)
+	}
+	if got := hub.Stats().Coalesced; got != 10 {
+		t.Fatalf("coalesced %d snapshots, want 10", got)
+	}
+}
+
+func TestQueueOverflowDisconnects(t *testing.T) {
+	hub := NewHub()
+	hub.QueueSize = 4
+	client := newClient(hub, nil, nil)
+
+	for i := 0; i < hub.QueueSize; i++ {
+		client.enqueue(NewMessage(TypeJobOutput, "job:a", i))
+	}
+	select {
+	case <-client.done:
+		t.Fatal("disconnected before the queue was full")
+	default:
+	}
+
+	client.enqueue(NewMessage(TypeNetworkUpdate, TopicNetwork, "snapshots do not count"))
+	select {
+	case <-client.done:
+		t.Fatal("disconnected for a snapshot")
+	default:
+	}
+
+	client.enqueue(NewMessage(TypeJobOutput, "job:a", "overflow"))
+	select {
+	case <-client.done:
+	default:
+		t.Fatal("still connected after the queue overflowed")
+	}
+	if client.reason != DisconnectSlow {
+		t.Fatalf("disconnected as %q, want %q", client.reason, DisconnectSlow)
+	}
+}
+
+func TestStalledClientDoesNotBlockOthers(t *testing.T) {
+	hub, url := startHub(t, func(h *Hub) {
+		h.QueueSize = 8
+		h.WriteTimeout = 200 * time.Millisecond
+	})
+	subscribe := func(conn *websocket.Conn) {
+		send(t, conn, Request{Type: RequestSubscribe, Topics: []Subscription{{Topic: "job:a"}}})
+		if m := read(t, conn); m.Type != TypeSubscribed {
+			t.Fatalf("got %+v, want subscribed", m)
+		}
+	}
+	stalled := dial(t, hub, url)
+	subscribe(stalled)
+	healthy := dial(t, hub, url)
+	subscribe(healthy)
+
+	const count = 200
+	received := make(chan int)
+	go func() {
+		n := 0
+		healthy.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for n < count {
+			if _, _, err := healthy.ReadMessage(); err != nil {
+				break
+			}
+			n++
+		}
+		received <- n
+	}()
+
+	// The stalled client never reads again, so its socket buffers and then
+	// its queue fill up
+	payload := strings.Repeat("x", 64*1024)
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		hub.Publish(NewMessage(TypeJobOutput, "job:a", payload))
+		time.Sleep(time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("publishing took %v; Publish waited for the stalled client", elapsed)
+	}
+
+	if n := <-received; n != count {
+		t.Fatalf("healthy client received %d of %d messages", n, count)
+	}
+	waitFor(t, "the stalled client to be dropped", func() bool { return hub.ClientCount() == 1 })
+	stats := hub.Stats()
+	if stats.Disconnects[DisconnectSlow]+stats.Disconnects[DisconnectWriteError] != 1 {
+		t.Fatalf("disconnects %v, want the stalled client dropped", stats.Disconnects)
+	}
+}
+
+func TestUnansweredPingsDisconnect(t *testing.T) {
+	hub, url := startHub(t, func(h *Hub) { h.PingInterval = 50 * time.Millisecond })
+	conn := dial(t, hub, url)
+
+	// Read frames so pings are processed, but never answer them
+	conn.SetPingHandler(func(string) error { return nil })
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	waitFor(t, "the client to time out", func() bool { return hub.ClientCount() == 0 })
+	if got := hub.Stats().Disconnects[DisconnectPingTimeout]; got != 1 {
+		t.Fatalf("got %d ping timeouts, want 1", got)
+	}
+}
+
+func TestZeroSettingsUseDefaults(t *testing.T) {
+	hub, url := startHub(t, func(h *Hub) {
+		h.PingInterval = 0
+		h.QueueSize = 0
+		h.WriteTimeout = 0
+		h.ReplaySize = -1
+	})
+	conn := dial(t, hub, url)
+
+	// A zero ping interval must not stop the writer, and a zero queue size
+	// must not drop the client on its first message
+	send(t, conn, Request{Type: RequestSubscribe, Topics: []Subscription{{Topic: "job:a"}}})
+	if m := read(t, conn); m.Type != TypeSubscribed {
+		t.Fatalf("got %+v, want subscribed", m)
+	}
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "line 1"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "line 2"))
+	for _, want := range []string{"line 1", "line 2"} {
+		if m := read(t, conn); m.Topic != "job:a" || m.Data != want {
+			t.Fatalf("got %+v, want %q on job:a", m, want)
+		}
+	}
+
+	if hub.ClientCount() != 1 || len(hub.Stats().Disconnects) != 0 {
+		t.Fatalf("clients %d, disconnects %v; want the client still connected", hub.ClientCount(), hub.Stats().Disconnects)
+	}
+	client := newClient(hub, nil, nil)
+	if client.queueSize != DefaultQueueSize || hub.pingInterval() != DefaultPingInterval || hub.writeTimeout() != DefaultWriteTimeout {
+		t.Fatalf("queue size %d ping interval %v write timeout %v, want the defaults", client.queueSize, hub.pingInterval(), hub.writeTimeout())
+	}
+}
+
+func TestAnsweredPingsKeepConnection(t *testing.T) {
+	hub, url := startHub(t, func(h *Hub) { h.PingInterval = 50 * time.Millisecond })
+	conn := dial(t, hub, url)
+
+	// The default ping handler answers with a pong
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	if hub.ClientCount() != 1 {
+		t.Fatal("client answering pings was disconnected")
+	}
+}
+
+func TestCloseSendsGoingAway(t *testing.T) {
+	hub, url := startHub(t, nil)
+	conn := dial(t, hub, url)
+
+	hub.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("got %v, want a going-away close", err)
+		}
+		break
+	}
+	waitFor(t, "the client to be removed", func() bool { return hub.ClientCount() == 0 })
+}
+
+func TestShutdownWritesQueuedMessages(t *testing.T) {
+	hub, url := startHub(t, nil)
+	conn := dial(t, hub, url)
+	send(t, conn, Request{Type: RequestSubscribe, Topics: []Subscription{{Topic: "job:1"}}})
+	read(t, conn) // subscribed
+
+	for i := 0; i < 20; i++ {
+		hub.Publish(NewMessage(TypeJobOutput, "job:1", i))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown did not finish: %v", err)
+	}
+
+	received := 0
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Fatalf("got %v, want a going-away close", err)
+			}
+			break
+		}
+		if message.Type == TypeJobOutput {
+			received++
+		}
+	}
+	if received != 20 {
+		t.Fatalf("received %d queued messages before the close, want 20", received)
+	}
+	if hub.ClientCount() != 0 {
+		t.Fatal("client still registered after shutdown")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	check := CheckOrigin([]string{"https://dashboard.example.com/", " http://10.0.0.5:3000"})
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},                              // not a browser
+		{"http://nettool.local:8080", true},     // same origin
+		{"https://dashboard.example.com", true}, // listed
+		{"http://10.0.0.5:3000", true},          // listed
+		{"https://evil.example.com", false},
+		{"http://nettool.local:9090", false}, // same host, other port
+		{"null", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://nettool.local:8080/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := check(r); got != tt.want {
+			t.Errorf("origin %q: got %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "http://nettool.local:8080/ws", nil)
+	r.Header.Set("Origin", "https://anywhere.example")
+	if !CheckOrigin([]string{"*"})(r) {
+		t.Error("* did not accept every origin")
+	}
+}
@@ -0,0 +1,41 @@
+package realtime
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CheckOrigin returns an origin check for WebSocket upgrades. Requests
+// without an Origin header (non-browser clients) and same-origin requests are
+// accepted. Other origins must be listed in allowed as scheme://host[:port];
+// "*" accepts every origin.
+func CheckOrigin(allowed []string) func(r *http.Request) bool {
+	allowAll := false
+	origins := make(map[string]bool)
+	for _, origin := range allowed {
+		origin = strings.TrimRight(strings.ToLower(strings.TrimSpace(origin)), "/")
+		switch origin {
+		case "":
+		case "*":
+			allowAll = true
+		default:
+			origins[origin] = true
+		}
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowAll {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		return origins[strings.ToLower(u.Scheme+"://"+u.Host)]
+	}
+}
@@ -0,0 +1,118 @@
+// Package realtime delivers live updates to browsers as typed messages on
+// topics the clients subscribe to
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Topic kinds. Interface, job and iteration topics name what they follow
+// after a colon, e.g. "interface:eth0" or "job:3f2a9c".
+const (
+	TopicNetwork   = "network"   // network snapshots
+	TopicEvents    = "events"    // network events from the kernel
+	TopicInstaller = "installer" // plugin installer progress
+	TopicInterface = "interface" // one interface's rates, addresses and events
+	TopicJob       = "job"       // status and output of a plugin job
+	TopicIteration = "iteration" // results of each iteration of a plugin job
+)
+
+// DefaultTopics are subscribed for new clients until they subscribe themselves
+var DefaultTopics = []string{TopicNetwork, TopicEvents}
+
+// Message types sent by the server
+const (
+	TypeNetworkUpdate     = "network_update"
+	TypeNetworkEvent      = "network_event"
+	TypeInterfaceUpdate   = "interface_update"
+	TypeJobStatus         = "job_status"
+	TypeJobOutput         = "job_output"
+	TypeIterationResult   = "iteration_result"
+	TypeInstallerProgress = "installer_progress"
+	TypeResync            = "resync" // an event stream resumed after messages it missed were dropped
+	TypeSubscribed        = "subscribed"
+	TypeUnsubscribed      = "unsubscribed"
+	TypePong              = "pong"
+	TypeError             = "error"
+)
+
+// Request types sent by clients
+const (
+	RequestSubscribe   = "subscribe"
+	RequestUnsubscribe = "unsubscribe"
+	RequestPing        = "ping"
+)
+
+// Message is a message from the server to clients
+type Message struct {
+	ID        uint64      `json:"id,omitempty"` // increasing for published messages, absent in replies
+	Type      string      `json:"type"`
+	Topic     string      `json:"topic,omitempty"`
+	RequestID string      `json:"requestId,omitempty"` // the request this message answers
+	Data      interface{} `json:"data,omitempty"`
+	Timestamp string      `json:"timestamp"`
+}
+
+// NewMessage creates a message on a topic stamped with the current time
+func NewMessage(msgType string, topic string, data interface{}) Message {
+	return Message{Type: msgType, Topic: topic, Data: data, Timestamp: time.Now().Format(time.RFC3339)}
+}
+
+// Request is a message from a client to the server
+type Request struct {
+	Type      string         `json:"type"`
+	RequestID string         `json:"requestId,omitempty"` // echoed in the reply
+	Topics    []Subscription `json:"topics,omitempty"`
+}
+
+// Subscription is a topic a client follows. MinIntervalMS is a rate hint:
+// snapshots (network and interface updates) are sent at most that often, with
+// the latest update delivered at the end of the interval. Other messages are
+// all delivered.
+type Subscription struct {
+	Topic         string `json:"topic"`
+	MinIntervalMS int    `json:"minIntervalMs,omitempty"`
+}
+
+// UnmarshalJSON accepts a subscription object or a bare topic name
+func (s *Subscription) UnmarshalJSON(b []byte) error {
+	var topic string
+	if err := json.Unmarshal(b, &topic); err == nil {
+		*s = Subscription{Topic: topic}
+		return nil
+	}
+	type plain Subscription
+	return json.Unmarshal(b, (*plain)(s))
+}
+
+// Topic builds a topic name from a kind and its argument
+func Topic(kind string, arg string) string {
+	return kind + ":" + arg
+}
+
+// ParseTopic validates a topic and splits it into its kind and argument
+func ParseTopic(topic string) (kind string, arg string, err error) {
+	kind, arg, hasArg := strings.Cut(topic, ":")
+	switch kind {
+	case TopicNetwork, TopicEvents, TopicInstaller:
+		if hasArg {
+			return "", "", fmt.Errorf("topic %s takes no argument", kind)
+		}
+	case TopicInterface, TopicJob, TopicIteration:
+		if arg == "" {
+			return "", "", fmt.Errorf("topic %s needs an argument, e.g. %s:<name>", kind, kind)
+		}
+	default:
+		return "", "", fmt.Errorf("unknown topic: %s", topic)
+	}
+	return kind, arg, nil
+}
+
+// coalesces reports whether a message is a snapshot, of which only the latest
+// matters when a client is rate limited or falling behind
+func coalesces(message Message) bool {
+	return message.Type == TypeNetworkUpdate || message.Type == TypeInterfaceUpdate
+}
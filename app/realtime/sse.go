@@ -0,0 +1,137 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEventTopics are followed by event streams that name no topics: the
+// network snapshots and events, installer progress and every job
+var DefaultEventTopics = []string{TopicNetwork, TopicEvents, TopicInstaller, Topic(TopicJob, "*"), Topic(TopicIteration, "*")}
+
+// sseRetry is how long browsers wait before reconnecting a dropped event stream
+const sseRetry = 3 * time.Second
+
+// ServeSSE streams messages as Server-Sent Events until the client
+// disconnects. The topics query parameter lists the topics to follow,
+// separated by commas, with DefaultEventTopics if it is empty; minIntervalMs
+// is a rate hint for their snapshots. Each event is named after the message
+// type, carries the message as JSON and has the message ID as event ID. A
+// client reconnecting with Last-Event-ID (or the lastEventId query parameter)
+// first receives the messages it missed, or a resync event followed by the
+// current state if they are no longer kept.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	topics := DefaultEventTopics
+	if list := query.Get("topics"); list != "" {
+		topics = nil
+		for _, topic := range strings.Split(list, ",") {
+			if topic = strings.TrimSpace(topic); topic != "" {
+				topics = append(topics, topic)
+			}
+		}
+	}
+	minInterval := 0
+	if value := query.Get("minIntervalMs"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid minIntervalMs: "+value, http.StatusBadRequest)
+			return
+		}
+		minInterval = n
+	}
+	subscriptions := make([]Subscription, 0, len(topics))
+	for _, topic := range topics {
+		if _, _, err := ParseTopic(topic); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		subscriptions = append(subscriptions, Subscription{Topic: topic, MinIntervalMS: minInterval})
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("lastEventId")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		// An unreadable ID is treated like one that is no longer kept
+		lastID, _ = strconv.ParseUint(lastEventID, 10, 64)
+		if lastID == 0 {
+			lastID = 1
+		}
+	}
+
+	t := &sseTransport{w: w, rc: http.NewResponseController(w)}
+	client := newClient(h, t, subscriptions)
+	// Replayed messages must fit in the queue along with new ones
+	client.queueSize += max(h.ReplaySize, 0)
+	registered, complete := h.register(client, lastID)
+	if !registered {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep reverse proxies from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil || t.rc.Flush() != nil {
+		client.disconnect(DisconnectWriteError)
+	}
+
+	if lastID == 0 || !complete {
+		for _, topic := range topics {
+			client.sendInitialState(topic)
+		}
+	}
+
+	go func() {
+		select {
+		case <-r.Context().Done():
+			client.disconnect(DisconnectClosed)
+		case <-client.done:
+		}
+	}()
+	h.serve(client)
+}
+
+// sseTransport writes messages to an event stream
+type sseTransport struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (t *sseTransport) write(message Message, timeout time.Duration) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	t.rc.SetWriteDeadline(time.Now().Add(timeout))
+	if message.ID != 0 {
+		if _, err := fmt.Fprintf(t.w, "id: %d\n", message.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(t.w, "event: %s\ndata: %s\n\n", message.Type, data); err != nil {
+		return err
+	}
+	return t.rc.Flush()
+}
+
+// ping writes a comment, which keeps proxies from closing an idle stream
+func (t *sseTransport) ping(timeout time.Duration) error {
+	t.rc.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := fmt.Fprint(t.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	return t.rc.Flush()
+}
+
+// close ends the stream; browsers reconnect and resume from the last event ID
+func (t *sseTransport) close(reason string, timeout time.Duration) {}
@@ -0,0 +1,190 @@
+package realtime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// event is a parsed Server-Sent Event
+type event struct {
+	id      string
+	name    string
+	message Message
+}
+
+// startSSE serves a hub's event stream on a test server and returns its URL
+func startSSE(t *testing.T, hub *Hub) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(hub.ServeSSE))
+	t.Cleanup(func() {
+		hub.Close()
+		server.Close()
+	})
+	return server.URL
+}
+
+// openStream connects to an event stream and waits until the hub has
+// registered it. Closing the returned function disconnects.
+func openStream(t *testing.T, hub *Hub, url string, lastEventID string) (<-chan event, func()) {
+	t.Helper()
+	want := hub.ClientCount() + 1
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatalf("connect: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		cancel()
+		t.Fatalf("got %s %q, want an event stream", resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan event, 64)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, 1024*1024)
+		var e event
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if e.name != "" {
+					events <- e
+				}
+				e = event{}
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.message)
+			}
+		}
+	}()
+	t.Cleanup(cancel)
+	waitFor(t, "stream registration", func() bool { return hub.ClientCount() >= want })
+	return events, cancel
+}
+
+// next returns the next event, failing the test if none arrives in time
+func next(t *testing.T, events <-chan event) event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("stream ended")
+		}
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return event{}
+}
+
+func TestEventStreamFollowsTopics(t *testing.T) {
+	hub := NewHub()
+	url := startSSE(t, hub)
+	events, _ := openStream(t, hub, url+"?topics=job:*,installer", "")
+
+	hub.Publish(NewMessage(TypeNetworkUpdate, TopicNetwork, "not followed"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "from a"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:b", "from b"))
+	hub.Publish(NewMessage(TypeInstallerProgress, TopicInstaller, "installing"))
+
+	var lastID string
+	for _, want := range []string{"from a", "from b", "installing"} {
+		e := next(t, events)
+		if e.message.Data != want || e.name != e.message.Type {
+			t.Fatalf("got %+v, want %q named after its type", e, want)
+		}
+		if e.id == "" || e.id <= lastID {
+			t.Fatalf("got event ID %q after %q, want increasing IDs", e.id, lastID)
+		}
+		lastID = e.id
+	}
+}
+
+func TestEventStreamResumesAfterLastEventID(t *testing.T) {
+	hub := NewHub()
+	url := startSSE(t, hub) + "?topics=job:a"
+	events, disconnect := openStream(t, hub, url, "")
+
+	for _, line := range []string{"1", "2", "3"} {
+		hub.Publish(NewMessage(TypeJobOutput, "job:a", line))
+	}
+	next(t, events)
+	second := next(t, events)
+	next(t, events)
+	disconnect()
+	waitFor(t, "the stream to close", func() bool { return hub.ClientCount() == 0 })
+
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "4"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:b", "other job"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "5"))
+
+	events, _ = openStream(t, hub, url, second.id)
+	for _, want := range []string{"3", "4", "5"} {
+		if e := next(t, events); e.message.Data != want {
+			t.Fatalf("got %+v, want %q replayed", e, want)
+		}
+	}
+}
+
+func TestEventStreamResyncsAfterGap(t *testing.T) {
+	hub := NewHub()
+	hub.ReplaySize = 2
+	hub.InitialState = func(topic string) []Message {
+		return []Message{NewMessage(TypeJobStatus, topic, "current")}
+	}
+	url := startSSE(t, hub) + "?topics=job:a"
+
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "dropped"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "kept 1"))
+	hub.Publish(NewMessage(TypeJobOutput, "job:a", "kept 2"))
+
+	events, _ := openStream(t, hub, url, "1")
+	for _, want := range []string{TypeResync, TypeJobOutput, TypeJobOutput, TypeJobStatus} {
+		if e := next(t, events); e.name != want {
+			t.Fatalf("got %+v, want %s", e, want)
+		}
+	}
+}
+
+func TestEventStreamStartsWithInitialState(t *testing.T) {
+	hub := NewHub()
+	hub.InitialState = func(topic string) []Message {
+		return []Message{NewMessage(TypeNetworkUpdate, topic, "snapshot")}
+	}
+	url := startSSE(t, hub)
+
+	events, _ := openStream(t, hub, url+"?topics=network", "")
+	if e := next(t, events); e.name != TypeNetworkUpdate || e.message.Data != "snapshot" {
+		t.Fatalf("got %+v, want the current snapshot", e)
+	}
+}
+
+func TestEventStreamRejectsUnknownTopics(t *testing.T) {
+	hub := NewHub()
+	url := startSSE(t, hub)
+
+	resp, err := http.Get(url + "?topics=network,bogus")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %s, want 400", resp.Status)
+	}
+}
@@ -0,0 +1,133 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxRequestSize limits the size of a request read from a WebSocket client
+const maxRequestSize = 64 * 1024
+
+// ServeWS upgrades the request to a WebSocket and serves the client until it
+// disconnects. New clients follow DefaultTopics.
+func (h *Hub) ServeWS(upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading to WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	topics := make([]Subscription, 0, len(DefaultTopics))
+	for _, topic := range DefaultTopics {
+		topics = append(topics, Subscription{Topic: topic})
+	}
+	client := newClient(h, &wsTransport{conn: conn}, topics)
+	if registered, _ := h.register(client, 0); !registered {
+		client.transport.close(DisconnectShutdown, time.Second)
+		return
+	}
+
+	go client.readPump(conn)
+	h.serve(client)
+}
+
+// readPump handles the client's requests until the connection fails. Pongs
+// extend the read deadline, so a client that stops answering pings times out.
+func (c *Client) readPump(conn *websocket.Conn) {
+	pongWait := 2 * c.hub.pingInterval()
+	conn.SetReadLimit(maxRequestSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				c.disconnect(DisconnectPingTimeout)
+			} else {
+				c.disconnect(DisconnectClosed)
+			}
+			return
+		}
+		var request Request
+		if err := json.Unmarshal(data, &request); err != nil {
+			c.enqueue(NewMessage(TypeError, "", "invalid request: "+err.Error()))
+			continue
+		}
+		c.handle(request)
+	}
+}
+
+// handle answers a client request
+func (c *Client) handle(request Request) {
+	reply := func(msgType string, topic string, data interface{}) {
+		message := NewMessage(msgType, topic, data)
+		message.RequestID = request.RequestID
+		c.enqueue(message)
+	}
+
+	switch request.Type {
+	case RequestPing:
+		reply(TypePong, "", nil)
+	case RequestSubscribe:
+		for _, s := range request.Topics {
+			if _, _, err := ParseTopic(s.Topic); err != nil {
+				reply(TypeError, s.Topic, err.Error())
+				continue
+			}
+			if s.MinIntervalMS < 0 {
+				s.MinIntervalMS = 0
+			}
+			c.subscribe(s)
+			reply(TypeSubscribed, s.Topic, s)
+			c.sendInitialState(s.Topic)
+		}
+	case RequestUnsubscribe:
+		for _, s := range request.Topics {
+			c.unsubscribe(s.Topic)
+			reply(TypeUnsubscribed, s.Topic, nil)
+		}
+	default:
+		reply(TypeError, "", "unknown request type: "+request.Type)
+	}
+}
+
+// wsTransport writes messages to a WebSocket connection
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *wsTransport) write(message Message, timeout time.Duration) error {
+	t.conn.SetWriteDeadline(time.Now().Add(timeout))
+	return t.conn.WriteJSON(message)
+}
+
+func (t *wsTransport) ping(timeout time.Duration) error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(timeout))
+}
+
+// close sends a close message explaining why the server disconnected the
+// client; clients that left or failed get none
+func (t *wsTransport) close(reason string, timeout time.Duration) {
+	var code int
+	var text string
+	switch reason {
+	case DisconnectSlow:
+		code, text = websocket.CloseTryAgainLater, "send queue full"
+	case DisconnectPingTimeout:
+		code, text = websocket.ClosePolicyViolation, "ping timeout"
+	case DisconnectShutdown:
+		code, text = websocket.CloseGoingAway, "server shutting down"
+	default:
+		return
+	}
+	t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(timeout))
+}
@@ -0,0 +1,76 @@
+/**
+ * NetTool Authentication
+ * Adds the CSRF token to state-changing requests, sends the browser to the
+ * login page when the session has expired and shows the current user
+ */
+
+const NetToolAuth = {
+    csrfCookie: 'nettool_csrf',
+    csrfHeader: 'X-CSRF-Token',
+
+    // Read the CSRF token the server set at login
+    csrfToken: function() {
+        const prefix = this.csrfCookie + '=';
+        const cookie = document.cookie.split('; ').find(c => c.startsWith(prefix));
+        return cookie ? decodeURIComponent(cookie.substring(prefix.length)) : '';
+    },
+
+    // The page to return to after logging in; only local paths are followed
+    nextPage: function() {
+        const next = new URLSearchParams(window.location.search).get('next');
+        return next && next.startsWith('/') && !next.startsWith('//') ? next : '/';
+    },
+
+    // Wrap fetch so same-origin requests carry the CSRF token and an expired
+    // session leads back to the login page
+    installFetch: function() {
+        const originalFetch = window.fetch.bind(window);
+        window.fetch = (input, init = {}) => {
+            const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+            const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+            const sameOrigin = url.origin === window.location.origin;
+
+            if (sameOrigin && !['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+                const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+                headers.set(this.csrfHeader, this.csrfToken());
+                init = {...init, headers};
+            }
+
+            return originalFetch(input, init).then(response => {
+                if (response.status === 401 && sameOrigin && !url.pathname.startsWith('/api/auth/')) {
+                    const here = window.location.pathname + window.location.search;
+                    window.location.href = '/login?next=' + encodeURIComponent(here);
+                }
+                return response;
+            });
+        };
+    },
+
+    // Show who is logged in and hide links the role cannot use
+    showUser: function() {
+        const container = document.getElementById('authUser');
+        if (!container) {
+            return;
+        }
+        fetch('/api/auth/me')
+            .then(response => response.ok ? response.json() : null)
+            .then(user => {
+                if (!user) {
+                    return;
+                }
+                document.getElementById('authUsername').textContent = user.username + ' (' + user.role + ')';
+                container.classList.remove('d-none');
+                if (user.role !== 'admin') {
+                    document.querySelectorAll('[data-requires-role="admin"]').forEach(el => el.classList.add('d-none'));
+                }
+            });
+
+        document.getElementById('logoutBtn').addEventListener('click', () => {
+            fetch('/api/auth/logout', {method: 'POST'})
+                .finally(() => { window.location.href = '/login'; });
+        });
+    }
+};
+
+NetToolAuth.installFetch();
+document.addEventListener('DOMContentLoaded', () => NetToolAuth.showUser());
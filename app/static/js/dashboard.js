@@ -18,6 +18,9 @@ let topologyChart;
 // Network data cache
 let lastNetworkData = null;
 
+// Show bit rates with binary (Kibit/s) instead of SI (kbit/s) prefixes
+let binaryBitRates = loadBitRateUnits();
+
 // Speed test variables
 let lastSpeedTest = null;
 let speedTestInProgress = false;
@@ -35,11 +38,16 @@ let autoRefreshPauseTime = null;
 // Initialize dashboard on document load
 document.addEventListener('DOMContentLoaded', function() {
     initializeCharts();
+    loadTrafficHistory();
+    loadConntrack();
+    setInterval(loadConntrack, 15000);
+    loadInterfaceTopology();
     initializeWebSocket();
     fetchNetworkInfo();
     
     // Setup automatic refresh functionality
     startAutoRefresh();
+    updateBitRateUnitsUI();
     
     // Set status indicators pulse effect
     setInterval(() => {
@@ -107,6 +115,23 @@ function addTrafficData(timestamp, downloadMbps, uploadMbps) {
     }
 }
 
+// Seed the traffic chart with recorded history so it is not empty on page load
+function loadTrafficHistory() {
+    const points = trafficHistory.maxDataPoints;
+    fetch(`/api/metrics?series=traffic.rx_bps,traffic.tx_bps&from=-${points * 30}s&step=30`)
+        .then(response => response.ok ? response.json() : null)
+        .then(result => {
+            if (!result || !result.series) return;
+            const rx = result.series['traffic.rx_bps'] || [];
+            const tx = result.series['traffic.tx_bps'] || [];
+            result.timestamps.forEach((t, i) => {
+                if (rx[i] === null && tx[i] === null) return;
+                addTrafficData(new Date(t).toLocaleTimeString(), (rx[i] || 0) / 1e6, (tx[i] || 0) / 1e6);
+            });
+        })
+        .catch(error => console.error('Error loading traffic history:', error));
+}
+
 // Format bytes to human-readable format
 function formatBytes(bytes, decimals = 2) {
     if (bytes === 0) return '0 Bytes';
@@ -117,6 +142,49 @@ function formatBytes(bytes, decimals = 2) {
     return parseFloat((bytes / Math.pow(k, i)).toFixed(dm)) + ' ' + sizes[i];
 }
 
+// Format a rate in bits per second with SI (default) or binary prefixes
+function formatBitRate(bps, binary = false) {
+    const base = binary ? 1024 : 1000;
+    const units = binary
+        ? ['bit/s', 'Kibit/s', 'Mibit/s', 'Gibit/s', 'Tibit/s']
+        : ['bit/s', 'kbit/s', 'Mbit/s', 'Gbit/s', 'Tbit/s'];
+    let i = 0;
+    while (bps >= base && i < units.length - 1) {
+        bps /= base;
+        i++;
+    }
+    return `${bps.toFixed(1)} ${units[i]}`;
+}
+
+// Read the bit rate units from ?units=binary or ?units=si, remembering
+// them for later visits
+function loadBitRateUnits() {
+    const units = new URLSearchParams(window.location.search).get('units');
+    if (units === 'binary' || units === 'si') {
+        localStorage.setItem('bitRateUnits', units);
+    }
+    return localStorage.getItem('bitRateUnits') === 'binary';
+}
+
+// Switch between SI and binary bit rate units and redraw the rates
+function toggleBitRateUnits() {
+    binaryBitRates = !binaryBitRates;
+    localStorage.setItem('bitRateUnits', binaryBitRates ? 'binary' : 'si');
+    updateBitRateUnitsUI();
+    if (lastNetworkData) {
+        updateConnectionMetrics(lastNetworkData);
+    }
+}
+
+// Update the units toggle to show the current units
+function updateBitRateUnitsUI() {
+    const button = document.getElementById('bitRateUnitsBtn');
+    if (button) {
+        button.textContent = binaryBitRates ? 'Kibit/s' : 'kbit/s';
+        button.setAttribute('title', binaryBitRates ? 'Show SI units' : 'Show binary units');
+    }
+}
+
 // Format uptime to human-readable format
 function formatUptime(seconds) {
     if (isNaN(seconds)) return '--:--:--';
@@ -166,9 +234,9 @@ function initializeTopology(data) {
         ? `${data.connection.latencyMS.toFixed(1)} ms` 
         : '-- ms';
         
-    const bandwidth = (data.traffic && typeof data.traffic.currentBandwidth !== 'undefined') 
-        ? `${data.traffic.currentBandwidth.toFixed(1)} Mbps` 
-        : '-- Mbps';
+    const bandwidth = (data.traffic && data.traffic.rates) 
+        ? `↓ ${formatBitRate(data.traffic.rates.rxBps, binaryBitRates)} ↑ ${formatBitRate(data.traffic.rates.txBps, binaryBitRates)}` 
+        : '-- Mbit/s';
     
     const gateway = data.gateway || '--';
     const ipAddress = data.ipv4Address || '--';
@@ -276,11 +344,17 @@ function initializeWebSocket() {
     }
     
     // Create new WebSocket connection
-    socket = new WebSocket(`ws://${window.location.host}/ws`);
+    const protocol = window.location.protocol === 'https:' ? 'wss' : 'ws';
+    socket = new WebSocket(`${protocol}://${window.location.host}/ws`);
     
     socket.onopen = function(e) {
         console.log('WebSocket connection established');
         
+        // Follow network snapshots at most every two seconds; the dashboard
+        // does not show individual network events
+        socket.send(JSON.stringify({ type: 'unsubscribe', topics: ['events'] }));
+        socket.send(JSON.stringify({ type: 'subscribe', topics: [{ topic: 'network', minIntervalMs: 2000 }] }));
+        
         // Set all indicators to active
         document.querySelectorAll('.realtime-indicator').forEach(ind => {
             ind.classList.add('active');
@@ -342,9 +416,6 @@ function fetchNetworkInfo() {
                 return;
             }
             
-            // Log service latency data specifically
-            console.log("Service Latency Data:", JSON.stringify(data.serviceLatency));
-            
             // Update the dashboard with the data
             updateDashboard(data);
         })
@@ -376,9 +447,8 @@ function updateDashboard(data) {
     // Update traffic statistics
     updateTrafficStatistics(data);
     
-    // Update service latency (try both methods)
+    // Update service latency
     updateServiceLatency(data);
-    setServiceLatencies(data); // Direct update as fallback
     
     // Update ARP table
     updateARPTable(data);
@@ -393,125 +463,41 @@ function updateDashboard(data) {
     updateTimestamp(data);
 }
 
-// Update service latency values
+// Icons for each latency probe method
+const latencyMethodIcons = {
+    icmp: 'bi-broadcast',
+    tcp: 'bi-plug',
+    http: 'bi-globe',
+    dns: 'bi-hdd-network'
+};
+
+// Render the result of every configured latency target
 function updateServiceLatency(data) {
-    console.log("Updating service latency with data:", data.serviceLatency);
-    
-    // Check DOM elements directly
-    console.log("googleLatency element exists:", document.getElementById('googleLatency') !== null);
-    console.log("amazonLatency element exists:", document.getElementById('amazonLatency') !== null);
-    console.log("cloudflareLatency element exists:", document.getElementById('cloudflareLatency') !== null);
-    console.log("microsoftLatency element exists:", document.getElementById('microsoftLatency') !== null);
-    
-    if (!data.serviceLatency) {
-        console.warn("No serviceLatency data available");
+    const grid = document.getElementById('serviceLatencyGrid');
+    if (!grid || !data.serviceLatency) return;
+
+    const results = Object.values(data.serviceLatency).sort((a, b) => a.name.localeCompare(b.name));
+    if (results.length === 0) {
+        grid.innerHTML = '<div class="small text-muted">No latency targets configured</div>';
         return;
     }
-    
-    // Update major service latencies
-    const services = {
-        'googleLatency': data.serviceLatency.google,
-        'amazonLatency': data.serviceLatency.amazon,
-        'cloudflareLatency': data.serviceLatency.cloudflare,
-        'microsoftLatency': data.serviceLatency.microsoft
-    };
-    
-    console.log("Service latencies:", services);
-    
-    // Update each service latency value directly without class manipulation first
-    for (const [elementId, value] of Object.entries(services)) {
-        const element = document.getElementById(elementId);
-        if (element) {
-            console.log(`Updating ${elementId} with value ${value}`);
-            element.textContent = value > 0 ? `${value.toFixed(1)} ms` : '-- ms';
-        } else {
-            console.warn(`Element with id ${elementId} not found in the DOM`);
-        }
-    }
-    
-    // Update network service latencies (DNS and HTTP)
-    if (data.serviceLatency.dns !== undefined) {
-        updateElementText('dnsLatency', data.serviceLatency.dns > 0 ? 
-            `${data.serviceLatency.dns.toFixed(1)} ms` : '-- ms');
-            
-        // Update progress bar
-        const dnsBar = document.getElementById('dnsLatencyBar');
-        if (dnsBar) {
-            const percentage = Math.min(data.serviceLatency.dns / 2, 100);
-            dnsBar.style.width = `${percentage}%`;
-            dnsBar.className = 'progress-bar';
-            if (data.serviceLatency.dns < 50) {
-                dnsBar.classList.add('bg-success');
-            } else if (data.serviceLatency.dns < 100) {
-                dnsBar.classList.add('bg-warning');
-            } else {
-                dnsBar.classList.add('bg-danger');
-            }
-        }
-    }
-    
-    if (data.serviceLatency.http !== undefined) {
-        updateElementText('httpLatency', data.serviceLatency.http > 0 ? 
-            `${data.serviceLatency.http.toFixed(1)} ms` : '-- ms');
-            
-        // Update progress bar
-        const httpBar = document.getElementById('httpLatencyBar');
-        if (httpBar) {
-            const percentage = Math.min(data.serviceLatency.http / 2, 100);
-            httpBar.style.width = `${percentage}%`;
-            httpBar.className = 'progress-bar';
-            if (data.serviceLatency.http < 100) {
-                httpBar.classList.add('bg-success');
-            } else if (data.serviceLatency.http < 200) {
-                httpBar.classList.add('bg-warning');
-            } else {
-                httpBar.classList.add('bg-danger');
-            }
-        }
-    }
-}
 
-// Direct function to update service latencies (simplified for debugging)
-function setServiceLatencies(data) {
-    if (!data || !data.serviceLatency) return;
-    
-    // Get elements
-    const googleEl = document.getElementById('googleLatency');
-    const amazonEl = document.getElementById('amazonLatency');
-    const cloudflareEl = document.getElementById('cloudflareLatency');
-    const microsoftEl = document.getElementById('microsoftLatency');
-    
-    // Update Google
-    if (googleEl && data.serviceLatency.google) {
-        googleEl.textContent = `${data.serviceLatency.google.toFixed(1)} ms`;
-    }
-    
-    // Update Amazon
-    if (amazonEl && data.serviceLatency.amazon) {
-        amazonEl.textContent = `${data.serviceLatency.amazon.toFixed(1)} ms`;
-    }
-    
-    // Update Cloudflare
-    if (cloudflareEl && data.serviceLatency.cloudflare) {
-        cloudflareEl.textContent = `${data.serviceLatency.cloudflare.toFixed(1)} ms`;
-    }
-    
-    // Update Microsoft
-    if (microsoftEl && data.serviceLatency.microsoft) {
-        microsoftEl.textContent = `${data.serviceLatency.microsoft.toFixed(1)} ms`;
-    }
-    
-    // Also update the network service latencies
-    const dnsLatencyEl = document.getElementById('dnsLatency');
-    const httpLatencyEl = document.getElementById('httpLatency');
-    
-    if (dnsLatencyEl && data.serviceLatency.dns) {
-        dnsLatencyEl.textContent = `${data.serviceLatency.dns.toFixed(1)} ms`;
-    }
-    
-    if (httpLatencyEl && data.serviceLatency.http) {
-        httpLatencyEl.textContent = `${data.serviceLatency.http.toFixed(1)} ms`;
-    }
+    grid.innerHTML = results.map(result => {
+        let statusClass = 'text-muted';
+        if (result.status === 'ok') statusClass = 'text-success';
+        else if (result.status === 'warning') statusClass = 'text-warning';
+        else if (result.status === 'critical' || result.status === 'down') statusClass = 'text-danger';
+
+        const value = result.status === 'down' ? 'Down' :
+            result.status === 'pending' ? '-- ms' : `${result.latencyMs.toFixed(1)} ms`;
+        const title = result.error ? ` title="${result.error}"` : '';
+
+        return `<div class="service-card"${title}>
+            <div class="service-icon"><i class="bi ${latencyMethodIcons[result.method] || 'bi-speedometer2'}"></i></div>
+            <div class="service-name">${result.name} <span class="small text-muted">(${result.method})</span></div>
+            <div class="service-latency ${statusClass}">${value}</div>
+        </div>`;
+    }).join('');
 }
 
 // Update connection status
@@ -544,6 +530,27 @@ function updateConnectionStatus(data) {
         connectionTypeElement.textContent = connectionType;
     }
     
+    // Update how far the connectivity check got
+    const connectivityElement = document.getElementById('connectivityState');
+    if (connectivityElement && data.connectivity && data.connectivity.state) {
+        connectivityElement.textContent = describeConnectivity(data.connectivity);
+        const failed = (data.connectivity.stages || []).find(stage => !stage.ok);
+        connectivityElement.title = failed ? failed.detail : '';
+    }
+    
+    // Update clock synchronization; latency and certificate checks depend on it
+    const clockElement = document.getElementById('clockStatus');
+    if (clockElement && data.timeSync && data.timeSync.source) {
+        const sync = data.timeSync;
+        let text = sync.synchronized ? `Synced (${sync.source})` : `Not synced (${sync.source})`;
+        if (sync.synchronized || sync.offsetMs) {
+            text += `, offset ${sync.offsetMs.toFixed(2)} ms`;
+        }
+        clockElement.textContent = text;
+        clockElement.className = sync.synchronized ? '' : 'text-warning';
+        clockElement.title = sync.reference ? `Reference: ${sync.reference}, stratum ${sync.stratum}` : '';
+    }
+    
     // Emit an event if connection status changed
     if (previousStatus !== currentStatus) {
         console.log(`Connection status changed from ${previousStatus} to ${currentStatus}`);
@@ -590,8 +597,9 @@ function updateConnectionMetrics(data) {
     }
     
     // Safe bandwidth update
-    if (data.traffic && typeof data.traffic.currentBandwidth !== 'undefined') {
-        updateElementText('bandwidth', `${data.traffic.currentBandwidth.toFixed(1)} Mbps`);
+    if (data.traffic && data.traffic.rates) {
+        const rates = data.traffic.rates;
+        updateElementText('bandwidth', `↓ ${formatBitRate(rates.rxBps, binaryBitRates)} ↑ ${formatBitRate(rates.txBps, binaryBitRates)}`);
     } else {
         updateElementText('bandwidth', '-- Mbps');
     }
@@ -615,6 +623,25 @@ function updateDNSServers(data) {
     } else {
         dnsElement.innerHTML = '<div>No DNS servers configured</div>';
     }
+
+    const resolver = data.resolver;
+    if (resolver) {
+        if (resolver.stubResolver) {
+            const mode = resolver.systemdResolved ? 'systemd-resolved' : 'local stub';
+            dnsElement.innerHTML += `<div>Via: ${mode} (${resolver.nameservers.join(', ')})</div>`;
+        }
+        if (resolver.search && resolver.search.length > 0) {
+            dnsElement.innerHTML += `<div>Search: ${resolver.search.join(' ')}</div>`;
+        }
+        (resolver.links || []).forEach(link => {
+            if (link.servers && link.servers.length > 0) {
+                dnsElement.innerHTML += `<div>${link.interface}: ${link.servers.join(', ')}</div>`;
+            }
+        });
+        if (resolver.global && resolver.global.dnssec) {
+            dnsElement.innerHTML += `<div>DNSSEC: ${resolver.global.dnssec}, DoT: ${resolver.global.dnsOverTls || 'no'}</div>`;
+        }
+    }
 }
 
 // Update interface details
@@ -717,6 +744,15 @@ function updateTrafficStatistics(data) {
                     const leaseExpires = new Date(data.dhcpInfo.leaseExpires);
                     dhcpInfoText += `<br>Expires: ${leaseExpires.toLocaleString()}`;
                 }
+
+                if (data.dhcpInfo.renewalTime && data.dhcpInfo.renewalTime !== "0001-01-01T00:00:00Z") {
+                    const renewalTime = new Date(data.dhcpInfo.renewalTime);
+                    dhcpInfoText += `<br>Renews: ${renewalTime.toLocaleString()}`;
+                }
+
+                if (data.dhcpInfo.client) {
+                    dhcpInfoText += `<br>Client: ${data.dhcpInfo.client}`;
+                }
                 
                 dhcpInfoEl.innerHTML = dhcpInfoText;
             } else {
@@ -770,6 +806,172 @@ function updateARPTable(data) {
     }
 }
 
+// Load the conntrack table; the card stays hidden where connection tracking is unavailable
+function loadConntrack() {
+    fetch('/api/conntrack?top=10&limit=10')
+        .then(response => response.ok ? response.json() : null)
+        .then(data => {
+            const card = document.getElementById('conntrackCard');
+            if (!card) return;
+            if (!data) {
+                card.style.display = 'none';
+                return;
+            }
+            card.style.display = '';
+            updateConntrack(data);
+        })
+        .catch(error => console.error('Error loading conntrack table:', error));
+}
+
+// Format a conntrack tuple as src:port → dst:port
+function formatConntrackTuple(tuple) {
+    const src = tuple.sourcePort ? `${tuple.source}:${tuple.sourcePort}` : tuple.source;
+    const dst = tuple.destinationPort ? `${tuple.destination}:${tuple.destinationPort}` : tuple.destination;
+    return `${src} → ${dst}`;
+}
+
+// Update the top flows and host aggregate tables
+function updateConntrack(data) {
+    const max = data.max ? ` / ${data.max}` : '';
+    updateElementText('conntrackCount', `${data.count}${max} flows`);
+
+    const footer = document.getElementById('conntrackFooter');
+    if (footer && !data.countersEnabled) {
+        footer.innerHTML = '<i class="bi bi-exclamation-triangle"></i> Byte counters are off; enable them with sysctl net.netfilter.nf_conntrack_acct=1';
+    }
+
+    const flowsBody = document.getElementById('conntrackFlows');
+    if (flowsBody) {
+        flowsBody.innerHTML = '';
+        (data.topFlows || []).forEach(flow => {
+            const row = document.createElement('tr');
+            [
+                flow.protocol,
+                formatConntrackTuple(flow.original),
+                formatConntrackTuple(flow.reply),
+                flow.nat ? flow.nat.toUpperCase() : '-',
+                flow.state || (flow.unreplied ? 'UNREPLIED' : '-'),
+                formatBytes(flow.bytes)
+            ].forEach(value => {
+                const cell = document.createElement('td');
+                cell.textContent = value;
+                row.appendChild(cell);
+            });
+            flowsBody.appendChild(row);
+        });
+        if (flowsBody.children.length === 0) {
+            flowsBody.innerHTML = '<tr><td colspan="6" class="text-center">No tracked flows</td></tr>';
+        }
+    }
+
+    const hostsBody = document.getElementById('conntrackHosts');
+    if (hostsBody) {
+        hostsBody.innerHTML = '';
+        (data.hosts || []).slice(0, 10).forEach(host => {
+            const row = document.createElement('tr');
+            [host.address, host.flows, formatBytes(host.bytesSent), formatBytes(host.bytesReceived)].forEach(value => {
+                const cell = document.createElement('td');
+                cell.textContent = value;
+                row.appendChild(cell);
+            });
+            hostsBody.appendChild(row);
+        });
+    }
+}
+
+// Load the interface graph and draw it as one tree per namespace
+function loadInterfaceTopology() {
+    fetch('/api/topology')
+        .then(response => response.json())
+        .then(topology => {
+            const container = document.getElementById('interfaceTopology');
+            if (!container) return;
+            if (topology.error) {
+                container.innerHTML = `<div class="small text-danger">${escapeHTML(topology.error)}</div>`;
+                return;
+            }
+            container.innerHTML = renderInterfaceTopology(topology);
+
+            const footer = document.getElementById('interfaceTopologyFooter');
+            if (footer && topology.errors && topology.errors.length > 0) {
+                footer.innerHTML = `<i class="bi bi-exclamation-triangle"></i> ${escapeHTML(topology.errors.join('; '))}`;
+            }
+        })
+        .catch(error => console.error('Error loading interface topology:', error));
+}
+
+// Escape text for use in HTML
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// Render the topology: members nest under their master, VLANs and stacked
+// devices under their parent; veth peers are listed next to each other
+function renderInterfaceTopology(topology) {
+    const nodes = {};
+    (topology.nodes || []).forEach(node => { nodes[node.id] = node; });
+
+    const children = {};
+    const peers = {};
+    const childIds = new Set();
+    (topology.edges || []).forEach(edge => {
+        if (edge.kind === 'veth') {
+            peers[edge.from] = edge.to;
+            peers[edge.to] = edge.from;
+            return;
+        }
+        if (!nodes[edge.to]) return;
+        (children[edge.to] = children[edge.to] || []).push(edge);
+        childIds.add(edge.from);
+    });
+
+    const describe = node => {
+        const details = [];
+        if (node.vlan) details.push(`VLAN ${node.vlan.vlanId}${node.vlan.protocol ? ' (' + node.vlan.protocol + ')' : ''}`);
+        if (node.bridge) details.push(`STP ${node.bridge.stp}${node.bridge.vlanFiltering ? ', VLAN filtering' : ''}`);
+        if (node.bond) details.push(`${node.bond.mode}${node.bond.activeSlave ? ', active ' + node.bond.activeSlave : ''}`);
+        if (node.vrf) details.push(`table ${node.vrf.table}`);
+        if (node.tunnel) {
+            const t = node.tunnel;
+            if (t.vni) details.push(`VNI ${t.vni}`);
+            if (t.remote) details.push(`${t.local || '*'} → ${t.remote}`);
+            if (t.listenPort) details.push(`port ${t.listenPort}, ${t.peers || 0} peers`);
+        }
+        if (node.port && node.port.state) details.push(`${node.port.kind} port ${node.port.state}`);
+        if (peers[node.id]) details.push(`peer ${peers[node.id]}`);
+        return details.map(d => escapeHTML(d)).join(' · ');
+    };
+
+    const renderNode = (node, depth) => {
+        if (depth > 8) return '';
+        const state = node.up ? (node.operState === 'DOWN' || node.operState === 'LOWERLAYERDOWN' ? 'text-warning' : 'text-success') : 'text-muted';
+        let html = `<li>
+            <i class="bi bi-circle-fill ${state}" title="${escapeHTML(node.operState)}"></i>
+            <strong>${escapeHTML(node.name)}</strong>
+            <span class="badge bg-secondary">${escapeHTML(node.kind)}</span>
+            <span class="small text-muted">${describe(node)}</span>
+            ${(node.addresses || []).length ? `<div class="small text-muted ms-4">${node.addresses.map(escapeHTML).join(', ')}</div>` : ''}`;
+        const kids = (children[node.id] || []).map(edge => nodes[edge.from]).filter(Boolean);
+        if (kids.length > 0) {
+            html += '<ul>' + kids.map(kid => renderNode(kid, depth + 1)).join('') + '</ul>';
+        }
+        return html + '</li>';
+    };
+
+    const groups = {};
+    Object.values(nodes).forEach(node => {
+        (groups[node.namespace || ''] = groups[node.namespace || ''] || []).push(node);
+    });
+
+    return Object.keys(groups).sort().map(ns => {
+        const roots = groups[ns].filter(node => !childIds.has(node.id));
+        const title = ns ? `Namespace ${escapeHTML(ns)}` : 'Default namespace';
+        return `<h6 class="mt-2">${title}</h6><ul class="interface-tree">${roots.map(node => renderNode(node, 0)).join('')}</ul>`;
+    }).join('');
+}
+
 // Update network topology
 function updateNetworkTopology(data) {
     const topologyElement = document.getElementById('networkTopology');
@@ -850,11 +1052,10 @@ function addTrafficDataPoint(data) {
     const timeLabel = now.toLocaleTimeString();
     
     // Safe check if traffic data exists
-    if (data.traffic && typeof data.traffic.currentBandwidth !== 'undefined') {
-        // Calculate download/upload split (for demonstration - in real app would come from actual measurements)
-        // This is just for visual effect on the chart since we only have total bandwidth
-        const downloadBandwidth = data.traffic.currentBandwidth * 0.7; // 70% of bandwidth
-        const uploadBandwidth = data.traffic.currentBandwidth * 0.3;   // 30% of bandwidth
+    if (data.traffic && data.traffic.rates) {
+        // Chart in Mbit/s (SI)
+        const downloadBandwidth = data.traffic.rates.rxBps / 1e6;
+        const uploadBandwidth = data.traffic.rates.txBps / 1e6;
         
         // Add data to traffic history
         addTrafficData(timeLabel, downloadBandwidth, uploadBandwidth);
@@ -1227,6 +1428,29 @@ function updateSpeedTestResults(data) {
     }
 }
 
+// Describe a connectivity state and the stage that failed
+function describeConnectivity(connectivity) {
+    const labels = {
+        'offline': 'No link',
+        'link': 'Link only',
+        'local': 'Local network',
+        'gateway': 'Gateway reachable',
+        'dns': 'DNS working',
+        'internet': 'Internet',
+        'captive-portal': 'Captive portal'
+    };
+    let text = labels[connectivity.state] || connectivity.state;
+    if (connectivity.state === 'captive-portal' && connectivity.portalUrl) {
+        text += ` (${connectivity.portalUrl})`;
+    } else if (connectivity.failedStage) {
+        text += ` - ${connectivity.failedStage} check failed`;
+    }
+    if (connectivity.proxy && connectivity.proxy.configured) {
+        text += ', via proxy';
+    }
+    return text;
+}
+
 // Check connection status and run speed test if appropriate
 function checkAndRunSpeedTest(event) {
     // If the connection just became active and we haven't run a test recently
@@ -0,0 +1,138 @@
+package telemetry
+
+import (
+	"sort"
+
+	"github.com/NetScout-Go/NetTool/app/core"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// NetworkCollector exposes the values of a network snapshot and the raw
+// counters of every interface. snapshot is called once per scrape.
+func NetworkCollector(snapshot func() *core.NetworkInfo) Collector {
+	return func() []*Family {
+		info := snapshot()
+		var families []*Family
+
+		families = append(families, interfaceFamilies()...)
+
+		if status, ok := info.Sections["connection"]; ok && !status.UpdatedAt.IsZero() {
+			families = append(families,
+				gauge("nettool_gateway_latency_seconds", "Average round-trip time to the default gateway.",
+					nil, Sample{Value: info.Connection.LatencyMS / 1000}),
+				gauge("nettool_gateway_packet_loss_ratio", "Fraction of pings to the default gateway that were lost.",
+					nil, Sample{Value: info.Connection.PacketLoss / 100}),
+			)
+		}
+
+		if info.Connectivity.State != "" {
+			families = append(families, gauge("nettool_connectivity_state", "Current connectivity state; 1 for the state the host is in.",
+				[]string{"state"}, Sample{LabelValues: []string{info.Connectivity.State}, Value: 1}))
+		}
+
+		if info.TimeSync.Source != "" {
+			synchronized := 0.0
+			if info.TimeSync.Synchronized {
+				synchronized = 1
+			}
+			families = append(families,
+				gauge("nettool_clock_synchronized", "Whether the system clock is synchronized to a time source.",
+					[]string{"source"}, Sample{LabelValues: []string{info.TimeSync.Source}, Value: synchronized}),
+				gauge("nettool_clock_offset_seconds", "Offset of the system clock from its time source; positive when ahead.",
+					nil, Sample{Value: info.TimeSync.OffsetMS / 1000}),
+			)
+		}
+
+		if info.SSID != "" {
+			families = append(families, gauge("nettool_wifi_signal_dbm", "Signal strength of the wireless connection.",
+				[]string{"interface", "ssid"},
+				Sample{LabelValues: []string{info.EthernetInfo.InterfaceName, info.SSID}, Value: float64(info.Connection.SignalStrength)}))
+		}
+
+		latency := &Family{Name: "nettool_service_latency_seconds", Help: "Latest latency measured to a configured target.", Type: TypeGauge, Labels: []string{"target", "method"}}
+		up := &Family{Name: "nettool_service_up", Help: "Whether the latest probe of a configured target succeeded.", Type: TypeGauge, Labels: []string{"target", "method"}}
+		names := make([]string, 0, len(info.ServiceLatency))
+		for name := range info.ServiceLatency {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			result := info.ServiceLatency[name]
+			if result.Status == core.LatencyStatusPending {
+				continue
+			}
+			labels := []string{name, string(result.Method)}
+			if result.Status == core.LatencyStatusDown {
+				up.Samples = append(up.Samples, Sample{LabelValues: labels, Value: 0})
+				continue
+			}
+			up.Samples = append(up.Samples, Sample{LabelValues: labels, Value: 1})
+			latency.Samples = append(latency.Samples, Sample{LabelValues: labels, Value: result.LatencyMS / 1000})
+		}
+		families = append(families, latency, up)
+
+		age := &Family{Name: "nettool_snapshot_section_age_seconds", Help: "Time since a section of the network snapshot was last collected.", Type: TypeGauge, Labels: []string{"section"}}
+		failing := &Family{Name: "nettool_snapshot_section_error", Help: "Whether the last collection of a snapshot section failed.", Type: TypeGauge, Labels: []string{"section"}}
+		sections := make([]string, 0, len(info.Sections))
+		for name := range info.Sections {
+			sections = append(sections, name)
+		}
+		sort.Strings(sections)
+		for _, name := range sections {
+			status := info.Sections[name]
+			if !status.UpdatedAt.IsZero() {
+				age.Samples = append(age.Samples, Sample{LabelValues: []string{name}, Value: float64(status.AgeMS) / 1000})
+			}
+			value := 0.0
+			if status.Error != "" {
+				value = 1
+			}
+			failing.Samples = append(failing.Samples, Sample{LabelValues: []string{name}, Value: value})
+		}
+		families = append(families, age, failing)
+
+		return families
+	}
+}
+
+// interfaceFamilies reads the kernel counters of every interface
+func interfaceFamilies() []*Family {
+	counters, err := psnet.IOCounters(true)
+	if err != nil {
+		return nil
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].Name < counters[j].Name })
+
+	type counterDef struct {
+		name  string
+		help  string
+		value func(c psnet.IOCountersStat) uint64
+	}
+	defs := []counterDef{
+		{"nettool_interface_receive_bytes_total", "Bytes received by the interface.", func(c psnet.IOCountersStat) uint64 { return c.BytesRecv }},
+		{"nettool_interface_transmit_bytes_total", "Bytes transmitted by the interface.", func(c psnet.IOCountersStat) uint64 { return c.BytesSent }},
+		{"nettool_interface_receive_packets_total", "Packets received by the interface.", func(c psnet.IOCountersStat) uint64 { return c.PacketsRecv }},
+		{"nettool_interface_transmit_packets_total", "Packets transmitted by the interface.", func(c psnet.IOCountersStat) uint64 { return c.PacketsSent }},
+		{"nettool_interface_receive_errors_total", "Receive errors on the interface.", func(c psnet.IOCountersStat) uint64 { return c.Errin }},
+		{"nettool_interface_transmit_errors_total", "Transmit errors on the interface.", func(c psnet.IOCountersStat) uint64 { return c.Errout }},
+		{"nettool_interface_receive_drops_total", "Received packets dropped by the interface.", func(c psnet.IOCountersStat) uint64 { return c.Dropin }},
+		{"nettool_interface_transmit_drops_total", "Transmitted packets dropped by the interface.", func(c psnet.IOCountersStat) uint64 { return c.Dropout }},
+		{"nettool_interface_receive_fifo_errors_total", "Receive FIFO overruns on the interface.", func(c psnet.IOCountersStat) uint64 { return c.Fifoin }},
+		{"nettool_interface_transmit_fifo_errors_total", "Transmit FIFO overruns on the interface.", func(c psnet.IOCountersStat) uint64 { return c.Fifoout }},
+	}
+
+	families := make([]*Family, 0, len(defs))
+	for _, def := range defs {
+		f := &Family{Name: def.name, Help: def.help, Type: TypeCounter, Labels: []string{"interface"}}
+		for _, c := range counters {
+			f.Samples = append(f.Samples, Sample{LabelValues: []string{c.Name}, Value: float64(def.value(c))})
+		}
+		families = append(families, f)
+	}
+	return families
+}
+
+// gauge builds a gauge family from samples
+func gauge(name, help string, labels []string, samples ...Sample) *Family {
+	return &Family{Name: name, Help: help, Type: TypeGauge, Labels: labels, Samples: samples}
+}
@@ -0,0 +1,201 @@
+// Package telemetry keeps NetTool's counters, gauges and histograms and
+// exposes them in the Prometheus text exposition format.
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is the type of a metric family
+type Type string
+
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+// Family is a named metric with its samples, as written to a scrape
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Labels  []string
+	Samples []Sample
+}
+
+// Sample is one labelled value of a family. Histogram samples carry their
+// cumulative bucket counts, sum and count instead of Value.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+	Buckets     []BucketCount
+	Sum         float64
+	Count       uint64
+}
+
+// BucketCount is the number of observations less than or equal to UpperBound
+type BucketCount struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// Collector produces families at scrape time
+type Collector func() []*Family
+
+// Registry holds the metrics exposed by one /metrics endpoint
+type Registry struct {
+	collectors []Collector
+	names      map[string]bool
+	mu         sync.RWMutex
+}
+
+// Default is the registry NetTool's packages register their metrics with
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// Register adds a collector that is called on every scrape
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// claim reserves a metric name, panicking on duplicates like a bad init would
+func (r *Registry) claim(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !validName(name) {
+		panic(fmt.Sprintf("telemetry: invalid metric name %q", name))
+	}
+	if r.names[name] {
+		panic(fmt.Sprintf("telemetry: metric %s registered twice", name))
+	}
+	r.names[name] = true
+}
+
+// Gather calls every collector and returns the families sorted by name
+func (r *Registry) Gather() []*Family {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	var families []*Family
+	for _, c := range collectors {
+		families = append(families, c()...)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// WriteText writes all families in the Prometheus text format (version 0.0.4)
+func (r *Registry) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, f := range r.Gather() {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.Name, f.Type)
+
+		for _, s := range f.Samples {
+			if f.Type != TypeHistogram {
+				writeSample(&b, f.Name, f.Labels, s.LabelValues, "", "", s.Value)
+				continue
+			}
+			for _, bucket := range s.Buckets {
+				writeSample(&b, f.Name+"_bucket", f.Labels, s.LabelValues, "le", formatFloat(bucket.UpperBound), float64(bucket.Count))
+			}
+			writeSample(&b, f.Name+"_bucket", f.Labels, s.LabelValues, "le", "+Inf", float64(s.Count))
+			writeSample(&b, f.Name+"_sum", f.Labels, s.LabelValues, "", "", s.Sum)
+			writeSample(&b, f.Name+"_count", f.Labels, s.LabelValues, "", "", float64(s.Count))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves the registry in the text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// writeSample writes one sample line, with an optional extra label such as "le"
+func writeSample(b *strings.Builder, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	b.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			v := ""
+			if i < len(values) {
+				v = values[i]
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", label, escapeLabelValue(v))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('\n')
+}
+
+// formatFloat formats a value the way the text format expects
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	// Counters are usually whole numbers; keep them out of exponent notation
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelEscaper.Replace(s) }
+
+// validName reports whether name is a valid metric or label name
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NetScout-Go/NetTool/app/core"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrape fetches the registry's handler and parses the body with
+// Prometheus' own text format parser
+func scrape(t *testing.T, r *Registry) map[string]*dto.MetricFamily {
+	t.Helper()
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scrape: status %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the 0.0.4 text format", contentType)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return families
+}
+
+// labels returns a metric's labels as a map
+func labels(m *dto.Metric) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range m.GetLabel() {
+		values[pair.GetName()] = pair.GetValue()
+	}
+	return values
+}
+
+func TestHandlerOutputParses(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("test_requests_total", "Requests served.\nSecond line with a \\ backslash.", "path")
+	requests.Inc("/api/\"quoted\"")
+	requests.Add(2, "C:\\temp\nnext")
+	r.NewGauge("test_temperature_celsius", "Current temperature.").Set(21.5)
+	durations := r.NewHistogram("test_duration_seconds", "Request durations.", []float64{0.1, 1}, "method")
+	durations.Observe(0.05, "GET")
+	durations.Observe(0.5, "GET")
+	durations.Observe(5, "GET")
+
+	families := scrape(t, r)
+
+	counter := families["test_requests_total"]
+	if counter == nil {
+		t.Fatalf("no test_requests_total in %v", families)
+	}
+	if counter.GetType() != dto.MetricType_COUNTER {
+		t.Errorf("test_requests_total type = %v, want counter", counter.GetType())
+	}
+	if want := "Requests served.\nSecond line with a \\ backslash."; counter.GetHelp() != want {
+		t.Errorf("help = %q, want %q", counter.GetHelp(), want)
+	}
+	values := make(map[string]float64)
+	for _, m := range counter.GetMetric() {
+		values[labels(m)["path"]] = m.GetCounter().GetValue()
+	}
+	if values["/api/\"quoted\""] != 1 || values["C:\\temp\nnext"] != 2 {
+		t.Errorf("counter values by escaped label = %v", values)
+	}
+
+	gauge := families["test_temperature_celsius"]
+	if gauge.GetType() != dto.MetricType_GAUGE || len(gauge.GetMetric()) != 1 || gauge.GetMetric()[0].GetGauge().GetValue() != 21.5 {
+		t.Errorf("test_temperature_celsius = %v, want one gauge of 21.5", gauge)
+	}
+
+	histogram := families["test_duration_seconds"]
+	if histogram.GetType() != dto.MetricType_HISTOGRAM || len(histogram.GetMetric()) != 1 {
+		t.Fatalf("test_duration_seconds = %v, want one histogram", histogram)
+	}
+	h := histogram.GetMetric()[0].GetHistogram()
+	if h.GetSampleCount() != 3 || h.GetSampleSum() != 5.55 {
+		t.Errorf("histogram count %d sum %v, want 3 and 5.55", h.GetSampleCount(), h.GetSampleSum())
+	}
+	wantBuckets := map[float64]uint64{0.1: 1, 1: 2}
+	for _, bucket := range h.GetBucket() {
+		if want, ok := wantBuckets[bucket.GetUpperBound()]; ok && bucket.GetCumulativeCount() != want {
+			t.Errorf("bucket le=%v = %d, want %d", bucket.GetUpperBound(), bucket.GetCumulativeCount(), want)
+		}
+	}
+}
+
+func TestNetworkCollectorFamilies(t *testing.T) {
+	info := &core.NetworkInfo{
+		Connection:   core.Connection{LatencyMS: 12, PacketLoss: 25},
+		Connectivity: core.ConnectivityInfo{State: "online"},
+		Sections: map[string]core.SectionStatus{
+			"connection": {UpdatedAt: time.Now(), AgeMS: 1500},
+			"wireless":   {Error: "no wireless interface"},
+		},
+	}
+	r := NewRegistry()
+	r.Register(NetworkCollector(func() *core.NetworkInfo { return info }))
+
+	families := scrape(t, r)
+
+	for _, name := range []string{
+		"nettool_gateway_latency_seconds",
+		"nettool_gateway_packet_loss_ratio",
+		"nettool_connectivity_state",
+		"nettool_snapshot_section_age_seconds",
+		"nettool_snapshot_section_error",
+	} {
+		family := families[name]
+		if family == nil {
+			t.Errorf("missing family %s", name)
+			continue
+		}
+		if family.GetType() != dto.MetricType_GAUGE || family.GetHelp() == "" {
+			t.Errorf("%s has type %v and help %q, want a documented gauge", name, family.GetType(), family.GetHelp())
+		}
+	}
+
+	if v := families["nettool_gateway_latency_seconds"].GetMetric()[0].GetGauge().GetValue(); v != 0.012 {
+		t.Errorf("gateway latency = %v, want 0.012", v)
+	}
+	if v := families["nettool_gateway_packet_loss_ratio"].GetMetric()[0].GetGauge().GetValue(); v != 0.25 {
+		t.Errorf("packet loss = %v, want 0.25", v)
+	}
+	for _, m := range families["nettool_snapshot_section_error"].GetMetric() {
+		section := labels(m)["section"]
+		if want := map[string]float64{"connection": 0, "wireless": 1}[section]; m.GetGauge().GetValue() != want {
+			t.Errorf("section %s error = %v, want %v", section, m.GetGauge().GetValue(), want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package telemetry
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit durations in seconds from a few milliseconds to a minute
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// vec is the labelled storage shared by counters and gauges
+type vec struct {
+	name   string
+	help   string
+	typ    Type
+	labels []string
+	values map[string]float64
+	keys   map[string][]string
+	mu     sync.Mutex
+}
+
+func newVec(r *Registry, name, help string, typ Type, labels []string) *vec {
+	r.claim(name)
+	for _, label := range labels {
+		if !validName(label) {
+			panic("telemetry: invalid label name " + label)
+		}
+	}
+
+	v := &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		values: make(map[string]float64),
+		keys:   make(map[string][]string),
+	}
+	r.Register(v.collect)
+	return v
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := labelKey(labelValues)
+	if _, ok := v.keys[key]; !ok {
+		v.keys[key] = append([]string(nil), labelValues...)
+	}
+	v.values[key] += delta
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := labelKey(labelValues)
+	if _, ok := v.keys[key]; !ok {
+		v.keys[key] = append([]string(nil), labelValues...)
+	}
+	v.values[key] = value
+}
+
+func (v *vec) collect() []*Family {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f := &Family{Name: v.name, Help: v.help, Type: v.typ, Labels: v.labels}
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f.Samples = append(f.Samples, Sample{LabelValues: v.keys[key], Value: v.values[key]})
+	}
+	// An unlabelled metric is always exposed, even before its first update
+	if len(v.labels) == 0 && len(f.Samples) == 0 {
+		f.Samples = append(f.Samples, Sample{})
+	}
+	return []*Family{f}
+}
+
+// CounterVec is a monotonically increasing value per label combination
+type CounterVec struct{ v *vec }
+
+// NewCounter registers a counter with the given label names. Counter names should end in _total.
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{v: newVec(r, name, help, TypeCounter, labels)}
+}
+
+// Inc adds one to the counter for the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.v.add(1, labelValues)
+}
+
+// Add adds a non-negative amount to the counter for the given label values
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(delta, labelValues)
+}
+
+// GaugeVec is a value that can go up and down per label combination
+type GaugeVec struct{ v *vec }
+
+// NewGauge registers a gauge with the given label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{v: newVec(r, name, help, TypeGauge, labels)}
+}
+
+// Set sets the gauge for the given label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.set(value, labelValues)
+}
+
+// Add adds delta (which may be negative) to the gauge for the given label values
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.v.add(delta, labelValues)
+}
+
+// histogram is the state of one label combination of a histogram
+type histogram struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative
+	sum         float64
+	count       uint64
+}
+
+// HistogramVec counts observations into fixed buckets per label combination
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	series  map[string]*histogram
+	mu      sync.Mutex
+}
+
+// NewHistogram registers a histogram. Nil buckets means DefaultBuckets.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	r.claim(name)
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+	}
+	r.Register(h.collect)
+	return h
+}
+
+// Observe records one observation for the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := labelKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) collect() []*Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f := &Family{Name: h.name, Help: h.help, Type: TypeHistogram, Labels: h.labels}
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		sample := Sample{LabelValues: s.labelValues, Sum: s.sum, Count: s.count}
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			sample.Buckets = append(sample.Buckets, BucketCount{UpperBound: upper, Count: cumulative})
+		}
+		f.Samples = append(f.Samples, sample)
+	}
+	return []*Family{f}
+}
@@ -0,0 +1,350 @@
+// Package timeseries is a small in-memory time-series store with automatic
+// downsampling from raw samples to one-minute and one-hour aggregates.
+package timeseries
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention controls how long each resolution is kept
+type Retention struct {
+	Raw    time.Duration `json:"raw"`
+	Minute time.Duration `json:"minute"`
+	Hour   time.Duration `json:"hour"`
+}
+
+// DefaultRetention keeps raw samples for 2 hours, minute aggregates for 7 days
+// and hour aggregates for 90 days
+func DefaultRetention() Retention {
+	return Retention{
+		Raw:    2 * time.Hour,
+		Minute: 7 * 24 * time.Hour,
+		Hour:   90 * 24 * time.Hour,
+	}
+}
+
+// Point is a single raw sample
+type Point struct {
+	Time  time.Time `json:"t"`
+	Value float64   `json:"v"`
+}
+
+// Bucket aggregates the samples that fall in one interval
+type Bucket struct {
+	Start time.Time `json:"t"`
+	Sum   float64   `json:"sum"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Count int       `json:"n"`
+}
+
+// Mean returns the average of the samples in the bucket
+func (b Bucket) Mean() float64 {
+	if b.Count == 0 {
+		return 0
+	}
+	return b.Sum / float64(b.Count)
+}
+
+// add folds a value into the bucket
+func (b *Bucket) add(v float64) {
+	if b.Count == 0 || v < b.Min {
+		b.Min = v
+	}
+	if b.Count == 0 || v > b.Max {
+		b.Max = v
+	}
+	b.Sum += v
+	b.Count++
+}
+
+// series holds every resolution of one metric
+type series struct {
+	Raw    []Point  `json:"raw"`
+	Minute []Bucket `json:"minute"`
+	Hour   []Bucket `json:"hour"`
+}
+
+// Store records named series and answers aligned range queries
+type Store struct {
+	retention Retention
+	series    map[string]*series
+	mu        sync.RWMutex
+}
+
+// NewStore creates an empty store with the given retention
+func NewStore(retention Retention) *Store {
+	return &Store{
+		retention: retention,
+		series:    make(map[string]*series),
+	}
+}
+
+// Record adds a sample to a series, updating its aggregates
+func (s *Store) Record(name string, t time.Time, value float64) {
+	// JSON cannot carry NaN or infinities
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ser, ok := s.series[name]
+	if !ok {
+		ser = &series{}
+		s.series[name] = ser
+	}
+
+	ser.Raw = append(ser.Raw, Point{Time: t, Value: value})
+	ser.Minute = addToBuckets(ser.Minute, t.Truncate(time.Minute), value)
+	ser.Hour = addToBuckets(ser.Hour, t.Truncate(time.Hour), value)
+}
+
+// RecordAll adds one sample per series, all at the same time
+func (s *Store) RecordAll(t time.Time, values map[string]float64) {
+	for name, value := range values {
+		s.Record(name, t, value)
+	}
+}
+
+// addToBuckets folds a value into the bucket starting at start, appending a
+// new bucket when the interval has moved on
+func addToBuckets(buckets []Bucket, start time.Time, value float64) []Bucket {
+	for i := len(buckets) - 1; i >= 0 && !buckets[i].Start.Before(start); i-- {
+		if buckets[i].Start.Equal(start) {
+			buckets[i].add(value)
+			return buckets
+		}
+	}
+
+	b := Bucket{Start: start}
+	b.add(value)
+	buckets = append(buckets, b)
+
+	// Late samples keep the buckets ordered
+	if n := len(buckets); n > 1 && buckets[n-1].Start.Before(buckets[n-2].Start) {
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	}
+	return buckets
+}
+
+// Compact drops data that has outlived its retention and forgets empty series
+func (s *Store) Compact(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, ser := range s.series {
+		rawCutoff := now.Add(-s.retention.Raw)
+		i := sort.Search(len(ser.Raw), func(i int) bool { return !ser.Raw[i].Time.Before(rawCutoff) })
+		ser.Raw = append([]Point(nil), ser.Raw[i:]...)
+
+		ser.Minute = trimBuckets(ser.Minute, now.Add(-s.retention.Minute))
+		ser.Hour = trimBuckets(ser.Hour, now.Add(-s.retention.Hour))
+
+		if len(ser.Raw) == 0 && len(ser.Minute) == 0 && len(ser.Hour) == 0 {
+			delete(s.series, name)
+		}
+	}
+}
+
+// trimBuckets removes buckets that start before cutoff
+func trimBuckets(buckets []Bucket, cutoff time.Time) []Bucket {
+	i := sort.Search(len(buckets), func(i int) bool { return !buckets[i].Start.Before(cutoff) })
+	return append([]Bucket(nil), buckets[i:]...)
+}
+
+// Names returns the names of all series, sorted
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.series))
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Result is the answer to a range query. Every series has one value per
+// timestamp; intervals without data are nil.
+type Result struct {
+	From       time.Time             `json:"from"`
+	To         time.Time             `json:"to"`
+	Step       int64                 `json:"stepSeconds"`
+	Resolution string                `json:"resolution"` // raw, minute or hour
+	Timestamps []time.Time           `json:"timestamps"`
+	Series     map[string][]*float64 `json:"series"`
+}
+
+// maxQueryPoints bounds the number of intervals a single query can return
+const maxQueryPoints = 10000
+
+// Query returns the named series between from and to, averaged into aligned
+// intervals of length step. The finest resolution that is still retained for
+// the whole range and is finer than step is used.
+func (s *Store) Query(names []string, from, to time.Time, step time.Duration) (*Result, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	from = from.Truncate(step)
+	count := int(to.Sub(from)/step) + 1
+	if count > maxQueryPoints {
+		return nil, fmt.Errorf("query would return %d points, the limit is %d", count, maxQueryPoints)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	resolution := "hour"
+	if step < time.Hour && !from.Before(now.Add(-s.retention.Minute)) {
+		resolution = "minute"
+	}
+	if step < time.Minute && !from.Before(now.Add(-s.retention.Raw)) {
+		resolution = "raw"
+	}
+
+	result := &Result{
+		From:       from,
+		To:         to,
+		Step:       int64(step / time.Second),
+		Resolution: resolution,
+		Timestamps: make([]time.Time, count),
+		Series:     make(map[string][]*float64, len(names)),
+	}
+	for i := range result.Timestamps {
+		result.Timestamps[i] = from.Add(time.Duration(i) * step)
+	}
+
+	for _, name := range names {
+		sums := make([]float64, count)
+		counts := make([]int, count)
+
+		add := func(t time.Time, sum float64, n int) {
+			if t.Before(from) || t.After(to) {
+				return
+			}
+			i := int(t.Sub(from) / step)
+			if i < count {
+				sums[i] += sum
+				counts[i] += n
+			}
+		}
+
+		if ser, ok := s.series[name]; ok {
+			switch resolution {
+			case "raw":
+				for _, p := range ser.Raw {
+					add(p.Time, p.Value, 1)
+				}
+			case "minute":
+				for _, b := range ser.Minute {
+					add(b.Start, b.Sum, b.Count)
+				}
+			default:
+				for _, b := range ser.Hour {
+					add(b.Start, b.Sum, b.Count)
+				}
+			}
+		}
+
+		values := make([]*float64, count)
+		for i := range values {
+			if counts[i] > 0 {
+				mean := sums[i] / float64(counts[i])
+				values[i] = &mean
+			}
+		}
+		result.Series[name] = values
+	}
+
+	return result, nil
+}
+
+// Save writes the whole store to a JSON file
+func (s *Store) Save(path string) error {
+	s.mu.RLock()
+	data, err := json.Marshal(s.series)
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create metrics directory: %v", err)
+	}
+	// Write to a temporary file first so a crash never leaves a truncated store
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace metrics file: %v", err)
+	}
+	return nil
+}
+
+// Load replaces the store contents with a file written by Save. A missing file is not an error.
+func (s *Store) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metrics: %v", err)
+	}
+
+	loaded := make(map[string]*series)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to parse metrics: %v", err)
+	}
+
+	s.mu.Lock()
+	s.series = loaded
+	s.mu.Unlock()
+	return nil
+}
+
+// ParseTime parses an absolute (RFC 3339 or Unix seconds) or relative ("-1h",
+// "30m", meaning that long before now) time used in queries
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" || value == "now" {
+		return now, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(value, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// ParseStep parses a query step given as a duration ("1m") or in seconds ("60")
+func ParseStep(value string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid step %q", value)
+	}
+	return d, nil
+}
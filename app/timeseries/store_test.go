@@ -0,0 +1,256 @@
+package timeseries
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noon is a fixed, hour-aligned start for tests that pass their own clock
+var noon = time.Date(2025, 6, 11, 12, 0, 0, 0, time.UTC)
+
+// values dereferences a query result series, with nil as NaN
+func values(series []*float64) []float64 {
+	out := make([]float64, len(series))
+	for i, v := range series {
+		out[i] = math.NaN()
+		if v != nil {
+			out[i] = *v
+		}
+	}
+	return out
+}
+
+// sameValues compares series values, treating NaN as equal to NaN
+func sameValues(got, want []float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] && !(math.IsNaN(got[i]) && math.IsNaN(want[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRecordDownsamples(t *testing.T) {
+	s := NewStore(DefaultRetention())
+	s.Record("rtt", noon.Add(10*time.Second), 1)
+	s.Record("rtt", noon.Add(50*time.Second), 3)
+	s.Record("rtt", noon.Add(70*time.Second), 8)
+	s.Record("rtt", noon.Add(time.Hour+5*time.Second), 4)
+	// A late sample lands in its own minute, keeping the buckets ordered
+	s.Record("rtt", noon.Add(30*time.Second), 2)
+	s.Record("rtt", noon.Add(40*time.Second), math.NaN())
+	s.Record("rtt", noon.Add(45*time.Second), math.Inf(1))
+
+	ser := s.series["rtt"]
+	if len(ser.Raw) != 5 {
+		t.Errorf("kept %d raw samples, want 5 without NaN and infinity", len(ser.Raw))
+	}
+	wantMinute := []Bucket{
+		{Start: noon, Sum: 6, Min: 1, Max: 3, Count: 3},
+		{Start: noon.Add(time.Minute), Sum: 8, Min: 8, Max: 8, Count: 1},
+		{Start: noon.Add(time.Hour), Sum: 4, Min: 4, Max: 4, Count: 1},
+	}
+	if !reflect.DeepEqual(ser.Minute, wantMinute) {
+		t.Errorf("minute buckets = %+v, want %+v", ser.Minute, wantMinute)
+	}
+	wantHour := []Bucket{
+		{Start: noon, Sum: 14, Min: 1, Max: 8, Count: 4},
+		{Start: noon.Add(time.Hour), Sum: 4, Min: 4, Max: 4, Count: 1},
+	}
+	if !reflect.DeepEqual(ser.Hour, wantHour) {
+		t.Errorf("hour buckets = %+v, want %+v", ser.Hour, wantHour)
+	}
+	if mean := ser.Hour[0].Mean(); mean != 3.5 {
+		t.Errorf("hour mean = %v, want 3.5", mean)
+	}
+
+	// Samples recorded out of order still end up in sorted buckets
+	s.Record("late", noon.Add(3*time.Minute), 1)
+	s.Record("late", noon.Add(time.Minute), 2)
+	if buckets := s.series["late"].Minute; !buckets[0].Start.Before(buckets[1].Start) {
+		t.Errorf("late sample left buckets unsorted: %+v", buckets)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s := NewStore(Retention{Raw: time.Hour, Minute: 2 * time.Hour, Hour: 3 * time.Hour})
+	s.Record("loss", noon.Add(10*time.Minute), 1)
+	s.Record("loss", noon.Add(70*time.Minute), 2)
+
+	// Raw samples go first, aggregates stay for their own retention
+	s.Compact(noon.Add(100 * time.Minute))
+	ser := s.series["loss"]
+	if len(ser.Raw) != 1 || ser.Raw[0].Value != 2 || len(ser.Minute) != 2 || len(ser.Hour) != 2 {
+		t.Errorf("after 100m: raw %v, %d minute and %d hour buckets; want the newest raw sample and every bucket",
+			ser.Raw, len(ser.Minute), len(ser.Hour))
+	}
+
+	s.Compact(noon.Add(3*time.Hour + 30*time.Minute))
+	ser = s.series["loss"]
+	if len(ser.Raw) != 0 || len(ser.Minute) != 0 || len(ser.Hour) != 1 || !ser.Hour[0].Start.Equal(noon.Add(time.Hour)) {
+		t.Errorf("after 3h30m: raw %v minute %v hour %v; want only the 13:00 hour", ser.Raw, ser.Minute, ser.Hour)
+	}
+
+	// A series with nothing left is forgotten
+	s.Compact(noon.Add(5 * time.Hour))
+	if names := s.Names(); len(names) != 0 {
+		t.Errorf("names = %v after everything expired", names)
+	}
+}
+
+func TestQueryResolution(t *testing.T) {
+	s := NewStore(DefaultRetention())
+	now := time.Now()
+
+	tests := []struct {
+		from       time.Duration // before now
+		step       time.Duration
+		resolution string
+	}{
+		{30 * time.Minute, 10 * time.Second, "raw"},
+		{30 * time.Minute, time.Minute, "minute"},
+		{3 * time.Hour, 10 * time.Second, "minute"}, // raw samples are kept for 2 hours
+		{6 * time.Hour, 5 * time.Minute, "minute"},
+		{30 * time.Minute, time.Hour, "hour"},
+		{30 * 24 * time.Hour, time.Minute * 10, "hour"}, // minute buckets are kept for 7 days
+	}
+	for _, tt := range tests {
+		result, err := s.Query([]string{"rtt"}, now.Add(-tt.from), now, tt.step)
+		if err != nil {
+			t.Errorf("from -%v step %v: %v", tt.from, tt.step, err)
+			continue
+		}
+		if result.Resolution != tt.resolution {
+			t.Errorf("from -%v step %v: resolution %q, want %q", tt.from, tt.step, result.Resolution, tt.resolution)
+		}
+	}
+}
+
+func TestQueryAlignsIntervals(t *testing.T) {
+	s := NewStore(DefaultRetention())
+	base := time.Now().Truncate(10 * time.Minute).Add(-20 * time.Minute)
+	s.Record("rtt", base.Add(5*time.Second), 1)
+	s.Record("rtt", base.Add(15*time.Second), 3)
+	s.Record("rtt", base.Add(25*time.Second), 10)
+	s.Record("rtt", base.Add(90*time.Second), 6)
+	s.Record("rtt", base.Add(5*time.Minute), 100)
+
+	// from is aligned down to the step, so the first interval starts at base
+	result, err := s.Query([]string{"rtt", "missing"}, base.Add(7*time.Second), base.Add(59*time.Second), 20*time.Second)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	wantTimes := []time.Time{base, base.Add(20 * time.Second), base.Add(40 * time.Second)}
+	if result.Resolution != "raw" || !reflect.DeepEqual(result.Timestamps, wantTimes) || result.Step != 20 {
+		t.Errorf("resolution %q step %d timestamps %v, want raw, 20 and %v", result.Resolution, result.Step, result.Timestamps, wantTimes)
+	}
+	if got, want := values(result.Series["rtt"]), []float64{2, 10, math.NaN()}; !sameValues(got, want) {
+		t.Errorf("rtt = %v, want %v", got, want)
+	}
+	if got := result.Series["missing"]; len(got) != 3 || got[0] != nil || got[1] != nil || got[2] != nil {
+		t.Errorf("unknown series = %v, want three empty intervals", values(got))
+	}
+
+	// Minute buckets are averaged by sample count, not by bucket
+	result, err = s.Query([]string{"rtt"}, base, base.Add(5*time.Minute), 2*time.Minute)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if got, want := values(result.Series["rtt"]), []float64{5, math.NaN(), 100}; result.Resolution != "minute" || !sameValues(got, want) {
+		t.Errorf("%s rtt = %v, want minute %v", result.Resolution, got, want)
+	}
+}
+
+func TestQueryRejectsBadRanges(t *testing.T) {
+	s := NewStore(DefaultRetention())
+	now := time.Now()
+	tests := []struct {
+		name     string
+		from, to time.Time
+		step     time.Duration
+		errText  string
+	}{
+		{"zero step", now.Add(-time.Hour), now, 0, "step must be positive"},
+		{"negative step", now.Add(-time.Hour), now, -time.Minute, "step must be positive"},
+		{"reversed range", now, now.Add(-time.Hour), time.Minute, "from must be before to"},
+		{"empty range", now, now, time.Minute, "from must be before to"},
+		{"too many points", now.Add(-24 * time.Hour), now, time.Second, "the limit is 10000"},
+	}
+	for _, tt := range tests {
+		if _, err := s.Query(nil, tt.from, tt.to, tt.step); err == nil || !strings.Contains(err.Error(), tt.errText) {
+			t.Errorf("%s: error = %v, want it to mention %q", tt.name, err, tt.errText)
+		}
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	s := NewStore(DefaultRetention())
+	s.Record("rtt", noon, 1.5)
+	if err := s.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded := NewStore(DefaultRetention())
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.series, s.series) {
+		t.Errorf("loaded %+v, want %+v", loaded.series["rtt"], s.series["rtt"])
+	}
+	if err := NewStore(DefaultRetention()).Load(filepath.Join(t.TempDir(), "none.json")); err != nil {
+		t.Errorf("missing file: %v", err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := noon
+	tests := map[string]time.Time{
+		"":                     now,
+		"now":                  now,
+		"2025-06-11T08:30:00Z": time.Date(2025, 6, 11, 8, 30, 0, 0, time.UTC),
+		"1749630600":           time.Unix(1749630600, 0),
+		"-1h":                  now.Add(-time.Hour),
+		"30m":                  now.Add(-30 * time.Minute),
+		"-1h30m":               now.Add(-90 * time.Minute),
+	}
+	for value, want := range tests {
+		got, err := ParseTime(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseTime(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"yesterday", "2025-13-01T00:00:00Z", "-", "1h ago", "12:00"} {
+		if _, err := ParseTime(value, now); err == nil || !strings.Contains(err.Error(), "invalid time") {
+			t.Errorf("ParseTime(%q) error = %v, want invalid time", value, err)
+		}
+	}
+}
+
+func TestParseStep(t *testing.T) {
+	tests := map[string]time.Duration{
+		"60":    time.Minute,
+		"1":     time.Second,
+		"5m":    5 * time.Minute,
+		"1h30m": 90 * time.Minute,
+	}
+	for value, want := range tests {
+		if got, err := ParseStep(value); err != nil || got != want {
+			t.Errorf("ParseStep(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "fast", "1x", "1.5", "m"} {
+		if _, err := ParseStep(value); err == nil || !strings.Contains(err.Error(), "invalid step") {
+			t.Errorf("ParseStep(%q) error = %v, want invalid step", value, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+)
+
+// embeddedAssets holds the templates and static files, so the binary runs
+// without the source tree
+//
+//go:embed app/templates app/static
+var embeddedAssets embed.FS
+
+// assetFS returns the embedded directory dir. Files in overrideDir, if given,
+// take the place of embedded files with the same path, so a theme only needs
+// to contain the files it changes.
+func assetFS(dir string, overrideDir string) (fs.FS, error) {
+	embedded, err := fs.Sub(embeddedAssets, dir)
+	if err != nil {
+		return nil, err
+	}
+	if overrideDir == "" {
+		return embedded, nil
+	}
+	info, err := os.Stat(overrideDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", overrideDir)
+	}
+	log.Printf("Files in %s override the built-in %s", overrideDir, dir)
+	return overlayFS{override: os.DirFS(overrideDir), base: embedded}, nil
+}
+
+// overlayFS opens files from override, falling back to base for files
+// override does not have
+type overlayFS struct {
+	override fs.FS
+	base     fs.FS
+}
+
+// Open opens name from the override, or from base if the override has no such file
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.override.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.base.Open(name)
+}
+
+// filesOnlyFS hides directories so the static handler serves files but does
+// not list directories, like gin's Static does for directories on disk
+type filesOnlyFS struct {
+	fs.FS
+}
+
+// Open opens name unless it is a directory
+func (f filesOnlyFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, fs.ErrNotExist
+	}
+	return file, nil
+}
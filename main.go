@@ -1,76 +1,303 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"github.com/NetScout-Go/NetTool/app/audit"
+	"github.com/NetScout-Go/NetTool/app/auth"
+	"github.com/NetScout-Go/NetTool/app/certs"
+	"github.com/NetScout-Go/NetTool/app/config"
 	"github.com/NetScout-Go/NetTool/app/core"
 	"github.com/NetScout-Go/NetTool/app/plugins"
+	"github.com/NetScout-Go/NetTool/app/realtime"
+	"github.com/NetScout-Go/NetTool/app/telemetry"
+	"github.com/NetScout-Go/NetTool/app/timeseries"
 	"github.com/gin-contrib/multitemplate"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// hub delivers live updates to WebSocket clients by topic
+var hub = realtime.NewHub()
+
+// upgrader accepts WebSocket connections; its origin check is set from realtime.allowedOrigins
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all connections for development
-	},
 }
 
 // createMyRender creates a multitemplate renderer for proper template inheritance
-func createMyRender() multitemplate.Renderer {
+func createMyRender(templates fs.FS) multitemplate.Renderer {
 	r := multitemplate.NewRenderer()
 
 	// Load templates
-	r.AddFromFiles("dashboard.html", "app/templates/layout.html", "app/templates/dashboard.html")
-	r.AddFromFiles("error.html", "app/templates/layout.html", "app/templates/error.html")
-	r.AddFromFiles("plugin_page.html", "app/templates/layout.html", "app/templates/plugin_page.html")
-	r.AddFromFiles("plugin_manager.html", "app/templates/layout.html", "app/templates/plugin_manager.html")
+	r.AddFromFS("dashboard.html", templates, "layout.html", "dashboard.html")
+	r.AddFromFS("error.html", templates, "layout.html", "error.html")
+	r.AddFromFS("plugin_page.html", templates, "layout.html", "plugin_page.html")
+	r.AddFromFS("plugin_manager.html", templates, "layout.html", "plugin_manager.html")
+	r.AddFromFS("login.html", templates, "login.html")
+	r.AddFromFS("setup.html", templates, "setup.html")
 
 	return r
 }
 
 func main() {
-	// Parse command line flags
-	port := flag.Int("port", 8080, "Port to run the server on")
+	// Settings come from the built-in defaults, then the config file, then
+	// NETTOOL_* environment variables and finally the command line
+	cfg := config.Default()
+	configFile := flag.String("config", os.Getenv("NETTOOL_CONFIG"), "YAML, TOML or JSON config file (default $NETTOOL_CONFIG)")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration as JSON and exit")
+	port := flag.Int("port", 0, "Port to run the server on, replacing the listen addresses (default 8080)")
+	flag.Var(&cfg.Listen, "listen", "Comma-separated addresses to listen on, e.g. 127.0.0.1:8080,[::1]:8080")
+	flag.StringVar(&cfg.DataDir, "data-dir", cfg.DataDir, "Directory for users, the audit log, metrics, latency targets and TLS files")
+	flag.StringVar(&cfg.PluginDir, "plugin-dir", cfg.PluginDir, "Directory plugins are installed in")
+	flag.StringVar(&cfg.PluginConfig, "plugin-config", cfg.PluginConfig, "File holding plugin sources and GitHub tokens")
+	flag.StringVar(&cfg.TemplateDir, "template-dir", cfg.TemplateDir, "Directory whose HTML templates replace the built-in ones with the same name")
+	flag.StringVar(&cfg.StaticDir, "static-dir", cfg.StaticDir, "Directory whose files replace or add to the built-in ones served under /static")
+	flag.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "debug (Gin debug output and requests), info (requests) or warn (no request log)")
+	flag.Var(&cfg.ShutdownTimeout, "shutdown-timeout", "How long running jobs may take to finish on SIGTERM before they are cancelled")
+	flag.Var(&cfg.Probes.MetricsInterval, "metrics-interval", "How often metrics are sampled")
+	flag.Var(&cfg.Probes.PollInterval, "poll-interval", "How often network updates are pushed when kernel events are unavailable")
+	flag.Var(&cfg.Metrics.RawRetention, "metrics-raw-retention", "How long to keep raw metric samples")
+	flag.Var(&cfg.Metrics.MinuteRetention, "metrics-minute-retention", "How long to keep one-minute metric aggregates")
+	flag.Var(&cfg.Metrics.HourRetention, "metrics-hour-retention", "How long to keep one-hour metric aggregates")
+	flag.Var(&cfg.Connectivity.ProbeURLs, "connectivity-probes", "Comma-separated HTTP URLs that answer 204, used to detect internet access and captive portals")
+	flag.StringVar(&cfg.Connectivity.DNSName, "connectivity-dns-name", cfg.Connectivity.DNSName, "Name resolved to check DNS (default: host of the first probe URL)")
+	flag.Var(&cfg.Realtime.AllowedOrigins, "ws-allowed-origins", "Comma-separated origins (scheme://host[:port]) besides the server's own that may open WebSockets, or * for any")
+	flag.Var(&cfg.Realtime.PingInterval, "ws-ping-interval", "How often WebSocket clients are pinged; clients that do not answer within twice this are dropped")
+	flag.IntVar(&cfg.Realtime.QueueSize, "ws-queue-size", cfg.Realtime.QueueSize, "Messages queued per WebSocket or event stream client before a client that falls behind is disconnected")
+	flag.IntVar(&cfg.Realtime.ReplaySize, "events-replay-size", cfg.Realtime.ReplaySize, "Recent messages kept so event streams reconnecting with Last-Event-ID can catch up")
+	flag.StringVar(&cfg.Auth.File, "auth-file", cfg.Auth.File, "File holding users and API tokens (default <data-dir>/auth.json)")
+	flag.Var(&cfg.Auth.SessionTTL, "session-ttl", "How long a login session lasts without requests")
+	flag.StringVar(&cfg.Audit.File, "audit-file", cfg.Audit.File, "Append-only, hash-chained log of plugin runs and administrative actions (default <data-dir>/audit.log)")
+	verifyAudit := flag.Bool("verify-audit", false, "Check the audit log's hash chain for tampering, print the result and exit")
+	flag.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert, "PEM certificate, with any intermediates, to serve HTTPS with (needs -tls-key)")
+	flag.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "PEM private key of -tls-cert")
+	flag.BoolVar(&cfg.TLS.SelfSigned, "tls-self-signed", cfg.TLS.SelfSigned, "Serve HTTPS with a certificate from a CA generated in -tls-dir on first run")
+	flag.StringVar(&cfg.TLS.Dir, "tls-dir", cfg.TLS.Dir, "Where the self-signed CA and the certificates it issues are kept (default <data-dir>/tls)")
+	flag.Var(&cfg.TLS.Hosts, "tls-hosts", "Comma-separated host names and IP addresses the self-signed certificate covers besides this host's name and addresses")
+	flag.StringVar(&cfg.TLS.ClientCA, "tls-client-ca", cfg.TLS.ClientCA, "PEM CA certificates whose client certificates log in as the user named by their common name")
+	flag.BoolVar(&cfg.TLS.RequireClientCert, "tls-require-client-cert", cfg.TLS.RequireClientCert, "Refuse HTTPS connections without a client certificate from -tls-client-ca")
+	tlsIssueClientCert := flag.String("tls-issue-client-cert", "", "Issue a client certificate for this user from the CA in -tls-dir, print its files and exit")
+	httpRedirectPort := flag.Int("http-redirect-port", 0, "With HTTPS, also listen for plain HTTP on this port and redirect it to HTTPS, replacing redirectListen")
+	netnsHelper := flag.Bool(core.NetnsHelperFlag, false, "Serve one request from stdin inside the current network namespace (used internally)")
 	flag.Parse()
 
-	// Ensure plugin directories exist
-	os.MkdirAll("app/plugins/plugins", 0755)
+	if *netnsHelper {
+		runNetnsHelper(cfg.PluginDir)
+		return
+	}
+	if err := loadConfig(cfg, *configFile); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if *port != 0 {
+		cfg.Listen = config.List{fmt.Sprintf(":%d", *port)}
+	}
+	if *httpRedirectPort != 0 {
+		cfg.RedirectListen = fmt.Sprintf(":%d", *httpRedirectPort)
+	}
+	if err := cfg.Finish(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if *printConfig {
+		data, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	if *verifyAudit {
+		os.Exit(runVerifyAudit(cfg.Audit.File))
+	}
+	if *tlsIssueClientCert != "" {
+		os.Exit(runIssueClientCert(cfg.TLS.Dir, *tlsIssueClientCert))
+	}
+
+	// Helper processes started in other network namespaces load the same plugins
+	if pluginDir, err := filepath.Abs(cfg.PluginDir); err == nil {
+		core.NetnsHelperArgs = []string{"-plugin-dir", pluginDir}
+	}
+
+	// Serve HTTPS with the given certificate or one from a generated CA
+	tlsReloader, renewCert, err := setupTLS(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.SelfSigned, cfg.TLS.Dir, cfg.TLS.Hosts, cfg.TLS.ClientCA)
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+	if tlsReloader == nil && (cfg.TLS.ClientCA != "" || cfg.RedirectListen != "") {
+		log.Fatalf("-tls-client-ca and -http-redirect-port need -tls-cert or -tls-self-signed")
+	}
+	if cfg.TLS.RequireClientCert && cfg.TLS.ClientCA == "" {
+		log.Fatalf("-tls-require-client-cert needs -tls-client-ca")
+	}
+	if tlsReloader != nil {
+		go tlsReloader.Watch(certs.DefaultWatchInterval, nil)
+		go reloadTLSOnSignal(tlsReloader, renewCert)
+	}
+
+	// Ensure plugin and data directories exist
+	os.MkdirAll(cfg.PluginDir, 0755)
+	os.MkdirAll(cfg.DataDir, 0755)
 
-	// Initialize the router
-	r := gin.Default()
+	// Initialize the router, logging requests unless only warnings are wanted
+	if cfg.LogLevel == config.LogDebug {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.New()
+	if cfg.LogLevel != config.LogWarn {
+		r.Use(gin.Logger())
+	}
+	r.Use(gin.Recovery())
+
+	// Every route except login, setup and static files needs a user or API
+	// token with a sufficient role
+	authStore, err := auth.NewStore(cfg.Auth.File)
+	if err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+	authManager, err := auth.NewManager(authStore)
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
+	authManager.SessionTTL = time.Duration(cfg.Auth.SessionTTL)
+	if code := authManager.SetupCode(); code != "" {
+		log.Printf("No users exist yet: open /setup and enter setup code %s to create the first admin", code)
+	}
+	r.Use(authManager.Authenticate())
+
+	// Record plugin runs and administrative actions with who did them
+	auditLog, err := audit.Open(cfg.Audit.File)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	if seq, head := auditLog.Head(); seq > 0 {
+		log.Printf("Audit log %s continues from entry %d with hash %s", cfg.Audit.File, seq, head)
+	}
+	audited := auditLog.Middleware()
+	viewer := authManager.Require(auth.RoleViewer)
+	operator := authManager.Require(auth.RoleOperator)
+	admin := authManager.Require(auth.RoleAdmin)
+
+	// Only same-origin pages and listed origins may open WebSockets
+	upgrader.CheckOrigin = realtime.CheckOrigin(cfg.Realtime.AllowedOrigins)
+	hub.PingInterval = time.Duration(cfg.Realtime.PingInterval)
+	hub.QueueSize = cfg.Realtime.QueueSize
+	hub.ReplaySize = cfg.Realtime.ReplaySize
+
+	// Watch the kernel for network changes so updates are event-driven
+	networkMonitor := core.NewNetworkMonitor(500)
+	if err := networkMonitor.Start(); err != nil {
+		log.Printf("Network monitor unavailable, falling back to polling: %v", err)
+	}
+
+	// Probe the configured latency targets in the background
+	latencyManager, err := core.NewLatencyManager(cfg.DataFile("latency_targets.json"))
+	if err != nil {
+		log.Printf("Failed to load latency targets, using defaults: %v", err)
+	}
+	latencyManager.Start()
+	core.SetLatencyManager(latencyManager)
+
+	// Probe connectivity stage by stage against the configured URLs
+	connectivityConfig := core.DefaultConnectivityConfig()
+	if len(cfg.Connectivity.ProbeURLs) > 0 {
+		connectivityConfig.ProbeURLs = cfg.Connectivity.ProbeURLs
+	}
+	connectivityConfig.DNSName = cfg.Connectivity.DNSName
+	core.SetConnectivityConfig(connectivityConfig)
+
+	// Collect network info sections concurrently and cache them
+	collectors, err := probeCollectors(cfg.Probes.Intervals)
+	if err != nil {
+		log.Fatalf("Invalid probe intervals: %v", err)
+	}
+	networkSnapshot := core.NewSnapshotCollector(collectors)
+	networkSnapshot.Start()
+
+	// Record snapshot metrics for history charts
+	metricsFile := cfg.DataFile("metrics.json")
+	metricsStore := timeseries.NewStore(timeseries.Retention{
+		Raw:    time.Duration(cfg.Metrics.RawRetention),
+		Minute: time.Duration(cfg.Metrics.MinuteRetention),
+		Hour:   time.Duration(cfg.Metrics.HourRetention),
+	})
+	if err := metricsStore.Load(metricsFile); err != nil {
+		log.Printf("Failed to load stored metrics: %v", err)
+	}
+	go recordMetrics(networkSnapshot, metricsStore, metricsFile, time.Duration(cfg.Probes.MetricsInterval))
+
+	// Expose network values and NetTool internals to Prometheus
+	telemetry.Default.Register(telemetry.NetworkCollector(networkSnapshot.Snapshot))
+	telemetry.Default.Register(hubMetrics)
 
 	// Start network info broadcaster in the background
-	go startNetworkInfoBroadcaster()
+	go startNetworkInfoBroadcaster(networkMonitor, networkSnapshot, time.Duration(cfg.Probes.PollInterval))
 
 	// Set HTML renderer
-	r.HTMLRender = createMyRender()
+	templates, err := assetFS("app/templates", cfg.TemplateDir)
+	if err != nil {
+		log.Fatalf("Failed to load templates: %v", err)
+	}
+	r.HTMLRender = createMyRender(templates)
 
 	// Initialize plugin manager
-	pluginManager := plugins.NewPluginManager()
+	pluginManager := plugins.NewPluginManager(cfg.PluginDir)
 
 	// Register plugins - our new implementation handles both modular and hardcoded plugins
 	pluginManager.RegisterPlugins()
 
 	// Initialize plugin installer
-	pluginInstaller := plugins.NewPluginInstaller("app/plugins/plugins", pluginManager)
+	pluginInstaller := plugins.NewPluginInstaller(cfg.PluginDir, cfg.PluginConfig, pluginManager)
+	pluginInstaller.SetProgressHandler(func(progress plugins.InstallerProgress) {
+		hub.Publish(realtime.NewMessage(realtime.TypeInstallerProgress, realtime.TopicInstaller, progress))
+	})
+
+	// Run plugins as jobs whose output streams to subscribed clients
+	jobManager := plugins.NewJobManager(pluginManager, func(event plugins.JobEvent) {
+		publishJobEvent(event)
+		recordJobOutcome(auditLog, event)
+	})
+	hub.InitialState = initialState(networkSnapshot, jobManager)
 
 	// Serve static files
-	r.Static("/static", "./app/static")
+	staticFiles, err := assetFS("app/static", cfg.StaticDir)
+	if err != nil {
+		log.Fatalf("Failed to load static files: %v", err)
+	}
+	r.StaticFS("/static", http.FS(filesOnlyFS{staticFiles}))
+
+	// Login and first-run setup pages
+	r.GET("/login", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "login.html", gin.H{"title": "Log in"})
+	})
+	r.GET("/setup", func(c *gin.Context) {
+		if !authManager.SetupRequired() {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+		c.HTML(http.StatusOK, "setup.html", gin.H{"title": "Set up NetTool"})
+	})
+
+	// Pages need a logged in user
+	pages := r.Group("/", authManager.RequirePage(auth.RoleViewer))
 
 	// Main dashboard route
-	r.GET("/", func(c *gin.Context) {
+	pages.GET("/", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "dashboard.html", gin.H{
 			"title":   "NetTool Dashboard",
 			"plugins": pluginManager.GetPlugins(),
@@ -78,7 +305,7 @@ func main() {
 	})
 
 	// Additional explicit dashboard route
-	r.GET("/dashboard", func(c *gin.Context) {
+	pages.GET("/dashboard", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "dashboard.html", gin.H{
 			"title":   "NetTool Dashboard",
 			"plugins": pluginManager.GetPlugins(),
@@ -86,7 +313,7 @@ func main() {
 	})
 
 	// Plugin manager route
-	r.GET("/plugin-manager", func(c *gin.Context) {
+	pages.GET("/plugin-manager", authManager.RequirePage(auth.RoleAdmin), func(c *gin.Context) {
 		c.HTML(http.StatusOK, "plugin_manager.html", gin.H{
 			"title":   "Plugin Manager",
 			"plugins": pluginManager.GetPlugins(),
@@ -94,7 +321,7 @@ func main() {
 	})
 
 	// Plugin page route
-	r.GET("/plugin/:id", func(c *gin.Context) {
+	pages.GET("/plugin/:id", func(c *gin.Context) {
 		pluginID := c.Param("id")
 		plugin, err := pluginManager.GetPlugin(pluginID)
 		if err != nil {
@@ -105,65 +332,537 @@ func main() {
 			return
 		}
 
-		c.HTML(http.StatusOK, "plugin_page.html", gin.H{
-			"title":   plugin.Name,
-			"plugin":  plugin,
-			"plugins": pluginManager.GetPlugins(),
+		c.HTML(http.StatusOK, "plugin_page.html", gin.H{
+			"title":   plugin.Name,
+			"plugin":  plugin,
+			"plugins": pluginManager.GetPlugins(),
+		})
+	})
+
+	// Login, first-run setup, users and API tokens
+	authAPI := r.Group("/api/auth")
+	{
+		// Create the first admin with the setup code from the log
+		authAPI.POST("/setup", audited, func(c *gin.Context) {
+			var request struct {
+				SetupCode string `json:"setupCode"`
+				Username  string `json:"username"`
+				Password  string `json:"password"`
+			}
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			principal, err := authManager.Setup(c, request.SetupCode, request.Username, request.Password)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Created the first admin %s", principal.Username)
+			c.JSON(http.StatusOK, principal)
+		})
+
+		// Log in and receive session and CSRF cookies
+		authAPI.POST("/login", func(c *gin.Context) {
+			var request struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			}
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			principal, err := authManager.Login(c, request.Username, request.Password)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, principal)
+		})
+
+		authAPI.POST("/logout", viewer, func(c *gin.Context) {
+			authManager.Logout(c)
+			c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+		})
+
+		// The current user, role and CSRF token
+		authAPI.GET("/me", viewer, func(c *gin.Context) {
+			c.JSON(http.StatusOK, auth.CurrentPrincipal(c))
+		})
+
+		// Change the current user's password; other sessions are logged out
+		authAPI.POST("/password", audited, viewer, func(c *gin.Context) {
+			var request struct {
+				CurrentPassword string `json:"currentPassword"`
+				NewPassword     string `json:"newPassword"`
+			}
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			username := auth.CurrentPrincipal(c).Username
+			if _, ok := authStore.CheckPassword(username, request.CurrentPassword); !ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": "current password is wrong"})
+				return
+			}
+			if err := authStore.SetPassword(username, request.NewPassword); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			authManager.EndSessions(c, username)
+			c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+		})
+
+		authAPI.GET("/users", admin, func(c *gin.Context) {
+			c.JSON(http.StatusOK, authStore.Users())
+		})
+
+		authAPI.POST("/users", audited, admin, func(c *gin.Context) {
+			var request struct {
+				Username string    `json:"username"`
+				Password string    `json:"password"`
+				Role     auth.Role `json:"role"`
+			}
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := authStore.CreateUser(request.Username, request.Password, request.Role); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			user, _ := authStore.User(request.Username)
+			c.JSON(http.StatusCreated, user)
+		})
+
+		// Change a user's role or reset their password, which logs them out
+		authAPI.PUT("/users/:username", audited, admin, func(c *gin.Context) {
+			username := c.Param("username")
+			var request struct {
+				Role     auth.Role `json:"role"`
+				Password string    `json:"password"`
+			}
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if _, ok := authStore.User(username); !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found: " + username})
+				return
+			}
+			if request.Role != "" {
+				if err := authStore.SetRole(username, request.Role); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			if request.Password != "" {
+				if err := authStore.SetPassword(username, request.Password); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				authManager.EndSessions(c, username)
+			}
+			user, _ := authStore.User(username)
+			c.JSON(http.StatusOK, user)
+		})
+
+		authAPI.DELETE("/users/:username", audited, admin, func(c *gin.Context) {
+			username := c.Param("username")
+			if err := authStore.DeleteUser(username); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			authManager.EndSessions(c, username)
+			c.JSON(http.StatusOK, gin.H{"message": "Deleted user " + username})
+		})
+
+		authAPI.GET("/tokens", admin, func(c *gin.Context) {
+			c.JSON(http.StatusOK, authStore.Tokens())
+		})
+
+		// Issue an API token; the token is only shown in this response
+		authAPI.POST("/tokens", audited, admin, func(c *gin.Context) {
+			var request struct {
+				Name          string    `json:"name"`
+				Role          auth.Role `json:"role"`
+				Owner         string    `json:"owner"`
+				ExpiresInDays int       `json:"expiresInDays"`
+			}
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if request.Owner == "" {
+				request.Owner = auth.CurrentPrincipal(c).Username
+			}
+			if request.Role == "" {
+				request.Role = auth.RoleViewer
+			}
+			ttl := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+			token, secret, err := authStore.CreateToken(request.Owner, request.Name, request.Role, ttl)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusCreated, gin.H{"token": secret, "details": token})
+		})
+
+		authAPI.DELETE("/tokens/:id", audited, admin, func(c *gin.Context) {
+			if err := authStore.DeleteToken(c.Param("id")); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "Revoked token " + c.Param("id")})
+		})
+	}
+
+	// API endpoints
+	api := r.Group("/api", viewer)
+	{
+		// Get all plugins
+		api.GET("/plugins", func(c *gin.Context) {
+			c.JSON(http.StatusOK, pluginManager.GetPlugins())
+		})
+
+		// Get specific plugin info
+		api.GET("/plugins/:id", func(c *gin.Context) {
+			pluginID := c.Param("id")
+			plugin, err := pluginManager.GetPlugin(pluginID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, plugin)
+		})
+
+		// Run a plugin
+		api.POST("/plugins/:id/run", audited, operator, func(c *gin.Context) {
+			pluginID := c.Param("id")
+			var params map[string]interface{}
+			if err := c.BindJSON(&params); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// An optional netns parameter runs the plugin inside that network namespace
+			netns, _ := params["netns"].(string)
+			delete(params, "netns")
+
+			result, err := pluginManager.RunPluginInNetns(pluginID, netns, params)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		})
+
+		// Run a plugin as a background job; follow it on the job:<id> topic
+		api.POST("/jobs", audited, operator, func(c *gin.Context) {
+			var request struct {
+				PluginID string                 `json:"pluginId"`
+				Netns    string                 `json:"netns"`
+				Params   map[string]interface{} `json:"params"`
+			}
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			job, err := jobManager.Start(request.PluginID, request.Netns, request.Params)
+			if err == plugins.ErrShuttingDown {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			audit.Note(c, "jobId", job.ID)
+			c.JSON(http.StatusAccepted, redactedJob(job))
+		})
+
+		// List recent plugin jobs
+		api.GET("/jobs", func(c *gin.Context) {
+			jobs := jobManager.List()
+			for i, job := range jobs {
+				jobs[i] = redactedJob(job)
+			}
+			c.JSON(http.StatusOK, jobs)
+		})
+
+		// Get a plugin job with its output so far
+		api.GET("/jobs/:id", func(c *gin.Context) {
+			job, err := jobManager.Get(c.Param("id"))
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, redactedJob(job))
+		})
+
+		// Cancel a running plugin job
+		api.POST("/jobs/:id/cancel", audited, operator, func(c *gin.Context) {
+			if _, err := jobManager.Get(c.Param("id")); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			job, err := jobManager.Cancel(c.Param("id"))
+			if err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, redactedJob(job))
+		})
+
+		// Get network information for the dashboard
+		api.GET("/network-info", forNetns(operator), func(c *gin.Context) {
+			if netns := c.Query("netns"); netns != "" {
+				// Other namespaces are collected on demand by a helper process
+				info, err := core.GetNetworkInfoInNetns(netns)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, info)
+				return
+			}
+			// Served from the cache; each section reports its own age
+			c.JSON(http.StatusOK, networkSnapshot.Snapshot())
+		})
+
+		// Re-check connectivity now and return each stage's outcome
+		api.GET("/connectivity", func(c *gin.Context) {
+			networkSnapshot.Refresh("connectivity")
+			c.JSON(http.StatusOK, networkSnapshot.Snapshot().Connectivity)
+		})
+
+		// Assess IPv6 readiness; listens for router advertisements for 1 to 10 seconds
+		api.GET("/ipv6", func(c *gin.Context) {
+			listen, err := strconv.Atoi(c.DefaultQuery("listen", "3"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "listen must be a whole number of seconds"})
+				return
+			}
+			listen = max(1, min(listen, int(core.MaxIPv6Listen/time.Second)))
+			report, err := core.GetIPv6Readiness(core.IPv6Options{Listen: time.Duration(listen) * time.Second})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, report)
+		})
+
+		// Get the ARP table, optionally of another network namespace
+		api.GET("/arp", forNetns(operator), func(c *gin.Context) {
+			entries, err := core.GetARPTableInNetns(c.Query("netns"))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, entries)
+		})
+
+		// List network namespaces that collectors and plugins can run in
+		api.GET("/netns", func(c *gin.Context) {
+			namespaces, err := core.ListNetns()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, namespaces)
+		})
+
+		// Get recent network change events (link, address, route, neighbor)
+		api.GET("/network-events", func(c *gin.Context) {
+			limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+			c.JSON(http.StatusOK, networkMonitor.Events(limit))
+		})
+
+		// List sockets with their owning process, optionally filtered
+		api.GET("/connections", func(c *gin.Context) {
+			port, _ := strconv.Atoi(c.Query("port"))
+			pid, _ := strconv.Atoi(c.Query("pid"))
+			connections, err := core.GetConnections(core.ConnectionFilter{
+				Protocol:    c.Query("protocol"),
+				State:       c.Query("state"),
+				Port:        port,
+				PID:         pid,
+				Command:     c.Query("command"),
+				Listening:   c.Query("listening") == "true",
+				Established: c.Query("established") == "true",
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, connections)
+		})
+
+		// Connection tracking table with NAT translations, top flows and per-host totals
+		api.GET("/conntrack", func(c *gin.Context) {
+			limit, _ := strconv.Atoi(c.DefaultQuery("limit", "500"))
+			top, _ := strconv.Atoi(c.DefaultQuery("top", "10"))
+			conntrack, err := core.GetConntrackTable(core.ConntrackOptions{
+				Protocol: c.Query("protocol"),
+				Host:     c.Query("host"),
+				NATOnly:  c.Query("nat") == "true",
+				Limit:    limit,
+				Top:      top,
+			})
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, conntrack)
+		})
+
+		// Firewall ruleset in a normalized form, from nftables or iptables
+		api.GET("/firewall", func(c *gin.Context) {
+			ruleset, err := core.GetFirewallRuleset()
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, ruleset)
+		})
+
+		// Trace a packet through the firewall ruleset
+		api.POST("/firewall/trace", audited, operator, func(c *gin.Context) {
+			var packet core.PacketTuple
+			if err := c.BindJSON(&packet); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			ruleset, err := core.GetFirewallRuleset()
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+
+			result, err := ruleset.Trace(packet)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		})
+
+		// Interface topology graph: bridges, bonds, VLANs, VRFs, tunnels and namespaces
+		api.GET("/topology", func(c *gin.Context) {
+			topology, err := core.GetTopology()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, topology)
+		})
+
+		// Query recorded metrics as aligned series
+		api.GET("/metrics", func(c *gin.Context) {
+			now := time.Now()
+			from, err := timeseries.ParseTime(c.DefaultQuery("from", "-1h"), now)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			to, err := timeseries.ParseTime(c.Query("to"), now)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			step, err := timeseries.ParseStep(c.DefaultQuery("step", "60"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			series := metricsStore.Names()
+			if names := c.Query("series"); names != "" {
+				series = strings.Split(names, ",")
+			}
+
+			result, err := metricsStore.Query(series, from, to, step)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, result)
 		})
-	})
 
-	// API endpoints
-	api := r.Group("/api")
-	{
-		// Get all plugins
-		api.GET("/plugins", func(c *gin.Context) {
-			c.JSON(http.StatusOK, pluginManager.GetPlugins())
+		// List the names of recorded metric series
+		api.GET("/metrics/series", func(c *gin.Context) {
+			c.JSON(http.StatusOK, metricsStore.Names())
 		})
 
-		// Get specific plugin info
-		api.GET("/plugins/:id", func(c *gin.Context) {
-			pluginID := c.Param("id")
-			plugin, err := pluginManager.GetPlugin(pluginID)
-			if err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		// Latency target configuration and latest results
+		api.GET("/latency-targets", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"targets": latencyManager.Targets(),
+				"results": latencyManager.Results(),
+			})
+		})
+
+		api.PUT("/latency-targets", audited, admin, func(c *gin.Context) {
+			var targets []core.LatencyTarget
+			if err := c.BindJSON(&targets); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			c.JSON(http.StatusOK, plugin)
+
+			if err := latencyManager.SetTargets(targets); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, latencyManager.Targets())
 		})
 
-		// Run a plugin
-		api.POST("/plugins/:id/run", func(c *gin.Context) {
-			pluginID := c.Param("id")
-			var params map[string]interface{}
-			if err := c.BindJSON(&params); err != nil {
+		api.POST("/latency-targets", audited, admin, func(c *gin.Context) {
+			var target core.LatencyTarget
+			if err := c.BindJSON(&target); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
 
-			result, err := pluginManager.RunPlugin(pluginID, params)
+			stored, err := latencyManager.AddTarget(target)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			c.JSON(http.StatusOK, result)
+
+			c.JSON(http.StatusCreated, stored)
 		})
 
-		// Get network information for the dashboard
-		api.GET("/network-info", func(c *gin.Context) {
-			networkInfo, err := core.GetNetworkInfo()
+		api.PUT("/latency-targets/:name", audited, admin, func(c *gin.Context) {
+			var target core.LatencyTarget
+			if err := c.BindJSON(&target); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			stored, err := latencyManager.UpdateTarget(c.Param("name"), target)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
 
-			// Update the timestamp to current time
-			networkInfo.Timestamp = time.Now()
+			c.JSON(http.StatusOK, stored)
+		})
+
+		api.DELETE("/latency-targets/:name", audited, admin, func(c *gin.Context) {
+			if err := latencyManager.RemoveTarget(c.Param("name")); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
 
-			c.JSON(http.StatusOK, networkInfo)
+			c.JSON(http.StatusOK, gin.H{"success": true})
 		})
 
 		// General plugin runner endpoint for dashboard features
-		api.POST("/run-plugin", func(c *gin.Context) {
+		api.POST("/run-plugin", audited, operator, func(c *gin.Context) {
 			var request struct {
 				ID     string                 `json:"id"`
 				Params map[string]interface{} `json:"params"`
@@ -184,7 +883,7 @@ func main() {
 		})
 
 		// Plugin Manager API endpoints
-		pluginManage := api.Group("/plugins/manage")
+		pluginManage := api.Group("/plugins/manage", audited, admin)
 		{
 			// List all installed plugins
 			pluginManage.GET("/list", func(c *gin.Context) {
@@ -421,6 +1120,7 @@ func main() {
 
 				// Count how many plugins were updated
 				updated := 0
+				var updatedIDs []string
 
 				// Update each plugin that has an update available
 				for _, plugin := range plugins {
@@ -428,175 +1128,679 @@ func main() {
 						_, err := pluginInstaller.UpdatePlugin(plugin.ID)
 						if err == nil {
 							updated++
+							updatedIDs = append(updatedIDs, plugin.ID)
 						}
 					}
 				}
+				audit.Note(c, "updated", updatedIDs)
 
 				c.JSON(http.StatusOK, gin.H{
 					"message": "Successfully updated plugins",
 					"updated": updated,
 				})
 			})
+
+			// Plugin system configuration; GitHub tokens are never returned
+			pluginManage.GET("/config", func(c *gin.Context) {
+				config := pluginInstaller.Config()
+				tokens := []gin.H{}
+				for _, token := range config.GetGitHubTokens() {
+					tokens = append(tokens, gin.H{"name": token.Name, "organization": token.Organization, "configured": token.Token != ""})
+				}
+				c.JSON(http.StatusOK, gin.H{"tokens": tokens, "sources": config.GetSources()})
+			})
+
+			// Add or replace a GitHub token
+			pluginManage.PUT("/config/tokens/:name", func(c *gin.Context) {
+				var request struct {
+					Token        string `json:"token"`
+					Organization string `json:"organization"`
+				}
+				if err := c.BindJSON(&request); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if err := pluginInstaller.Config().AddGitHubToken(c.Param("name"), request.Token, request.Organization); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{"message": "Saved token " + c.Param("name")})
+			})
+
+			pluginManage.DELETE("/config/tokens/:name", func(c *gin.Context) {
+				if err := pluginInstaller.Config().RemoveGitHubToken(c.Param("name")); err != nil {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{"message": "Removed token " + c.Param("name")})
+			})
+
+			// Add or replace a plugin source
+			pluginManage.PUT("/config/sources/:name", func(c *gin.Context) {
+				var source plugins.PluginSource
+				if err := c.BindJSON(&source); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if source.Organization == "" {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "organization is required"})
+					return
+				}
+				if err := pluginInstaller.Config().AddSource(c.Param("name"), source.Organization, source.Pattern, source.IsDefault); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				pluginInstaller.ReloadSources()
+				c.JSON(http.StatusOK, gin.H{"message": "Saved source " + c.Param("name")})
+			})
+
+			pluginManage.DELETE("/config/sources/:name", func(c *gin.Context) {
+				if err := pluginInstaller.Config().RemoveSource(c.Param("name")); err != nil {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				pluginInstaller.ReloadSources()
+				c.JSON(http.StatusOK, gin.H{"message": "Removed source " + c.Param("name")})
+			})
 		}
+
+		// Query the audit log, newest first
+		api.GET("/audit", admin, func(c *gin.Context) {
+			filter := audit.Filter{
+				Actor:   c.Query("actor"),
+				Action:  c.Query("action"),
+				Target:  c.Query("target"),
+				Outcome: c.Query("outcome"),
+			}
+			if since := c.Query("since"); since != "" {
+				t, err := time.Parse(time.RFC3339, since)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+					return
+				}
+				filter.Since = t
+			}
+			if until := c.Query("until"); until != "" {
+				t, err := time.Parse(time.RFC3339, until)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid until: " + err.Error()})
+					return
+				}
+				filter.Until = t
+			}
+			if limit := c.Query("limit"); limit != "" {
+				n, err := strconv.Atoi(limit)
+				if err != nil || n < 1 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + limit})
+					return
+				}
+				filter.Limit = n
+			}
+
+			entries, err := auditLog.Query(filter)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, entries)
+		})
+
+		// Check the audit log's hash chain
+		api.GET("/audit/verify", admin, func(c *gin.Context) {
+			result, err := audit.Verify(auditLog.Path())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		})
 	}
 
 	// WebSocket for real-time updates
-	r.GET("/ws", func(c *gin.Context) {
-		handleWebSocketConnection(c.Writer, c.Request)
+	r.GET("/ws", viewer, func(c *gin.Context) {
+		hub.ServeWS(&upgrader, c.Writer, c.Request)
 	})
 
-	// Start the server
-	log.Printf("Starting NetTool server on :%d", *port)
-	log.Fatal(r.Run(fmt.Sprintf(":%d", *port)))
-}
+	// Server-Sent Events alternative to the WebSocket, for clients behind
+	// proxies that do not pass WebSockets
+	r.GET("/api/events", viewer, func(c *gin.Context) {
+		hub.ServeSSE(c.Writer, c.Request)
+	})
 
-// Clients map to manage WebSocket connections
-var clients = make(map[*websocket.Conn]bool)
-var clientsMutex = sync.Mutex{}
+	// Prometheus scrape endpoint
+	r.GET("/metrics", viewer, gin.WrapH(telemetry.Default.Handler()))
 
-func handleWebSocketConnection(w http.ResponseWriter, r *http.Request) {
-	ws, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("Error upgrading to WebSocket: %v", err)
-		return
+	// Serve on every listen address until SIGTERM or Ctrl-C
+	server := &http.Server{Handler: r}
+	if tlsReloader != nil {
+		clientAuth := tls.VerifyClientCertIfGiven
+		if cfg.TLS.RequireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+		server.TLSConfig = tlsReloader.TLSConfig(clientAuth)
+	}
+	serveErrors := make(chan error, len(cfg.Listen)+1)
+	for _, address := range cfg.Listen {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", address, err)
+		}
+		go func() {
+			if tlsReloader == nil {
+				log.Printf("Starting NetTool server on %s", address)
+				serveErrors <- server.Serve(listener)
+			} else {
+				log.Printf("Starting NetTool server on %s with HTTPS", address)
+				serveErrors <- server.ServeTLS(listener, "", "")
+			}
+		}()
+	}
+	var redirect *http.Server
+	if cfg.RedirectListen != "" {
+		redirect = &http.Server{
+			Addr:              cfg.RedirectListen,
+			Handler:           redirectToHTTPS(listenPort(cfg.Listen[0])),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", cfg.RedirectListen)
+			serveErrors <- redirect.ListenAndServe()
+		}()
 	}
-	defer ws.Close()
-
-	// Register new client
-	clientsMutex.Lock()
-	clients[ws] = true
-	clientsMutex.Unlock()
 
-	// Remove client when connection closes
-	defer func() {
-		clientsMutex.Lock()
-		delete(clients, ws)
-		clientsMutex.Unlock()
+	stop, cancelStop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-serveErrors:
+		log.Fatal(err)
+	case <-stop.Done():
+	}
+	// A second signal kills NetTool at once
+	cancelStop()
+
+	// Stop accepting connections and give running jobs until the shutdown
+	// timeout to finish, then cancel them. Clients are sent the messages
+	// still queued for them before they are disconnected.
+	log.Printf("Shutting down, waiting up to %s for running jobs", cfg.ShutdownTimeout)
+	deadline := time.Now().Add(time.Duration(cfg.ShutdownTimeout))
+	jobsCtx, cancelJobs := context.WithDeadline(context.Background(), deadline)
+	defer cancelJobs()
+	serverCtx, cancelServer := context.WithDeadline(context.Background(), deadline.Add(10*time.Second))
+	defer cancelServer()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- server.Shutdown(serverCtx)
 	}()
+	if redirect != nil {
+		redirect.Close()
+	}
+	if err := jobManager.Shutdown(jobsCtx); err != nil {
+		log.Printf("Cancelled jobs still running after %s", cfg.ShutdownTimeout)
+	}
+	if err := hub.Shutdown(serverCtx); err != nil {
+		log.Printf("Some clients did not disconnect in time: %v", err)
+	}
+	if err := <-serverDone; err != nil {
+		log.Printf("Closing connections that are still open: %v", err)
+		server.Close()
+	}
 
-	// No need to start individual updaters anymore
-	// We're using the global broadcaster
+	networkSnapshot.Stop()
+	latencyManager.Stop()
+	networkMonitor.Stop()
+	if err := metricsStore.Save(metricsFile); err != nil {
+		log.Printf("Failed to save metrics: %v", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		log.Printf("Failed to close audit log: %v", err)
+	}
+	log.Printf("NetTool stopped")
+}
 
-	// Handle incoming messages (not required for this application, but included for completeness)
-	for {
-		_, _, err := ws.ReadMessage()
+// loadConfig reads the config file, if any, over the defaults in cfg, then
+// applies NETTOOL_* environment variables and parses the command line again
+// so flags given explicitly win over both
+func loadConfig(cfg *config.Config, file string) error {
+	if file != "" {
+		if err := cfg.Load(file); err != nil {
+			return err
+		}
+	}
+	if err := cfg.ApplyEnv(); err != nil {
+		return err
+	}
+	return flag.CommandLine.Parse(os.Args[1:])
+}
+
+// listenPort returns the port of a listen address such as ":8443"
+func listenPort(address string) int {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return 443
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return 443
+	}
+	return n
+}
+
+// probeCollectors returns the default snapshot collectors with the intervals
+// configured for them by section name
+func probeCollectors(intervals map[string]config.Duration) ([]core.Collector, error) {
+	collectors := core.DefaultCollectors()
+	var names []string
+	for i := range collectors {
+		names = append(names, collectors[i].Name)
+		if interval, ok := intervals[collectors[i].Name]; ok {
+			collectors[i].Interval = time.Duration(interval)
+		}
+	}
+	for name := range intervals {
+		known := false
+		for _, n := range names {
+			known = known || n == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown section %q; sections are %s", name, strings.Join(names, ", "))
+		}
+	}
+	return collectors, nil
+}
+
+// setupTLS returns a reloader for the HTTPS certificate, or nil to serve
+// plain HTTP. With selfSigned the CA in dir is created on first run and
+// issues a server certificate for this host; the returned function renews
+// that certificate when it nears expiry or no longer covers the host's
+// addresses.
+func setupTLS(certFile string, keyFile string, selfSigned bool, dir string, extraHosts []string, clientCAFile string) (*certs.Reloader, func() error, error) {
+	var renew func() error
+	switch {
+	case selfSigned && (certFile != "" || keyFile != ""):
+		return nil, nil, fmt.Errorf("use either -tls-cert and -tls-key or -tls-self-signed")
+	case selfSigned:
+		authority, created, err := certs.LoadOrCreateAuthority(dir)
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			break
+			return nil, nil, err
 		}
+		if created {
+			log.Printf("Created a self-signed CA in %s; install %s in browsers and clients to trust NetTool", dir, filepath.Join(dir, certs.CAFile))
+		}
+		log.Printf("TLS CA %q, SHA-256 fingerprint %s", authority.Cert.Subject.CommonName, certs.Fingerprint(authority.Cert))
+		renew = func() error {
+			hosts := certs.DefaultHosts(extraHosts)
+			_, _, issued, err := authority.EnsureServerCert(hosts)
+			if issued {
+				log.Printf("Issued a server certificate for %s", strings.Join(hosts, ", "))
+			}
+			return err
+		}
+		if err := renew(); err != nil {
+			return nil, nil, err
+		}
+		certFile, keyFile = filepath.Join(dir, certs.ServerFile), filepath.Join(dir, certs.ServerKeyFile)
+	case certFile == "" && keyFile == "":
+		return nil, nil, nil
+	case certFile == "" || keyFile == "":
+		return nil, nil, fmt.Errorf("-tls-cert and -tls-key must be given together")
 	}
+
+	reloader, err := certs.NewReloader(certFile, keyFile, clientCAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Serving TLS certificate %s for %q, SHA-256 fingerprint %s", certFile, reloader.Leaf().Subject.CommonName, certs.Fingerprint(reloader.Leaf()))
+	return reloader, renew, nil
 }
 
-func sendPeriodicNetworkUpdates(ws *websocket.Conn) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// reloadTLSOnSignal reloads the certificate files on SIGHUP. A self-signed
+// certificate is also checked for renewal then and once a day.
+func reloadTLSOnSignal(reloader *certs.Reloader, renew func() error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	daily := time.NewTicker(24 * time.Hour)
+	defer daily.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			networkInfo, err := core.GetNetworkInfo()
-			if err != nil {
-				log.Printf("Error getting network info: %v", err)
+		case <-hup:
+			log.Printf("Received SIGHUP, reloading the TLS certificate")
+		case <-daily.C:
+			if renew == nil {
 				continue
 			}
+		}
+		if renew != nil {
+			if err := renew(); err != nil {
+				log.Printf("Failed to renew the TLS certificate: %v", err)
+			}
+		}
+		if err := reloader.Reload(); err != nil {
+			log.Printf("Failed to reload the TLS certificate, still serving the old one: %v", err)
+			continue
+		}
+		log.Printf("Serving TLS certificate with SHA-256 fingerprint %s", certs.Fingerprint(reloader.Leaf()))
+	}
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS on httpsPort
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "missing Host header", http.StatusBadRequest)
+			return
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 literal
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// runIssueClientCert issues a client certificate for username from the
+// self-signed CA in dir and returns the exit status
+func runIssueClientCert(dir string, username string) int {
+	authority, created, err := certs.LoadOrCreateAuthority(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load the CA: %v\n", err)
+		return 1
+	}
+	if created {
+		fmt.Printf("Created a CA in %s\n", dir)
+	}
+	certFile, keyFile, err := authority.IssueClientCert(username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to issue a client certificate: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Client certificate for %s: %s\nKey: %s\nStart NetTool with -tls-client-ca %s to accept it\n", username, certFile, keyFile, filepath.Join(dir, certs.CAFile))
+	return 0
+}
+
+// startNetworkInfoBroadcaster publishes network events and fresh snapshots to
+// the subscribed clients. Snapshots are only recomputed after the monitor reports a
+// change; without a running monitor it falls back to polling.
+func startNetworkInfoBroadcaster(monitor *core.NetworkMonitor, snapshot *core.SnapshotCollector, pollInterval time.Duration) {
+	if !monitor.IsRunning() {
+		pollNetworkInfo(snapshot, pollInterval)
+		return
+	}
+
+	events := monitor.Subscribe()
+	defer monitor.Unsubscribe(events)
 
-			// Check if this specific client is still connected
-			clientsMutex.Lock()
-			if !clients[ws] {
-				clientsMutex.Unlock()
+	// Coalesce bursts of events (an interface coming up triggers several)
+	// into a single snapshot
+	var pending <-chan time.Time
+	stale := make(map[string]bool)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
 				return
 			}
-			clientsMutex.Unlock()
+			publishNetworkEvent(event)
+			for _, name := range core.EventSections(event) {
+				stale[name] = true
+			}
+			if pending == nil {
+				pending = time.After(500 * time.Millisecond)
+			}
+		case <-pending:
+			pending = nil
+			// Recollect only the sections the events touched
+			var sections []string
+			for name := range stale {
+				sections = append(sections, name)
+				delete(stale, name)
+			}
+			if len(sections) > 0 {
+				snapshot.Refresh(sections...)
+			}
+			broadcastNetworkSnapshot(snapshot)
+		}
+	}
+}
 
-			// Send update to this client
-			err = ws.WriteJSON(map[string]interface{}{
-				"type":      "network_update",
-				"data":      networkInfo,
-				"timestamp": time.Now().Format(time.RFC3339),
-			})
-			if err != nil {
-				log.Printf("Error sending network update: %v", err)
-				return
+// recordMetrics samples the cached snapshot into the metrics store every
+// interval, compacting it every minute and saving it to disk every five minutes
+func recordMetrics(snapshot *core.SnapshotCollector, store *timeseries.Store, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastSample, lastCompact, lastSave time.Time
+	for now := range ticker.C {
+		store.RecordAll(now, snapshot.Snapshot().Metrics(lastSample))
+		lastSample = now
+
+		if now.Sub(lastCompact) >= time.Minute {
+			store.Compact(now)
+			lastCompact = now
+		}
+		if now.Sub(lastSave) >= 5*time.Minute {
+			if err := store.Save(path); err != nil {
+				log.Printf("Failed to save metrics: %v", err)
 			}
+			lastSave = now
 		}
 	}
 }
 
-// Broadcast network information to all connected clients
-func broadcastNetworkInfo() {
-	networkInfo, err := core.GetNetworkInfo()
+// runVerifyAudit checks the audit log's hash chain and returns the exit status:
+// 0 if it is intact, 1 if it was tampered with and 2 if it cannot be read
+func runVerifyAudit(path string) int {
+	result, err := audit.Verify(path)
 	if err != nil {
-		log.Printf("Error getting network info for broadcast: %v", err)
+		fmt.Fprintf(os.Stderr, "Failed to verify audit log: %v\n", err)
+		return 2
+	}
+	fmt.Printf("%s: %d entries, last entry %d, head %s\n", path, result.Entries, result.LastSeq, result.Head)
+	for _, problem := range result.Problems {
+		fmt.Printf("line %d (entry %d): %s\n", problem.Line, problem.Seq, problem.Reason)
+	}
+	if !result.Valid {
+		fmt.Printf("TAMPERED: %d problems found\n", len(result.Problems))
+		return 1
+	}
+	fmt.Println("OK: hash chain intact")
+	return 0
+}
+
+// recordJobOutcome records how a plugin job ended; its start is recorded
+// with the request that started it
+func recordJobOutcome(auditLog *audit.Log, event plugins.JobEvent) {
+	if event.Kind != plugins.JobEventStatus || event.Job == nil || !event.Job.Done() {
 		return
 	}
+	outcome := audit.OutcomeSuccess
+	switch event.Job.Status {
+	case plugins.JobFailed:
+		outcome = audit.OutcomeFailure
+	case plugins.JobCancelled:
+		outcome = audit.OutcomeCancelled
+	}
+	entry := audit.Entry{
+		Actor:   "system",
+		Action:  "job finished",
+		Target:  event.Job.PluginID,
+		Params:  event.Job.Params,
+		Details: map[string]interface{}{"jobId": event.Job.ID, "netns": event.Job.Netns, "iterations": event.Job.Iteration},
+		Outcome: outcome,
+		Error:   event.Job.Error,
+	}
+	if _, err := auditLog.Append(entry); err != nil {
+		log.Printf("Failed to record audit entry for job %s: %v", event.Job.ID, err)
+	}
+}
 
-	clientsMutex.Lock()
-	defer clientsMutex.Unlock()
+// runNetnsHelper serves one request from a parent NetTool that started this
+// process inside another network namespace
+func runNetnsHelper(pluginDir string) {
+	// Only the response may go to stdout; anything plugins print goes to stderr
+	out := os.Stdout
+	os.Stdout = os.Stderr
 
-	// Send update to all connected clients
-	for client := range clients {
-		err := client.WriteJSON(map[string]interface{}{
-			"type":      "network_update",
-			"data":      networkInfo,
-			"timestamp": time.Now().Format(time.RFC3339),
-		})
-		if err != nil {
-			log.Printf("Error sending network update to client: %v", err)
-			// Consider removing the client from the clients map if needed
-		}
+	pluginManager := plugins.NewPluginManager(pluginDir)
+	pluginManager.RegisterPlugins()
+	if err := core.ServeNetnsHelper(os.Stdin, out, pluginManager.RunPlugin); err != nil {
+		log.Fatalf("Failed to write namespace helper response: %v", err)
 	}
 }
 
-// startNetworkInfoBroadcaster sends network updates to all connected clients
-func startNetworkInfoBroadcaster() {
-	ticker := time.NewTicker(3 * time.Second)
+// pollNetworkInfo publishes network updates every interval
+func pollNetworkInfo(snapshot *core.SnapshotCollector, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		<-ticker.C
+		broadcastNetworkSnapshot(snapshot)
+	}
+}
 
-		// Only broadcast if there are clients connected
-		clientsMutex.Lock()
-		clientCount := len(clients)
-		clientsMutex.Unlock()
+// hubMetrics reports the realtime hub's clients, queues and counters
+func hubMetrics() []*telemetry.Family {
+	stats := hub.Stats()
+	disconnects := &telemetry.Family{
+		Name:   "nettool_websocket_disconnects_total",
+		Help:   "WebSocket and event stream clients disconnected, by reason.",
+		Type:   telemetry.TypeCounter,
+		Labels: []string{"reason"},
+	}
+	for _, reason := range stats.DisconnectReasons() {
+		disconnects.Samples = append(disconnects.Samples, telemetry.Sample{LabelValues: []string{reason}, Value: float64(stats.Disconnects[reason])})
+	}
 
-		if clientCount == 0 {
-			continue
-		}
+	return []*telemetry.Family{
+		{
+			Name:    "nettool_websocket_clients",
+			Help:    "WebSocket and event stream clients currently connected.",
+			Type:    telemetry.TypeGauge,
+			Samples: []telemetry.Sample{{Value: float64(stats.Clients)}},
+		},
+		{
+			Name:    "nettool_websocket_queued_messages",
+			Help:    "Messages waiting in WebSocket and event stream client send queues.",
+			Type:    telemetry.TypeGauge,
+			Samples: []telemetry.Sample{{Value: float64(stats.Queued)}},
+		},
+		{
+			Name:    "nettool_websocket_messages_sent_total",
+			Help:    "Messages written to WebSocket and event stream clients.",
+			Type:    telemetry.TypeCounter,
+			Samples: []telemetry.Sample{{Value: float64(stats.Sent)}},
+		},
+		{
+			Name:    "nettool_websocket_messages_coalesced_total",
+			Help:    "Snapshots replaced by a newer one before a slow WebSocket or event stream client received them.",
+			Type:    telemetry.TypeCounter,
+			Samples: []telemetry.Sample{{Value: float64(stats.Coalesced)}},
+		},
+		disconnects,
+	}
+}
 
-		// Get network info once for all clients
-		networkInfo, err := core.GetNetworkInfo()
-		if err != nil {
-			log.Printf("Error getting network info for broadcast: %v", err)
+// broadcastNetworkSnapshot publishes the cached network info to the network
+// topic and the state of each followed interface to its interface topic
+func broadcastNetworkSnapshot(snapshot *core.SnapshotCollector) {
+	if hub.ClientCount() == 0 {
+		return
+	}
+
+	networkInfo := snapshot.Snapshot()
+	hub.Publish(realtime.NewMessage(realtime.TypeNetworkUpdate, realtime.TopicNetwork, networkInfo))
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+	for _, iface := range ifaces {
+		topic := realtime.Topic(realtime.TopicInterface, iface.Name)
+		if !hub.HasSubscribers(topic) {
 			continue
 		}
+		if status, err := core.GetInterfaceStatus(networkInfo, iface.Name); err == nil {
+			hub.Publish(realtime.NewMessage(realtime.TypeInterfaceUpdate, topic, status))
+		}
+	}
+}
+
+// publishNetworkEvent publishes a network event to the events topic and to
+// the topic of the interface it concerns
+func publishNetworkEvent(event core.NetworkEvent) {
+	hub.Publish(realtime.NewMessage(realtime.TypeNetworkEvent, realtime.TopicEvents, event))
+	if event.Interface != "" {
+		hub.Publish(realtime.NewMessage(realtime.TypeNetworkEvent, realtime.Topic(realtime.TopicInterface, event.Interface), event))
+	}
+}
 
-		// Set timestamp to current time
-		networkInfo.Timestamp = time.Now()
+// publishJobEvent publishes plugin job status and output to the job's topic
+// and iteration results to its iteration topic
+func publishJobEvent(event plugins.JobEvent) {
+	switch event.Kind {
+	case plugins.JobEventStatus:
+		hub.Publish(realtime.NewMessage(realtime.TypeJobStatus, realtime.Topic(realtime.TopicJob, event.JobID), redactedJob(event.Job)))
+	case plugins.JobEventOutput:
+		hub.Publish(realtime.NewMessage(realtime.TypeJobOutput, realtime.Topic(realtime.TopicJob, event.JobID), event))
+	case plugins.JobEventIteration:
+		hub.Publish(realtime.NewMessage(realtime.TypeIterationResult, realtime.Topic(realtime.TopicIteration, event.JobID), event))
+	}
+}
 
-		// Prepare the message once for all clients
-		message := map[string]interface{}{
-			"type":      "network_update",
-			"data":      networkInfo,
-			"timestamp": time.Now().Format(time.RFC3339),
+// forNetns applies check only to requests that name another network namespace
+// with ?netns=, since those start a helper process inside it
+func forNetns(check gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("netns") != "" {
+			check(c)
 		}
+	}
+}
+
+// redactedJob returns a copy of a job with secrets in its parameters replaced
+// as in the audit log, for sending to clients
+func redactedJob(job *plugins.Job) *plugins.Job {
+	if job == nil {
+		return nil
+	}
+	copied := *job
+	copied.Params = audit.Redact(job.Params)
+	return &copied
+}
 
-		// Broadcast to all clients
-		clientsMutex.Lock()
-		for client := range clients {
-			// Send in a non-blocking way
-			go func(c *websocket.Conn) {
-				if err := c.WriteJSON(message); err != nil {
-					log.Printf("Error broadcasting to client: %v", err)
-
-					// Close and remove failed client
-					c.Close()
-					clientsMutex.Lock()
-					delete(clients, c)
-					clientsMutex.Unlock()
-				}
-			}(client)
+// initialState returns what a client receives when it subscribes to a topic,
+// so it does not have to wait for the next update
+func initialState(snapshot *core.SnapshotCollector, jobs *plugins.JobManager) func(topic string) []realtime.Message {
+	return func(topic string) []realtime.Message {
+		kind, arg, err := realtime.ParseTopic(topic)
+		if err != nil {
+			return nil
+		}
+		switch kind {
+		case realtime.TopicNetwork:
+			return []realtime.Message{realtime.NewMessage(realtime.TypeNetworkUpdate, topic, snapshot.Snapshot())}
+		case realtime.TopicInterface:
+			status, err := core.GetInterfaceStatus(snapshot.Snapshot(), arg)
+			if err != nil {
+				return []realtime.Message{realtime.NewMessage(realtime.TypeError, topic, err.Error())}
+			}
+			return []realtime.Message{realtime.NewMessage(realtime.TypeInterfaceUpdate, topic, status)}
+		case realtime.TopicJob, realtime.TopicIteration:
+			job, err := jobs.Get(arg)
+			if err != nil {
+				return []realtime.Message{realtime.NewMessage(realtime.TypeError, topic, err.Error())}
+			}
+			if kind == realtime.TopicJob {
+				return []realtime.Message{realtime.NewMessage(realtime.TypeJobStatus, topic, redactedJob(job))}
+			}
 		}
-		clientsMutex.Unlock()
+		return nil
 	}
 }